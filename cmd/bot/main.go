@@ -4,9 +4,12 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"strconv"
 	"time"
 
 	"github.com/amalrajan30/spacedgram/internal/bot"
+	"github.com/amalrajan30/spacedgram/internal/generation"
+	"github.com/amalrajan30/spacedgram/internal/llm"
 	"github.com/amalrajan30/spacedgram/internal/scheduler"
 	"github.com/amalrajan30/spacedgram/internal/storage"
 	"github.com/joho/godotenv"
@@ -17,7 +20,7 @@ import (
 	"github.com/PaulSonOfLars/gotgbot/v2/ext"
 	"github.com/PaulSonOfLars/gotgbot/v2/ext/handlers"
 	"github.com/PaulSonOfLars/gotgbot/v2/ext/handlers/filters/callbackquery"
-	"github.com/robfig/cron/v3"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext/handlers/filters/pollanswer"
 )
 
 func main() {
@@ -54,16 +57,50 @@ func main() {
 		panic("Failed to create new bot: " + err.Error())
 	}
 
-	loc, _ := time.LoadLocation("Asia/Kolkata")
-	c := cron.New(cron.WithLocation(loc))
+	llmConfig, err := llm.ConfigFromEnv()
 
-	scheduler := scheduler.NewScheduler(*b)
+	if err != nil {
+		log.Fatalf("loading llm config failed: %v", err)
+	}
+
+	if err := llm.Configure(llmConfig); err != nil {
+		log.Fatalf("configuring llm provider failed: %v", err)
+	}
 
-	c.AddFunc("0 20 * * *", scheduler.RunScheduled)
 	repository := storage.NewRepository(db)
+
+	if userID, err := strconv.ParseInt(os.Getenv("USER_ID"), 10, 64); err == nil {
+		llm.SetUsageTracker(bot.NewUsageTracker(repository, userID))
+	} else {
+		log.Printf("USER_ID is not set, llm usage won't be tracked")
+	}
 	botService := bot.NewBotService(repository)
 
-	botHandler := bot.NewBotHandler(botService)
+	gracePeriod := 2 * time.Hour
+
+	if value := os.Getenv("REMINDER_GRACE_PERIOD"); value != "" {
+		gracePeriod, err = time.ParseDuration(value)
+
+		if err != nil {
+			log.Fatalf("invalid REMINDER_GRACE_PERIOD: %v", err)
+		}
+	}
+
+	workers := 2
+
+	if value := os.Getenv("GENERATION_WORKERS"); value != "" {
+		workers, err = strconv.Atoi(value)
+
+		if err != nil {
+			log.Fatalf("invalid GENERATION_WORKERS: %v", err)
+		}
+	}
+
+	generationPool := generation.NewPool(botService, repository, workers)
+
+	scheduler := scheduler.NewScheduler(*b, botService, repository, gracePeriod)
+
+	botHandler := bot.NewBotHandler(botService, scheduler)
 
 	dispatcher := ext.NewDispatcher(&ext.DispatcherOpts{
 		Error: func(b *gotgbot.Bot, ctx *ext.Context, err error) ext.DispatcherAction {
@@ -75,6 +112,13 @@ func main() {
 
 	updater := ext.NewUpdater(dispatcher, nil)
 
+	// Runs before the commands, so that a command leaves the conversation
+	// or answer awaited in the chat
+	dispatcher.AddHandlerToGroup(
+		handlers.NewMessage(botHandler.IsOtherCommand, botHandler.EndFlows),
+		-1,
+	)
+
 	dispatcher.AddHandler(
 		handlers.NewCommand("list_topics", botHandler.ListTopics),
 	)
@@ -88,15 +132,71 @@ func main() {
 	)
 
 	dispatcher.AddHandler(
-		handlers.NewCallback(callbackquery.Equal("reset"), botHandler.HandleReviewReset),
+		handlers.NewCommand("settings", botHandler.Settings),
+	)
+
+	dispatcher.AddHandler(
+		handlers.NewCommand("undo", botHandler.Undo),
+	)
+
+	dispatcher.AddHandler(
+		handlers.NewCommand("usage", botHandler.Usage),
 	)
 
 	dispatcher.AddHandler(
-		handlers.NewCallback(callbackquery.Equal("cloze_yes"), botHandler.ClozeQuestion),
+		handlers.NewCommand("search", botHandler.Search),
 	)
 
 	dispatcher.AddHandler(
-		handlers.NewCallback(callbackquery.Equal("cloze_no"), botHandler.ClozeQuestion),
+		handlers.NewCommand("find", botHandler.Find),
+	)
+
+	dispatcher.AddHandler(
+		handlers.NewCommand("tag", botHandler.Tag),
+	)
+
+	dispatcher.AddHandler(
+		handlers.NewCommand("untag", botHandler.Untag),
+	)
+
+	dispatcher.AddHandler(
+		handlers.NewCommand("review", botHandler.Review),
+	)
+
+	dispatcher.AddHandler(
+		handlers.NewCommand("deck", botHandler.Deck),
+	)
+
+	dispatcher.AddHandler(
+		handlers.NewCommand("decks", botHandler.Decks),
+	)
+
+	dispatcher.AddHandler(
+		handlers.NewCommand("leeches", botHandler.Leeches),
+	)
+
+	dispatcher.AddHandler(
+		handlers.NewCommand("suspended", botHandler.Suspended),
+	)
+
+	dispatcher.AddHandler(
+		handlers.NewCommand("sources", botHandler.Sources),
+	)
+
+	// Conversations come before the other handlers, so that their callbacks
+	// and replies aren't taken by them
+	dispatcher.AddHandler(botHandler.AddNoteConversation())
+
+	dispatcher.AddHandler(botHandler.EditNoteConversation())
+
+	dispatcher.AddHandler(botHandler.SourceRenameConversation())
+
+	dispatcher.AddHandler(
+		handlers.NewCallback(callbackquery.Equal("reset"), botHandler.HandleReviewReset),
+	)
+
+	dispatcher.AddHandler(
+		handlers.NewCallback(callbackquery.Prefix("cloze_"), botHandler.ClozeQuestion),
 	)
 
 	dispatcher.AddHandler(
@@ -111,6 +211,98 @@ func main() {
 		handlers.NewCallback(callbackquery.Prefix("review"), botHandler.HandleReviews),
 	)
 
+	dispatcher.AddHandler(
+		handlers.NewCallback(callbackquery.Prefix("card_"), botHandler.HandleReviews),
+	)
+
+	dispatcher.AddHandler(
+		handlers.NewCallback(callbackquery.Equal("cardtypes"), botHandler.CardTypes),
+	)
+
+	dispatcher.AddHandler(
+		handlers.NewCallback(callbackquery.Prefix("cardtype_"), botHandler.ToggleCardType),
+	)
+
+	dispatcher.AddHandler(
+		handlers.NewCallback(callbackquery.Equal("cards_generate"), botHandler.GenerateCards),
+	)
+
+	dispatcher.AddHandler(
+		handlers.NewCallback(callbackquery.Prefix("snooze_"), botHandler.SnoozeReminder),
+	)
+
+	dispatcher.AddHandler(
+		handlers.NewCallback(callbackquery.Equal("undo"), botHandler.HandleUndo),
+	)
+
+	dispatcher.AddHandler(
+		handlers.NewCallback(callbackquery.Prefix("reveal_"), botHandler.RevealNote),
+	)
+
+	dispatcher.AddHandler(
+		handlers.NewCallback(callbackquery.Prefix("typed_skip_"), botHandler.SkipAnswer),
+	)
+
+	dispatcher.AddHandler(
+		handlers.NewCallback(callbackquery.Prefix("question_"), botHandler.HandleQuestionFeedback),
+	)
+
+	dispatcher.AddHandler(
+		handlers.NewCallback(callbackquery.Prefix("search_review_"), botHandler.ReviewNow),
+	)
+
+	dispatcher.AddHandler(
+		handlers.NewCallback(callbackquery.Prefix("find_page_"), botHandler.FindPage),
+	)
+
+	dispatcher.AddHandler(
+		handlers.NewCallback(callbackquery.Prefix("related_"), botHandler.ShowRelated),
+	)
+
+	dispatcher.AddHandler(
+		handlers.NewCallback(callbackquery.Prefix("link_"), botHandler.LinkRelated),
+	)
+
+	dispatcher.AddHandler(
+		handlers.NewCallback(callbackquery.Prefix("deck_"), botHandler.StartDeck),
+	)
+
+	dispatcher.AddHandler(
+		handlers.NewCallback(callbackquery.Prefix("leech_"), botHandler.HandleLeech),
+	)
+
+	dispatcher.AddHandler(
+		handlers.NewCallback(callbackquery.Prefix("note_"), botHandler.HandleNoteAction),
+	)
+
+	dispatcher.AddHandler(
+		handlers.NewCallback(callbackquery.Prefix("fwd_"), botHandler.HandleForwardAction),
+	)
+
+	dispatcher.AddHandler(
+		handlers.NewCallback(callbackquery.Prefix("src_"), botHandler.HandleSourceAction),
+	)
+
+	dispatcher.AddHandler(
+		handlers.NewMessage(botHandler.IsForwarded, botHandler.HandleForward),
+	)
+
+	dispatcher.AddHandler(
+		handlers.NewMessage(botHandler.IsAwaitingEdit, botHandler.HandleQuestionEdit),
+	)
+
+	dispatcher.AddHandler(
+		handlers.NewMessage(botHandler.IsAwaitingRewrite, botHandler.HandleLeechRewrite),
+	)
+
+	dispatcher.AddHandler(
+		handlers.NewMessage(botHandler.IsAwaitingAnswer, botHandler.HandleAnswer),
+	)
+
+	dispatcher.AddHandler(
+		handlers.NewPollAnswer(pollanswer.All, botHandler.HandleQuizAnswer),
+	)
+
 	dispatcher.AddHandler(
 		handlers.NewCallback(callbackquery.All, botHandler.HandleSelectSourceCallback),
 	)
@@ -133,7 +325,11 @@ func main() {
 	// Idle, to keep updates coming in, and avoid bot stopping.
 	defer updater.Idle()
 
-	c.Start()
+	if err := scheduler.Start(); err != nil {
+		log.Printf("failed to start scheduler: %v", err)
+	}
+
+	generationPool.Start()
 
 	// defer highlights.UploadHandler()
 }
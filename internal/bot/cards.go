@@ -0,0 +1,300 @@
+package bot
+
+import (
+	"fmt"
+	"log"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/amalrajan30/spacedgram/internal/llm"
+	"github.com/amalrajan30/spacedgram/internal/spaced"
+	"github.com/amalrajan30/spacedgram/internal/storage"
+)
+
+// GenerateCard asks the LLM for a card of the given type from a note
+func (s BotService) GenerateCard(note storage.Note, cardType string) (storage.Card, error) {
+	card := storage.Card{
+		NoteID: int(note.ID),
+		Type:   cardType,
+	}
+
+	highlight := s.highlightOf(&note)
+
+	switch cardType {
+	case storage.CardTypeCloze:
+		// Cloze cards show the question of the note, so a rewritten
+		// question is reviewed in both places
+		if _, err := s.GetClozeQuestion(&note); err != nil {
+			return storage.Card{}, err
+		}
+	case storage.CardTypeOpen:
+		open, err := llm.GenerateOpenQuestion(highlight)
+		if err != nil {
+			return storage.Card{}, err
+		}
+		card.Question = open.Question
+		card.Answer = open.Answer
+	case storage.CardTypeTrueFalse:
+		trueFalse, err := llm.GenerateTrueFalseQuestion(highlight)
+		if err != nil {
+			return storage.Card{}, err
+		}
+		card.Question = "True or false? " + trueFalse.Statement
+		card.Answer = fmt.Sprintf("%v. %s", formatTrueFalse(trueFalse.IsTrue), trueFalse.Explanation)
+	case storage.CardTypeExplain:
+		explain, err := llm.GenerateExplainPrompt(highlight)
+		if err != nil {
+			return storage.Card{}, err
+		}
+		card.Question = explain.Prompt
+		card.Answer = explain.KeyPoints
+	case storage.CardTypeReverse:
+		reverse, err := llm.GenerateReverseCard(highlight)
+		if err != nil {
+			return storage.Card{}, err
+		}
+		card.Question = fmt.Sprintf("Which passage is about: %s?", reverse.Concept)
+		card.Answer = note.Content
+	default:
+		return storage.Card{}, fmt.Errorf("unknown card type %q", cardType)
+	}
+
+	return s.repo.SaveCard(card)
+}
+
+func formatTrueFalse(isTrue bool) string {
+	if isTrue {
+		return "True"
+	}
+	return "False"
+}
+
+// QueueSourceCards queues the missing cards of the source's card types for
+// each of its notes, and returns how many were queued
+func (s BotService) QueueSourceCards(sourceID int) (int, error) {
+	source, err := s.repo.GetSource(sourceID)
+
+	if err != nil {
+		return 0, fmt.Errorf("getting source: %w", err)
+	}
+
+	notes, err := s.repo.GetSourceNotes(sourceID)
+
+	if err != nil {
+		return 0, err
+	}
+
+	jobs := []storage.GenerationJob{}
+
+	for _, note := range notes {
+		existing, err := s.repo.GetCardTypes(int(note.ID))
+
+		if err != nil {
+			return 0, err
+		}
+
+		for _, cardType := range source.CardTypes {
+			if slices.Contains(existing, cardType) {
+				continue
+			}
+
+			jobs = append(jobs, storage.GenerationJob{
+				NoteID:   int(note.ID),
+				Kind:     storage.GenerationKindCard,
+				CardType: cardType,
+			})
+		}
+	}
+
+	return s.repo.EnqueueGenerationJobs(jobs)
+}
+
+// ToggleCardType adds or removes a card type from the ones generated for a
+// source
+func (s BotService) ToggleCardType(sourceID int, cardType string) (storage.Source, error) {
+	if !slices.Contains(storage.CardTypes, cardType) {
+		return storage.Source{}, fmt.Errorf("unknown card type %q", cardType)
+	}
+
+	source, err := s.repo.GetSource(sourceID)
+
+	if err != nil {
+		return storage.Source{}, err
+	}
+
+	types := []string{}
+
+	for _, existing := range storage.CardTypes {
+		enabled := slices.Contains(source.CardTypes, existing)
+
+		if existing == cardType {
+			enabled = !enabled
+		}
+
+		if enabled {
+			types = append(types, existing)
+		}
+	}
+
+	if err := s.repo.SetSourceCardTypes(sourceID, types); err != nil {
+		return storage.Source{}, err
+	}
+
+	source.CardTypes = types
+
+	return source, nil
+}
+
+// StartCardReview builds a session from the due cards of a source. Cards go
+// through the same daily limits and ordering as notes.
+func (s BotService) StartCardReview(userID int64, sourceID int) (*ReviewSession, error) {
+	source, err := s.repo.GetSource(sourceID)
+
+	if err != nil {
+		return nil, fmt.Errorf("getting source: %w", err)
+	}
+
+	settings, err := s.repo.GetUserSettings(userID)
+
+	if err != nil {
+		return nil, fmt.Errorf("getting user settings: %w", err)
+	}
+
+	cards, err := s.repo.GetDueCards(sourceID, settings.DayEnd(time.Now()))
+
+	if err != nil {
+		return nil, err
+	}
+
+	// The queue builder works on notes, so each card stands in as a note
+	// carrying its own schedule
+	scheduled := []storage.Note{}
+
+	for _, card := range cards {
+		scheduled = append(scheduled, cardSchedule(card))
+	}
+
+	cardIDs, heldBack, err := s.buildQueue(userID, settings, scheduled)
+
+	if err != nil {
+		return nil, fmt.Errorf("building review queue: %w", err)
+	}
+
+	return &ReviewSession{
+		Source:   source,
+		Count:    len(cardIDs),
+		NoteIDs:  cardIDs,
+		HeldBack: heldBack,
+	}, nil
+}
+
+// cardSchedule returns the card's schedule in the shape of a note, as used by
+// the spaced repetition algorithm and the queue builder
+func cardSchedule(card storage.Card) storage.Note {
+	note := storage.Note{
+		EasinessFactor: card.EasinessFactor,
+		NextDueDate:    card.NextDueDate,
+		LastReviewed:   card.LastReviewed,
+		Interval:       card.Interval,
+		ReviewCount:    card.ReviewCount,
+		Location:       card.Note.Location,
+		SourceID:       card.Note.SourceID,
+	}
+	note.ID = card.ID
+
+	return note
+}
+
+// HandleCardResponse applies the rating of a card and returns its review
+// log, along with whether its note just became a leech. Lapses of a card
+// count as lapses of its note.
+func (s BotService) HandleCardResponse(userID int64, callbackData string) (storage.ReviewLog, bool, error) {
+	parts := strings.Split(callbackData, "_")
+
+	if len(parts) < 3 {
+		return storage.ReviewLog{}, false, fmt.Errorf("Failed to parse data while handling card response: %v", callbackData)
+	}
+
+	cardID, err := strconv.Atoi(parts[1])
+
+	if err != nil {
+		return storage.ReviewLog{}, false, fmt.Errorf("Failed to parse data while handling card response: %w", err)
+	}
+
+	rating, err := strconv.Atoi(parts[2])
+
+	if err != nil {
+		return storage.ReviewLog{}, false, fmt.Errorf("Failed to parse data while handling card response: %w", err)
+	}
+
+	log.Printf("Got card: %v from review response with rating: %v", cardID, rating)
+
+	card, err := s.repo.GetCard(cardID)
+
+	if err != nil {
+		return storage.ReviewLog{}, false, fmt.Errorf("Failed to get card: %w", err)
+	}
+
+	settings, err := s.repo.GetUserSettings(userID)
+
+	if err != nil {
+		return storage.ReviewLog{}, false, fmt.Errorf("getting user settings: %w", err)
+	}
+
+	nextDue, interval, easiness := spaced.GetNextDueDate(cardSchedule(*card), rating)
+
+	now := time.Now()
+
+	if err := s.repo.UpdateCardSchedule(cardID, storage.Card{
+		NextDueDate:    &nextDue,
+		Interval:       interval,
+		EasinessFactor: &easiness,
+		LastReviewed:   &now,
+		ReviewCount:    card.ReviewCount + 1,
+	}); err != nil {
+		return storage.ReviewLog{}, false, err
+	}
+
+	// A new card can't lapse even if its note was reviewed before
+	lapsed := card.Note
+	lapsed.ReviewCount = card.ReviewCount
+
+	var noteUpdate storage.Note
+	becameLeech := applyLapse(&lapsed, rating, settings, &noteUpdate)
+
+	if noteUpdate.Lapses > 0 {
+		if _, err := s.repo.UpdateNote(card.NoteID, noteUpdate); err != nil {
+			return storage.ReviewLog{}, false, err
+		}
+	}
+
+	if becameLeech {
+		s.tagLeech(card.NoteID, settings)
+	}
+
+	reviewLog, err := s.repo.InsertReviewLog(storage.ReviewLog{
+		UserID:             userID,
+		NoteID:             card.NoteID,
+		CardID:             cardID,
+		SourceID:           card.Note.SourceID,
+		Rating:             rating,
+		WasNew:             card.ReviewCount == 0,
+		ReviewedAt:         now,
+		PrevEasinessFactor: card.EasinessFactor,
+		PrevNextDueDate:    card.NextDueDate,
+		PrevLastReviewed:   card.LastReviewed,
+		PrevInterval:       card.Interval,
+		PrevReviewCount:    card.ReviewCount,
+		PrevLapses:         card.Note.Lapses,
+		PrevLeech:          card.Note.Leech,
+		PrevSuspended:      card.Note.Suspended,
+	})
+
+	if err != nil {
+		return storage.ReviewLog{}, false, fmt.Errorf("logging review: %w", err)
+	}
+
+	return reviewLog, becameLeech, nil
+}
@@ -0,0 +1,158 @@
+package bot
+
+import (
+	"fmt"
+	"html"
+	"log"
+	"slices"
+	"strings"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+	"github.com/amalrajan30/spacedgram/internal/storage"
+)
+
+var cardTypeNames = map[string]string{
+	storage.CardTypeCloze:     "Cloze",
+	storage.CardTypeOpen:      "Open question",
+	storage.CardTypeTrueFalse: "True/false",
+	storage.CardTypeExplain:   "Explain",
+	storage.CardTypeReverse:   "Reverse",
+}
+
+func buildCardTypesKeyboard(source storage.Source) gotgbot.InlineKeyboardMarkup {
+	var keyboardRows [][]gotgbot.InlineKeyboardButton
+
+	for _, cardType := range storage.CardTypes {
+		check := "▫️"
+		if slices.Contains(source.CardTypes, cardType) {
+			check = "✅"
+		}
+
+		keyboardRows = append(keyboardRows, []gotgbot.InlineKeyboardButton{{
+			Text:         fmt.Sprintf("%v %v", check, cardTypeNames[cardType]),
+			CallbackData: "cardtype_" + cardType,
+		}})
+	}
+
+	keyboardRows = append(keyboardRows, []gotgbot.InlineKeyboardButton{{
+		Text:         "⚙️ Generate cards",
+		CallbackData: "cards_generate",
+	}})
+
+	return gotgbot.InlineKeyboardMarkup{
+		InlineKeyboard: keyboardRows,
+	}
+}
+
+func (h *BotHandler) editCardTypes(b *gotgbot.Bot, msg gotgbot.MaybeInaccessibleMessage, source storage.Source) error {
+	return h.editMessage(b, msg, fmt.Sprintf(
+		"🃏 <b>Card types</b>\n"+
+			"━━━━━━━━━━━━━━\n"+
+			"<b>Title:</b> %s\n\n"+
+			"Choose the cards to generate for each note",
+		html.EscapeString(source.Title),
+	), &gotgbot.EditMessageTextOpts{
+		ReplyMarkup: buildCardTypesKeyboard(source),
+		ParseMode:   "HTML",
+	})
+}
+
+// CardTypes shows the card types of the selected source
+func (h *BotHandler) CardTypes(b *gotgbot.Bot, ctx *ext.Context) error {
+
+	if !checkUser(ctx.Update.CallbackQuery.From.Id) {
+		return nil
+	}
+
+	cb := ctx.Update.CallbackQuery
+
+	_, err := cb.Answer(b, &gotgbot.AnswerCallbackQueryOpts{
+		Text: "Processing...",
+	})
+
+	if err != nil {
+		return fmt.Errorf("failed to answer callback query: %w", err)
+	}
+
+	id, _ := h.getUserData("source_id")
+
+	source, err := h.service.repo.GetSource(id)
+
+	if err != nil {
+		return h.editMessage(b, cb.Message, "Could not find the specified book", nil)
+	}
+
+	return h.editCardTypes(b, cb.Message, source)
+}
+
+func (h *BotHandler) ToggleCardType(b *gotgbot.Bot, ctx *ext.Context) error {
+
+	if !checkUser(ctx.Update.CallbackQuery.From.Id) {
+		return nil
+	}
+
+	cb := ctx.Update.CallbackQuery
+
+	_, err := cb.Answer(b, &gotgbot.AnswerCallbackQueryOpts{
+		Text: "Updating...",
+	})
+
+	if err != nil {
+		return fmt.Errorf("failed to answer callback query: %w", err)
+	}
+
+	id, _ := h.getUserData("source_id")
+
+	source, err := h.service.ToggleCardType(id, strings.TrimPrefix(cb.Data, "cardtype_"))
+
+	if err != nil {
+		log.Printf("Failed to toggle card type: %v", err)
+		return h.editMessage(b, cb.Message, "Failed to update card types", nil)
+	}
+
+	return h.editCardTypes(b, cb.Message, source)
+}
+
+// GenerateCards queues the missing cards of the selected source, they are
+// generated in the background
+func (h *BotHandler) GenerateCards(b *gotgbot.Bot, ctx *ext.Context) error {
+
+	if !checkUser(ctx.Update.CallbackQuery.From.Id) {
+		return nil
+	}
+
+	cb := ctx.Update.CallbackQuery
+
+	_, err := cb.Answer(b, &gotgbot.AnswerCallbackQueryOpts{
+		Text: "Queueing...",
+	})
+
+	if err != nil {
+		return fmt.Errorf("failed to answer callback query: %w", err)
+	}
+
+	id, _ := h.getUserData("source_id")
+
+	source, err := h.service.repo.GetSource(id)
+
+	if err != nil {
+		return h.editMessage(b, cb.Message, "Could not find the specified book", nil)
+	}
+
+	if len(source.CardTypes) == 0 {
+		return h.editMessage(b, cb.Message, "Choose at least one card type first", &gotgbot.EditMessageTextOpts{
+			ReplyMarkup: buildCardTypesKeyboard(source),
+			ParseMode:   "HTML",
+		})
+	}
+
+	queued, err := h.service.QueueSourceCards(id)
+
+	if err != nil {
+		log.Printf("Failed to queue cards: %v", err)
+		return h.editMessage(b, cb.Message, "Failed to queue cards", nil)
+	}
+
+	return h.editMessage(b, cb.Message, fmt.Sprintf("⚙️ Queued %v cards for %s, they will be ready to review shortly", queued, html.EscapeString(source.Title)), nil)
+}
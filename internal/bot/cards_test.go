@@ -0,0 +1,153 @@
+package bot
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/amalrajan30/spacedgram/internal/storage"
+	"gorm.io/gorm"
+)
+
+func TestCardSchedule(t *testing.T) {
+	due := time.Date(2024, 3, 10, 0, 0, 0, 0, time.UTC)
+	easiness := 2.5
+
+	card := storage.Card{
+		Model:          gorm.Model{ID: 9},
+		NoteID:         3,
+		EasinessFactor: &easiness,
+		NextDueDate:    &due,
+		Interval:       6,
+		ReviewCount:    2,
+		Note:           storage.Note{Model: gorm.Model{ID: 3}, SourceID: 4, Location: "120", Interval: 1},
+	}
+
+	note := cardSchedule(card)
+
+	if note.ID != 9 || note.SourceID != 4 || note.Location != "120" {
+		t.Errorf("cardSchedule = note %v of source %v at %q, want the card id with the note's source and location", note.ID, note.SourceID, note.Location)
+	}
+
+	if note.Interval != 6 || note.ReviewCount != 2 || note.NextDueDate != &due || note.EasinessFactor != &easiness {
+		t.Errorf("cardSchedule = %+v, want the schedule of the card", note)
+	}
+}
+
+func TestGenerateCardUnknownType(t *testing.T) {
+	s, db := testService(t)
+	source := testSource(t, db, storage.Source{})
+
+	if _, err := s.GenerateCard(storage.Note{SourceID: int(source.ID)}, "essay"); err == nil {
+		t.Error("GenerateCard accepted an unknown card type")
+	}
+}
+
+func TestClozeCardUsesNote(t *testing.T) {
+	s, db := testService(t)
+	source := testSource(t, db, storage.Source{})
+
+	note := storage.Note{Content: "Highlight", SourceID: int(source.ID), Question: "The ___ empire", Answer: "Roman"}
+
+	if err := db.Create(&note).Error; err != nil {
+		t.Fatalf("failed to create note: %v", err)
+	}
+
+	t.Cleanup(func() {
+		db.Unscoped().Where("note_id = ?", note.ID).Delete(&storage.Card{})
+	})
+
+	card, err := s.GenerateCard(note, storage.CardTypeCloze)
+
+	if err != nil {
+		t.Fatalf("GenerateCard failed: %v", err)
+	}
+
+	saved, err := s.repo.GetCard(int(card.ID))
+
+	if err != nil {
+		t.Fatalf("GetCard failed: %v", err)
+	}
+
+	if saved.Question != note.Question || saved.Answer != note.Answer {
+		t.Errorf("cloze card = %q, %q, want the question of the note", saved.Question, saved.Answer)
+	}
+}
+
+func TestCardReviewAndUndo(t *testing.T) {
+	s, db := testService(t)
+	userID := testUserID(t, db)
+	source := testSource(t, db, storage.Source{})
+
+	note := storage.Note{Content: "Highlight", SourceID: int(source.ID)}
+
+	if err := db.Create(&note).Error; err != nil {
+		t.Fatalf("failed to create note: %v", err)
+	}
+
+	t.Cleanup(func() {
+		db.Unscoped().Where("note_id = ?", note.ID).Delete(&storage.Card{})
+	})
+
+	card, err := s.repo.SaveCard(storage.Card{NoteID: int(note.ID), Type: storage.CardTypeOpen, Question: "Q", Answer: "A"})
+
+	if err != nil {
+		t.Fatalf("SaveCard failed: %v", err)
+	}
+
+	reviewLog, becameLeech, err := s.HandleCardResponse(userID, fmt.Sprintf("card_%v_5", card.ID))
+
+	if err != nil || becameLeech {
+		t.Fatalf("HandleCardResponse = %v, %v, want a review", becameLeech, err)
+	}
+
+	reviewed, err := s.repo.GetCard(int(card.ID))
+
+	if err != nil {
+		t.Fatalf("GetCard failed: %v", err)
+	}
+
+	if reviewed.ReviewCount != 1 || reviewed.NextDueDate == nil {
+		t.Errorf("card after a review = %+v, want it scheduled", reviewed)
+	}
+
+	// The card is scheduled on its own, the note stays new
+	if reviewed.Note.ReviewCount != 0 || reviewed.Note.NextDueDate != nil {
+		t.Errorf("note of the reviewed card = %+v, want it untouched", reviewed.Note)
+	}
+
+	if reviewLog.CardID != int(card.ID) || reviewLog.NoteID != int(note.ID) || !reviewLog.WasNew {
+		t.Errorf("review log = %+v, want the new card of the note", reviewLog)
+	}
+
+	if _, err := s.UndoReview(userID, reviewLog.ID); err != nil {
+		t.Fatalf("UndoReview failed: %v", err)
+	}
+
+	undone, err := s.repo.GetCard(int(card.ID))
+
+	if err != nil {
+		t.Fatalf("GetCard failed: %v", err)
+	}
+
+	if undone.ReviewCount != 0 || undone.NextDueDate != nil || undone.EasinessFactor != nil {
+		t.Errorf("card after undoing its review = %+v, want it new", undone)
+	}
+
+	// Saving a card of the same type replaces its question
+	if _, err := s.repo.SaveCard(storage.Card{NoteID: int(note.ID), Type: storage.CardTypeOpen, Question: "Q2", Answer: "A2"}); err != nil {
+		t.Fatalf("SaveCard failed: %v", err)
+	}
+
+	types, err := s.repo.GetCardTypes(int(note.ID))
+
+	if err != nil || len(types) != 1 {
+		t.Fatalf("GetCardTypes = %v (%v), want a single card", types, err)
+	}
+
+	replaced, err := s.repo.GetCard(int(card.ID))
+
+	if err != nil || replaced.Question != "Q2" {
+		t.Errorf("card after saving it again = %v (%v), want question Q2", replaced, err)
+	}
+}
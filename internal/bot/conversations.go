@@ -0,0 +1,129 @@
+package bot
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext/handlers/conversation"
+)
+
+// conversationStates keeps the state of a conversation by chat, like the
+// default storage of gotgbot, but can also be ended from outside the
+// conversation when another flow starts in the chat
+type conversationStates struct {
+	mux    sync.Mutex
+	states map[int64]conversation.State
+}
+
+func (c *conversationStates) Get(ctx *ext.Context) (*conversation.State, error) {
+	if ctx.EffectiveChat == nil {
+		return nil, conversation.ErrEmptyKey
+	}
+
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	state, ok := c.states[ctx.EffectiveChat.Id]
+
+	if !ok {
+		return nil, conversation.ErrKeyNotFound
+	}
+
+	return &state, nil
+}
+
+func (c *conversationStates) Set(ctx *ext.Context, state conversation.State) error {
+	if ctx.EffectiveChat == nil {
+		return conversation.ErrEmptyKey
+	}
+
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	if c.states == nil {
+		c.states = map[int64]conversation.State{}
+	}
+
+	c.states[ctx.EffectiveChat.Id] = state
+
+	return nil
+}
+
+func (c *conversationStates) Delete(ctx *ext.Context) error {
+	if ctx.EffectiveChat == nil {
+		return conversation.ErrEmptyKey
+	}
+
+	c.end(ctx.EffectiveChat.Id)
+
+	return nil
+}
+
+func (c *conversationStates) end(chatID int64) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	delete(c.states, chatID)
+}
+
+// newConversationStates returns the state storage of a conversation, kept so
+// that endFlows can end it
+func (h *BotHandler) newConversationStates() *conversationStates {
+	h.rwMux.Lock()
+	defer h.rwMux.Unlock()
+
+	states := &conversationStates{}
+	h.conversations = append(h.conversations, states)
+
+	return states
+}
+
+// endFlows ends the conversations of a chat and stops waiting for text in
+// it, as another flow starts
+func (h *BotHandler) endFlows(chatID int64) {
+	h.rwMux.Lock()
+	conversations := h.conversations
+	delete(h.pending, chatID)
+	delete(h.drafts, chatID)
+	delete(h.editing, chatID)
+	delete(h.renaming, chatID)
+	h.rwMux.Unlock()
+
+	for _, states := range conversations {
+		states.end(chatID)
+	}
+}
+
+// Commands answering the conversation in progress rather than leaving it
+var conversationCommands = map[string]bool{
+	"cancel": true,
+	"skip":   true,
+}
+
+// IsOtherCommand filters the commands that leave the flow in progress, i.e.
+// all but the ones answering a conversation
+func (h *BotHandler) IsOtherCommand(msg *gotgbot.Message) bool {
+	if !strings.HasPrefix(msg.Text, "/") {
+		return false
+	}
+
+	command := strings.TrimPrefix(strings.Fields(msg.Text)[0], "/")
+	command, _, _ = strings.Cut(command, "@")
+
+	return !conversationCommands[strings.ToLower(command)]
+}
+
+// EndFlows ends the flow in progress in the chat before a command is
+// handled, so that a forgotten /add or edit doesn't take the next replies
+func (h *BotHandler) EndFlows(b *gotgbot.Bot, ctx *ext.Context) error {
+
+	if !checkUser(ctx.EffectiveMessage.From.Id) {
+		return nil
+	}
+
+	h.endFlows(ctx.EffectiveChat.Id)
+
+	return nil
+}
@@ -0,0 +1,59 @@
+package bot
+
+import (
+	"testing"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext/handlers/conversation"
+)
+
+func TestIsOtherCommand(t *testing.T) {
+	h := NewBotHandler(nil, nil)
+
+	tests := map[string]bool{
+		"/review":           true,
+		"/sources@spacebot": true,
+		"/cancel":           false,
+		"/Skip":             false,
+		"/skip@spacebot":    false,
+		"a reply":           false,
+	}
+
+	for text, want := range tests {
+		if got := h.IsOtherCommand(&gotgbot.Message{Text: text}); got != want {
+			t.Errorf("IsOtherCommand(%q) = %v, want %v", text, got, want)
+		}
+	}
+}
+
+func TestEndFlows(t *testing.T) {
+	h := NewBotHandler(nil, nil)
+	states := h.newConversationStates()
+
+	chat := func(id int64) *ext.Context {
+		return &ext.Context{EffectiveChat: &gotgbot.Chat{Id: id}}
+	}
+
+	for _, id := range []int64{1, 2} {
+		if err := states.Set(chat(id), conversation.State{Key: "title"}); err != nil {
+			t.Fatalf("Set failed: %v", err)
+		}
+	}
+
+	h.renaming = map[int64]int{1: 7}
+
+	h.endFlows(1)
+
+	if _, err := states.Get(chat(1)); err != conversation.ErrKeyNotFound {
+		t.Errorf("conversation of the chat = %v, want it ended", err)
+	}
+
+	if state, err := states.Get(chat(2)); err != nil || state.Key != "title" {
+		t.Errorf("conversation of another chat = %v, %v, want it kept", state, err)
+	}
+
+	if _, ok := h.renaming[1]; ok {
+		t.Error("the chat is still renaming a source")
+	}
+}
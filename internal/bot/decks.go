@@ -0,0 +1,92 @@
+package bot
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/amalrajan30/spacedgram/internal/query"
+	"github.com/amalrajan30/spacedgram/internal/storage"
+)
+
+// Most notes drilled in a deck session
+const maxDeckSession = 50
+
+// SaveDeck validates the query of a deck and saves it under name
+func (s BotService) SaveDeck(userID int64, name string, deckQuery string) (storage.Deck, error) {
+	name = strings.TrimSpace(name)
+
+	if name == "" {
+		return storage.Deck{}, fmt.Errorf("missing deck name")
+	}
+
+	if _, err := query.Parse(deckQuery); err != nil {
+		return storage.Deck{}, fmt.Errorf("invalid query: %w", err)
+	}
+
+	return s.repo.SaveDeck(userID, name, deckQuery)
+}
+
+func (s BotService) GetDecks(userID int64) ([]storage.Deck, error) {
+	return s.repo.GetDecks(userID)
+}
+
+func (s BotService) DeleteDeck(userID int64, name string) error {
+	return s.repo.DeleteDeck(userID, strings.TrimSpace(name))
+}
+
+type DeckSession struct {
+	Deck storage.Deck
+	// Notes matching the query
+	Matching int
+	Count    int
+	NoteIDs  []int
+}
+
+// StartDeckReview builds a session from the notes matching a deck's query,
+// due or not, ordered like the user's reviews. Daily limits don't apply, as
+// decks are meant for drilling.
+func (s BotService) StartDeckReview(userID int64, deckID int) (*DeckSession, error) {
+	deck, err := s.repo.GetDeck(userID, deckID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	expr, err := query.Parse(deck.Query)
+
+	if err != nil {
+		return nil, fmt.Errorf("parsing query of deck %v: %w", deck.Name, err)
+	}
+
+	settings, err := s.repo.GetUserSettings(userID)
+
+	if err != nil {
+		return nil, fmt.Errorf("getting user settings: %w", err)
+	}
+
+	notes, err := s.repo.GetQueryNotes(expr)
+
+	if err != nil {
+		return nil, err
+	}
+
+	matching := len(notes)
+	notes = orderNotes(notes, settings.QueueOrder, time.Now())
+
+	if len(notes) > maxDeckSession {
+		notes = notes[:maxDeckSession]
+	}
+
+	noteIDs := []int{}
+	for _, note := range notes {
+		noteIDs = append(noteIDs, int(note.ID))
+	}
+
+	return &DeckSession{
+		Deck:     deck,
+		Matching: matching,
+		Count:    len(noteIDs),
+		NoteIDs:  noteIDs,
+	}, nil
+}
@@ -0,0 +1,208 @@
+package bot
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+	"gorm.io/gorm"
+)
+
+const deckUsage = "Usage:\n" +
+	"/deck save <name> <query> - save a deck\n" +
+	"/deck delete <name> - delete a deck\n" +
+	"/decks - list and start your decks\n\n" +
+	"Queries combine source:, tag:, is:due|new|scheduled|leech, ease, lapses, interval and reviews " +
+	"with AND, OR, NOT and parentheses, e.g.\n" +
+	"source:\"Sapiens\" AND tag:history AND ease<2.0 AND lapses>2"
+
+// Deck saves or deletes a deck
+func (h *BotHandler) Deck(b *gotgbot.Bot, ctx *ext.Context) error {
+
+	if !checkUser(ctx.Message.From.Id) {
+		return nil
+	}
+
+	args := ctx.Args()[1:]
+
+	if len(args) < 2 {
+		_, err := ctx.EffectiveMessage.Reply(b, deckUsage, nil)
+		return err
+	}
+
+	userID := ctx.EffectiveUser.Id
+	name := args[1]
+
+	switch args[0] {
+	case "save":
+		deckQuery := strings.Join(args[2:], " ")
+
+		if deckQuery == "" {
+			_, err := ctx.EffectiveMessage.Reply(b, deckUsage, nil)
+			return err
+		}
+
+		deck, err := h.service.SaveDeck(userID, name, deckQuery)
+
+		if err != nil {
+			_, err = ctx.EffectiveMessage.Reply(b, fmt.Sprintf("Failed to save deck: %v", err), nil)
+			return err
+		}
+
+		_, err = ctx.EffectiveMessage.Reply(b, fmt.Sprintf(
+			"🗂 <b>Deck saved</b>\n"+
+				"━━━━━━━━━━━━━━\n"+
+				"<b>Name:</b> %s\n"+
+				"<b>Query:</b> <code>%s</code>\n\n"+
+				"Start it from /decks",
+			html.EscapeString(deck.Name),
+			html.EscapeString(deck.Query),
+		), &gotgbot.SendMessageOpts{
+			ParseMode: "HTML",
+		})
+
+		return err
+	case "delete":
+		text := fmt.Sprintf("Deck %v deleted", name)
+
+		if err := h.service.DeleteDeck(userID, name); err != nil {
+			text = "Failed to delete deck"
+
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				text = fmt.Sprintf("No deck named %v", name)
+			} else {
+				log.Printf("Failed to delete deck %v: %v", name, err)
+			}
+		}
+
+		_, err := ctx.EffectiveMessage.Reply(b, text, nil)
+		return err
+	default:
+		_, err := ctx.EffectiveMessage.Reply(b, deckUsage, nil)
+		return err
+	}
+}
+
+// Decks lists the user's decks with buttons to start them
+func (h *BotHandler) Decks(b *gotgbot.Bot, ctx *ext.Context) error {
+
+	if !checkUser(ctx.Message.From.Id) {
+		return nil
+	}
+
+	decks, err := h.service.GetDecks(ctx.EffectiveUser.Id)
+
+	if err != nil {
+		log.Printf("Failed to get decks: %v", err)
+		_, err = ctx.EffectiveMessage.Reply(b, "Failed to get decks", nil)
+		return err
+	}
+
+	if len(decks) == 0 {
+		_, err = ctx.EffectiveMessage.Reply(b, "No decks yet\n\n"+deckUsage, nil)
+		return err
+	}
+
+	text := "🗂 <b>Decks</b>\n" +
+		"━━━━━━━━━━━━━━\n"
+
+	var keyboard [][]gotgbot.InlineKeyboardButton
+	var currentRow []gotgbot.InlineKeyboardButton
+
+	for i, deck := range decks {
+		text = text + fmt.Sprintf(
+			"<b>%s</b>: <code>%s</code>\n",
+			html.EscapeString(deck.Name),
+			html.EscapeString(deck.Query),
+		)
+
+		currentRow = append(currentRow, gotgbot.InlineKeyboardButton{
+			Text:         deck.Name,
+			CallbackData: fmt.Sprintf("deck_%v", deck.ID),
+		})
+
+		if (i+1)%3 == 0 || i == len(decks)-1 {
+			keyboard = append(keyboard, currentRow)
+			currentRow = []gotgbot.InlineKeyboardButton{}
+		}
+	}
+
+	_, err = ctx.EffectiveMessage.Reply(b, text, &gotgbot.SendMessageOpts{
+		ParseMode: "HTML",
+		ReplyMarkup: gotgbot.InlineKeyboardMarkup{
+			InlineKeyboard: keyboard,
+		},
+	})
+
+	if err != nil {
+		return fmt.Errorf("failed to send decks: %w", err)
+	}
+
+	return nil
+}
+
+// StartDeck starts a review session of a deck picked from /decks
+func (h *BotHandler) StartDeck(b *gotgbot.Bot, ctx *ext.Context) error {
+
+	if !checkUser(ctx.Update.CallbackQuery.From.Id) {
+		return nil
+	}
+
+	cb := ctx.Update.CallbackQuery
+
+	_, err := cb.Answer(b, &gotgbot.AnswerCallbackQueryOpts{
+		Text: "Starting Review....",
+	})
+
+	if err != nil {
+		return fmt.Errorf("failed to answer callback query: %w", err)
+	}
+
+	deckID, err := strconv.Atoi(strings.TrimPrefix(cb.Data, "deck_"))
+
+	if err != nil {
+		return h.editMessage(b, cb.Message, "Got invalid response", nil)
+	}
+
+	session, err := h.service.StartDeckReview(cb.From.Id, deckID)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			return h.editMessage(b, cb.Message, "Could not find the specified deck", nil)
+		default:
+			log.Printf("Failed to start deck review: %v", err)
+			return h.editMessage(b, cb.Message, "Failed to start review", nil)
+		}
+	}
+
+	if session.Count == 0 {
+		return h.editMessage(b, cb.Message, fmt.Sprintf(
+			"No notes match the deck %s",
+			html.EscapeString(session.Deck.Name),
+		), nil)
+	}
+
+	if err := h.editMessage(b, cb.Message, fmt.Sprintf(
+		"🗂 <b>Starting Review</b>\n"+
+			"━━━━━━━━━━━━━━\n"+
+			"<b>Deck:</b> %s\n"+
+			"<b>Matching:</b> %v\n"+
+			"<b>Now:</b> %v",
+		html.EscapeString(session.Deck.Name),
+		session.Matching,
+		session.Count,
+	), nil); err != nil {
+		return fmt.Errorf("editing message: %w", err)
+	}
+
+	h.setUserData("clozeQuestion", reviewModePlain)
+	h.startSession(session.NoteIDs, session.Count)
+
+	return h.showReview(b, cb.From.Id, cb.Message.GetChat().Id, nil, "")
+}
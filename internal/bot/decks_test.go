@@ -0,0 +1,61 @@
+package bot
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+
+	"github.com/amalrajan30/spacedgram/internal/storage"
+)
+
+func TestDeckReview(t *testing.T) {
+	s, db := testService(t)
+	userID := testUserID(t, db)
+	source := testSource(t, db, storage.Source{})
+
+	t.Cleanup(func() {
+		db.Unscoped().Where("user_id = ?", userID).Delete(&storage.Deck{})
+	})
+
+	notes := make([]storage.Note, 3)
+
+	for i := range notes {
+		notes[i] = storage.Note{Content: fmt.Sprintf("Highlight %v", i), SourceID: int(source.ID), ReviewCount: i}
+
+		if err := db.Create(&notes[i]).Error; err != nil {
+			t.Fatalf("failed to create note: %v", err)
+		}
+	}
+
+	if _, err := s.SaveDeck(userID, " ", "reviews>0"); err == nil {
+		t.Error("SaveDeck accepted a deck without a name")
+	}
+
+	if _, err := s.SaveDeck(userID, "broken", "reviews>"); err == nil {
+		t.Error("SaveDeck accepted an invalid query")
+	}
+
+	deck, err := s.SaveDeck(userID, " reviewed ", fmt.Sprintf("source:%q reviews>0", source.Title))
+
+	if err != nil || deck.Name != "reviewed" {
+		t.Fatalf("SaveDeck = %+v, %v, want the trimmed name", deck, err)
+	}
+
+	session, err := s.StartDeckReview(userID, int(deck.ID))
+
+	if err != nil {
+		t.Fatalf("StartDeckReview failed: %v", err)
+	}
+
+	ids := slices.Clone(session.NoteIDs)
+	slices.Sort(ids)
+
+	// Notes are drilled whether they're due or not
+	if want := []int{int(notes[1].ID), int(notes[2].ID)}; !slices.Equal(ids, want) || session.Matching != 2 || session.Count != 2 {
+		t.Errorf("deck session = %+v, want %v", session, want)
+	}
+
+	if err := s.DeleteDeck(userID, " reviewed"); err != nil {
+		t.Errorf("DeleteDeck failed: %v", err)
+	}
+}
@@ -0,0 +1,114 @@
+package bot
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/amalrajan30/spacedgram/internal/storage"
+)
+
+// logQuestionFeedback records what was done with the current question of a
+// note and returns the note
+func (s BotService) logQuestionFeedback(userID int64, noteID int, action string, replacement string) (*storage.Note, error) {
+	note, err := s.repo.GetNote(noteID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if note.Question == "" {
+		return nil, fmt.Errorf("note %d has no question", noteID)
+	}
+
+	err = s.repo.InsertQuestionFeedback(storage.QuestionFeedback{
+		UserID:      userID,
+		NoteID:      noteID,
+		Question:    note.Question,
+		Answer:      note.Answer,
+		Action:      action,
+		Replacement: replacement,
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return note, nil
+}
+
+// RegenerateQuestion replaces the cloze question of a note with a new one,
+// telling the LLM which questions were rejected before
+func (s BotService) RegenerateQuestion(userID int64, noteID int) (*storage.Note, error) {
+	if _, err := s.logQuestionFeedback(userID, noteID, storage.QuestionFeedbackRegenerated, ""); err != nil {
+		return nil, err
+	}
+
+	note, err := s.repo.SetClozeQuestion(noteID, "", "")
+
+	if err != nil {
+		return nil, err
+	}
+
+	regenerated, err := s.GetClozeQuestion(note)
+
+	if err != nil {
+		// Try again in the background rather than leaving the note without
+		// a question
+		s.retryGeneration(noteID, storage.GenerationKindCloze)
+		return nil, err
+	}
+
+	return regenerated, nil
+}
+
+// RejectQuestion drops the cloze question of a note and queues a new one, the
+// note is shown plain until it is ready
+func (s BotService) RejectQuestion(userID int64, noteID int) error {
+	if _, err := s.logQuestionFeedback(userID, noteID, storage.QuestionFeedbackRejected, ""); err != nil {
+		return err
+	}
+
+	if _, err := s.repo.SetClozeQuestion(noteID, "", ""); err != nil {
+		return err
+	}
+
+	s.retryGeneration(noteID, storage.GenerationKindCloze)
+
+	return nil
+}
+
+// splitQuestion splits a question typed as "question | answer". The answer
+// is empty when left out.
+func splitQuestion(text string) (string, string, error) {
+	question, answer, hasAnswer := strings.Cut(text, "|")
+	question = strings.TrimSpace(question)
+	answer = strings.TrimSpace(answer)
+
+	if question == "" || (hasAnswer && answer == "") {
+		return "", "", fmt.Errorf("question and answer can't be empty")
+	}
+
+	return question, answer, nil
+}
+
+// EditQuestion replaces the cloze question of a note with the user's text,
+// given as "question | answer". The answer is kept when left out.
+func (s BotService) EditQuestion(userID int64, noteID int, text string) (*storage.Note, error) {
+	question, answer, err := splitQuestion(text)
+
+	if err != nil {
+		return nil, err
+	}
+
+	note, err := s.logQuestionFeedback(userID, noteID, storage.QuestionFeedbackEdited, strings.TrimSpace(text))
+
+	if err != nil {
+		return nil, err
+	}
+
+	if answer == "" {
+		answer = note.Answer
+	}
+
+	return s.repo.SetClozeQuestion(noteID, question, answer)
+}
@@ -0,0 +1,137 @@
+package bot
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+	"github.com/amalrajan30/spacedgram/internal/llm"
+)
+
+func questionFeedbackRow(noteID uint) []gotgbot.InlineKeyboardButton {
+	return []gotgbot.InlineKeyboardButton{
+		{
+			Text:         "🔄 Regenerate",
+			CallbackData: fmt.Sprintf("question_regen_%v", noteID),
+		},
+		{
+			Text:         "✏️ Edit",
+			CallbackData: fmt.Sprintf("question_edit_%v", noteID),
+		},
+		{
+			Text:         "👎 Bad question",
+			CallbackData: fmt.Sprintf("question_bad_%v", noteID),
+		},
+	}
+}
+
+// showCurrentAgain sends the card at the session cursor again, e.g. after
+// its question changed
+func (h *BotHandler) showCurrentAgain(b *gotgbot.Bot, userID int64, chatID int64, msg gotgbot.MaybeInaccessibleMessage) error {
+	if skip, ok := h.getUserData("skip"); ok && skip > 0 {
+		h.setUserData("skip", skip-1)
+	}
+
+	return h.showReview(b, userID, chatID, msg, "")
+}
+
+// HandleQuestionFeedback regenerates, rejects or starts editing the cloze
+// question of a card
+func (h *BotHandler) HandleQuestionFeedback(b *gotgbot.Bot, ctx *ext.Context) error {
+
+	if !checkUser(ctx.Update.CallbackQuery.From.Id) {
+		return nil
+	}
+
+	cb := ctx.Update.CallbackQuery
+	parts := strings.Split(cb.Data, "_")
+
+	if len(parts) != 3 {
+		return h.editMessage(b, cb.Message, "Got invalid response", nil)
+	}
+
+	noteID, err := strconv.Atoi(parts[2])
+
+	if err != nil {
+		return h.editMessage(b, cb.Message, "Got invalid response", nil)
+	}
+
+	answers := map[string]string{
+		"regen": "Regenerating...",
+		"edit":  "Editing",
+		"bad":   "Thanks for the feedback",
+	}
+
+	_, err = cb.Answer(b, &gotgbot.AnswerCallbackQueryOpts{
+		Text: answers[parts[1]],
+	})
+
+	if err != nil {
+		return fmt.Errorf("failed to answer callback query: %w", err)
+	}
+
+	chatID := cb.Message.GetChat().Id
+
+	switch parts[1] {
+	case "regen":
+		if _, err := h.service.RegenerateQuestion(cb.From.Id, noteID); err != nil {
+			log.Printf("Failed to regenerate question: %v", err)
+
+			if !errors.Is(err, llm.ErrBudgetExceeded) {
+				return h.editMessage(b, cb.Message, "Failed to regenerate the question", nil)
+			}
+
+			// The note is shown plain until its question is regenerated
+			if _, err := b.SendMessage(chatID, "💸 LLM budget reached, the question will be regenerated once it resets", nil); err != nil {
+				log.Printf("Failed to send budget message: %v", err)
+			}
+		}
+	case "bad":
+		if err := h.service.RejectQuestion(cb.From.Id, noteID); err != nil {
+			log.Printf("Failed to reject question: %v", err)
+			return h.editMessage(b, cb.Message, "Failed to reject the question", nil)
+		}
+	case "edit":
+		h.setAwaitingEdit(chatID, noteID)
+
+		return h.editMessage(b, cb.Message,
+			"✏️ Reply with the new question, optionally followed by <code>| answer</code>",
+			&gotgbot.EditMessageTextOpts{
+				ParseMode: "HTML",
+			})
+	default:
+		return h.editMessage(b, cb.Message, "Got invalid response", nil)
+	}
+
+	return h.showCurrentAgain(b, cb.From.Id, chatID, cb.Message)
+}
+
+// HandleQuestionEdit replaces the cloze question being edited with the
+// message text and shows the card again
+func (h *BotHandler) HandleQuestionEdit(b *gotgbot.Bot, ctx *ext.Context) error {
+
+	if !checkUser(ctx.EffectiveMessage.From.Id) {
+		return nil
+	}
+
+	chatID := ctx.EffectiveChat.Id
+
+	noteID, ok := h.takeAwaitingEdit(chatID)
+
+	if !ok {
+		return nil
+	}
+
+	if _, err := h.service.EditQuestion(ctx.EffectiveMessage.From.Id, noteID, ctx.EffectiveMessage.Text); err != nil {
+		log.Printf("Failed to edit question: %v", err)
+		h.setAwaitingEdit(chatID, noteID)
+		_, err = ctx.EffectiveMessage.Reply(b, fmt.Sprintf("Could not update the question: %v", err), nil)
+		return err
+	}
+
+	return h.showCurrentAgain(b, ctx.EffectiveMessage.From.Id, chatID, nil)
+}
@@ -0,0 +1,137 @@
+package bot
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/amalrajan30/spacedgram/internal/storage"
+	"gorm.io/gorm"
+)
+
+// testQuestionNote creates a note with a cloze question, removed with its
+// feedback and jobs when the test ends
+func testQuestionNote(t *testing.T, db *gorm.DB) storage.Note {
+	t.Helper()
+
+	source := testSource(t, db, storage.Source{})
+	note := storage.Note{
+		Content:  "Rome is the capital of Italy",
+		Question: "____ is the capital of Italy.",
+		Answer:   "Rome",
+		SourceID: int(source.ID),
+	}
+
+	if err := db.Create(&note).Error; err != nil {
+		t.Fatalf("failed to create note: %v", err)
+	}
+
+	t.Cleanup(func() {
+		db.Unscoped().Where("note_id = ?", note.ID).Delete(&storage.QuestionFeedback{})
+		db.Unscoped().Where("note_id = ?", note.ID).Delete(&storage.GenerationJob{})
+	})
+
+	return note
+}
+
+func TestRegenerateQuestion(t *testing.T) {
+	s, db := testService(t)
+	fake := useFakeProvider(t)
+	userID := testUserID(t, db)
+	note := testQuestionNote(t, db)
+
+	fake.SetResponse("create_question", `{"question": "Rome is the capital of ____.", "answer": "Italy"}`)
+
+	regenerated, err := s.RegenerateQuestion(userID, int(note.ID))
+
+	if err != nil {
+		t.Fatalf("RegenerateQuestion failed: %v", err)
+	}
+
+	if regenerated.Question != "Rome is the capital of ____." || regenerated.Answer != "Italy" {
+		t.Errorf("RegenerateQuestion = %q (%q), want the new question", regenerated.Question, regenerated.Answer)
+	}
+
+	calls := fake.Calls()
+
+	if len(calls) != 1 || !strings.Contains(calls[0].UserPrompt, "____ is the capital of Italy. (answer: Rome)") {
+		t.Errorf("provider calls = %+v, want one mentioning the previous question", calls)
+	}
+
+	rejected, err := s.repo.GetRejectedQuestions(int(note.ID))
+
+	if err != nil || len(rejected) != 1 || rejected[0].Action != storage.QuestionFeedbackRegenerated {
+		t.Errorf("GetRejectedQuestions = %+v (%v), want the regenerated question", rejected, err)
+	}
+}
+
+func TestRejectQuestion(t *testing.T) {
+	s, db := testService(t)
+	userID := testUserID(t, db)
+	note := testQuestionNote(t, db)
+
+	if err := s.RejectQuestion(userID, int(note.ID)); err != nil {
+		t.Fatalf("RejectQuestion failed: %v", err)
+	}
+
+	rejected, err := s.repo.GetNote(int(note.ID))
+
+	if err != nil {
+		t.Fatalf("GetNote failed: %v", err)
+	}
+
+	if rejected.Question != "" || rejected.Answer != "" {
+		t.Errorf("question after rejecting it = %q (%q), want none", rejected.Question, rejected.Answer)
+	}
+
+	var jobs int64
+	db.Model(&storage.GenerationJob{}).Where("note_id = ? AND kind = ?", note.ID, storage.GenerationKindCloze).Count(&jobs)
+
+	if jobs != 1 {
+		t.Errorf("%v cloze jobs queued, want 1", jobs)
+	}
+
+	// There is no question left to reject
+	if err := s.RejectQuestion(userID, int(note.ID)); err == nil {
+		t.Error("RejectQuestion rejected a note without a question")
+	}
+}
+
+func TestEditQuestion(t *testing.T) {
+	s, db := testService(t)
+	userID := testUserID(t, db)
+	note := testQuestionNote(t, db)
+
+	edited, err := s.EditQuestion(userID, int(note.ID), "The capital of Italy is ____. | Rome ")
+
+	if err != nil {
+		t.Fatalf("EditQuestion failed: %v", err)
+	}
+
+	if edited.Question != "The capital of Italy is ____." || edited.Answer != "Rome" {
+		t.Errorf("EditQuestion = %q (%q), want the edited question", edited.Question, edited.Answer)
+	}
+
+	// The answer is kept when left out
+	edited, err = s.EditQuestion(userID, int(note.ID), "Italy's capital is ____.")
+
+	if err != nil {
+		t.Fatalf("EditQuestion failed: %v", err)
+	}
+
+	if edited.Question != "Italy's capital is ____." || edited.Answer != "Rome" {
+		t.Errorf("EditQuestion = %q (%q), want the question edited and the answer kept", edited.Question, edited.Answer)
+	}
+
+	// Edits aren't rejections
+	if rejected, err := s.repo.GetRejectedQuestions(int(note.ID)); err != nil || len(rejected) != 0 {
+		t.Errorf("GetRejectedQuestions = %+v (%v), want none", rejected, err)
+	}
+}
+
+func TestEditQuestionEmpty(t *testing.T) {
+	for _, text := range []string{"", " | Rome", "Question ____ |  "} {
+		if _, err := (BotService{}).EditQuestion(1, 1, text); err == nil {
+			t.Errorf("EditQuestion accepted %q", text)
+		}
+	}
+}
@@ -0,0 +1,240 @@
+package bot
+
+import (
+	"fmt"
+	"html"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+	"github.com/amalrajan30/spacedgram/internal/storage"
+)
+
+// Number of notes shown per page of /find results
+const findPageSize = 5
+
+type findQuery struct {
+	Query   string
+	Filters storage.NoteFilters
+}
+
+const findUsage = "Usage: /find [source:<id>] [tag:<name>] [is:due|new|scheduled] <keywords>\n\n" +
+	"Use quotes for exact phrases, \"or\" for alternatives and -word to exclude a word."
+
+// parseFindQuery splits the filters out of the arguments of /find
+func parseFindQuery(args []string) (findQuery, error) {
+	var query findQuery
+	var keywords []string
+
+	for _, arg := range args {
+		switch {
+		case strings.HasPrefix(arg, "source:"):
+			sourceID, err := strconv.Atoi(strings.TrimPrefix(arg, "source:"))
+
+			if err != nil || sourceID <= 0 {
+				return query, fmt.Errorf("invalid source %q", arg)
+			}
+
+			query.Filters.SourceID = sourceID
+		case strings.HasPrefix(arg, "tag:"):
+			query.Filters.Tag = storage.NormalizeTag(strings.TrimPrefix(arg, "tag:"))
+		case strings.HasPrefix(arg, "is:"):
+			state := strings.TrimPrefix(arg, "is:")
+
+			switch state {
+			case storage.DueStateDue, storage.DueStateNew, storage.DueStateScheduled:
+				query.Filters.DueState = state
+			default:
+				return query, fmt.Errorf("invalid due state %q", state)
+			}
+		default:
+			keywords = append(keywords, arg)
+		}
+	}
+
+	query.Query = strings.Join(keywords, " ")
+
+	return query, nil
+}
+
+func (h *BotHandler) setFind(chatID int64, query findQuery) {
+	h.rwMux.Lock()
+	defer h.rwMux.Unlock()
+
+	if h.finds == nil {
+		h.finds = map[int64]findQuery{}
+	}
+
+	h.finds[chatID] = query
+}
+
+func (h *BotHandler) getFind(chatID int64) (findQuery, bool) {
+	h.rwMux.RLock()
+	defer h.rwMux.RUnlock()
+
+	query, ok := h.finds[chatID]
+
+	return query, ok
+}
+
+// findPage renders a page of the results of a query, with buttons to review
+// each note and to move between pages
+func (h *BotHandler) findPage(userID int64, query findQuery, page int) (string, *gotgbot.InlineKeyboardMarkup, error) {
+	settings, err := h.service.repo.GetUserSettings(userID)
+
+	if err != nil {
+		return "", nil, err
+	}
+
+	filters := query.Filters
+	filters.DueBefore = settings.DayEnd(time.Now())
+	filters.Limit = findPageSize
+	filters.Offset = page * findPageSize
+
+	notes, total, err := h.service.repo.SearchNotes(query.Query, filters)
+
+	if err != nil {
+		return "", nil, err
+	}
+
+	if total == 0 {
+		return "No highlights found", nil, nil
+	}
+
+	pages := (total + findPageSize - 1) / findPageSize
+
+	text := fmt.Sprintf(
+		"🔍 <b>Find:</b> %s\n"+
+			"━━━━━━━━━━━━━━\n"+
+			"%v matches · page %v/%v\n\n",
+		html.EscapeString(query.Query),
+		total,
+		page+1,
+		pages,
+	)
+
+	var keyboardRows [][]gotgbot.InlineKeyboardButton
+
+	for i, note := range notes {
+		position := filters.Offset + i + 1
+
+		text = text + formatSearchResult(position, note)
+		keyboardRows = append(keyboardRows, reviewNowRow(position, note))
+	}
+
+	var navigation []gotgbot.InlineKeyboardButton
+
+	if page > 0 {
+		navigation = append(navigation, gotgbot.InlineKeyboardButton{
+			Text:         "◀️ Previous",
+			CallbackData: fmt.Sprintf("find_page_%v", page-1),
+		})
+	}
+
+	if page+1 < pages {
+		navigation = append(navigation, gotgbot.InlineKeyboardButton{
+			Text:         "Next ▶️",
+			CallbackData: fmt.Sprintf("find_page_%v", page+1),
+		})
+	}
+
+	if len(navigation) > 0 {
+		keyboardRows = append(keyboardRows, navigation)
+	}
+
+	return text, &gotgbot.InlineKeyboardMarkup{InlineKeyboard: keyboardRows}, nil
+}
+
+// Find searches the notes by keywords
+func (h *BotHandler) Find(b *gotgbot.Bot, ctx *ext.Context) error {
+
+	if !checkUser(ctx.Message.From.Id) {
+		return nil
+	}
+
+	query, err := parseFindQuery(ctx.Args()[1:])
+
+	if err != nil {
+		_, err = ctx.EffectiveMessage.Reply(b, fmt.Sprintf("%v\n\n%v", err, findUsage), nil)
+		return err
+	}
+
+	if query.Query == "" {
+		_, err = ctx.EffectiveMessage.Reply(b, findUsage, nil)
+		return err
+	}
+
+	h.setFind(ctx.EffectiveChat.Id, query)
+
+	text, keyboard, err := h.findPage(ctx.Message.From.Id, query, 0)
+
+	if err != nil {
+		log.Printf("Failed to find notes: %v", err)
+		_, err = ctx.EffectiveMessage.Reply(b, "Search failed, try again later", nil)
+		return err
+	}
+
+	opts := &gotgbot.SendMessageOpts{
+		ParseMode: "HTML",
+	}
+
+	if keyboard != nil {
+		opts.ReplyMarkup = keyboard
+	}
+
+	_, err = ctx.EffectiveMessage.Reply(b, text, opts)
+
+	if err != nil {
+		return fmt.Errorf("Failed to send find results: %w", err)
+	}
+
+	return nil
+}
+
+// FindPage moves to another page of the latest /find results
+func (h *BotHandler) FindPage(b *gotgbot.Bot, ctx *ext.Context) error {
+
+	if !checkUser(ctx.Update.CallbackQuery.From.Id) {
+		return nil
+	}
+
+	cb := ctx.Update.CallbackQuery
+
+	_, err := cb.Answer(b, nil)
+
+	if err != nil {
+		return fmt.Errorf("failed to answer callback query: %w", err)
+	}
+
+	page, err := strconv.Atoi(strings.TrimPrefix(cb.Data, "find_page_"))
+
+	if err != nil || page < 0 {
+		return h.editMessage(b, cb.Message, "Got invalid response", nil)
+	}
+
+	query, ok := h.getFind(cb.Message.GetChat().Id)
+
+	if !ok {
+		return h.editMessage(b, cb.Message, "These results have expired, search again with /find", nil)
+	}
+
+	text, keyboard, err := h.findPage(cb.From.Id, query, page)
+
+	if err != nil {
+		log.Printf("Failed to find notes: %v", err)
+		return h.editMessage(b, cb.Message, "Search failed, try again later", nil)
+	}
+
+	opts := &gotgbot.EditMessageTextOpts{
+		ParseMode: "HTML",
+	}
+
+	if keyboard != nil {
+		opts.ReplyMarkup = *keyboard
+	}
+
+	return h.editMessage(b, cb.Message, text, opts)
+}
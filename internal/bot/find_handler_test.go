@@ -0,0 +1,79 @@
+package bot
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/amalrajan30/spacedgram/internal/storage"
+)
+
+func TestParseFindQuery(t *testing.T) {
+	query, err := parseFindQuery([]string{"source:12", "roman", "is:due", "tag:#History", `"empire`, `fell"`})
+
+	if err != nil {
+		t.Fatalf("parseFindQuery failed: %v", err)
+	}
+
+	if query.Query != `roman "empire fell"` || query.Filters.SourceID != 12 || query.Filters.DueState != storage.DueStateDue || query.Filters.Tag != "history" {
+		t.Errorf("parseFindQuery = %+v, want the keywords of source 12 due and tagged history", query)
+	}
+
+	for _, args := range [][]string{
+		{"source:abc", "rome"},
+		{"source:-1", "rome"},
+		{"is:overdue", "rome"},
+	} {
+		if _, err := parseFindQuery(args); err == nil {
+			t.Errorf("parseFindQuery(%q) succeeded", args)
+		}
+	}
+}
+
+func TestFindPage(t *testing.T) {
+	s, db := testService(t)
+	source := testSource(t, db, storage.Source{})
+	h := NewBotHandler(s, nil)
+	userID := testUserID(t, db)
+
+	for i := 0; i < findPageSize+2; i++ {
+		if err := db.Create(&storage.Note{Content: "Carthage must be destroyed <b>", SourceID: int(source.ID)}).Error; err != nil {
+			t.Fatalf("failed to create note: %v", err)
+		}
+	}
+
+	query := findQuery{Query: "carthage", Filters: storage.NoteFilters{SourceID: int(source.ID)}}
+
+	text, keyboard, err := h.findPage(userID, query, 0)
+
+	if err != nil {
+		t.Fatalf("findPage failed: %v", err)
+	}
+
+	if !strings.Contains(text, "7 matches · page 1/2") || !strings.Contains(text, "&lt;b&gt;") {
+		t.Errorf("first page = %q, want 7 matches on 2 pages with the content escaped", text)
+	}
+
+	rows := keyboard.InlineKeyboard
+
+	if len(rows) != findPageSize+1 || len(rows[findPageSize]) != 1 || rows[findPageSize][0].CallbackData != "find_page_1" {
+		t.Errorf("first page keyboard = %+v, want a review button per note and the next page", rows)
+	}
+
+	text, keyboard, err = h.findPage(userID, query, 1)
+
+	if err != nil {
+		t.Fatalf("findPage failed: %v", err)
+	}
+
+	rows = keyboard.InlineKeyboard
+
+	if !strings.Contains(text, "<b>6.</b>") || len(rows) != 3 || rows[2][0].CallbackData != "find_page_0" {
+		t.Errorf("second page = %q with %+v, want the last 2 notes and the previous page", text, rows)
+	}
+
+	query.Query = "sparta"
+
+	if text, keyboard, err := h.findPage(userID, query, 0); err != nil || text != "No highlights found" || keyboard != nil {
+		t.Errorf("findPage without matches = %q, %v, %v", text, keyboard, err)
+	}
+}
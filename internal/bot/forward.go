@@ -0,0 +1,49 @@
+package bot
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/amalrajan30/spacedgram/internal/storage"
+)
+
+// Source of the forwarded notes saved without choosing one
+const telegramSource = "Telegram"
+
+// SaveForward adds a forwarded message as a note of a source, or of the
+// Telegram source when sourceID is 0
+func (s BotService) SaveForward(sourceID int, forward storage.Note) (*storage.Note, error) {
+	content := strings.TrimSpace(forward.Content)
+
+	if content == "" {
+		return nil, fmt.Errorf("the message has no text")
+	}
+
+	if sourceID == 0 {
+		source, err := s.repo.FindOrCreateSource(telegramSource, telegramOrigin)
+
+		if err != nil {
+			return nil, err
+		}
+
+		sourceID = int(source.ID)
+	}
+
+	return s.insertNote(storage.Note{
+		Content:  content,
+		SourceID: sourceID,
+		Forward:  forward.Forward,
+	})
+}
+
+// GenerateQuestion generates the cloze question of a note right away rather
+// than in the background
+func (s BotService) GenerateQuestion(noteID int) (*storage.Note, error) {
+	note, err := s.repo.GetNote(noteID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return s.GetClozeQuestion(note)
+}
@@ -0,0 +1,296 @@
+package bot
+
+import (
+	"fmt"
+	"html"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+	"github.com/amalrajan30/spacedgram/internal/storage"
+)
+
+// Most forwarded messages kept waiting to be saved, the oldest are dropped
+const maxForwards = 20
+
+// IsForwarded filters the messages with text forwarded from another chat
+func (h *BotHandler) IsForwarded(msg *gotgbot.Message) bool {
+	return msg.ForwardOrigin != nil && (msg.Text != "" || msg.Caption != "")
+}
+
+// forwardOrigin describes who sent a forwarded message originally. Posts of
+// public chats get a link back to them.
+func forwardOrigin(origin gotgbot.MessageOrigin) *storage.ForwardOrigin {
+	merged := origin.MergeMessageOrigin()
+
+	forward := storage.ForwardOrigin{
+		Type: merged.Type,
+		Date: time.Unix(merged.Date, 0),
+	}
+
+	switch {
+	case merged.SenderUser != nil:
+		forward.Name = strings.TrimSpace(merged.SenderUser.FirstName + " " + merged.SenderUser.LastName)
+	case merged.SenderUserName != "":
+		forward.Name = merged.SenderUserName
+	case merged.SenderChat != nil:
+		forward.Name = merged.SenderChat.Title
+	case merged.Chat != nil:
+		forward.Name = merged.Chat.Title
+	}
+
+	if merged.Chat != nil && merged.Chat.Username != "" && merged.MessageId != 0 {
+		forward.Link = fmt.Sprintf("https://t.me/%s/%d", merged.Chat.Username, merged.MessageId)
+	}
+
+	return &forward
+}
+
+// forwardedNote is the note a forwarded message would become
+func forwardedNote(msg *gotgbot.Message) storage.Note {
+	content := msg.Text
+
+	if content == "" {
+		content = msg.Caption
+	}
+
+	return storage.Note{
+		Content: content,
+		Forward: forwardOrigin(msg.ForwardOrigin),
+	}
+}
+
+func (h *BotHandler) setForward(messageID int64, note storage.Note) {
+	h.rwMux.Lock()
+	defer h.rwMux.Unlock()
+
+	if h.forwards == nil {
+		h.forwards = map[int64]storage.Note{}
+	}
+
+	h.forwards[messageID] = note
+
+	// Message ids grow over time, the smallest is the oldest forward
+	for len(h.forwards) > maxForwards {
+		oldest := messageID
+
+		for id := range h.forwards {
+			oldest = min(oldest, id)
+		}
+
+		delete(h.forwards, oldest)
+	}
+}
+
+func (h *BotHandler) getForward(messageID int64) (storage.Note, bool) {
+	h.rwMux.RLock()
+	defer h.rwMux.RUnlock()
+
+	note, ok := h.forwards[messageID]
+
+	return note, ok
+}
+
+func (h *BotHandler) deleteForward(messageID int64) {
+	h.rwMux.Lock()
+	defer h.rwMux.Unlock()
+
+	delete(h.forwards, messageID)
+}
+
+func formatForward(note storage.Note) string {
+	text := fmt.Sprintf("<i>%s</i>\n", html.EscapeString(truncate(note.Content, searchSnippet)))
+
+	if note.Forward != nil && note.Forward.Name != "" {
+		text = text + fmt.Sprintf("📡 %s\n", html.EscapeString(note.Forward.Name))
+	}
+
+	return text
+}
+
+// HandleForward offers to save a forwarded message as a note
+func (h *BotHandler) HandleForward(b *gotgbot.Bot, ctx *ext.Context) error {
+
+	if !checkUser(ctx.EffectiveMessage.From.Id) {
+		return nil
+	}
+
+	msg := ctx.EffectiveMessage
+	note := forwardedNote(msg)
+
+	h.setForward(msg.MessageId, note)
+
+	keyboard := gotgbot.InlineKeyboardMarkup{
+		InlineKeyboard: [][]gotgbot.InlineKeyboardButton{
+			{
+				{
+					Text:         "📥 " + telegramSource,
+					CallbackData: fmt.Sprintf("fwd_save_%v_0", msg.MessageId),
+				},
+				{
+					Text:         "📚 Choose source",
+					CallbackData: fmt.Sprintf("fwd_sources_%v", msg.MessageId),
+				},
+				{
+					Text:         "✖️ Ignore",
+					CallbackData: fmt.Sprintf("fwd_ignore_%v", msg.MessageId),
+				},
+			},
+		},
+	}
+
+	_, err := msg.Reply(b, "📨 <b>Save as a note?</b>\n"+
+		"━━━━━━━━━━━━━━\n"+
+		formatForward(note), &gotgbot.SendMessageOpts{
+		ReplyMarkup: keyboard,
+		ParseMode:   "HTML",
+	})
+
+	if err != nil {
+		return fmt.Errorf("failed to send message: %w", err)
+	}
+
+	return nil
+}
+
+// HandleForwardAction saves a forwarded message to the Telegram source or a
+// chosen one, and generates the question of the saved note on demand
+func (h *BotHandler) HandleForwardAction(b *gotgbot.Bot, ctx *ext.Context) error {
+
+	if !checkUser(ctx.Update.CallbackQuery.From.Id) {
+		return nil
+	}
+
+	cb := ctx.Update.CallbackQuery
+	parts := strings.Split(cb.Data, "_")
+
+	if len(parts) < 3 {
+		return h.editMessage(b, cb.Message, "Got invalid response", nil)
+	}
+
+	id, err := strconv.ParseInt(parts[2], 10, 64)
+
+	if err != nil {
+		return h.editMessage(b, cb.Message, "Got invalid response", nil)
+	}
+
+	answers := map[string]string{
+		"save":   "Saving...",
+		"cloze":  "Generating...",
+		"ignore": "Ignored",
+	}
+
+	_, err = cb.Answer(b, &gotgbot.AnswerCallbackQueryOpts{
+		Text: answers[parts[1]],
+	})
+
+	if err != nil {
+		return fmt.Errorf("failed to answer callback query: %w", err)
+	}
+
+	switch parts[1] {
+	case "sources":
+		return h.showForwardSources(b, cb.Message, id)
+	case "save":
+		if len(parts) != 4 {
+			return h.editMessage(b, cb.Message, "Got invalid response", nil)
+		}
+
+		sourceID, err := strconv.Atoi(parts[3])
+
+		if err != nil {
+			return h.editMessage(b, cb.Message, "Got invalid response", nil)
+		}
+
+		return h.saveForward(b, cb.Message, id, sourceID)
+	case "cloze":
+		note, err := h.service.GenerateQuestion(int(id))
+
+		if err != nil {
+			log.Printf("Failed to generate question of forwarded note %v: %v", id, err)
+			h.service.retryGeneration(int(id), storage.GenerationKindCloze)
+			return h.editMessage(b, cb.Message, "Could not generate the question now, it will be generated in the background", nil)
+		}
+
+		return h.editMessage(b, cb.Message, fmt.Sprintf(
+			"✅ Saved to <b>%s</b>\n\n❓ %s\n💡 <tg-spoiler>%s</tg-spoiler>",
+			html.EscapeString(note.Source.Title),
+			html.EscapeString(note.Question),
+			html.EscapeString(note.Answer),
+		), nil)
+	case "ignore":
+		h.deleteForward(id)
+		return h.editMessage(b, cb.Message, "Not saved", nil)
+	}
+
+	return h.editMessage(b, cb.Message, "Got invalid response", nil)
+}
+
+func (h *BotHandler) showForwardSources(b *gotgbot.Bot, msg gotgbot.MaybeInaccessibleMessage, messageID int64) error {
+	sources := h.service.repo.GetSources()
+
+	var keyboard [][]gotgbot.InlineKeyboardButton
+	var currentRow []gotgbot.InlineKeyboardButton
+
+	for i, source := range sources {
+		currentRow = append(currentRow, gotgbot.InlineKeyboardButton{
+			Text:         strings.Split(source.Name, ":")[0],
+			CallbackData: fmt.Sprintf("fwd_save_%v_%v", messageID, source.Id),
+		})
+
+		if (i+1)%3 == 0 || i == len(sources)-1 {
+			keyboard = append(keyboard, currentRow)
+			currentRow = []gotgbot.InlineKeyboardButton{}
+		}
+	}
+
+	_, _, err := msg.EditReplyMarkup(b, &gotgbot.EditMessageReplyMarkupOpts{
+		ReplyMarkup: gotgbot.InlineKeyboardMarkup{InlineKeyboard: keyboard},
+	})
+
+	if err != nil {
+		return fmt.Errorf("failed to edit message: %w", err)
+	}
+
+	return nil
+}
+
+func (h *BotHandler) saveForward(b *gotgbot.Bot, msg gotgbot.MaybeInaccessibleMessage, messageID int64, sourceID int) error {
+	forward, ok := h.getForward(messageID)
+
+	if !ok {
+		return h.editMessage(b, msg, "The message is no longer available, forward it again", nil)
+	}
+
+	note, err := h.service.SaveForward(sourceID, forward)
+
+	if err != nil {
+		log.Printf("Failed to save forwarded message: %v", err)
+		return h.editMessage(b, msg, "Failed to save the note", nil)
+	}
+
+	h.deleteForward(messageID)
+
+	source, err := h.service.repo.GetSource(note.SourceID)
+
+	if err != nil {
+		log.Printf("Failed to get source of forwarded note: %v", err)
+	}
+
+	return h.editMessage(b, msg, fmt.Sprintf(
+		"✅ Saved to <b>%s</b>\n\n%s",
+		html.EscapeString(source.Title),
+		formatForward(*note),
+	), &gotgbot.EditMessageTextOpts{
+		ParseMode: "HTML",
+		ReplyMarkup: gotgbot.InlineKeyboardMarkup{
+			InlineKeyboard: [][]gotgbot.InlineKeyboardButton{{{
+				Text:         "✨ Generate question",
+				CallbackData: fmt.Sprintf("fwd_cloze_%v", note.ID),
+			}}},
+		},
+	})
+}
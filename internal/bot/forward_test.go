@@ -0,0 +1,145 @@
+package bot
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/amalrajan30/spacedgram/internal/storage"
+)
+
+func TestIsForwarded(t *testing.T) {
+	h := NewBotHandler(nil, nil)
+	origin := gotgbot.MessageOriginUser{Date: 1, SenderUser: gotgbot.User{FirstName: "Ada"}}
+	reply := &gotgbot.ExternalReplyInfo{Origin: origin}
+
+	tests := []struct {
+		name string
+		msg  gotgbot.Message
+		want bool
+	}{
+		{"forwarded text", gotgbot.Message{ForwardOrigin: origin, Text: "Quote"}, true},
+		{"forwarded photo with caption", gotgbot.Message{ForwardOrigin: origin, Caption: "Caption"}, true},
+		{"forwarded sticker", gotgbot.Message{ForwardOrigin: origin}, false},
+		{"quoted reply", gotgbot.Message{Text: "Look", ExternalReply: reply, Quote: &gotgbot.TextQuote{Text: "Quote"}}, false},
+		{"plain message", gotgbot.Message{Text: "Hello"}, false},
+	}
+
+	for _, test := range tests {
+		if got := h.IsForwarded(&test.msg); got != test.want {
+			t.Errorf("IsForwarded(%v) = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestForwardOrigin(t *testing.T) {
+	date := time.Date(2024, 3, 10, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name   string
+		origin gotgbot.MessageOrigin
+		want   storage.ForwardOrigin
+	}{
+		{
+			"user",
+			gotgbot.MessageOriginUser{Date: date.Unix(), SenderUser: gotgbot.User{FirstName: "Ada", LastName: "Lovelace"}},
+			storage.ForwardOrigin{Type: "user", Name: "Ada Lovelace", Date: date},
+		},
+		{
+			"hidden user",
+			gotgbot.MessageOriginHiddenUser{Date: date.Unix(), SenderUserName: "Anonymous"},
+			storage.ForwardOrigin{Type: "hidden_user", Name: "Anonymous", Date: date},
+		},
+		{
+			"public channel",
+			gotgbot.MessageOriginChannel{Date: date.Unix(), Chat: gotgbot.Chat{Title: "News", Username: "news"}, MessageId: 42},
+			storage.ForwardOrigin{Type: "channel", Name: "News", Link: "https://t.me/news/42", Date: date},
+		},
+		{
+			"private channel",
+			gotgbot.MessageOriginChannel{Date: date.Unix(), Chat: gotgbot.Chat{Title: "Diary"}, MessageId: 42},
+			storage.ForwardOrigin{Type: "channel", Name: "Diary", Date: date},
+		},
+	}
+
+	for _, test := range tests {
+		got := forwardOrigin(test.origin)
+
+		if got.Type != test.want.Type || got.Name != test.want.Name || got.Link != test.want.Link || !got.Date.Equal(test.want.Date) {
+			t.Errorf("forwardOrigin of %v = %+v, want %+v", test.name, *got, test.want)
+		}
+	}
+}
+
+func TestForwardedNote(t *testing.T) {
+	origin := gotgbot.MessageOriginHiddenUser{Date: 1, SenderUserName: "Anonymous"}
+
+	if note := forwardedNote(&gotgbot.Message{ForwardOrigin: origin, Caption: "Caption"}); note.Content != "Caption" || note.Forward.Name != "Anonymous" {
+		t.Errorf("note of a forwarded photo = %+v, want its caption", note)
+	}
+
+	if note := forwardedNote(&gotgbot.Message{ForwardOrigin: origin, Text: "Text", Caption: "Caption"}); note.Content != "Text" {
+		t.Errorf("note of a forwarded message = %+v, want its text", note)
+	}
+}
+
+func TestPendingForwards(t *testing.T) {
+	h := NewBotHandler(nil, nil)
+	note := storage.Note{Content: "<Quote>", Forward: &storage.ForwardOrigin{Name: "Ada & co"}}
+
+	h.setForward(5, note)
+
+	if got, ok := h.getForward(5); !ok || got.Content != note.Content {
+		t.Errorf("getForward = %+v, %v, want the pending note", got, ok)
+	}
+
+	h.deleteForward(5)
+
+	if _, ok := h.getForward(5); ok {
+		t.Error("a deleted forward is still pending")
+	}
+
+	// Only the latest forwards stay pending
+	for id := int64(1); id <= maxForwards+1; id++ {
+		h.setForward(id, note)
+	}
+
+	if _, ok := h.getForward(1); ok || len(h.forwards) != maxForwards {
+		t.Errorf("%v forwards pending, want the latest %v", len(h.forwards), maxForwards)
+	}
+
+	if text := formatForward(note); !strings.Contains(text, "&lt;Quote&gt;") || !strings.Contains(text, "Ada &amp; co") {
+		t.Errorf("formatForward = %q, want the note and sender escaped", text)
+	}
+}
+
+func TestSaveForward(t *testing.T) {
+	s, db := testService(t)
+	source := testSource(t, db, storage.Source{})
+	forward := &storage.ForwardOrigin{Type: "channel", Name: "News", Link: "https://t.me/news/42", Date: time.Now().Truncate(time.Second)}
+
+	if _, err := s.SaveForward(int(source.ID), storage.Note{Content: " ", Forward: forward}); err == nil {
+		t.Error("SaveForward accepted a message without text")
+	}
+
+	note, err := s.SaveForward(int(source.ID), storage.Note{Content: " Breaking news ", Forward: forward})
+
+	if err != nil {
+		t.Fatalf("SaveForward failed: %v", err)
+	}
+
+	t.Cleanup(func() {
+		db.Unscoped().Where("note_id = ?", note.ID).Delete(&storage.GenerationJob{})
+	})
+
+	saved, err := s.repo.GetNote(int(note.ID))
+
+	if err != nil {
+		t.Fatalf("GetNote failed: %v", err)
+	}
+
+	if saved.Content != "Breaking news" || saved.SourceID != int(source.ID) || saved.Forward == nil || saved.Forward.Link != forward.Link {
+		t.Errorf("saved note = %+v, want the trimmed text with where it came from", saved)
+	}
+}
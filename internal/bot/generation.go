@@ -0,0 +1,183 @@
+package bot
+
+import (
+	"fmt"
+	"log"
+	"slices"
+	"time"
+
+	"github.com/amalrajan30/spacedgram/internal/llm"
+	"github.com/amalrajan30/spacedgram/internal/storage"
+)
+
+// Notes due within this window get their cloze questions generated ahead of
+// their review
+const generationLookahead = 24 * time.Hour
+
+// Number of highlights before and after a note given as context
+const contextHighlights = 2
+
+// highlightOf returns a note with its source and neighbouring highlights, as
+// sent to the LLM
+func (s BotService) highlightOf(note *storage.Note) llm.Highlight {
+	source := note.Source
+
+	if source.ID == 0 {
+		var err error
+		source, err = s.repo.GetSource(note.SourceID)
+
+		if err != nil {
+			log.Printf("Failed to get source of note %v: %v", note.ID, err)
+		}
+	}
+
+	highlight := llm.Highlight{
+		Content:      note.Content,
+		Title:        source.Title,
+		Author:       source.Author,
+		Location:     note.Location,
+		SystemPrompt: source.SystemPrompt,
+	}
+
+	before, after, err := s.repo.GetNeighbourNotes(*note, contextHighlights)
+
+	if err != nil {
+		log.Printf("Failed to get neighbouring highlights of note %v: %v", note.ID, err)
+		return highlight
+	}
+
+	for _, neighbour := range before {
+		highlight.Before = append(highlight.Before, neighbour.Content)
+	}
+
+	for _, neighbour := range after {
+		highlight.After = append(highlight.After, neighbour.Content)
+	}
+
+	return highlight
+}
+
+// EnqueueUpcoming queues cloze questions for the new and soon due notes of
+// sources with cloze questions enabled
+func (s BotService) EnqueueUpcoming() (int, error) {
+	notes, err := s.repo.GetNotesMissingCloze(time.Now().Add(generationLookahead))
+
+	if err != nil {
+		return 0, err
+	}
+
+	jobs := []storage.GenerationJob{}
+
+	for _, note := range notes {
+		jobs = append(jobs, storage.GenerationJob{
+			NoteID: int(note.ID),
+			Kind:   storage.GenerationKindCloze,
+		})
+	}
+
+	return s.repo.EnqueueGenerationJobs(jobs)
+}
+
+// enqueueGeneration queues a question that was missing during a review
+func (s BotService) enqueueGeneration(noteID int, kind string) {
+	_, err := s.repo.EnqueueGenerationJobs([]storage.GenerationJob{{
+		NoteID: noteID,
+		Kind:   kind,
+	}})
+
+	if err != nil {
+		log.Printf("Failed to queue %v generation for note %v: %v", kind, noteID, err)
+	}
+}
+
+// retryGeneration queues a question the user asked for, even if generating
+// it failed recently
+func (s BotService) retryGeneration(noteID int, kind string) {
+	_, err := s.repo.RetryGenerationJobs([]storage.GenerationJob{{
+		NoteID: noteID,
+		Kind:   kind,
+	}})
+
+	if err != nil {
+		log.Printf("Failed to queue %v generation for note %v: %v", kind, noteID, err)
+	}
+}
+
+// RunGenerationJob generates the question of a job, unless it was already
+// generated
+func (s BotService) RunGenerationJob(job storage.GenerationJob) error {
+	note, err := s.repo.GetNote(job.NoteID)
+
+	if err != nil {
+		return fmt.Errorf("getting note: %w", err)
+	}
+
+	switch job.Kind {
+	case storage.GenerationKindCloze:
+		_, err = s.GetClozeQuestion(note)
+	case storage.GenerationKindQuiz:
+		_, err = s.GetQuizQuestion(note)
+	case storage.GenerationKindPrompt:
+		err = s.generateRecallPrompt(note)
+	case storage.GenerationKindCard:
+		existing, typesErr := s.repo.GetCardTypes(job.NoteID)
+
+		if typesErr != nil {
+			return typesErr
+		}
+
+		if slices.Contains(existing, job.CardType) {
+			return nil
+		}
+
+		_, err = s.GenerateCard(*note, job.CardType)
+	case storage.GenerationKindTags:
+		err = s.suggestTags(note)
+	default:
+		return fmt.Errorf("unknown generation kind %q", job.Kind)
+	}
+
+	return err
+}
+
+func (s BotService) generateRecallPrompt(note *storage.Note) error {
+	if note.Prompt != "" {
+		return nil
+	}
+
+	recallPrompt, err := llm.GenerateRecallPrompt(s.highlightOf(note))
+
+	if err != nil {
+		return err
+	}
+
+	_, err = s.repo.UpdateNote(int(note.ID), storage.Note{Prompt: recallPrompt.Prompt})
+
+	return err
+}
+
+// SetSourceCloze turns cloze questions on or off for a source. Turning them
+// on queues the questions of its upcoming notes.
+func (s BotService) SetSourceCloze(sourceID int, enabled bool) (storage.Source, error) {
+	if err := s.repo.SetSourceCloze(sourceID, enabled); err != nil {
+		return storage.Source{}, err
+	}
+
+	if enabled {
+		if _, err := s.EnqueueUpcoming(); err != nil {
+			log.Printf("Failed to queue cloze questions of source %v: %v", sourceID, err)
+		}
+	}
+
+	return s.repo.GetSource(sourceID)
+}
+
+// SetSourceSystemPrompt sets the instructions given to the LLM for the
+// questions of a source. Existing questions are kept.
+func (s BotService) SetSourceSystemPrompt(sourceID int, prompt string) (storage.Source, error) {
+	if err := s.repo.SetSourceSystemPrompt(sourceID, prompt); err != nil {
+		return storage.Source{}, err
+	}
+
+	return s.repo.GetSource(sourceID)
+}
@@ -0,0 +1,142 @@
+package bot
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/amalrajan30/spacedgram/internal/storage"
+)
+
+func TestRunGenerationJob(t *testing.T) {
+	s, db := testService(t)
+	fake := useFakeProvider(t)
+	source := testSource(t, db, storage.Source{})
+
+	note := storage.Note{Content: "Rome is the capital of Italy", SourceID: int(source.ID)}
+
+	if err := db.Create(&note).Error; err != nil {
+		t.Fatalf("failed to create note: %v", err)
+	}
+
+	t.Cleanup(func() {
+		db.Unscoped().Where("note_id = ?", note.ID).Delete(&storage.Card{})
+	})
+
+	for _, job := range []storage.GenerationJob{
+		{NoteID: int(note.ID), Kind: storage.GenerationKindCloze},
+		{NoteID: int(note.ID), Kind: storage.GenerationKindPrompt},
+		{NoteID: int(note.ID), Kind: storage.GenerationKindCard, CardType: storage.CardTypeOpen},
+	} {
+		if err := s.RunGenerationJob(job); err != nil {
+			t.Fatalf("RunGenerationJob(%v %v) failed: %v", job.Kind, job.CardType, err)
+		}
+	}
+
+	generated, err := s.repo.GetNote(int(note.ID))
+
+	if err != nil {
+		t.Fatalf("GetNote failed: %v", err)
+	}
+
+	if generated.Question == "" || generated.Prompt == "" {
+		t.Errorf("note = %+v, want its cloze question and prompt generated", generated)
+	}
+
+	if types, err := s.repo.GetCardTypes(int(note.ID)); err != nil || len(types) != 1 || types[0] != storage.CardTypeOpen {
+		t.Errorf("card types = %v (%v), want the open card", types, err)
+	}
+
+	calls := len(fake.Calls())
+
+	// Jobs of questions generated in the meantime have nothing left to do
+	for _, job := range []storage.GenerationJob{
+		{NoteID: int(note.ID), Kind: storage.GenerationKindCloze},
+		{NoteID: int(note.ID), Kind: storage.GenerationKindCard, CardType: storage.CardTypeOpen},
+	} {
+		if err := s.RunGenerationJob(job); err != nil {
+			t.Fatalf("RunGenerationJob(%v %v) failed: %v", job.Kind, job.CardType, err)
+		}
+	}
+
+	if got := len(fake.Calls()); got != calls {
+		t.Errorf("provider called %v more times, want none", got-calls)
+	}
+
+	if err := s.RunGenerationJob(storage.GenerationJob{NoteID: int(note.ID), Kind: "essay"}); err == nil {
+		t.Error("RunGenerationJob accepted an unknown kind")
+	}
+}
+
+func TestHighlightOf(t *testing.T) {
+	s, db := testService(t)
+	source := testSource(t, db, storage.Source{Author: "Marcus Aurelius", SystemPrompt: "Ask in Latin"})
+
+	notes := []storage.Note{}
+	for _, location := range []string{"Location 300", "20", "1000", "100", "5", ""} {
+		note := storage.Note{Content: "Highlight at " + location, Location: location, SourceID: int(source.ID)}
+
+		if err := db.Create(&note).Error; err != nil {
+			t.Fatalf("failed to create note: %v", err)
+		}
+
+		notes = append(notes, note)
+	}
+
+	// Locations are compared as numbers, the one without counting as 0
+	highlight := s.highlightOf(&notes[3])
+
+	if highlight.Title != source.Title || highlight.Author != "Marcus Aurelius" || highlight.Location != "100" || highlight.SystemPrompt != "Ask in Latin" {
+		t.Errorf("highlight = %+v, want the source's metadata", highlight)
+	}
+
+	if want := []string{"Highlight at 5", "Highlight at 20"}; !slices.Equal(highlight.Before, want) {
+		t.Errorf("highlights before = %v, want %v", highlight.Before, want)
+	}
+
+	if want := []string{"Highlight at Location 300", "Highlight at 1000"}; !slices.Equal(highlight.After, want) {
+		t.Errorf("highlights after = %v, want %v", highlight.After, want)
+	}
+
+	highlight = s.highlightOf(&notes[5])
+
+	if len(highlight.Before) != 0 {
+		t.Errorf("highlights before the first = %v, want none", highlight.Before)
+	}
+
+	if want := []string{"Highlight at 5", "Highlight at 20"}; !slices.Equal(highlight.After, want) {
+		t.Errorf("highlights after the first = %v, want %v", highlight.After, want)
+	}
+}
+
+func TestSetSourceSystemPrompt(t *testing.T) {
+	s, db := testService(t)
+	fake := useFakeProvider(t)
+	source := testSource(t, db, storage.Source{})
+
+	updated, err := s.SetSourceSystemPrompt(int(source.ID), "Focus on dates")
+
+	if err != nil {
+		t.Fatalf("SetSourceSystemPrompt failed: %v", err)
+	}
+
+	if updated.SystemPrompt != "Focus on dates" {
+		t.Errorf("system prompt = %q, want %q", updated.SystemPrompt, "Focus on dates")
+	}
+
+	note := storage.Note{Content: "Rome was founded in 753 BC", SourceID: int(source.ID)}
+
+	if err := db.Create(&note).Error; err != nil {
+		t.Fatalf("failed to create note: %v", err)
+	}
+
+	if err := s.RunGenerationJob(storage.GenerationJob{NoteID: int(note.ID), Kind: storage.GenerationKindCloze}); err != nil {
+		t.Fatalf("RunGenerationJob failed: %v", err)
+	}
+
+	calls := fake.Calls()
+
+	if len(calls) == 0 || !strings.HasSuffix(calls[len(calls)-1].SystemPrompt, "Focus on dates") {
+		t.Errorf("calls = %+v, want the source's prompt in the system prompt", calls)
+	}
+}
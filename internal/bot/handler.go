@@ -3,23 +3,81 @@ package bot
 import (
 	"errors"
 	"fmt"
+	"html"
 	"log"
+	"math/rand"
 	"os"
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/PaulSonOfLars/gotgbot/v2"
 	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+	"github.com/amalrajan30/spacedgram/internal/storage"
 	"gorm.io/gorm"
 )
 
+// ReminderScheduler reschedules a user's reminders after their settings
+// change or when a reminder gets snoozed
+type ReminderScheduler interface {
+	ScheduleUser(settings storage.UserSettings) error
+	Snooze(userID int64, until time.Time)
+}
+
+// Number of ratings that can be undone in a session
+const maxUndo = 10
+
 type BotHandler struct {
-	service *BotService
+	service   *BotService
+	reminders ReminderScheduler
 
 	rwMux    sync.RWMutex
 	userData map[string]int
 	notes    []int
+	// Review logs of the latest ratings of the session, newest last
+	undo []uint
+	// When the prompt of the current card was shown
+	shownAt time.Time
+	// Text awaited for a note, by chat
+	pending map[int64]pendingInput
+	// Quiz polls of the session waiting for an answer, by poll id
+	quizzes map[string]quizPoll
+	// Latest /find query, by chat
+	finds map[int64]findQuery
+	// Notes being written with /add, by chat
+	drafts map[int64]noteDraft
+	// Notes whose content is being edited, by chat
+	editing map[int64]int
+	// Forwarded messages waiting to be saved, by message id
+	forwards map[int64]storage.Note
+	// Sources being renamed, by chat
+	renaming map[int64]int
+	// Latest message sent with a keyboard, i.e. the card on screen, by chat
+	cardMessages map[int64]int64
+	// States of the conversations, ended when another flow starts
+	conversations []*conversationStates
+}
+
+// Kinds of text the bot can wait for in a chat
+const (
+	inputAnswer = iota + 1
+	inputEdit
+	inputRewrite
+)
+
+// pendingInput is the text awaited in a chat: the typed answer of a card, an
+// edited cloze question or a rewritten leech. A chat waits for one at a
+// time, starting another flow replaces it.
+type pendingInput struct {
+	Kind   int
+	NoteID int
+}
+
+type quizPoll struct {
+	NoteID        int
+	ChatID        int64
+	CorrectOption int64
 }
 
 func checkUser(from int64) bool {
@@ -59,9 +117,128 @@ func (handler *BotHandler) getUserData(key string) (int, bool) {
 	return val, err
 }
 
-func NewBotHandler(service *BotService) *BotHandler {
+func (handler *BotHandler) pushUndo(reviewLogID uint) {
+	handler.rwMux.Lock()
+	defer handler.rwMux.Unlock()
+
+	handler.undo = append(handler.undo, reviewLogID)
+
+	if len(handler.undo) > maxUndo {
+		handler.undo = handler.undo[len(handler.undo)-maxUndo:]
+	}
+}
+
+func (handler *BotHandler) popUndo() (uint, bool) {
+	handler.rwMux.Lock()
+	defer handler.rwMux.Unlock()
+
+	if len(handler.undo) == 0 {
+		return 0, false
+	}
+
+	reviewLogID := handler.undo[len(handler.undo)-1]
+	handler.undo = handler.undo[:len(handler.undo)-1]
+
+	return reviewLogID, true
+}
+
+func (handler *BotHandler) setShownAt(at time.Time) {
+	handler.rwMux.Lock()
+	defer handler.rwMux.Unlock()
+
+	handler.shownAt = at
+}
+
+func (handler *BotHandler) getShownAt() time.Time {
+	handler.rwMux.RLock()
+	defer handler.rwMux.RUnlock()
+
+	return handler.shownAt
+}
+
+func (handler *BotHandler) setPending(chatID int64, kind int, noteID int) {
+	handler.endFlows(chatID)
+
+	handler.rwMux.Lock()
+	defer handler.rwMux.Unlock()
+
+	if handler.pending == nil {
+		handler.pending = map[int64]pendingInput{}
+	}
+
+	handler.pending[chatID] = pendingInput{Kind: kind, NoteID: noteID}
+}
+
+// takePending returns the note whose text of that kind is awaited in the
+// chat, if any, and stops waiting for it
+func (handler *BotHandler) takePending(chatID int64, kind int) (int, bool) {
+	handler.rwMux.Lock()
+	defer handler.rwMux.Unlock()
+
+	pending, ok := handler.pending[chatID]
+
+	if !ok || pending.Kind != kind {
+		return 0, false
+	}
+
+	delete(handler.pending, chatID)
+
+	return pending.NoteID, true
+}
+
+// isPending filters the text messages awaited as the given kind
+func (handler *BotHandler) isPending(msg *gotgbot.Message, kind int) bool {
+	handler.rwMux.RLock()
+	defer handler.rwMux.RUnlock()
+
+	pending, ok := handler.pending[msg.Chat.Id]
+
+	return ok && pending.Kind == kind && msg.Text != "" && !strings.HasPrefix(msg.Text, "/")
+}
+
+func (handler *BotHandler) setAwaitingAnswer(chatID int64, noteID int) {
+	handler.setPending(chatID, inputAnswer, noteID)
+}
+
+func (handler *BotHandler) takeAwaitingAnswer(chatID int64) (int, bool) {
+	return handler.takePending(chatID, inputAnswer)
+}
+
+// IsAwaitingAnswer filters the messages answering a typed cloze question
+func (handler *BotHandler) IsAwaitingAnswer(msg *gotgbot.Message) bool {
+	return handler.isPending(msg, inputAnswer)
+}
+
+func (handler *BotHandler) setAwaitingEdit(chatID int64, noteID int) {
+	handler.setPending(chatID, inputEdit, noteID)
+}
+
+func (handler *BotHandler) takeAwaitingEdit(chatID int64) (int, bool) {
+	return handler.takePending(chatID, inputEdit)
+}
+
+// IsAwaitingEdit filters the messages replacing a cloze question
+func (handler *BotHandler) IsAwaitingEdit(msg *gotgbot.Message) bool {
+	return handler.isPending(msg, inputEdit)
+}
+
+// startSession sets the notes of a new review session and resets its cursor
+func (handler *BotHandler) startSession(noteIDs []int, count int) {
+	handler.setUserData("notes_count", count)
+	handler.setUserData("skip", 0)
+
+	handler.rwMux.Lock()
+	handler.notes = noteIDs
+	handler.undo = nil
+	handler.pending = nil
+	handler.quizzes = nil
+	handler.rwMux.Unlock()
+}
+
+func NewBotHandler(service *BotService, reminders ReminderScheduler) *BotHandler {
 	return &BotHandler{
-		service: service,
+		service:   service,
+		reminders: reminders,
 	}
 }
 
@@ -92,16 +269,46 @@ var reviewButtons = []reviewButton{
 	{Text: "Complete Blackout", Score: 0},
 }
 
-func (h *BotHandler) buildReviewKeyboard(noteID int64) gotgbot.InlineKeyboardMarkup {
+func undoKeyboard() gotgbot.InlineKeyboardMarkup {
+	return gotgbot.InlineKeyboardMarkup{
+		InlineKeyboard: [][]gotgbot.InlineKeyboardButton{{
+			{
+				Text:         "↩️ Undo",
+				CallbackData: "undo",
+			},
+		}},
+	}
+}
+
+// buildReviewKeyboard builds the grading keyboard of a note, followed by a
+// row to suspend, bury, delete or edit it. Cards revealed after a prompt pass
+// the time it took to reveal them, 0 otherwise.
+func (h *BotHandler) buildReviewKeyboard(noteID int64, revealMs int64) gotgbot.InlineKeyboardMarkup {
+	keyboard := h.buildGradeKeyboard("review", noteID, revealMs)
+	keyboard.InlineKeyboard = append(keyboard.InlineKeyboard, noteActionsRow(noteID))
+
+	return keyboard
+}
+
+// buildGradeKeyboard builds a grading keyboard whose callbacks start with
+// prefix, "review" for notes and "card" for cards
+func (h *BotHandler) buildGradeKeyboard(prefix string, id int64, revealMs int64) gotgbot.InlineKeyboardMarkup {
 	var keyboardRows [][]gotgbot.InlineKeyboardButton
 
 	for _, button := range reviewButtons {
+		callbackData := fmt.Sprintf("%v_%v_%v", prefix, id, button.Score)
+		if revealMs > 0 {
+			callbackData = fmt.Sprintf("%v_%v", callbackData, revealMs)
+		}
+
 		keyboardRows = append(keyboardRows, []gotgbot.InlineKeyboardButton{{
 			Text:         button.Text,
-			CallbackData: fmt.Sprintf("review_%v_%v", noteID, button.Score),
+			CallbackData: callbackData,
 		}})
 	}
 
+	keyboardRows = append(keyboardRows, undoKeyboard().InlineKeyboard...)
+
 	return gotgbot.InlineKeyboardMarkup{
 		InlineKeyboard: keyboardRows,
 	}
@@ -113,17 +320,31 @@ func (handler *BotHandler) ListTopics(b *gotgbot.Bot, ctx *ext.Context) error {
 		return nil
 	}
 
-	fmt.Println("Got list all topic")
+	sources, err := handler.service.GetSourceSummaries()
 
-	sources := handler.service.repo.GetSources()
+	if err != nil {
+		log.Printf("Failed to get sources: %v", err)
+		_, err = ctx.EffectiveMessage.Reply(b, "Failed to get sources", nil)
+		return err
+	}
 
 	msg := ""
+	position := 0
 
-	for i, source := range sources {
-		msg = msg + fmt.Sprintf("%v) %v \n", i+1, source)
+	for _, source := range sources {
+		if source.Archived {
+			continue
+		}
+
+		position++
+		msg = msg + fmt.Sprintf("%v) %s · %v notes\n", position, html.EscapeString(source.Title), source.TotalNotes)
 	}
 
-	_, err := ctx.EffectiveMessage.Reply(b, msg, &gotgbot.SendMessageOpts{
+	if msg == "" {
+		msg = "No sources yet, /sync your highlights or /add a note"
+	}
+
+	_, err = ctx.EffectiveMessage.Reply(b, msg, &gotgbot.SendMessageOpts{
 		ParseMode: "HTML",
 	})
 
@@ -226,16 +447,24 @@ func (h *BotHandler) HandleSelectSourceCallback(b *gotgbot.Bot, ctx *ext.Context
 	h.setUserData("source_id", int(source.ID))
 
 	keyboard := gotgbot.InlineKeyboardMarkup{
-		InlineKeyboard: [][]gotgbot.InlineKeyboardButton{{
+		InlineKeyboard: [][]gotgbot.InlineKeyboardButton{
 			{
-				Text:         "Start Review",
-				CallbackData: "start_review",
+				{
+					Text:         "Start Review",
+					CallbackData: "start_review",
+				},
+				{
+					Text:         "Reset",
+					CallbackData: "reset",
+				},
 			},
 			{
-				Text:         "Reset",
-				CallbackData: "reset",
+				{
+					Text:         "🃏 Card types",
+					CallbackData: "cardtypes",
+				},
 			},
-		}},
+		},
 	}
 
 	if err := h.editMessage(b, cb.Message, fmt.Sprintf(
@@ -243,7 +472,7 @@ func (h *BotHandler) HandleSelectSourceCallback(b *gotgbot.Bot, ctx *ext.Context
 			"━━━━━━━━━━━━━━\n"+
 			"<b>Title:</b> %s\n"+
 			"<b>Notes:</b> %v",
-		source.Title,
+		html.EscapeString(source.Title),
 		source.TotalNotes,
 	), &gotgbot.EditMessageTextOpts{
 		ReplyMarkup: keyboard,
@@ -274,22 +503,42 @@ func (h *BotHandler) StartReview(b *gotgbot.Bot, ctx *ext.Context) error {
 
 	status, err := h.service.ClozeStatus(id)
 
+	if err != nil {
+		log.Printf("Failed to get cloze status of source %v: %v", id, err)
+	}
+
+	// Sources with cloze questions enabled skip the choice
 	if status {
-		ctx.CallbackQuery.Data = "cloze_yes"
-		h.ClozeQuestion(b, ctx)
+		return h.startReview(b, ctx, reviewModeCloze)
 	}
 
 	keyboard := gotgbot.InlineKeyboardMarkup{
-		InlineKeyboard: [][]gotgbot.InlineKeyboardButton{{
+		InlineKeyboard: [][]gotgbot.InlineKeyboardButton{
 			{
-				Text:         "Yes",
-				CallbackData: "cloze_yes",
+				{
+					Text:         "Yes",
+					CallbackData: "cloze_yes",
+				},
+				{
+					Text:         "No",
+					CallbackData: "cloze_no",
+				},
 			},
 			{
-				Text:         "No",
-				CallbackData: "cloze_no",
+				{
+					Text:         "Type answers",
+					CallbackData: "cloze_typed",
+				},
+				{
+					Text:         "Quiz",
+					CallbackData: "cloze_quiz",
+				},
+				{
+					Text:         "Cards",
+					CallbackData: "cloze_cards",
+				},
 			},
-		}},
+		},
 	}
 
 	if err := h.editMessage(b, cb.Message, "Want to use cloze style questions?", &gotgbot.EditMessageTextOpts{
@@ -320,12 +569,29 @@ func (h *BotHandler) ClozeQuestion(b *gotgbot.Bot, ctx *ext.Context) error {
 		return fmt.Errorf("failed to answer callback query: %w", err)
 	}
 
-	if strings.Split(data, "_")[1] == "yes" {
-		h.setUserData("clozeQuestion", 1)
-	} else {
-		h.setUserData("clozeQuestion", 0)
+	mode := reviewModePlain
+
+	switch strings.Split(data, "_")[1] {
+	case "yes":
+		mode = reviewModeCloze
+	case "typed":
+		mode = reviewModeTyped
+	case "quiz":
+		mode = reviewModeQuiz
+	case "cards":
+		mode = reviewModeCards
 	}
 
+	return h.startReview(b, ctx, mode)
+}
+
+// startReview starts a review session of the selected source showing notes
+// in the given mode
+func (h *BotHandler) startReview(b *gotgbot.Bot, ctx *ext.Context, mode int) error {
+	cb := ctx.Update.CallbackQuery
+
+	h.setUserData("clozeQuestion", mode)
+
 	id, not_found := h.getUserData("source_id")
 
 	if not_found {
@@ -334,7 +600,15 @@ func (h *BotHandler) ClozeQuestion(b *gotgbot.Bot, ctx *ext.Context) error {
 
 	log.Printf("Got book to start review: %v\n", id)
 
-	session, err := h.service.StartSourceReview(id)
+	var session *ReviewSession
+	var err error
+
+	if mode == reviewModeCards {
+		session, err = h.service.StartCardReview(cb.From.Id, id)
+	} else {
+		session, err = h.service.StartSourceReview(cb.From.Id, id)
+	}
+
 	if err != nil {
 		switch {
 		case errors.Is(err, gorm.ErrRecordNotFound):
@@ -345,26 +619,43 @@ func (h *BotHandler) ClozeQuestion(b *gotgbot.Bot, ctx *ext.Context) error {
 		}
 	}
 
+	if session.Count == 0 {
+		return h.editMessage(b, cb.Message, fmt.Sprintf(
+			"No notes left to review today from %s%s",
+			html.EscapeString(session.Source.Title),
+			formatHeldBack(session.HeldBack),
+		), nil)
+	}
+
 	if err := h.editMessage(b, cb.Message, fmt.Sprintf(
 		"📚 <b>Starting Review</b>\n"+
 			"━━━━━━━━━━━━━━\n"+
 			"<b>Book:</b> %s\n"+
-			"<b>Notes:</b> %v",
-		session.Source.Title,
+			"<b>Notes:</b> %v\n"+
+			"<b>Today:</b> %v%s",
+		html.EscapeString(session.Source.Title),
 		session.Source.TotalNotes,
+		session.Count,
+		formatHeldBack(session.HeldBack),
 	), nil); err != nil {
 		return fmt.Errorf("editing message: %w", err)
 	}
 
-	h.setUserData("notes_count", session.Count)
-	h.setUserData("skip", 0)
-	h.notes = session.NoteIDs
+	h.startSession(session.NoteIDs, session.Count)
 
 	h.HandleReviews(b, ctx)
 
 	return nil
 }
 
+func formatHeldBack(heldBack int) string {
+	if heldBack == 0 {
+		return ""
+	}
+
+	return fmt.Sprintf("\n<i>%v notes held back by daily limits</i>", heldBack)
+}
+
 func (h *BotHandler) HandleReviews(b *gotgbot.Bot, ctx *ext.Context) error {
 
 	if !checkUser(ctx.Update.CallbackQuery.From.Id) {
@@ -382,12 +673,87 @@ func (h *BotHandler) HandleReviews(b *gotgbot.Bot, ctx *ext.Context) error {
 		return fmt.Errorf("Failed to answer callback query: %v", err)
 	}
 
+	return h.showReview(b, cb.From.Id, cb.Message.GetChat().Id, cb.Message, data)
+}
+
+// sendOrEdit edits msg, or sends a new message to the chat when there is no
+// message to edit
+func (h *BotHandler) sendOrEdit(b *gotgbot.Bot, chatID int64, msg gotgbot.MaybeInaccessibleMessage, text string, keyboard *gotgbot.InlineKeyboardMarkup) error {
+	if msg != nil {
+		opts := &gotgbot.EditMessageTextOpts{
+			ParseMode: "HTML",
+		}
+		if keyboard != nil {
+			opts.ReplyMarkup = *keyboard
+			h.setCardMessage(chatID, msg.GetMessageId())
+		}
+		return h.editMessage(b, msg, text, opts)
+	}
+
+	opts := &gotgbot.SendMessageOpts{
+		ParseMode: "HTML",
+	}
+	if keyboard != nil {
+		opts.ReplyMarkup = *keyboard
+	}
+
+	sent, err := b.SendMessage(chatID, text, opts)
+
+	if err != nil {
+		return fmt.Errorf("failed to send message: %w", err)
+	}
+
+	if keyboard != nil {
+		h.setCardMessage(chatID, sent.MessageId)
+	}
+
+	return nil
+}
+
+func (h *BotHandler) setCardMessage(chatID int64, messageID int64) {
+	h.rwMux.Lock()
+	defer h.rwMux.Unlock()
+
+	if h.cardMessages == nil {
+		h.cardMessages = map[int64]int64{}
+	}
+
+	h.cardMessages[chatID] = messageID
+}
+
+// clearCardKeyboard removes the buttons of the card on screen, once they no
+// longer act on the card shown
+func (h *BotHandler) clearCardKeyboard(b *gotgbot.Bot, chatID int64) {
+	h.rwMux.Lock()
+	messageID, ok := h.cardMessages[chatID]
+	delete(h.cardMessages, chatID)
+	h.rwMux.Unlock()
+
+	if !ok {
+		return
+	}
+
+	_, _, err := b.EditMessageReplyMarkup(&gotgbot.EditMessageReplyMarkupOpts{
+		ChatId:    chatID,
+		MessageId: messageID,
+	})
+
+	if err != nil {
+		log.Printf("Failed to clear keyboard of card %v: %v", messageID, err)
+	}
+}
+
+// showReview handles the rating carried by data, if any, and sends the note
+// at the session cursor. msg is the message that triggered it, replaced by
+// the new card, or nil when the review is continued from a command.
+func (h *BotHandler) showReview(b *gotgbot.Bot, userID int64, chatID int64, msg gotgbot.MaybeInaccessibleMessage, data string) error {
+
 	skip, skipNotFound := h.getUserData("skip")
 	// notes_count, not_found := h.getUserData("notes_count")
 
 	if !skipNotFound {
 		log.Printf("Not found hit: %v", skip)
-		return h.editMessage(b, cb.Message, "Got invalid response", nil)
+		return h.sendOrEdit(b, chatID, msg, "Got invalid response", nil)
 	}
 
 	fmt.Printf("Notes : %v \n", h.notes)
@@ -396,37 +762,107 @@ func (h *BotHandler) HandleReviews(b *gotgbot.Bot, ctx *ext.Context) error {
 
 	fmt.Printf("Claze enabled: %v \n", clazeEnabled)
 
-	state, err := h.service.ProcessReview(h.notes, skip, data, clazeEnabled == 1)
+	state, err := h.service.ProcessReview(userID, h.notes, skip, data, clazeEnabled)
 
 	if err != nil {
 		log.Printf("Error processing review: %v", err)
-		return h.editMessage(b, cb.Message, "Something went wrong while processing review", nil)
+		return h.sendOrEdit(b, chatID, msg, "Something went wrong while processing review", nil)
+	}
+
+	if state.ReviewLogID != 0 {
+		h.pushUndo(state.ReviewLogID)
+	}
+
+	if state.LeechID != 0 {
+		h.sendLeechNotice(b, chatID, state.LeechID)
 	}
 
 	if state.IsComplete {
 		log.Printf("Review completed")
-		return h.editMessage(b, cb.Message, "Review complete", nil)
+		keyboard := undoKeyboard()
+		return h.sendOrEdit(b, chatID, msg, "Review complete", &keyboard)
 	}
 
+	// Commands like /tag act on the card shown last
+	h.setUserData("current_note", int(state.NoteToReview.ID))
+
 	// Delete the previous message to avoid spoiler reveal issues
-	_, err = cb.Message.Delete(b, nil)
-	if err != nil {
-		log.Printf("Error deleting previous message: %v", err)
+	if msg != nil {
+		_, err = msg.Delete(b, nil)
+		if err != nil {
+			log.Printf("Error deleting previous message: %v", err)
+		}
 	}
 
 	var noteText string
+	var keyboard gotgbot.InlineKeyboardMarkup
 
-	if clazeEnabled == 0 {
+	switch state.Mode {
+	case reviewModePlain:
 		noteText = fmt.Sprintf(
 			"📝 <b>Note #%v/%v</b>\n\n"+
+				"<i>%s</i>\n\n"+
+				"📚 <i>From:</i> %v",
+			skip+1,
+			len(h.notes),
+			html.EscapeString(state.Prompt),
+			html.EscapeString(state.NoteToReview.Source.Title),
+		)
+
+		keyboard = gotgbot.InlineKeyboardMarkup{
+			InlineKeyboard: append([][]gotgbot.InlineKeyboardButton{{
+				{
+					Text:         "👁 Show",
+					CallbackData: fmt.Sprintf("reveal_%v", state.NoteToReview.ID),
+				},
+			}}, undoKeyboard().InlineKeyboard...),
+		}
+	case reviewModeTyped:
+		noteText = fmt.Sprintf(
+			"📝 <b>Note #%v/%v</b>\n\n"+
+				"Question: %s\n\n"+
+				"✍️ <i>Reply with your answer</i>\n\n"+
+				"📚 <i>From:</i> %v",
+			skip+1,
+			len(h.notes),
+			html.EscapeString(state.NoteToReview.Question),
+			html.EscapeString(state.NoteToReview.Source.Title),
+		)
+
+		keyboard = gotgbot.InlineKeyboardMarkup{
+			InlineKeyboard: append([][]gotgbot.InlineKeyboardButton{{
+				{
+					Text:         "🤷 Show answer",
+					CallbackData: fmt.Sprintf("typed_skip_%v", state.NoteToReview.ID),
+				},
+			}}, undoKeyboard().InlineKeyboard...),
+		}
+
+		h.setAwaitingAnswer(chatID, int(state.NoteToReview.ID))
+	case reviewModeQuiz:
+		if err := h.sendQuiz(b, chatID, skip+1, state.NoteToReview); err != nil {
+			return err
+		}
+
+		h.setUserData("skip", skip+1)
+
+		return nil
+	case reviewModeCards:
+		noteText = fmt.Sprintf(
+			"🃏 <b>Card #%v/%v</b> · <i>%v</i>\n\n"+
 				"%s\n\n"+
+				"Answer: <span class=\"tg-spoiler\">%s</span>\n\n"+
 				"📚 <i>From:</i> %v",
 			skip+1,
 			len(h.notes),
-			state.NoteToReview.Content,
-			state.NoteToReview.Source.Title,
+			state.CardToReview.Type,
+			html.EscapeString(state.CardToReview.Question),
+			html.EscapeString(state.CardToReview.Answer),
+			html.EscapeString(state.NoteToReview.Source.Title),
 		)
-	} else {
+
+		keyboard = h.buildGradeKeyboard("card", int64(state.CardToReview.ID), 0)
+	default:
 		noteText = fmt.Sprintf(
 			"📝 <b>Note #%v/%v</b>\n\n"+
 				"Question: %s\n\n"+
@@ -434,22 +870,31 @@ func (h *BotHandler) HandleReviews(b *gotgbot.Bot, ctx *ext.Context) error {
 				"📚 <i>From:</i> %v",
 			skip+1,
 			len(h.notes),
-			state.NoteToReview.Question,
-			state.NoteToReview.Answer,
-			state.NoteToReview.Source.Title,
+			html.EscapeString(state.NoteToReview.Question),
+			html.EscapeString(state.NoteToReview.Answer),
+			html.EscapeString(state.NoteToReview.Source.Title),
 		)
+
+		keyboard = h.buildReviewKeyboard(int64(state.NoteToReview.ID), 0)
+		keyboard.InlineKeyboard = append(keyboard.InlineKeyboard, questionFeedbackRow(state.NoteToReview.ID))
 	}
 
-	keyboard := h.buildReviewKeyboard(int64(state.NoteToReview.ID))
+	keyboard.InlineKeyboard = append(keyboard.InlineKeyboard, relatedRow(state.NoteToReview.ID))
 
-	if _, keyboardErr := b.SendMessage(cb.Message.GetChat().Id, noteText, &gotgbot.SendMessageOpts{
+	sent, keyboardErr := b.SendMessage(chatID, noteText, &gotgbot.SendMessageOpts{
 		ReplyMarkup: keyboard,
 		ParseMode:   "HTML",
-	}); keyboardErr != nil {
+	})
+
+	if keyboardErr != nil {
 		log.Printf("Error while sending review keyboard: %v", keyboardErr)
 		return fmt.Errorf("editing message with note: %w", keyboardErr)
 	}
 
+	h.setCardMessage(chatID, sent.MessageId)
+
+	h.setShownAt(time.Now())
+
 	h.setUserData("skip", skip+1)
 
 	return nil
@@ -508,7 +953,7 @@ func (h *BotHandler) StartReviewScheduled(b *gotgbot.Bot, ctx *ext.Context) erro
 		return fmt.Errorf("failed to answer callback query: %w", err)
 	}
 
-	session, err := h.service.ScheduledReview()
+	session, err := h.service.ScheduledReview(cb.From.Id)
 
 	if err != nil {
 		log.Printf("Failed to start review: %v", err)
@@ -517,20 +962,657 @@ func (h *BotHandler) StartReviewScheduled(b *gotgbot.Bot, ctx *ext.Context) erro
 
 	if session.Count == 0 {
 		log.Printf("No notes to review today")
-		return h.editMessage(b, cb.Message, "No Notes left to review today!", nil)
+		return h.editMessage(b, cb.Message, "No Notes left to review today!"+formatHeldBack(session.HeldBack), nil)
 	}
 
 	if err := h.editMessage(b, cb.Message, fmt.Sprintf(
-		"Total review for today: %v",
+		"Total review for today: %v%s",
 		session.Count,
+		formatHeldBack(session.HeldBack),
 	), nil); err != nil {
 		return fmt.Errorf("editing message: %w", err)
 	}
 
-	h.setUserData("notes_count", session.Count)
-	h.setUserData("skip", 0)
-	h.notes = session.NoteIDs
+	h.startSession(session.NoteIDs, session.Count)
 
 	h.HandleReviews(b, ctx)
 	return nil
 }
+
+func formatToggle(enabled bool) string {
+	if enabled {
+		return "on"
+	}
+	return "off"
+}
+
+func formatSettings(settings storage.UserSettings) string {
+	reminders := strings.Join(settings.Reminders(), ", ")
+
+	if reminders == "" {
+		reminders = "off"
+	}
+
+	return fmt.Sprintf(
+		"⚙️ <b>Settings</b>\n"+
+			"━━━━━━━━━━━━━━\n"+
+			"<b>Timezone:</b> %s\n"+
+			"<b>Reminders:</b> %s\n"+
+			"<b>Day starts at:</b> %02d:00\n"+
+			"<b>New cards per day:</b> %v\n"+
+			"<b>Reviews per day:</b> %v\n"+
+			"<b>Queue order:</b> %v\n"+
+			"<b>Prompt:</b> %v\n"+
+			"<b>LLM judge:</b> %v\n"+
+			"<b>LLM budget:</b> %v a day, %v a month\n"+
+			"<b>Leeches:</b> after %v lapses, %v\n\n"+
+			"<code>/settings timezone Europe/Berlin</code>\n"+
+			"<code>/settings reminders 08:00 20:30</code>\n"+
+			"<code>/settings reminders off</code>\n"+
+			"<code>/settings rollover 4</code>\n"+
+			"<code>/settings newcards 20</code>\n"+
+			"<code>/settings reviews 200</code>\n"+
+			"<code>/settings source &lt;id&gt; newcards 10|default</code>\n"+
+			"<code>/settings source &lt;id&gt; reviews 50|default</code>\n"+
+			"<code>/settings source &lt;id&gt; cloze on|off</code>\n"+
+			"<code>/settings source &lt;id&gt; system &lt;instructions&gt;|default</code>\n"+
+			"<code>/settings order %s</code>\n"+
+			"<code>/settings prompt %s</code>\n"+
+			"<code>/settings judge on|off</code>\n"+
+			"<code>/settings budget daily|monthly 0.50|off</code>\n"+
+			"<code>/settings leech 8</code>\n"+
+			"<code>/settings leech %s</code>",
+		settings.Timezone,
+		reminders,
+		settings.RolloverHour,
+		settings.NewCardsPerDay,
+		settings.MaxReviewsPerDay,
+		settings.QueueOrder,
+		settings.PromptStyle,
+		formatToggle(settings.LLMJudge),
+		formatBudget(settings.DailyBudget),
+		formatBudget(settings.MonthlyBudget),
+		settings.LeechThreshold,
+		settings.LeechAction,
+		strings.Join(storage.QueueOrders, "|"),
+		strings.Join(storage.PromptStyles, "|"),
+		strings.Join(storage.LeechActions, "|"),
+	)
+}
+
+func (h *BotHandler) Settings(b *gotgbot.Bot, ctx *ext.Context) error {
+
+	if !checkUser(ctx.Message.From.Id) {
+		return nil
+	}
+
+	userID := ctx.Message.From.Id
+	args := ctx.Args()[1:]
+
+	var settings storage.UserSettings
+	var err error
+
+	switch {
+	case len(args) == 0:
+		settings, err = h.service.GetSettings(userID)
+	case args[0] == "timezone" && len(args) == 2:
+		settings, err = h.service.SetTimezone(userID, args[1])
+	case args[0] == "reminders" && len(args) == 2 && args[1] == "off":
+		settings, err = h.service.SetReminderTimes(userID, nil)
+	case args[0] == "reminders" && len(args) > 1:
+		settings, err = h.service.SetReminderTimes(userID, args[1:])
+	case args[0] == "rollover" && len(args) == 2:
+		hour, convErr := strconv.Atoi(args[1])
+		if convErr != nil {
+			err = fmt.Errorf("rollover hour must be a number, got %q", args[1])
+			break
+		}
+		settings, err = h.service.SetRolloverHour(userID, hour)
+	case (args[0] == "newcards" || args[0] == "reviews") && len(args) == 2:
+		limit, convErr := strconv.Atoi(args[1])
+		if convErr != nil {
+			err = fmt.Errorf("limit must be a number, got %q", args[1])
+			break
+		}
+		if args[0] == "newcards" {
+			settings, err = h.service.SetDailyLimits(userID, &limit, nil)
+		} else {
+			settings, err = h.service.SetDailyLimits(userID, nil, &limit)
+		}
+	case args[0] == "order" && len(args) == 2:
+		settings, err = h.service.SetQueueOrder(userID, args[1])
+	case args[0] == "prompt" && len(args) == 2:
+		settings, err = h.service.SetPromptStyle(userID, args[1])
+	case args[0] == "judge" && len(args) == 2 && (args[1] == "on" || args[1] == "off"):
+		settings, err = h.service.SetLLMJudge(userID, args[1] == "on")
+	case args[0] == "budget" && len(args) == 3:
+		budget := 0.0
+		if args[2] != "off" {
+			parsed, convErr := strconv.ParseFloat(strings.TrimPrefix(args[2], "$"), 64)
+			if convErr != nil {
+				err = fmt.Errorf("budget must be an amount in USD or off, got %q", args[2])
+				break
+			}
+			budget = parsed
+		}
+		settings, err = h.service.SetBudget(userID, args[1], budget)
+	case args[0] == "leech" && len(args) == 2:
+		threshold, convErr := strconv.Atoi(args[1])
+		if convErr != nil {
+			settings, err = h.service.SetLeechAction(userID, args[1])
+			break
+		}
+		settings, err = h.service.SetLeechThreshold(userID, threshold)
+	case args[0] == "source" && len(args) >= 4:
+		return h.setSourceSetting(b, ctx, args[1], args[2], strings.Join(args[3:], " "))
+	default:
+		err = fmt.Errorf("unknown setting")
+	}
+
+	if err != nil {
+		log.Printf("Failed to update settings: %v", err)
+		_, replyErr := ctx.EffectiveMessage.Reply(b, fmt.Sprintf("Could not update settings: %v", err), nil)
+		return replyErr
+	}
+
+	if len(args) > 0 && h.reminders != nil {
+		if err := h.reminders.ScheduleUser(settings); err != nil {
+			log.Printf("Failed to reschedule reminders: %v", err)
+		}
+	}
+
+	_, err = ctx.EffectiveMessage.Reply(b, formatSettings(settings), &gotgbot.SendMessageOpts{
+		ParseMode: "HTML",
+	})
+
+	if err != nil {
+		return fmt.Errorf("Failed to send settings message: %w", err)
+	}
+
+	return nil
+}
+
+func formatLimit(limit *int) string {
+	if limit == nil {
+		return "default"
+	}
+	return strconv.Itoa(*limit)
+}
+
+func formatBudget(budget float64) string {
+	if budget <= 0 {
+		return "no cap"
+	}
+	return fmt.Sprintf("$%.2f", budget)
+}
+
+func formatSystemPrompt(prompt string) string {
+	if prompt == "" {
+		return "default"
+	}
+	return html.EscapeString(prompt)
+}
+
+func (h *BotHandler) setSourceSetting(b *gotgbot.Bot, ctx *ext.Context, sourceArg string, kind string, value string) error {
+	sourceID, err := strconv.Atoi(sourceArg)
+
+	if err != nil {
+		_, err = ctx.EffectiveMessage.Reply(b, fmt.Sprintf("Invalid source id %q", sourceArg), nil)
+		return err
+	}
+
+	source, err := h.service.repo.GetSource(sourceID)
+
+	if err != nil {
+		_, err = ctx.EffectiveMessage.Reply(b, "Could not find the specified book", nil)
+		return err
+	}
+
+	var limit *int
+
+	switch {
+	case kind == "system":
+		// Free text, checked by the service
+	case kind == "cloze":
+		if value != "on" && value != "off" {
+			_, err = ctx.EffectiveMessage.Reply(b, fmt.Sprintf("Cloze must be on or off, got %q", value), nil)
+			return err
+		}
+	case value != "default":
+		parsed, convErr := strconv.Atoi(value)
+		if convErr != nil {
+			_, err = ctx.EffectiveMessage.Reply(b, fmt.Sprintf("Limit must be a number or default, got %q", value), nil)
+			return err
+		}
+		limit = &parsed
+	}
+
+	switch kind {
+	case "newcards":
+		source, err = h.service.SetSourceLimits(sourceID, limit, source.MaxReviewsPerDay)
+	case "reviews":
+		source, err = h.service.SetSourceLimits(sourceID, source.NewCardsPerDay, limit)
+	case "cloze":
+		source, err = h.service.SetSourceCloze(sourceID, value == "on")
+	case "system":
+		if value == "default" {
+			value = ""
+		}
+		source, err = h.service.SetSourceSystemPrompt(sourceID, value)
+	default:
+		err = fmt.Errorf("unknown source setting %q", kind)
+	}
+
+	if err != nil {
+		log.Printf("Failed to update source settings: %v", err)
+		_, replyErr := ctx.EffectiveMessage.Reply(b, fmt.Sprintf("Could not update source: %v", err), nil)
+		return replyErr
+	}
+
+	_, err = ctx.EffectiveMessage.Reply(b, fmt.Sprintf(
+		"📚 <b>%s</b>\n"+
+			"<b>New cards per day:</b> %v\n"+
+			"<b>Reviews per day:</b> %v\n"+
+			"<b>Cloze questions:</b> %v\n"+
+			"<b>System prompt:</b> %s",
+		html.EscapeString(source.Title),
+		formatLimit(source.NewCardsPerDay),
+		formatLimit(source.MaxReviewsPerDay),
+		formatToggle(source.ClozeQuestion),
+		formatSystemPrompt(source.SystemPrompt),
+	), &gotgbot.SendMessageOpts{
+		ParseMode: "HTML",
+	})
+
+	if err != nil {
+		return fmt.Errorf("Failed to send source limits message: %w", err)
+	}
+
+	return nil
+}
+
+func (h *BotHandler) SnoozeReminder(b *gotgbot.Bot, ctx *ext.Context) error {
+
+	if !checkUser(ctx.Update.CallbackQuery.From.Id) {
+		return nil
+	}
+
+	cb := ctx.Update.CallbackQuery
+
+	_, err := cb.Answer(b, &gotgbot.AnswerCallbackQueryOpts{
+		Text: "Snoozing",
+	})
+
+	if err != nil {
+		return fmt.Errorf("failed to answer callback query: %w", err)
+	}
+
+	settings, err := h.service.GetSettings(cb.From.Id)
+
+	if err != nil {
+		log.Printf("Failed to get settings: %v", err)
+		return h.editMessage(b, cb.Message, "Failed to snooze reminder", nil)
+	}
+
+	now := time.Now()
+	var until time.Time
+
+	switch strings.TrimPrefix(cb.Data, "snooze_") {
+	case "30m":
+		until = now.Add(30 * time.Minute)
+	case "2h":
+		until = now.Add(2 * time.Hour)
+	case "tomorrow":
+		until = settings.FirstReminderTomorrow(now)
+	default:
+		return h.editMessage(b, cb.Message, "Got invalid response", nil)
+	}
+
+	h.reminders.Snooze(cb.From.Id, until)
+
+	return h.editMessage(b, cb.Message, fmt.Sprintf(
+		"⏰ Snoozed until %v",
+		until.In(settings.Location()).Format("Mon 15:04"),
+	), nil)
+}
+
+// undoLastReview restores the schedule of the latest rated note of the
+// session and moves the cursor back to show it again
+func (h *BotHandler) undoLastReview(b *gotgbot.Bot, userID int64, chatID int64, msg gotgbot.MaybeInaccessibleMessage) error {
+	reviewLogID, ok := h.popUndo()
+
+	if !ok {
+		return h.sendOrEdit(b, chatID, nil, "Nothing to undo", nil)
+	}
+
+	noteID, err := h.service.UndoReview(userID, reviewLogID)
+
+	if err != nil {
+		log.Printf("Failed to undo review: %v", err)
+		return h.sendOrEdit(b, chatID, nil, "Failed to undo the last rating", nil)
+	}
+
+	// Undoing from the command sends the card again, the one on screen would
+	// still rate the note the cursor moved away from
+	if msg == nil {
+		h.clearCardKeyboard(b, chatID)
+	}
+
+	skip, _ := h.getUserData("skip")
+	position := -1
+
+	for i := min(skip, len(h.notes)) - 1; i >= 0; i-- {
+		if h.notes[i] == noteID {
+			position = i
+			break
+		}
+	}
+
+	if position == -1 {
+		return h.sendOrEdit(b, chatID, msg, "Rating undone, the note is not part of this session anymore", nil)
+	}
+
+	h.setUserData("skip", position)
+
+	return h.showReview(b, userID, chatID, msg, "undo")
+}
+
+func (h *BotHandler) HandleUndo(b *gotgbot.Bot, ctx *ext.Context) error {
+
+	if !checkUser(ctx.Update.CallbackQuery.From.Id) {
+		return nil
+	}
+
+	cb := ctx.Update.CallbackQuery
+
+	_, err := cb.Answer(b, &gotgbot.AnswerCallbackQueryOpts{
+		Text: "Undoing",
+	})
+
+	if err != nil {
+		return fmt.Errorf("failed to answer callback query: %w", err)
+	}
+
+	return h.undoLastReview(b, cb.From.Id, cb.Message.GetChat().Id, cb.Message)
+}
+
+func (h *BotHandler) Undo(b *gotgbot.Bot, ctx *ext.Context) error {
+
+	if !checkUser(ctx.Message.From.Id) {
+		return nil
+	}
+
+	return h.undoLastReview(b, ctx.Message.From.Id, ctx.EffectiveChat.Id, nil)
+}
+
+// RevealNote replaces the prompt of a card with the highlight and its grading
+// keyboard, keeping how long it took to reveal it for the review log
+func (h *BotHandler) RevealNote(b *gotgbot.Bot, ctx *ext.Context) error {
+
+	if !checkUser(ctx.Update.CallbackQuery.From.Id) {
+		return nil
+	}
+
+	cb := ctx.Update.CallbackQuery
+
+	_, err := cb.Answer(b, &gotgbot.AnswerCallbackQueryOpts{
+		Text: "Revealing",
+	})
+
+	if err != nil {
+		return fmt.Errorf("failed to answer callback query: %w", err)
+	}
+
+	noteID, err := strconv.Atoi(strings.TrimPrefix(cb.Data, "reveal_"))
+
+	if err != nil {
+		return h.editMessage(b, cb.Message, "Got invalid response", nil)
+	}
+
+	note, err := h.service.repo.GetNote(noteID)
+
+	if err != nil {
+		log.Printf("Failed to get note to reveal: %v", err)
+		return h.editMessage(b, cb.Message, "Something went wrong while processing review", nil)
+	}
+
+	// The prompt time is lost on restarts, use the message date instead
+	shownAt := h.getShownAt()
+	if sentAt := time.Unix(cb.Message.GetDate(), 0); shownAt.Before(sentAt) {
+		shownAt = sentAt
+	}
+
+	revealMs := max(time.Since(shownAt).Milliseconds(), 1)
+
+	skip, _ := h.getUserData("skip")
+
+	keyboard := h.buildReviewKeyboard(int64(note.ID), revealMs)
+	keyboard.InlineKeyboard = append(keyboard.InlineKeyboard, relatedRow(note.ID))
+
+	return h.editMessage(b, cb.Message, fmt.Sprintf(
+		"📝 <b>Note #%v/%v</b>\n\n"+
+			"%s\n\n"+
+			"📚 <i>From:</i> %v",
+		skip,
+		len(h.notes),
+		html.EscapeString(note.Content),
+		html.EscapeString(note.Source.Title),
+	), &gotgbot.EditMessageTextOpts{
+		ReplyMarkup: keyboard,
+		ParseMode:   "HTML",
+	})
+}
+
+// sendAnswerGrade shows how a typed answer compares to the expected one,
+// with the grading keyboard and the suggested grade marked
+func (h *BotHandler) sendAnswerGrade(b *gotgbot.Bot, chatID int64, grade *AnswerGrade) error {
+	keyboard := h.buildReviewKeyboard(int64(grade.Note.ID), 0)
+
+	for i, button := range reviewButtons {
+		if button.Score == grade.Suggested {
+			keyboard.InlineKeyboard[i][0].Text = "✅ " + button.Text
+		}
+	}
+
+	text := fmt.Sprintf(
+		"<b>Your answer:</b> %s\n"+
+			"<b>Expected:</b> %s\n"+
+			"<b>Match:</b> %.0f%%\n",
+		grade.Diff,
+		html.EscapeString(grade.Note.Answer),
+		grade.Similarity*100,
+	)
+
+	if grade.Judgement != nil {
+		text = text + fmt.Sprintf("<b>Judge:</b> %s\n", html.EscapeString(grade.Judgement.Explanation))
+	}
+
+	text = text + "\nAccept the suggested grade ✅ or pick another one"
+
+	if _, err := b.SendMessage(chatID, text, &gotgbot.SendMessageOpts{
+		ReplyMarkup: keyboard,
+		ParseMode:   "HTML",
+	}); err != nil {
+		return fmt.Errorf("failed to send answer grade: %w", err)
+	}
+
+	return nil
+}
+
+// HandleAnswer grades the reply to a typed cloze question
+func (h *BotHandler) HandleAnswer(b *gotgbot.Bot, ctx *ext.Context) error {
+
+	if !checkUser(ctx.EffectiveMessage.From.Id) {
+		return nil
+	}
+
+	chatID := ctx.EffectiveChat.Id
+
+	noteID, ok := h.takeAwaitingAnswer(chatID)
+
+	if !ok {
+		return nil
+	}
+
+	grade, err := h.service.GradeAnswer(ctx.EffectiveMessage.From.Id, noteID, ctx.EffectiveMessage.Text)
+
+	if err != nil {
+		log.Printf("Failed to grade answer: %v", err)
+		h.setAwaitingAnswer(chatID, noteID)
+		_, err = ctx.EffectiveMessage.Reply(b, "Something went wrong while grading, try again", nil)
+		return err
+	}
+
+	return h.sendAnswerGrade(b, chatID, grade)
+}
+
+// SkipAnswer reveals the answer of a typed cloze question without one
+func (h *BotHandler) SkipAnswer(b *gotgbot.Bot, ctx *ext.Context) error {
+
+	if !checkUser(ctx.Update.CallbackQuery.From.Id) {
+		return nil
+	}
+
+	cb := ctx.Update.CallbackQuery
+
+	_, err := cb.Answer(b, &gotgbot.AnswerCallbackQueryOpts{
+		Text: "Showing answer",
+	})
+
+	if err != nil {
+		return fmt.Errorf("failed to answer callback query: %w", err)
+	}
+
+	noteID, err := strconv.Atoi(strings.TrimPrefix(cb.Data, "typed_skip_"))
+
+	if err != nil {
+		return h.editMessage(b, cb.Message, "Got invalid response", nil)
+	}
+
+	h.takeAwaitingAnswer(cb.Message.GetChat().Id)
+
+	grade, err := h.service.GradeAnswer(cb.From.Id, noteID, "")
+
+	if err != nil {
+		log.Printf("Failed to grade answer: %v", err)
+		return h.editMessage(b, cb.Message, "Something went wrong while processing review", nil)
+	}
+
+	return h.sendAnswerGrade(b, cb.Message.GetChat().Id, grade)
+}
+
+// Telegram limits on quiz polls
+const (
+	maxPollQuestion    = 300
+	maxPollOption      = 100
+	maxPollExplanation = 200
+)
+
+func truncate(text string, limit int) string {
+	runes := []rune(text)
+
+	if len(runes) <= limit {
+		return text
+	}
+
+	return string(runes[:limit-1]) + "…"
+}
+
+// quizDistractors are the distractors of a note that read differently from
+// its answer and from each other once shown as poll options
+func quizDistractors(note *storage.Note) []string {
+	key := func(choice string) string {
+		return strings.ToLower(strings.TrimSpace(truncate(choice, maxPollOption)))
+	}
+
+	seen := map[string]bool{key(note.QuizAnswer): true}
+	distractors := []string{}
+
+	for _, distractor := range note.QuizDistractors {
+		if seen[key(distractor)] {
+			continue
+		}
+
+		seen[key(distractor)] = true
+		distractors = append(distractors, distractor)
+	}
+
+	return distractors
+}
+
+// sendQuiz sends the multiple choice question of a note as a quiz poll,
+// with the options shuffled
+func (h *BotHandler) sendQuiz(b *gotgbot.Bot, chatID int64, position int, note *storage.Note) error {
+	choices := append([]string{note.QuizAnswer}, quizDistractors(note)...)
+	order := rand.Perm(len(choices))
+
+	options := make([]gotgbot.InputPollOption, len(choices))
+
+	for i, choice := range choices {
+		options[order[i]] = gotgbot.InputPollOption{Text: truncate(choice, maxPollOption)}
+	}
+
+	// The answer is the first choice
+	correctOption := int64(order[0])
+
+	question := fmt.Sprintf("#%v/%v %s", position, len(h.notes), note.QuizQuestion)
+
+	msg, err := b.SendPoll(chatID, truncate(question, maxPollQuestion), options, &gotgbot.SendPollOpts{
+		IsAnonymous:     false,
+		Type:            "quiz",
+		CorrectOptionId: correctOption,
+		Explanation:     truncate(note.Content, maxPollExplanation),
+		ReplyMarkup:     undoKeyboard(),
+	})
+
+	if err != nil {
+		log.Printf("Error while sending quiz: %v", err)
+		return fmt.Errorf("sending quiz: %w", err)
+	}
+
+	h.rwMux.Lock()
+	defer h.rwMux.Unlock()
+
+	if h.quizzes == nil {
+		h.quizzes = map[string]quizPoll{}
+	}
+
+	h.quizzes[msg.Poll.Id] = quizPoll{
+		NoteID:        int(note.ID),
+		ChatID:        chatID,
+		CorrectOption: correctOption,
+	}
+
+	return nil
+}
+
+func (h *BotHandler) takeQuiz(pollID string) (quizPoll, bool) {
+	h.rwMux.Lock()
+	defer h.rwMux.Unlock()
+
+	quiz, ok := h.quizzes[pollID]
+	delete(h.quizzes, pollID)
+
+	return quiz, ok
+}
+
+// HandleQuizAnswer grades the note of a quiz poll depending on whether the
+// chosen option was right, and moves on to the next card
+func (h *BotHandler) HandleQuizAnswer(b *gotgbot.Bot, ctx *ext.Context) error {
+	answer := ctx.PollAnswer
+
+	if answer.User == nil || !checkUser(answer.User.Id) || len(answer.OptionIds) == 0 {
+		return nil
+	}
+
+	quiz, ok := h.takeQuiz(answer.PollId)
+
+	if !ok {
+		return nil
+	}
+
+	correct := answer.OptionIds[0] == quiz.CorrectOption
+	data := fmt.Sprintf("review_%v_%v", quiz.NoteID, quizGrade(correct))
+
+	return h.showReview(b, answer.User.Id, quiz.ChatID, nil, data)
+}
@@ -0,0 +1,84 @@
+package bot
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/amalrajan30/spacedgram/internal/storage"
+)
+
+func TestTruncate(t *testing.T) {
+	tests := []struct {
+		text  string
+		limit int
+		want  string
+	}{
+		{"short", 10, "short"},
+		{"exactly", 7, "exactly"},
+		{"too long", 5, "too …"},
+		{"éééééé", 4, "ééé…"},
+	}
+
+	for _, test := range tests {
+		if got := truncate(test.text, test.limit); got != test.want {
+			t.Errorf("truncate(%q, %v) = %q, want %q", test.text, test.limit, got, test.want)
+		}
+	}
+
+	if got := truncate(strings.Repeat("a", 500), maxPollQuestion); utf8.RuneCountInString(got) != maxPollQuestion {
+		t.Errorf("truncated question has %v characters, want %v", utf8.RuneCountInString(got), maxPollQuestion)
+	}
+}
+
+func TestTakeQuiz(t *testing.T) {
+	h := NewBotHandler(nil, nil)
+	h.quizzes = map[string]quizPoll{"poll": {NoteID: 7, ChatID: 1, CorrectOption: 2}}
+
+	quiz, ok := h.takeQuiz("poll")
+
+	if !ok || quiz.NoteID != 7 || quiz.CorrectOption != 2 {
+		t.Fatalf("takeQuiz = %+v, %v, want the quiz of note 7", quiz, ok)
+	}
+
+	// A poll is only answered once
+	if _, ok := h.takeQuiz("poll"); ok {
+		t.Error("takeQuiz returned the quiz a second time")
+	}
+
+	if _, ok := h.takeQuiz("other"); ok {
+		t.Error("takeQuiz returned a quiz for an unknown poll")
+	}
+}
+
+func TestCardMessage(t *testing.T) {
+	h := NewBotHandler(nil, nil)
+
+	h.setCardMessage(1, 10)
+	h.setCardMessage(1, 11)
+	h.setCardMessage(2, 20)
+
+	// Only the latest card of a chat is on screen
+	if got := h.cardMessages[1]; got != 11 {
+		t.Errorf("card message of chat 1 = %v, want 11", got)
+	}
+
+	// Chats without a card on screen have nothing to clear
+	h.clearCardKeyboard(nil, 3)
+
+	if len(h.cardMessages) != 2 {
+		t.Errorf("card messages = %v, want the ones of chats 1 and 2", h.cardMessages)
+	}
+}
+
+func TestQuizDistractors(t *testing.T) {
+	note := &storage.Note{
+		QuizAnswer:      "Rome",
+		QuizDistractors: []string{"Athens", " rome ", "Sparta", "athens"},
+	}
+
+	if got, want := quizDistractors(note), []string{"Athens", "Sparta"}; !slices.Equal(got, want) {
+		t.Errorf("quizDistractors = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,136 @@
+package bot
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/amalrajan30/spacedgram/internal/storage"
+)
+
+// Tag given to leeches when the user's leech action is to tag them
+const leechTag = "leech"
+
+// applyLapse counts a failed rating of a learnt note as a lapse in update,
+// flagging the note as a leech once it reaches the user's threshold. It
+// returns whether the note just became a leech.
+func applyLapse(note *storage.Note, rating int, settings storage.UserSettings, update *storage.Note) bool {
+	if note.ReviewCount == 0 || rating >= 3 {
+		return false
+	}
+
+	update.Lapses = note.Lapses + 1
+
+	if note.Leech || update.Lapses < settings.LeechThreshold {
+		return false
+	}
+
+	log.Printf("Note %v became a leech after %v lapses", note.ID, update.Lapses)
+
+	update.Leech = true
+	update.Suspended = settings.LeechAction == storage.LeechActionSuspend
+
+	return true
+}
+
+// tagLeech tags a note that just became a leech, if that is the user's
+// leech action
+func (s BotService) tagLeech(noteID int, settings storage.UserSettings) {
+	if settings.LeechAction != storage.LeechActionTag {
+		return
+	}
+
+	if err := s.repo.TagNote(noteID, []string{leechTag}); err != nil {
+		log.Printf("Failed to tag leech %v: %v", noteID, err)
+	}
+}
+
+// SetLeechThreshold sets the lapses after which a note becomes a leech.
+// Existing leeches stay flagged.
+func (s BotService) SetLeechThreshold(userID int64, threshold int) (storage.UserSettings, error) {
+	settings, err := s.repo.GetUserSettings(userID)
+
+	if err != nil {
+		return storage.UserSettings{}, err
+	}
+
+	settings.LeechThreshold = threshold
+
+	return s.repo.SaveUserSettings(settings)
+}
+
+func (s BotService) SetLeechAction(userID int64, action string) (storage.UserSettings, error) {
+	settings, err := s.repo.GetUserSettings(userID)
+
+	if err != nil {
+		return storage.UserSettings{}, err
+	}
+
+	settings.LeechAction = action
+
+	return s.repo.SaveUserSettings(settings)
+}
+
+func (s BotService) GetLeeches() ([]storage.Note, error) {
+	return s.repo.GetLeeches()
+}
+
+// RegenerateLeech gives a leech a new cloze question and brings it back to
+// reviews
+func (s BotService) RegenerateLeech(userID int64, noteID int) error {
+	note, err := s.repo.GetNote(noteID)
+
+	if err != nil {
+		return err
+	}
+
+	if note.Question == "" {
+		_, err = s.GetClozeQuestion(note)
+	} else {
+		_, err = s.RegenerateQuestion(userID, noteID)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return s.repo.ReleaseLeech(noteID)
+}
+
+// RewriteLeech replaces the cloze question of a leech with the user's text,
+// given as "question | answer", and brings it back to reviews
+func (s BotService) RewriteLeech(userID int64, noteID int, text string) error {
+	note, err := s.repo.GetNote(noteID)
+
+	if err != nil {
+		return err
+	}
+
+	if note.Question != "" {
+		if _, err := s.EditQuestion(userID, noteID, text); err != nil {
+			return err
+		}
+
+		return s.repo.ReleaseLeech(noteID)
+	}
+
+	question, answer, err := splitQuestion(text)
+
+	if err != nil {
+		return err
+	}
+
+	if answer == "" {
+		return fmt.Errorf("the note has no question yet, add its answer after |")
+	}
+
+	if _, err := s.repo.SetClozeQuestion(noteID, question, answer); err != nil {
+		return err
+	}
+
+	return s.repo.ReleaseLeech(noteID)
+}
+
+// ResetLeech makes a leech new again
+func (s BotService) ResetLeech(noteID int) error {
+	return s.repo.ResetNote(noteID)
+}
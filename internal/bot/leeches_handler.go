@@ -0,0 +1,261 @@
+package bot
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+	"github.com/amalrajan30/spacedgram/internal/llm"
+)
+
+// Most leeches listed by /leeches
+const maxLeechesShown = 10
+
+func (h *BotHandler) setAwaitingRewrite(chatID int64, noteID int) {
+	h.setPending(chatID, inputRewrite, noteID)
+}
+
+func (h *BotHandler) takeAwaitingRewrite(chatID int64) (int, bool) {
+	return h.takePending(chatID, inputRewrite)
+}
+
+// IsAwaitingRewrite filters the messages rewriting the question of a leech
+func (h *BotHandler) IsAwaitingRewrite(msg *gotgbot.Message) bool {
+	return h.isPending(msg, inputRewrite)
+}
+
+// sendLeechNotice tells the user a card they just rated became a leech
+func (h *BotHandler) sendLeechNotice(b *gotgbot.Bot, chatID int64, noteID int) {
+	text := "🩸 That card keeps slipping and is now a leech"
+
+	if note, err := h.service.repo.GetNote(noteID); err == nil && note.Suspended {
+		text = text + ", it won't show up in reviews until you fix it"
+	}
+
+	if _, err := b.SendMessage(chatID, text+". See /leeches", nil); err != nil {
+		log.Printf("Failed to send leech notice: %v", err)
+	}
+}
+
+// leechesMessage lists the leeches with buttons to fix each of them
+func (h *BotHandler) leechesMessage() (string, *gotgbot.InlineKeyboardMarkup, error) {
+	leeches, err := h.service.GetLeeches()
+
+	if err != nil {
+		return "", nil, err
+	}
+
+	if len(leeches) == 0 {
+		return "🎉 No leeches", nil, nil
+	}
+
+	text := fmt.Sprintf(
+		"🩸 <b>Leeches</b>\n"+
+			"━━━━━━━━━━━━━━\n"+
+			"%v notes keep slipping. Rewrite or regenerate their question, reset them or delete them.\n\n",
+		len(leeches),
+	)
+
+	var keyboardRows [][]gotgbot.InlineKeyboardButton
+
+	for i, note := range leeches {
+		if i == maxLeechesShown {
+			text = text + fmt.Sprintf("<i>and %v more</i>", len(leeches)-maxLeechesShown)
+			break
+		}
+
+		status := ""
+		if note.Suspended {
+			status = " · suspended"
+		}
+
+		text = text + fmt.Sprintf(
+			"<b>%v.</b> <i>%s</i>\n📚 %s · %v lapses%s\n",
+			i+1,
+			html.EscapeString(truncate(note.Content, searchSnippet)),
+			html.EscapeString(note.Source.Title),
+			note.Lapses,
+			status,
+		)
+
+		if note.Question != "" {
+			text = text + fmt.Sprintf("❓ %s\n", html.EscapeString(note.Question))
+		}
+
+		text = text + "\n"
+
+		keyboardRows = append(keyboardRows, []gotgbot.InlineKeyboardButton{
+			{
+				Text:         fmt.Sprintf("✏️ #%v", i+1),
+				CallbackData: fmt.Sprintf("leech_rewrite_%v", note.ID),
+			},
+			{
+				Text:         fmt.Sprintf("🔄 #%v", i+1),
+				CallbackData: fmt.Sprintf("leech_regen_%v", note.ID),
+			},
+			{
+				Text:         fmt.Sprintf("♻️ #%v", i+1),
+				CallbackData: fmt.Sprintf("leech_reset_%v", note.ID),
+			},
+			{
+				Text:         fmt.Sprintf("🗑 #%v", i+1),
+				CallbackData: fmt.Sprintf("leech_delete_%v", note.ID),
+			},
+		})
+	}
+
+	return text, &gotgbot.InlineKeyboardMarkup{InlineKeyboard: keyboardRows}, nil
+}
+
+// Leeches lists the notes that keep being forgotten
+func (h *BotHandler) Leeches(b *gotgbot.Bot, ctx *ext.Context) error {
+
+	if !checkUser(ctx.Message.From.Id) {
+		return nil
+	}
+
+	text, keyboard, err := h.leechesMessage()
+
+	if err != nil {
+		log.Printf("Failed to get leeches: %v", err)
+		_, err = ctx.EffectiveMessage.Reply(b, "Failed to get leeches", nil)
+		return err
+	}
+
+	opts := &gotgbot.SendMessageOpts{
+		ParseMode: "HTML",
+	}
+
+	if keyboard != nil {
+		opts.ReplyMarkup = keyboard
+	}
+
+	_, err = ctx.EffectiveMessage.Reply(b, text, opts)
+
+	if err != nil {
+		return fmt.Errorf("Failed to send leeches: %w", err)
+	}
+
+	return nil
+}
+
+// refreshLeeches edits the /leeches message after one of them was handled
+func (h *BotHandler) refreshLeeches(b *gotgbot.Bot, msg gotgbot.MaybeInaccessibleMessage) error {
+	text, keyboard, err := h.leechesMessage()
+
+	if err != nil {
+		log.Printf("Failed to get leeches: %v", err)
+		return h.editMessage(b, msg, "Failed to get leeches", nil)
+	}
+
+	opts := &gotgbot.EditMessageTextOpts{
+		ParseMode: "HTML",
+	}
+
+	if keyboard != nil {
+		opts.ReplyMarkup = *keyboard
+	}
+
+	return h.editMessage(b, msg, text, opts)
+}
+
+// HandleLeech rewrites, regenerates, resets or deletes a leech
+func (h *BotHandler) HandleLeech(b *gotgbot.Bot, ctx *ext.Context) error {
+
+	if !checkUser(ctx.Update.CallbackQuery.From.Id) {
+		return nil
+	}
+
+	cb := ctx.Update.CallbackQuery
+	parts := strings.Split(cb.Data, "_")
+
+	if len(parts) != 3 {
+		return h.editMessage(b, cb.Message, "Got invalid response", nil)
+	}
+
+	noteID, err := strconv.Atoi(parts[2])
+
+	if err != nil {
+		return h.editMessage(b, cb.Message, "Got invalid response", nil)
+	}
+
+	answers := map[string]string{
+		"rewrite": "Rewriting",
+		"regen":   "Regenerating...",
+		"reset":   "Note reset",
+		"delete":  "Note deleted",
+	}
+
+	_, err = cb.Answer(b, &gotgbot.AnswerCallbackQueryOpts{
+		Text: answers[parts[1]],
+	})
+
+	if err != nil {
+		return fmt.Errorf("failed to answer callback query: %w", err)
+	}
+
+	switch parts[1] {
+	case "rewrite":
+		h.setAwaitingRewrite(cb.Message.GetChat().Id, noteID)
+
+		return h.editMessage(b, cb.Message,
+			"✏️ Reply with the new question, followed by <code>| answer</code> if it has none yet",
+			&gotgbot.EditMessageTextOpts{
+				ParseMode: "HTML",
+			})
+	case "regen":
+		err = h.service.RegenerateLeech(cb.From.Id, noteID)
+	case "reset":
+		err = h.service.ResetLeech(noteID)
+	case "delete":
+		err = h.service.DeleteNote(noteID)
+	default:
+		return h.editMessage(b, cb.Message, "Got invalid response", nil)
+	}
+
+	if err != nil {
+		log.Printf("Failed to %v leech %v: %v", parts[1], noteID, err)
+
+		text := "Failed to update the leech"
+		if errors.Is(err, llm.ErrBudgetExceeded) {
+			text = "💸 LLM budget reached, try again once it resets"
+		}
+
+		return h.editMessage(b, cb.Message, text, nil)
+	}
+
+	return h.refreshLeeches(b, cb.Message)
+}
+
+// HandleLeechRewrite replaces the question of the leech being rewritten with
+// the message text
+func (h *BotHandler) HandleLeechRewrite(b *gotgbot.Bot, ctx *ext.Context) error {
+
+	if !checkUser(ctx.EffectiveMessage.From.Id) {
+		return nil
+	}
+
+	chatID := ctx.EffectiveChat.Id
+
+	noteID, ok := h.takeAwaitingRewrite(chatID)
+
+	if !ok {
+		return nil
+	}
+
+	if err := h.service.RewriteLeech(ctx.EffectiveMessage.From.Id, noteID, ctx.EffectiveMessage.Text); err != nil {
+		log.Printf("Failed to rewrite leech: %v", err)
+		h.setAwaitingRewrite(chatID, noteID)
+		_, err = ctx.EffectiveMessage.Reply(b, fmt.Sprintf("Could not update the question: %v", err), nil)
+		return err
+	}
+
+	_, err := ctx.EffectiveMessage.Reply(b, "✅ Question updated, the note is back in your reviews. See /leeches for the rest", nil)
+
+	return err
+}
@@ -0,0 +1,256 @@
+package bot
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+
+	"github.com/amalrajan30/spacedgram/internal/storage"
+)
+
+func TestApplyLapse(t *testing.T) {
+	settings := storage.UserSettings{LeechThreshold: 3, LeechAction: storage.LeechActionSuspend}
+
+	tests := []struct {
+		name        string
+		note        storage.Note
+		rating      int
+		settings    storage.UserSettings
+		becameLeech bool
+		want        storage.Note
+	}{
+		{"new note", storage.Note{Lapses: 2}, 1, settings, false, storage.Note{}},
+		{"remembered", storage.Note{ReviewCount: 4, Lapses: 2}, 3, settings, false, storage.Note{}},
+		{"lapse", storage.Note{ReviewCount: 4, Lapses: 1}, 2, settings, false, storage.Note{Lapses: 2}},
+		{"suspended leech", storage.Note{ReviewCount: 4, Lapses: 2}, 0, settings, true, storage.Note{Lapses: 3, Leech: true, Suspended: true}},
+		{
+			"tagged leech",
+			storage.Note{ReviewCount: 4, Lapses: 2},
+			1,
+			storage.UserSettings{LeechThreshold: 3, LeechAction: storage.LeechActionTag},
+			true,
+			storage.Note{Lapses: 3, Leech: true},
+		},
+		{"already a leech", storage.Note{ReviewCount: 9, Lapses: 5, Leech: true}, 1, settings, false, storage.Note{Lapses: 6}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var update storage.Note
+
+			if got := applyLapse(&test.note, test.rating, test.settings, &update); got != test.becameLeech {
+				t.Errorf("became a leech = %v, want %v", got, test.becameLeech)
+			}
+
+			if update.Lapses != test.want.Lapses || update.Leech != test.want.Leech || update.Suspended != test.want.Suspended {
+				t.Errorf("update = %v lapses, leech %v, suspended %v, want %v, %v, %v",
+					update.Lapses, update.Leech, update.Suspended, test.want.Lapses, test.want.Leech, test.want.Suspended)
+			}
+		})
+	}
+}
+
+func TestLeechSettings(t *testing.T) {
+	s, db := testService(t)
+	userID := testUserID(t, db)
+
+	t.Cleanup(func() {
+		db.Unscoped().Where("user_id = ?", userID).Delete(&storage.UserSettings{})
+	})
+
+	if _, err := s.SetLeechThreshold(userID, 0); err == nil {
+		t.Error("SetLeechThreshold accepted 0")
+	}
+
+	if _, err := s.SetLeechAction(userID, "delete"); err == nil {
+		t.Error("SetLeechAction accepted an unknown action")
+	}
+
+	if settings, err := s.SetLeechThreshold(userID, 4); err != nil || settings.LeechThreshold != 4 || settings.LeechAction != storage.LeechActionSuspend {
+		t.Errorf("SetLeechThreshold = %+v, %v, want a threshold of 4 suspending leeches", settings, err)
+	}
+
+	if settings, err := s.SetLeechAction(userID, storage.LeechActionTag); err != nil || settings.LeechThreshold != 4 || settings.LeechAction != storage.LeechActionTag {
+		t.Errorf("SetLeechAction = %+v, %v, want a threshold of 4 tagging leeches", settings, err)
+	}
+}
+
+func TestLeechReview(t *testing.T) {
+	s, db := testService(t)
+	userID := testUserID(t, db)
+	source := testSource(t, db, storage.Source{})
+
+	t.Cleanup(func() {
+		db.Unscoped().Where("user_id = ?", userID).Delete(&storage.UserSettings{})
+	})
+
+	if _, err := s.SetLeechThreshold(userID, 2); err != nil {
+		t.Fatalf("SetLeechThreshold failed: %v", err)
+	}
+
+	note := storage.Note{Content: "Hard highlight", SourceID: int(source.ID), ReviewCount: 1}
+
+	if err := db.Create(&note).Error; err != nil {
+		t.Fatalf("failed to create note: %v", err)
+	}
+
+	review := func() (storage.ReviewLog, bool) {
+		t.Helper()
+
+		reviewLog, becameLeech, err := s.HandleReviewResponse(userID, fmt.Sprintf("review_%v_1", note.ID))
+
+		if err != nil {
+			t.Fatalf("HandleReviewResponse failed: %v", err)
+		}
+
+		return reviewLog, becameLeech
+	}
+
+	if _, becameLeech := review(); becameLeech {
+		t.Error("the note became a leech after a single lapse")
+	}
+
+	reviewLog, becameLeech := review()
+
+	if !becameLeech {
+		t.Error("the note didn't become a leech after two lapses")
+	}
+
+	leech, err := s.repo.GetNote(int(note.ID))
+
+	if err != nil {
+		t.Fatalf("GetNote failed: %v", err)
+	}
+
+	if leech.Lapses != 2 || !leech.Leech || !leech.Suspended {
+		t.Errorf("note = %v lapses, leech %v, suspended %v, want a suspended leech after 2 lapses", leech.Lapses, leech.Leech, leech.Suspended)
+	}
+
+	leeches, err := s.GetLeeches()
+
+	if err != nil || !slices.ContainsFunc(leeches, func(n storage.Note) bool { return n.ID == note.ID }) {
+		t.Errorf("leeches = %v (%v), want the note among them", len(leeches), err)
+	}
+
+	// Undoing the rating brings the note back
+	if _, err := s.UndoReview(userID, reviewLog.ID); err != nil {
+		t.Fatalf("UndoReview failed: %v", err)
+	}
+
+	undone, err := s.repo.GetNote(int(note.ID))
+
+	if err != nil {
+		t.Fatalf("GetNote failed: %v", err)
+	}
+
+	if undone.Lapses != 1 || undone.Leech || undone.Suspended {
+		t.Errorf("note after undo = %v lapses, leech %v, suspended %v, want 1 lapse", undone.Lapses, undone.Leech, undone.Suspended)
+	}
+}
+
+func TestTaggedLeech(t *testing.T) {
+	s, db := testService(t)
+	userID := testUserID(t, db)
+	source := testSource(t, db, storage.Source{})
+
+	note := storage.Note{Content: "Hard highlight", SourceID: int(source.ID), ReviewCount: 3}
+
+	if err := db.Create(&note).Error; err != nil {
+		t.Fatalf("failed to create note: %v", err)
+	}
+
+	t.Cleanup(func() {
+		db.Unscoped().Where("user_id = ?", userID).Delete(&storage.UserSettings{})
+		db.Exec("DELETE FROM note_tags WHERE note_id = ?", note.ID)
+	})
+
+	if _, err := s.SetLeechThreshold(userID, 1); err != nil {
+		t.Fatalf("SetLeechThreshold failed: %v", err)
+	}
+
+	if _, err := s.SetLeechAction(userID, storage.LeechActionTag); err != nil {
+		t.Fatalf("SetLeechAction failed: %v", err)
+	}
+
+	if _, becameLeech, err := s.HandleReviewResponse(userID, fmt.Sprintf("review_%v_2", note.ID)); err != nil || !becameLeech {
+		t.Fatalf("HandleReviewResponse = %v, %v, want the note to become a leech", becameLeech, err)
+	}
+
+	leech, err := s.repo.GetNote(int(note.ID))
+
+	if err != nil {
+		t.Fatalf("GetNote failed: %v", err)
+	}
+
+	if !leech.Leech || leech.Suspended {
+		t.Errorf("note = leech %v, suspended %v, want a leech left in reviews", leech.Leech, leech.Suspended)
+	}
+
+	if tags, err := s.repo.GetNoteTags(int(note.ID)); err != nil || !slices.Contains(tags, leechTag) {
+		t.Errorf("tags = %v (%v), want the leech tag", tags, err)
+	}
+}
+
+func TestCardLapse(t *testing.T) {
+	s, db := testService(t)
+	userID := testUserID(t, db)
+	source := testSource(t, db, storage.Source{})
+
+	note := storage.Note{Content: "Hard highlight", SourceID: int(source.ID)}
+
+	if err := db.Create(&note).Error; err != nil {
+		t.Fatalf("failed to create note: %v", err)
+	}
+
+	t.Cleanup(func() {
+		db.Unscoped().Where("user_id = ?", userID).Delete(&storage.UserSettings{})
+		db.Unscoped().Where("note_id = ?", note.ID).Delete(&storage.Card{})
+		db.Exec("DELETE FROM note_tags WHERE note_id = ?", note.ID)
+	})
+
+	if _, err := s.SetLeechThreshold(userID, 1); err != nil {
+		t.Fatalf("SetLeechThreshold failed: %v", err)
+	}
+
+	if _, err := s.SetLeechAction(userID, storage.LeechActionTag); err != nil {
+		t.Fatalf("SetLeechAction failed: %v", err)
+	}
+
+	card, err := s.repo.SaveCard(storage.Card{NoteID: int(note.ID), Type: storage.CardTypeOpen, Question: "Q", Answer: "A", ReviewCount: 1})
+
+	if err != nil {
+		t.Fatalf("SaveCard failed: %v", err)
+	}
+
+	// Lapses of a card count towards its note
+	reviewLog, becameLeech, err := s.HandleCardResponse(userID, fmt.Sprintf("card_%v_1", card.ID))
+
+	if err != nil || !becameLeech {
+		t.Fatalf("HandleCardResponse = %v, %v, want the note to become a leech", becameLeech, err)
+	}
+
+	leech, err := s.repo.GetNote(int(note.ID))
+
+	if err != nil || leech.Lapses != 1 || !leech.Leech || leech.Suspended {
+		t.Errorf("note = %+v (%v), want a leech with a lapse", leech, err)
+	}
+
+	if tags, _ := s.repo.GetNoteTags(int(note.ID)); !slices.Contains(tags, leechTag) {
+		t.Errorf("note tags = %v, want %v", tags, leechTag)
+	}
+
+	// Undoing the rating restores the note and drops the tag
+	if _, err := s.UndoReview(userID, reviewLog.ID); err != nil {
+		t.Fatalf("UndoReview failed: %v", err)
+	}
+
+	undone, err := s.repo.GetNote(int(note.ID))
+
+	if err != nil || undone.Lapses != 0 || undone.Leech {
+		t.Errorf("note after undoing = %+v (%v), want no lapses", undone, err)
+	}
+
+	if tags, _ := s.repo.GetNoteTags(int(note.ID)); slices.Contains(tags, leechTag) {
+		t.Errorf("note tags after undoing = %v, want no %v", tags, leechTag)
+	}
+}
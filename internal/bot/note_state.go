@@ -0,0 +1,93 @@
+package bot
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/amalrajan30/spacedgram/internal/storage"
+)
+
+func (s BotService) SuspendNote(noteID int) error {
+	return s.repo.SetNoteSuspended(noteID, true)
+}
+
+func (s BotService) UnsuspendNote(noteID int) error {
+	return s.repo.SetNoteSuspended(noteID, false)
+}
+
+// BuryNote leaves a note out of reviews until the user's next day starts
+func (s BotService) BuryNote(userID int64, noteID int) error {
+	settings, err := s.repo.GetUserSettings(userID)
+
+	if err != nil {
+		return fmt.Errorf("getting user settings: %w", err)
+	}
+
+	return s.repo.BuryNote(noteID, settings.DayEnd(time.Now()))
+}
+
+// DeleteNote soft deletes a note, it can be restored from the database
+func (s BotService) DeleteNote(noteID int) error {
+	if err := s.repo.DeleteNote(noteID); err != nil {
+		return err
+	}
+
+	s.index.Remove(noteID)
+
+	return nil
+}
+
+func (s BotService) GetSuspendedNotes() ([]storage.Note, error) {
+	return s.repo.GetSuspendedNotes()
+}
+
+// EditNote replaces the content of a note, keeping the previous one as a
+// revision. Its embedding and cards are made again from the new content, its
+// questions when it is next reviewed.
+func (s BotService) EditNote(noteID int, content string) error {
+	content = strings.TrimSpace(content)
+
+	if content == "" {
+		return fmt.Errorf("the note can't be empty")
+	}
+
+	if err := s.repo.EditNoteContent(noteID, content); err != nil {
+		return err
+	}
+
+	if err := s.repo.DeleteEmbedding(noteID); err != nil {
+		return fmt.Errorf("dropping embedding of edited note: %w", err)
+	}
+
+	cardTypes, err := s.repo.GetCardTypes(noteID)
+
+	if err != nil {
+		return err
+	}
+
+	jobs := []storage.GenerationJob{}
+
+	for _, cardType := range cardTypes {
+		jobs = append(jobs, storage.GenerationJob{
+			NoteID:   noteID,
+			Kind:     storage.GenerationKindCard,
+			CardType: cardType,
+		})
+	}
+
+	if _, err := s.repo.RetryGenerationJobs(jobs); err != nil {
+		return err
+	}
+
+	s.index.Remove(noteID)
+
+	go func() {
+		if _, err := s.EmbedPendingNotes(); err != nil {
+			log.Printf("Failed to embed edited note: %v", err)
+		}
+	}()
+
+	return nil
+}
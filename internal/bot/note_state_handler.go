@@ -0,0 +1,190 @@
+package bot
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+)
+
+// Most notes listed by /suspended
+const maxSuspendedShown = 10
+
+func noteActionsRow(noteID int64) []gotgbot.InlineKeyboardButton {
+	return []gotgbot.InlineKeyboardButton{
+		{
+			Text:         "⏸ Suspend",
+			CallbackData: fmt.Sprintf("note_suspend_%v", noteID),
+		},
+		{
+			Text:         "💤 Bury",
+			CallbackData: fmt.Sprintf("note_bury_%v", noteID),
+		},
+		{
+			Text:         "🗑 Delete",
+			CallbackData: fmt.Sprintf("note_delete_%v", noteID),
+		},
+		{
+			Text:         "📝 Edit",
+			CallbackData: fmt.Sprintf("note_edit_%v", noteID),
+		},
+	}
+}
+
+// HandleNoteAction suspends, buries or deletes the note of the card under
+// review and moves on to the next card. Edits go through the edit
+// conversation.
+func (h *BotHandler) HandleNoteAction(b *gotgbot.Bot, ctx *ext.Context) error {
+
+	if !checkUser(ctx.Update.CallbackQuery.From.Id) {
+		return nil
+	}
+
+	cb := ctx.Update.CallbackQuery
+	parts := strings.Split(cb.Data, "_")
+
+	if len(parts) != 3 {
+		return h.editMessage(b, cb.Message, "Got invalid response", nil)
+	}
+
+	noteID, err := strconv.Atoi(parts[2])
+
+	if err != nil {
+		return h.editMessage(b, cb.Message, "Got invalid response", nil)
+	}
+
+	answers := map[string]string{
+		"suspend":   "Suspended",
+		"unsuspend": "Back in reviews",
+		"bury":      "Buried until tomorrow",
+		"delete":    "Deleted",
+	}
+
+	_, err = cb.Answer(b, &gotgbot.AnswerCallbackQueryOpts{
+		Text: answers[parts[1]],
+	})
+
+	if err != nil {
+		return fmt.Errorf("failed to answer callback query: %w", err)
+	}
+
+	chatID := cb.Message.GetChat().Id
+
+	switch parts[1] {
+	case "suspend":
+		err = h.service.SuspendNote(noteID)
+	case "unsuspend":
+		if err := h.service.UnsuspendNote(noteID); err != nil {
+			log.Printf("Failed to unsuspend note %v: %v", noteID, err)
+			return h.editMessage(b, cb.Message, "Failed to unsuspend the note", nil)
+		}
+
+		return h.refreshSuspended(b, cb.Message)
+	case "bury":
+		err = h.service.BuryNote(cb.From.Id, noteID)
+	case "delete":
+		err = h.service.DeleteNote(noteID)
+	default:
+		return h.editMessage(b, cb.Message, "Got invalid response", nil)
+	}
+
+	if err != nil {
+		log.Printf("Failed to %v note %v: %v", parts[1], noteID, err)
+		return h.editMessage(b, cb.Message, fmt.Sprintf("Failed to %v the note", parts[1]), nil)
+	}
+
+	// The cursor already points past the card, so this shows the next one
+	return h.showReview(b, cb.From.Id, chatID, cb.Message, "")
+}
+
+// suspendedMessage lists the suspended notes with buttons to unsuspend them
+func (h *BotHandler) suspendedMessage() (string, *gotgbot.InlineKeyboardMarkup, error) {
+	notes, err := h.service.GetSuspendedNotes()
+
+	if err != nil {
+		return "", nil, err
+	}
+
+	if len(notes) == 0 {
+		return "No suspended notes", nil, nil
+	}
+
+	text := fmt.Sprintf(
+		"⏸ <b>Suspended</b>\n"+
+			"━━━━━━━━━━━━━━\n"+
+			"%v notes are left out of reviews.\n\n",
+		len(notes),
+	)
+
+	var keyboardRows [][]gotgbot.InlineKeyboardButton
+
+	for i, note := range notes {
+		if i == maxSuspendedShown {
+			text = text + fmt.Sprintf("<i>and %v more</i>", len(notes)-maxSuspendedShown)
+			break
+		}
+
+		text = text + formatSearchResult(i+1, note)
+
+		keyboardRows = append(keyboardRows, []gotgbot.InlineKeyboardButton{{
+			Text:         fmt.Sprintf("▶️ Unsuspend #%v", i+1),
+			CallbackData: fmt.Sprintf("note_unsuspend_%v", note.ID),
+		}})
+	}
+
+	return text, &gotgbot.InlineKeyboardMarkup{InlineKeyboard: keyboardRows}, nil
+}
+
+// Suspended lists the suspended notes
+func (h *BotHandler) Suspended(b *gotgbot.Bot, ctx *ext.Context) error {
+
+	if !checkUser(ctx.Message.From.Id) {
+		return nil
+	}
+
+	text, keyboard, err := h.suspendedMessage()
+
+	if err != nil {
+		log.Printf("Failed to get suspended notes: %v", err)
+		_, err = ctx.EffectiveMessage.Reply(b, "Failed to get suspended notes", nil)
+		return err
+	}
+
+	opts := &gotgbot.SendMessageOpts{
+		ParseMode: "HTML",
+	}
+
+	if keyboard != nil {
+		opts.ReplyMarkup = keyboard
+	}
+
+	_, err = ctx.EffectiveMessage.Reply(b, text, opts)
+
+	if err != nil {
+		return fmt.Errorf("Failed to send suspended notes: %w", err)
+	}
+
+	return nil
+}
+
+func (h *BotHandler) refreshSuspended(b *gotgbot.Bot, msg gotgbot.MaybeInaccessibleMessage) error {
+	text, keyboard, err := h.suspendedMessage()
+
+	if err != nil {
+		log.Printf("Failed to get suspended notes: %v", err)
+		return h.editMessage(b, msg, "Failed to get suspended notes", nil)
+	}
+
+	opts := &gotgbot.EditMessageTextOpts{
+		ParseMode: "HTML",
+	}
+
+	if keyboard != nil {
+		opts.ReplyMarkup = *keyboard
+	}
+
+	return h.editMessage(b, msg, text, opts)
+}
@@ -0,0 +1,87 @@
+package bot
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/amalrajan30/spacedgram/internal/llm"
+	"github.com/amalrajan30/spacedgram/internal/storage"
+)
+
+func TestBuryNote(t *testing.T) {
+	s, db := testService(t)
+	userID := testUserID(t, db)
+	source := testSource(t, db, storage.Source{})
+
+	note := storage.Note{Content: "Highlight", SourceID: int(source.ID)}
+
+	if err := db.Create(&note).Error; err != nil {
+		t.Fatalf("failed to create note: %v", err)
+	}
+
+	if err := s.BuryNote(userID, int(note.ID)); err != nil {
+		t.Fatalf("BuryNote failed: %v", err)
+	}
+
+	buried, err := s.repo.GetNote(int(note.ID))
+
+	if err != nil {
+		t.Fatalf("GetNote failed: %v", err)
+	}
+
+	settings := storage.DefaultUserSettings(userID)
+
+	if buried.BuriedUntil == nil || !buried.BuriedUntil.Equal(settings.DayEnd(time.Now())) {
+		t.Errorf("buried until %v, want the end of the user's day", buried.BuriedUntil)
+	}
+}
+
+func TestEditNote(t *testing.T) {
+	s, db := testService(t)
+	source := testSource(t, db, storage.Source{})
+	model := fmt.Sprintf("%v %v", t.Name(), time.Now().UnixNano())
+
+	llm.SetEmbedder(testEmbedder{model: model})
+	t.Cleanup(func() {
+		llm.SetEmbedder(nil)
+		db.Unscoped().Where("embed_model = ?", model).Delete(&storage.NoteEmbedding{})
+	})
+
+	note := storage.Note{Content: "Highlight", SourceID: int(source.ID)}
+
+	if err := db.Create(&note).Error; err != nil {
+		t.Fatalf("failed to create note: %v", err)
+	}
+
+	t.Cleanup(func() {
+		db.Unscoped().Where("note_id = ?", note.ID).Delete(&storage.NoteRevision{})
+	})
+
+	if err := s.repo.SaveEmbedding(int(note.ID), model, []float32{1, 0}); err != nil {
+		t.Fatalf("SaveEmbedding failed: %v", err)
+	}
+
+	if err := s.EditNote(int(note.ID), "  "); err == nil {
+		t.Error("EditNote accepted an empty note")
+	}
+
+	if err := s.EditNote(int(note.ID), " Edited highlight "); err != nil {
+		t.Fatalf("EditNote failed: %v", err)
+	}
+
+	if edited, err := s.repo.GetNote(int(note.ID)); err != nil || edited.Content != "Edited highlight" {
+		t.Errorf("edited note = %q (%v), want the trimmed content", edited.Content, err)
+	}
+
+	// The old vector is dropped until the note is embedded again
+	embedding, err := s.repo.GetEmbedding(int(note.ID), model)
+
+	if err != nil {
+		t.Fatalf("GetEmbedding failed: %v", err)
+	}
+
+	if embedding != nil && embedding.Dimensions == 2 {
+		t.Error("the embedding of the old content was kept")
+	}
+}
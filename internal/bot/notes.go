@@ -0,0 +1,78 @@
+package bot
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/amalrajan30/spacedgram/internal/storage"
+)
+
+// Origin of the sources created from Telegram
+const telegramOrigin = "telegram"
+
+// AddSource returns the source with the given title, creating it when the
+// user names a new one
+func (s BotService) AddSource(title string) (storage.Source, error) {
+	title = strings.TrimSpace(title)
+
+	if title == "" {
+		return storage.Source{}, fmt.Errorf("the title can't be empty")
+	}
+
+	return s.repo.FindOrCreateSource(title, telegramOrigin)
+}
+
+// AddNote adds a note written by the user to a source, with an optional
+// cloze question. Its tags and embedding are made in the background like
+// imported notes.
+func (s BotService) AddNote(sourceID int, content string, question string, answer string) (*storage.Note, error) {
+	content = strings.TrimSpace(content)
+
+	if content == "" {
+		return nil, fmt.Errorf("the note can't be empty")
+	}
+
+	return s.insertNote(storage.Note{
+		Content:  content,
+		SourceID: sourceID,
+		Question: question,
+		Answer:   answer,
+	})
+}
+
+func (s BotService) insertNote(note storage.Note) (*storage.Note, error) {
+	if err := s.repo.InsertNote(&note); err != nil {
+		return nil, err
+	}
+
+	s.enqueueGeneration(int(note.ID), storage.GenerationKindTags)
+
+	go func() {
+		if _, err := s.EmbedPendingNotes(); err != nil {
+			log.Printf("Failed to embed added note: %v", err)
+		}
+	}()
+
+	return &note, nil
+}
+
+func (s BotService) GetNoteRevisions(noteID int) ([]storage.NoteRevision, error) {
+	return s.repo.GetNoteRevisions(noteID)
+}
+
+// RestoreRevision puts back the content of a revision. The replaced content
+// is kept as a revision too, so restoring can be undone.
+func (s BotService) RestoreRevision(noteID int, revisionID int) error {
+	revision, err := s.repo.GetNoteRevision(revisionID)
+
+	if err != nil {
+		return err
+	}
+
+	if revision.NoteID != noteID {
+		return fmt.Errorf("revision %d is not of note %d", revisionID, noteID)
+	}
+
+	return s.EditNote(noteID, revision.Content)
+}
@@ -0,0 +1,614 @@
+package bot
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext/handlers"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext/handlers/filters/callbackquery"
+	"github.com/amalrajan30/spacedgram/internal/storage"
+)
+
+// States of the /add and edit conversations
+const (
+	addStateSource   = "add_source"
+	addStateTitle    = "add_title"
+	addStateText     = "add_text"
+	addStateQuestion = "add_question"
+	editStateText    = "edit_text"
+)
+
+// Revisions offered to restore when editing a note, besides the original
+const maxRevisionsShown = 4
+
+// noteDraft is a note being written with /add
+type noteDraft struct {
+	SourceID    int
+	SourceTitle string
+	Content     string
+}
+
+// isNoteText filters the replies of the conversations, leaving commands,
+// forwarded messages and replies to other chats to their handlers
+func isNoteText(msg *gotgbot.Message) bool {
+	return msg.Text != "" && !strings.HasPrefix(msg.Text, "/") && msg.ForwardOrigin == nil && msg.ExternalReply == nil
+}
+
+// AddNoteConversation walks through adding a note: choosing or creating its
+// source, sending its text, then an optional cloze question
+func (h *BotHandler) AddNoteConversation() handlers.Conversation {
+	return handlers.NewConversation(
+		[]ext.Handler{handlers.NewCommand("add", h.AddNote)},
+		map[string][]ext.Handler{
+			addStateSource: {
+				handlers.NewCallback(callbackquery.Prefix("add_"), h.ChooseNoteSource),
+			},
+			addStateTitle: {
+				handlers.NewMessage(isNoteText, h.HandleNoteSourceTitle),
+			},
+			addStateText: {
+				handlers.NewMessage(isNoteText, h.HandleNoteText),
+			},
+			addStateQuestion: {
+				handlers.NewMessage(isNoteText, h.HandleNoteQuestion),
+				handlers.NewCommand("skip", h.SkipNoteQuestion),
+			},
+		},
+		&handlers.ConversationOpts{
+			Exits:        []ext.Handler{handlers.NewCommand("cancel", h.CancelAddNote)},
+			AllowReEntry: true,
+			StateStorage: h.newConversationStates(),
+		},
+	)
+}
+
+// EditNoteConversation replaces the content of the note under review with
+// the next reply, or restores one of its revisions
+func (h *BotHandler) EditNoteConversation() handlers.Conversation {
+	return handlers.NewConversation(
+		[]ext.Handler{handlers.NewCallback(callbackquery.Prefix("note_edit_"), h.StartNoteEdit)},
+		map[string][]ext.Handler{
+			editStateText: {
+				handlers.NewMessage(isNoteText, h.HandleNoteEdit),
+				handlers.NewCallback(callbackquery.Prefix("revision_"), h.RestoreNoteRevision),
+				handlers.NewCallback(callbackquery.Equal("edit_cancel"), h.CancelNoteEdit),
+			},
+		},
+		&handlers.ConversationOpts{
+			Exits:        []ext.Handler{handlers.NewCommand("cancel", h.CancelNoteEdit)},
+			AllowReEntry: true,
+			StateStorage: h.newConversationStates(),
+		},
+	)
+}
+
+func (h *BotHandler) setDraft(chatID int64, draft noteDraft) {
+	h.rwMux.Lock()
+	defer h.rwMux.Unlock()
+
+	if h.drafts == nil {
+		h.drafts = map[int64]noteDraft{}
+	}
+
+	h.drafts[chatID] = draft
+}
+
+func (h *BotHandler) getDraft(chatID int64) noteDraft {
+	h.rwMux.RLock()
+	defer h.rwMux.RUnlock()
+
+	return h.drafts[chatID]
+}
+
+func (h *BotHandler) clearDraft(chatID int64) {
+	h.rwMux.Lock()
+	defer h.rwMux.Unlock()
+
+	delete(h.drafts, chatID)
+}
+
+func (h *BotHandler) setEditing(chatID int64, noteID int) {
+	h.rwMux.Lock()
+	defer h.rwMux.Unlock()
+
+	if h.editing == nil {
+		h.editing = map[int64]int{}
+	}
+
+	h.editing[chatID] = noteID
+}
+
+func (h *BotHandler) takeEditing(chatID int64) (int, bool) {
+	h.rwMux.Lock()
+	defer h.rwMux.Unlock()
+
+	noteID, ok := h.editing[chatID]
+	delete(h.editing, chatID)
+
+	return noteID, ok
+}
+
+func (h *BotHandler) getEditing(chatID int64) (int, bool) {
+	h.rwMux.RLock()
+	defer h.rwMux.RUnlock()
+
+	noteID, ok := h.editing[chatID]
+
+	return noteID, ok
+}
+
+// AddNote starts the /add conversation by asking for the source of the note
+func (h *BotHandler) AddNote(b *gotgbot.Bot, ctx *ext.Context) error {
+
+	if !checkUser(ctx.Message.From.Id) {
+		return nil
+	}
+
+	sources := h.service.repo.GetSources()
+
+	var keyboard [][]gotgbot.InlineKeyboardButton
+	var currentRow []gotgbot.InlineKeyboardButton
+
+	for i, source := range sources {
+		currentRow = append(currentRow, gotgbot.InlineKeyboardButton{
+			Text:         strings.Split(source.Name, ":")[0],
+			CallbackData: fmt.Sprintf("add_source_%v", source.Id),
+		})
+
+		if (i+1)%3 == 0 || i == len(sources)-1 {
+			keyboard = append(keyboard, currentRow)
+			currentRow = []gotgbot.InlineKeyboardButton{}
+		}
+	}
+
+	keyboard = append(keyboard, []gotgbot.InlineKeyboardButton{{
+		Text:         "➕ New source",
+		CallbackData: "add_new",
+	}})
+
+	h.endFlows(ctx.EffectiveChat.Id)
+	h.setDraft(ctx.EffectiveChat.Id, noteDraft{})
+
+	_, err := ctx.EffectiveMessage.Reply(b, "📝 <b>New note</b>\n"+
+		"━━━━━━━━━━━━━━\n"+
+		"Choose the source of the note, or /cancel", &gotgbot.SendMessageOpts{
+		ReplyMarkup: gotgbot.InlineKeyboardMarkup{InlineKeyboard: keyboard},
+		ParseMode:   "HTML",
+	})
+
+	if err != nil {
+		return fmt.Errorf("failed to send message: %w", err)
+	}
+
+	return handlers.NextConversationState(addStateSource)
+}
+
+// ChooseNoteSource sets the source of the new note, or asks for the title of
+// a new source
+func (h *BotHandler) ChooseNoteSource(b *gotgbot.Bot, ctx *ext.Context) error {
+
+	if !checkUser(ctx.Update.CallbackQuery.From.Id) {
+		return nil
+	}
+
+	cb := ctx.Update.CallbackQuery
+
+	_, err := cb.Answer(b, nil)
+
+	if err != nil {
+		return fmt.Errorf("failed to answer callback query: %w", err)
+	}
+
+	if cb.Data == "add_new" {
+		if err := h.editMessage(b, cb.Message, "Send the title of the new source", nil); err != nil {
+			return err
+		}
+
+		return handlers.NextConversationState(addStateTitle)
+	}
+
+	sourceID, err := strconv.Atoi(strings.TrimPrefix(cb.Data, "add_source_"))
+
+	if err != nil {
+		return h.editMessage(b, cb.Message, "Got invalid response", nil)
+	}
+
+	source, err := h.service.repo.GetSource(sourceID)
+
+	if err != nil {
+		log.Printf("Failed to get source of new note: %v", err)
+		return h.editMessage(b, cb.Message, "Could not find the source", nil)
+	}
+
+	h.setDraft(cb.Message.GetChat().Id, noteDraft{
+		SourceID:    int(source.ID),
+		SourceTitle: source.Title,
+	})
+
+	err = h.editMessage(b, cb.Message, fmt.Sprintf(
+		"Send the text of the note for <b>%s</b>",
+		html.EscapeString(source.Title),
+	), nil)
+
+	if err != nil {
+		return err
+	}
+
+	return handlers.NextConversationState(addStateText)
+}
+
+// HandleNoteSourceTitle creates the source named by the user, or picks the
+// existing one with that title
+func (h *BotHandler) HandleNoteSourceTitle(b *gotgbot.Bot, ctx *ext.Context) error {
+
+	if !checkUser(ctx.EffectiveMessage.From.Id) {
+		return nil
+	}
+
+	source, err := h.service.AddSource(ctx.EffectiveMessage.Text)
+
+	if err != nil {
+		log.Printf("Failed to add source: %v", err)
+		_, err = ctx.EffectiveMessage.Reply(b, fmt.Sprintf("Could not add the source: %v", err), nil)
+		return err
+	}
+
+	h.setDraft(ctx.EffectiveChat.Id, noteDraft{
+		SourceID:    int(source.ID),
+		SourceTitle: source.Title,
+	})
+
+	_, err = ctx.EffectiveMessage.Reply(b, fmt.Sprintf(
+		"Send the text of the note for <b>%s</b>",
+		html.EscapeString(source.Title),
+	), &gotgbot.SendMessageOpts{
+		ParseMode: "HTML",
+	})
+
+	if err != nil {
+		return fmt.Errorf("failed to send message: %w", err)
+	}
+
+	return handlers.NextConversationState(addStateText)
+}
+
+// HandleNoteText keeps the text of the new note and asks for its question
+func (h *BotHandler) HandleNoteText(b *gotgbot.Bot, ctx *ext.Context) error {
+
+	if !checkUser(ctx.EffectiveMessage.From.Id) {
+		return nil
+	}
+
+	chatID := ctx.EffectiveChat.Id
+
+	draft := h.getDraft(chatID)
+	draft.Content = strings.TrimSpace(ctx.EffectiveMessage.Text)
+	h.setDraft(chatID, draft)
+
+	_, err := ctx.EffectiveMessage.Reply(b,
+		"Send a question for the note as <code>question | answer</code>, or /skip to add it without one",
+		&gotgbot.SendMessageOpts{
+			ParseMode: "HTML",
+		},
+	)
+
+	if err != nil {
+		return fmt.Errorf("failed to send message: %w", err)
+	}
+
+	return handlers.NextConversationState(addStateQuestion)
+}
+
+// HandleNoteQuestion adds the new note with the question sent by the user
+func (h *BotHandler) HandleNoteQuestion(b *gotgbot.Bot, ctx *ext.Context) error {
+
+	if !checkUser(ctx.EffectiveMessage.From.Id) {
+		return nil
+	}
+
+	question, answer, err := splitQuestion(ctx.EffectiveMessage.Text)
+
+	if err == nil && answer == "" {
+		err = fmt.Errorf("add the answer after a |")
+	}
+
+	if err != nil {
+		_, err = ctx.EffectiveMessage.Reply(b, fmt.Sprintf("Could not use the question: %v", err), nil)
+		return err
+	}
+
+	return h.saveDraft(b, ctx, question, answer)
+}
+
+// SkipNoteQuestion adds the new note without a question
+func (h *BotHandler) SkipNoteQuestion(b *gotgbot.Bot, ctx *ext.Context) error {
+
+	if !checkUser(ctx.EffectiveMessage.From.Id) {
+		return nil
+	}
+
+	return h.saveDraft(b, ctx, "", "")
+}
+
+func (h *BotHandler) saveDraft(b *gotgbot.Bot, ctx *ext.Context, question string, answer string) error {
+	chatID := ctx.EffectiveChat.Id
+	draft := h.getDraft(chatID)
+
+	if _, err := h.service.AddNote(draft.SourceID, draft.Content, question, answer); err != nil {
+		log.Printf("Failed to add note: %v", err)
+		_, err = ctx.EffectiveMessage.Reply(b, "Failed to add the note", nil)
+		return err
+	}
+
+	h.clearDraft(chatID)
+
+	_, err := ctx.EffectiveMessage.Reply(b, fmt.Sprintf(
+		"✅ Note added to <b>%s</b>",
+		html.EscapeString(draft.SourceTitle),
+	), &gotgbot.SendMessageOpts{
+		ParseMode: "HTML",
+	})
+
+	if err != nil {
+		return fmt.Errorf("failed to send message: %w", err)
+	}
+
+	return handlers.EndConversation()
+}
+
+func (h *BotHandler) CancelAddNote(b *gotgbot.Bot, ctx *ext.Context) error {
+	h.clearDraft(ctx.EffectiveChat.Id)
+
+	_, err := ctx.EffectiveMessage.Reply(b, "The note was not added", nil)
+
+	if err != nil {
+		return fmt.Errorf("failed to send message: %w", err)
+	}
+
+	return handlers.EndConversation()
+}
+
+// formatRevisions lists the previous contents of a note, the original first
+func formatRevisions(revisions []storage.NoteRevision) string {
+	text := ""
+
+	for i, revision := range revisions {
+		label := fmt.Sprintf("#%v", i+1)
+
+		if i == 0 {
+			label = "Original"
+		}
+
+		text = text + fmt.Sprintf(
+			"<b>%v</b> · %v\n<i>%s</i>\n\n",
+			label,
+			revision.CreatedAt.Format("2 Jan 2006"),
+			html.EscapeString(truncate(revision.Content, searchSnippet)),
+		)
+	}
+
+	return text
+}
+
+// revisionsKeyboard offers to restore the original content of a note and its
+// latest revisions
+func revisionsKeyboard(noteID int, revisions []storage.NoteRevision) [][]gotgbot.InlineKeyboardButton {
+	var keyboard [][]gotgbot.InlineKeyboardButton
+	var currentRow []gotgbot.InlineKeyboardButton
+
+	for i, revision := range revisions {
+		if i > 0 && i < len(revisions)-maxRevisionsShown {
+			continue
+		}
+
+		text := fmt.Sprintf("↩️ #%v", i+1)
+
+		if i == 0 {
+			text = "↩️ Original"
+		}
+
+		currentRow = append(currentRow, gotgbot.InlineKeyboardButton{
+			Text:         text,
+			CallbackData: fmt.Sprintf("revision_%v_%v", noteID, revision.ID),
+		})
+
+		if len(currentRow) == 3 {
+			keyboard = append(keyboard, currentRow)
+			currentRow = []gotgbot.InlineKeyboardButton{}
+		}
+	}
+
+	if len(currentRow) > 0 {
+		keyboard = append(keyboard, currentRow)
+	}
+
+	return append(keyboard, []gotgbot.InlineKeyboardButton{{
+		Text:         "✖️ Cancel",
+		CallbackData: "edit_cancel",
+	}})
+}
+
+// StartNoteEdit asks for the new content of the note under review, showing
+// its revisions
+func (h *BotHandler) StartNoteEdit(b *gotgbot.Bot, ctx *ext.Context) error {
+
+	if !checkUser(ctx.Update.CallbackQuery.From.Id) {
+		return nil
+	}
+
+	cb := ctx.Update.CallbackQuery
+
+	noteID, err := strconv.Atoi(strings.TrimPrefix(cb.Data, "note_edit_"))
+
+	if err != nil {
+		return h.editMessage(b, cb.Message, "Got invalid response", nil)
+	}
+
+	_, err = cb.Answer(b, &gotgbot.AnswerCallbackQueryOpts{
+		Text: "Editing",
+	})
+
+	if err != nil {
+		return fmt.Errorf("failed to answer callback query: %w", err)
+	}
+
+	note, err := h.service.repo.GetNote(noteID)
+
+	if err != nil {
+		log.Printf("Failed to get note to edit: %v", err)
+		return h.editMessage(b, cb.Message, "Could not find the note", nil)
+	}
+
+	revisions, err := h.service.GetNoteRevisions(noteID)
+
+	if err != nil {
+		log.Printf("Failed to get revisions of note %v: %v", noteID, err)
+	}
+
+	text := fmt.Sprintf(
+		"📝 <b>Edit note</b>\n"+
+			"━━━━━━━━━━━━━━\n"+
+			"<code>%s</code>\n\n"+
+			"Reply with the new text of the note.",
+		html.EscapeString(note.Content),
+	)
+
+	if len(revisions) > 0 {
+		text = text + " Earlier versions can be restored:\n\n" + formatRevisions(revisions)
+	}
+
+	h.endFlows(cb.Message.GetChat().Id)
+	h.setEditing(cb.Message.GetChat().Id, noteID)
+
+	err = h.editMessage(b, cb.Message, text, &gotgbot.EditMessageTextOpts{
+		ParseMode: "HTML",
+		ReplyMarkup: gotgbot.InlineKeyboardMarkup{
+			InlineKeyboard: revisionsKeyboard(noteID, revisions),
+		},
+	})
+
+	if err != nil {
+		return err
+	}
+
+	return handlers.NextConversationState(editStateText)
+}
+
+// HandleNoteEdit replaces the content of the note being edited with the
+// reply and shows the card again
+func (h *BotHandler) HandleNoteEdit(b *gotgbot.Bot, ctx *ext.Context) error {
+
+	if !checkUser(ctx.EffectiveMessage.From.Id) {
+		return nil
+	}
+
+	chatID := ctx.EffectiveChat.Id
+
+	noteID, ok := h.getEditing(chatID)
+
+	if !ok {
+		return handlers.EndConversation()
+	}
+
+	err := h.service.EditNote(noteID, ctx.EffectiveMessage.Text)
+
+	switch {
+	case errors.Is(err, storage.ErrContentUnchanged):
+		_, err = ctx.EffectiveMessage.Reply(b, "The note is unchanged, send a different text or /cancel", nil)
+		return err
+	case err != nil:
+		log.Printf("Failed to edit note: %v", err)
+		_, err = ctx.EffectiveMessage.Reply(b, fmt.Sprintf("Could not update the note: %v", err), nil)
+		return err
+	}
+
+	h.takeEditing(chatID)
+
+	if err := h.showCurrentAgain(b, ctx.EffectiveMessage.From.Id, chatID, nil); err != nil {
+		log.Printf("Failed to show edited note: %v", err)
+	}
+
+	return handlers.EndConversation()
+}
+
+// RestoreNoteRevision puts back an earlier content of the note being edited
+func (h *BotHandler) RestoreNoteRevision(b *gotgbot.Bot, ctx *ext.Context) error {
+
+	if !checkUser(ctx.Update.CallbackQuery.From.Id) {
+		return nil
+	}
+
+	cb := ctx.Update.CallbackQuery
+	parts := strings.Split(cb.Data, "_")
+
+	if len(parts) != 3 {
+		return h.editMessage(b, cb.Message, "Got invalid response", nil)
+	}
+
+	noteID, err := strconv.Atoi(parts[1])
+
+	if err != nil {
+		return h.editMessage(b, cb.Message, "Got invalid response", nil)
+	}
+
+	revisionID, err := strconv.Atoi(parts[2])
+
+	if err != nil {
+		return h.editMessage(b, cb.Message, "Got invalid response", nil)
+	}
+
+	err = h.service.RestoreRevision(noteID, revisionID)
+
+	if err != nil && !errors.Is(err, storage.ErrContentUnchanged) {
+		log.Printf("Failed to restore revision %v of note %v: %v", revisionID, noteID, err)
+		_, err = cb.Answer(b, &gotgbot.AnswerCallbackQueryOpts{
+			Text: "Failed to restore the note",
+		})
+		return err
+	}
+
+	_, err = cb.Answer(b, &gotgbot.AnswerCallbackQueryOpts{
+		Text: "Restored",
+	})
+
+	if err != nil {
+		return fmt.Errorf("failed to answer callback query: %w", err)
+	}
+
+	h.takeEditing(cb.Message.GetChat().Id)
+
+	if err := h.showCurrentAgain(b, cb.From.Id, cb.Message.GetChat().Id, cb.Message); err != nil {
+		log.Printf("Failed to show restored note: %v", err)
+	}
+
+	return handlers.EndConversation()
+}
+
+// CancelNoteEdit leaves the note as it was and shows the card again
+func (h *BotHandler) CancelNoteEdit(b *gotgbot.Bot, ctx *ext.Context) error {
+	chatID := ctx.EffectiveChat.Id
+
+	h.takeEditing(chatID)
+
+	var msg gotgbot.MaybeInaccessibleMessage
+
+	if cb := ctx.Update.CallbackQuery; cb != nil {
+		if _, err := cb.Answer(b, nil); err != nil {
+			return fmt.Errorf("failed to answer callback query: %w", err)
+		}
+
+		msg = cb.Message
+	}
+
+	if err := h.showCurrentAgain(b, ctx.EffectiveSender.Id(), chatID, msg); err != nil {
+		log.Printf("Failed to show note after cancelling edit: %v", err)
+	}
+
+	return handlers.EndConversation()
+}
@@ -0,0 +1,116 @@
+package bot
+
+import (
+	"testing"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/amalrajan30/spacedgram/internal/storage"
+)
+
+func TestAddNote(t *testing.T) {
+	s, db := testService(t)
+	source := testSource(t, db, storage.Source{})
+
+	if _, err := s.AddSource("  "); err == nil {
+		t.Error("AddSource accepted an empty title")
+	}
+
+	// Naming an existing source adds to it
+	if found, err := s.AddSource(" " + source.Title + " "); err != nil || found.ID != source.ID {
+		t.Errorf("AddSource = %+v, %v, want the existing source", found, err)
+	}
+
+	if _, err := s.AddNote(int(source.ID), " \n ", "", ""); err == nil {
+		t.Error("AddNote accepted an empty note")
+	}
+
+	note, err := s.AddNote(int(source.ID), " Memento mori ", "Memento ____", "mori")
+
+	if err != nil {
+		t.Fatalf("AddNote failed: %v", err)
+	}
+
+	t.Cleanup(func() {
+		db.Unscoped().Where("note_id = ?", note.ID).Delete(&storage.GenerationJob{})
+	})
+
+	added, err := s.repo.GetNote(int(note.ID))
+
+	if err != nil || added.Content != "Memento mori" || added.Question != "Memento ____" || added.Answer != "mori" || added.SourceID != int(source.ID) {
+		t.Errorf("added note = %+v (%v), want the trimmed note with its question", added, err)
+	}
+
+	var jobs int64
+	db.Model(&storage.GenerationJob{}).Where("note_id = ? AND kind = ?", note.ID, storage.GenerationKindTags).Count(&jobs)
+
+	if jobs != 1 {
+		t.Errorf("%v tag suggestion jobs queued, want 1", jobs)
+	}
+}
+
+func TestRestoreRevision(t *testing.T) {
+	s, db := testService(t)
+	source := testSource(t, db, storage.Source{})
+
+	note := storage.Note{Content: "Original", SourceID: int(source.ID)}
+	other := storage.Note{Content: "Other", SourceID: int(source.ID)}
+
+	for _, n := range []*storage.Note{&note, &other} {
+		if err := db.Create(n).Error; err != nil {
+			t.Fatalf("failed to create note: %v", err)
+		}
+	}
+
+	t.Cleanup(func() {
+		db.Unscoped().Where("note_id IN ?", []uint{note.ID, other.ID}).Delete(&storage.NoteRevision{})
+	})
+
+	if err := s.EditNote(int(note.ID), "Edited"); err != nil {
+		t.Fatalf("EditNote failed: %v", err)
+	}
+
+	revisions, err := s.GetNoteRevisions(int(note.ID))
+
+	if err != nil || len(revisions) != 1 {
+		t.Fatalf("revisions = %+v (%v), want the original", revisions, err)
+	}
+
+	if err := s.RestoreRevision(int(other.ID), int(revisions[0].ID)); err == nil {
+		t.Error("RestoreRevision restored the revision of another note")
+	}
+
+	if err := s.RestoreRevision(int(note.ID), int(revisions[0].ID)); err != nil {
+		t.Fatalf("RestoreRevision failed: %v", err)
+	}
+
+	if restored, err := s.repo.GetNote(int(note.ID)); err != nil || restored.Content != "Original" {
+		t.Errorf("restored note = %q (%v), want the original", restored.Content, err)
+	}
+
+	// The replaced content is kept, so restoring can be undone
+	if revisions, err := s.GetNoteRevisions(int(note.ID)); err != nil || len(revisions) != 2 || revisions[1].Content != "Edited" {
+		t.Errorf("revisions after restoring = %+v (%v), want the edit kept", revisions, err)
+	}
+}
+
+func TestIsNoteText(t *testing.T) {
+	origin := gotgbot.MessageOriginUser{Date: 1, SenderUser: gotgbot.User{FirstName: "Ada"}}
+
+	tests := []struct {
+		name string
+		msg  gotgbot.Message
+		want bool
+	}{
+		{"text", gotgbot.Message{Text: "A thought"}, true},
+		{"command", gotgbot.Message{Text: "/cancel"}, false},
+		{"forwarded", gotgbot.Message{Text: "Quote", ForwardOrigin: origin}, false},
+		{"reply to another chat", gotgbot.Message{Text: "Look", ExternalReply: &gotgbot.ExternalReplyInfo{Origin: origin}}, false},
+		{"photo", gotgbot.Message{Caption: "Caption"}, false},
+	}
+
+	for _, test := range tests {
+		if got := isNoteText(&test.msg); got != test.want {
+			t.Errorf("isNoteText(%v) = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,252 @@
+package bot
+
+import (
+	"fmt"
+	"math/rand"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/amalrajan30/spacedgram/internal/spaced"
+	"github.com/amalrajan30/spacedgram/internal/storage"
+)
+
+// dailyLimit tracks how many cards can still be reviewed today. A negative
+// remaining count means there is no limit.
+type dailyLimit struct {
+	newLeft     int
+	reviewsLeft int
+}
+
+func remaining(limit int, done int) int {
+	if done >= limit {
+		return 0
+	}
+	return limit - done
+}
+
+func (l *dailyLimit) left(isNew bool) *int {
+	if isNew {
+		return &l.newLeft
+	}
+	return &l.reviewsLeft
+}
+
+func (l *dailyLimit) available(isNew bool) bool {
+	return *l.left(isNew) != 0
+}
+
+func (l *dailyLimit) take(isNew bool) {
+	if left := l.left(isNew); *left > 0 {
+		*left--
+	}
+}
+
+// interleave spreads the new cards evenly between the reviews
+func interleave(reviews []int, newNotes []int) []int {
+	gap := 1
+	if len(newNotes) > 0 && len(reviews) > len(newNotes) {
+		gap = len(reviews) / len(newNotes)
+	}
+
+	queue := make([]int, 0, len(reviews)+len(newNotes))
+	ri, ni := 0, 0
+
+	for ri < len(reviews) || ni < len(newNotes) {
+		for i := 0; i < gap && ri < len(reviews); i++ {
+			queue = append(queue, reviews[ri])
+			ri++
+		}
+
+		if ni < len(newNotes) {
+			queue = append(queue, newNotes[ni])
+			ni++
+		}
+	}
+
+	return queue
+}
+
+var locationNumber = regexp.MustCompile(`\d+`)
+
+// locationOf returns the first number of a highlight location, so that
+// "Location 1234-1240" sorts before "Location 1300"
+func locationOf(note storage.Note) int {
+	location, _ := strconv.Atoi(locationNumber.FindString(note.Location))
+	return location
+}
+
+// dueBefore sorts notes by due date, most overdue first. Notes that were
+// never reviewed keep their import order.
+func dueBefore(a storage.Note, b storage.Note) bool {
+	switch {
+	case a.NextDueDate == nil && b.NextDueDate == nil:
+		return a.ID < b.ID
+	case a.NextDueDate == nil:
+		return false
+	case b.NextDueDate == nil:
+		return true
+	default:
+		return a.NextDueDate.Before(*b.NextDueDate)
+	}
+}
+
+// roundRobin takes one note from each source in turn, keeping the order of
+// the notes within a source
+func roundRobin(notes []storage.Note) []storage.Note {
+	sourceOrder := []int{}
+	bySource := map[int][]storage.Note{}
+
+	for _, note := range notes {
+		if _, ok := bySource[note.SourceID]; !ok {
+			sourceOrder = append(sourceOrder, note.SourceID)
+		}
+		bySource[note.SourceID] = append(bySource[note.SourceID], note)
+	}
+
+	ordered := make([]storage.Note, 0, len(notes))
+
+	for len(ordered) < len(notes) {
+		for _, sourceID := range sourceOrder {
+			if sourceNotes := bySource[sourceID]; len(sourceNotes) > 0 {
+				ordered = append(ordered, sourceNotes[0])
+				bySource[sourceID] = sourceNotes[1:]
+			}
+		}
+	}
+
+	return ordered
+}
+
+// orderNotes sorts the notes of a session following one of the
+// storage.QueueOrders
+func orderNotes(notes []storage.Note, order string, now time.Time) []storage.Note {
+	switch order {
+	case storage.QueueOrderRetrievability:
+		sort.SliceStable(notes, func(i, j int) bool {
+			return spaced.Retrievability(notes[i], now) < spaced.Retrievability(notes[j], now)
+		})
+	case storage.QueueOrderLocation:
+		sort.SliceStable(notes, func(i, j int) bool {
+			if notes[i].SourceID != notes[j].SourceID {
+				return notes[i].SourceID < notes[j].SourceID
+			}
+			return locationOf(notes[i]) < locationOf(notes[j])
+		})
+	case storage.QueueOrderRandom:
+		rand.Shuffle(len(notes), func(i, j int) {
+			notes[i], notes[j] = notes[j], notes[i]
+		})
+	case storage.QueueOrderRoundRobin:
+		sort.SliceStable(notes, func(i, j int) bool {
+			return dueBefore(notes[i], notes[j])
+		})
+		return roundRobin(notes)
+	default:
+		sort.SliceStable(notes, func(i, j int) bool {
+			return dueBefore(notes[i], notes[j])
+		})
+	}
+
+	return notes
+}
+
+// interleaved returns whether new cards are spread evenly between the
+// reviews for a queue order. Orders by urgency have no place for new cards,
+// the others place them along with the reviews.
+func interleaved(order string) bool {
+	return order == storage.QueueOrderOverdue || order == storage.QueueOrderRetrievability
+}
+
+// buildQueue orders the notes of a session following the user's queue order
+// and holds back the ones going over the user's and the sources' daily
+// limits. New cards are interleaved with the reviews for orders by urgency.
+func (s BotService) buildQueue(userID int64, settings storage.UserSettings, notes []storage.Note) (noteIDs []int, heldBack int, err error) {
+	counts, err := s.repo.CountReviewsSince(userID, settings.DayStart(time.Now()))
+
+	if err != nil {
+		return nil, 0, fmt.Errorf("counting todays reviews: %w", err)
+	}
+
+	newDone, reviewsDone := 0, 0
+	done := map[int]storage.ReviewCount{}
+
+	for _, count := range counts {
+		newDone += count.New
+		reviewsDone += count.Reviews
+		done[count.SourceID] = count
+	}
+
+	userLimit := dailyLimit{
+		newLeft:     remaining(settings.NewCardsPerDay, newDone),
+		reviewsLeft: remaining(settings.MaxReviewsPerDay, reviewsDone),
+	}
+
+	sourceIDs := []int{}
+	for _, note := range notes {
+		if !slices.Contains(sourceIDs, note.SourceID) {
+			sourceIDs = append(sourceIDs, note.SourceID)
+		}
+	}
+
+	sources, err := s.repo.GetSourcesByID(sourceIDs)
+
+	if err != nil {
+		return nil, 0, err
+	}
+
+	sourceLimits := map[int]*dailyLimit{}
+
+	for _, sourceID := range sourceIDs {
+		source, ok := sources[sourceID]
+
+		if !ok {
+			return nil, 0, fmt.Errorf("source %d not found", sourceID)
+		}
+
+		limit := &dailyLimit{newLeft: -1, reviewsLeft: -1}
+
+		if source.NewCardsPerDay != nil {
+			limit.newLeft = remaining(*source.NewCardsPerDay, done[sourceID].New)
+		}
+
+		if source.MaxReviewsPerDay != nil {
+			limit.reviewsLeft = remaining(*source.MaxReviewsPerDay, done[sourceID].Reviews)
+		}
+
+		sourceLimits[sourceID] = limit
+	}
+
+	picked := []int{}
+	reviewIDs := []int{}
+	newIDs := []int{}
+
+	for _, note := range orderNotes(notes, settings.QueueOrder, time.Now()) {
+		isNew := note.NextDueDate == nil
+
+		limit := sourceLimits[note.SourceID]
+
+		if !limit.available(isNew) || !userLimit.available(isNew) {
+			heldBack++
+			continue
+		}
+
+		limit.take(isNew)
+		userLimit.take(isNew)
+		picked = append(picked, int(note.ID))
+
+		if isNew {
+			newIDs = append(newIDs, int(note.ID))
+		} else {
+			reviewIDs = append(reviewIDs, int(note.ID))
+		}
+	}
+
+	if interleaved(settings.QueueOrder) {
+		return interleave(reviewIDs, newIDs), heldBack, nil
+	}
+
+	return picked, heldBack, nil
+}
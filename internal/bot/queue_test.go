@@ -0,0 +1,252 @@
+package bot
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/amalrajan30/spacedgram/internal/storage"
+	"gorm.io/gorm"
+)
+
+func TestInterleave(t *testing.T) {
+	tests := []struct {
+		name     string
+		reviews  []int
+		newNotes []int
+		want     []int
+	}{
+		{"evenly", []int{1, 2, 3, 4}, []int{10, 11}, []int{1, 2, 10, 3, 4, 11}},
+		{"uneven", []int{1, 2, 3, 4, 5}, []int{10, 11}, []int{1, 2, 10, 3, 4, 11, 5}},
+		{"more new cards", []int{1}, []int{10, 11, 12}, []int{1, 10, 11, 12}},
+		{"no new cards", []int{1, 2}, nil, []int{1, 2}},
+		{"no reviews", nil, []int{10, 11}, []int{10, 11}},
+		{"empty", nil, nil, []int{}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := interleave(test.reviews, test.newNotes); !slices.Equal(got, test.want) {
+				t.Errorf("interleave(%v, %v) = %v, want %v", test.reviews, test.newNotes, got, test.want)
+			}
+		})
+	}
+}
+
+func TestDailyLimit(t *testing.T) {
+	limit := dailyLimit{newLeft: remaining(2, 1), reviewsLeft: -1}
+
+	if !limit.available(true) {
+		t.Fatal("no new card left, want 1")
+	}
+
+	limit.take(true)
+
+	if limit.available(true) {
+		t.Error("a new card is left after taking the last one")
+	}
+
+	for i := 0; i < 3; i++ {
+		limit.take(false)
+	}
+
+	if !limit.available(false) || limit.reviewsLeft != -1 {
+		t.Errorf("reviews left = %v, want no limit", limit.reviewsLeft)
+	}
+
+	if got := remaining(5, 7); got != 0 {
+		t.Errorf("remaining(5, 7) = %v, want 0", got)
+	}
+}
+
+func TestBuildQueue(t *testing.T) {
+	s, db := testService(t)
+	userID := testUserID(t, db)
+
+	one := 1
+	limited := testSource(t, db, storage.Source{NewCardsPerDay: &one})
+	unlimited := testSource(t, db, storage.Source{})
+
+	now := time.Now()
+	due := func(days int) *time.Time {
+		at := now.AddDate(0, 0, -days)
+		return &at
+	}
+
+	note := func(id uint, sourceID uint, nextDue *time.Time) storage.Note {
+		return storage.Note{Model: gorm.Model{ID: id}, SourceID: int(sourceID), NextDueDate: nextDue}
+	}
+
+	notes := []storage.Note{
+		note(1, unlimited.ID, due(1)),
+		note(2, unlimited.ID, due(4)),
+		note(3, unlimited.ID, due(2)),
+		note(4, unlimited.ID, due(3)),
+		note(5, limited.ID, nil),
+		note(6, limited.ID, nil),
+		note(7, unlimited.ID, nil),
+	}
+
+	settings := storage.UserSettings{Timezone: "UTC", NewCardsPerDay: 2, MaxReviewsPerDay: 3, QueueOrder: storage.QueueOrderOverdue}
+
+	queue, heldBack, err := s.buildQueue(userID, settings, notes)
+
+	if err != nil {
+		t.Fatalf("buildQueue failed: %v", err)
+	}
+
+	// The most overdue reviews first, and a single new card of the limited
+	// source
+	if want := []int{2, 5, 4, 7, 3}; !slices.Equal(queue, want) {
+		t.Errorf("queue = %v, want %v", queue, want)
+	}
+
+	if heldBack != 2 {
+		t.Errorf("held back %v notes, want 2", heldBack)
+	}
+
+	// Orders other than by urgency keep new cards in their place
+	location := settings
+	location.QueueOrder = storage.QueueOrderLocation
+
+	queue, heldBack, err = s.buildQueue(userID, location, slices.Clone(notes))
+
+	if err != nil {
+		t.Fatalf("buildQueue failed: %v", err)
+	}
+
+	if want := []int{5, 1, 2, 3, 7}; !slices.Equal(queue, want) || heldBack != 2 {
+		t.Errorf("queue by location = %v, held back %v, want %v, held back 2", queue, heldBack, want)
+	}
+
+	// New cards reviewed today count towards the limits
+	_, err = s.repo.InsertReviewLog(storage.ReviewLog{
+		UserID:     userID,
+		NoteID:     8,
+		SourceID:   int(limited.ID),
+		WasNew:     true,
+		ReviewedAt: now,
+	})
+
+	if err != nil {
+		t.Fatalf("InsertReviewLog failed: %v", err)
+	}
+
+	queue, heldBack, err = s.buildQueue(userID, settings, notes)
+
+	if err != nil {
+		t.Fatalf("buildQueue failed: %v", err)
+	}
+
+	if want := []int{2, 4, 3, 7}; !slices.Equal(queue, want) {
+		t.Errorf("queue after a new card = %v, want %v", queue, want)
+	}
+
+	if heldBack != 3 {
+		t.Errorf("held back %v notes after a new card, want 3", heldBack)
+	}
+}
+
+func TestInterleaved(t *testing.T) {
+	tests := map[string]bool{
+		storage.QueueOrderOverdue:        true,
+		storage.QueueOrderRetrievability: true,
+		storage.QueueOrderLocation:       false,
+		storage.QueueOrderRandom:         false,
+		storage.QueueOrderRoundRobin:     false,
+	}
+
+	for order, want := range tests {
+		if got := interleaved(order); got != want {
+			t.Errorf("interleaved(%q) = %v, want %v", order, got, want)
+		}
+	}
+}
+
+func TestLocationOf(t *testing.T) {
+	tests := []struct {
+		location string
+		want     int
+	}{
+		{"1234", 1234},
+		{"Location 120-125", 120},
+		{"page 7", 7},
+		{"", 0},
+		{"unknown", 0},
+	}
+
+	for _, test := range tests {
+		if got := locationOf(storage.Note{Location: test.location}); got != test.want {
+			t.Errorf("locationOf(%q) = %v, want %v", test.location, got, test.want)
+		}
+	}
+}
+
+func TestRoundRobin(t *testing.T) {
+	notes := []storage.Note{
+		{SourceID: 1, Content: "a1"},
+		{SourceID: 1, Content: "a2"},
+		{SourceID: 1, Content: "a3"},
+		{SourceID: 2, Content: "b1"},
+		{SourceID: 3, Content: "c1"},
+		{SourceID: 3, Content: "c2"},
+	}
+
+	got := []string{}
+	for _, note := range roundRobin(notes) {
+		got = append(got, note.Content)
+	}
+
+	if want := []string{"a1", "b1", "c1", "a2", "c2", "a3"}; !slices.Equal(got, want) {
+		t.Errorf("roundRobin = %v, want %v", got, want)
+	}
+}
+
+func TestOrderNotes(t *testing.T) {
+	now := time.Date(2024, 3, 10, 12, 0, 0, 0, time.UTC)
+	daysAgo := func(days int) *time.Time {
+		at := now.AddDate(0, 0, -days)
+		return &at
+	}
+
+	notes := func() []storage.Note {
+		return []storage.Note{
+			{Model: gorm.Model{ID: 1}, SourceID: 2, Location: "Location 900", NextDueDate: daysAgo(1), LastReviewed: daysAgo(2), Interval: 1},
+			{Model: gorm.Model{ID: 2}, SourceID: 1, Location: "Location 1200", NextDueDate: daysAgo(5), LastReviewed: daysAgo(15), Interval: 10},
+			{Model: gorm.Model{ID: 3}, SourceID: 1, Location: "Location 300"},
+			{Model: gorm.Model{ID: 4}, SourceID: 2, Location: "Location 100", NextDueDate: daysAgo(3), LastReviewed: daysAgo(13), Interval: 10},
+		}
+	}
+
+	tests := []struct {
+		order string
+		want  []uint
+	}{
+		// Never reviewed notes go last
+		{storage.QueueOrderOverdue, []uint{2, 4, 1, 3}},
+		// Retrievability of a day overdue on a 1 day interval is 0.81, of 5
+		// days overdue on a 10 day interval 0.85
+		{storage.QueueOrderRetrievability, []uint{3, 1, 2, 4}},
+		{storage.QueueOrderLocation, []uint{3, 2, 4, 1}},
+		{storage.QueueOrderRoundRobin, []uint{2, 4, 3, 1}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.order, func(t *testing.T) {
+			got := []uint{}
+			for _, note := range orderNotes(notes(), test.order, now) {
+				got = append(got, note.ID)
+			}
+
+			if !slices.Equal(got, test.want) {
+				t.Errorf("orderNotes by %v = %v, want %v", test.order, got, test.want)
+			}
+		})
+	}
+
+	shuffled := orderNotes(notes(), storage.QueueOrderRandom, now)
+
+	if len(shuffled) != 4 {
+		t.Errorf("random order kept %v of 4 notes", len(shuffled))
+	}
+}
@@ -0,0 +1,156 @@
+package bot
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+	"github.com/amalrajan30/spacedgram/internal/llm"
+)
+
+// Number of similar highlights shown next to a card
+const relatedResults = 3
+
+func relatedRow(noteID uint) []gotgbot.InlineKeyboardButton {
+	return []gotgbot.InlineKeyboardButton{{
+		Text:         "🔗 Related",
+		CallbackData: fmt.Sprintf("related_%v", noteID),
+	}}
+}
+
+// ShowRelated sends the highlights linked to the card under review and the
+// closest ones of other sources, which can be marked as helpful
+func (h *BotHandler) ShowRelated(b *gotgbot.Bot, ctx *ext.Context) error {
+
+	if !checkUser(ctx.Update.CallbackQuery.From.Id) {
+		return nil
+	}
+
+	cb := ctx.Update.CallbackQuery
+
+	noteID, err := strconv.Atoi(strings.TrimPrefix(cb.Data, "related_"))
+
+	if err != nil {
+		_, err = cb.Answer(b, &gotgbot.AnswerCallbackQueryOpts{Text: "Got invalid response"})
+		return err
+	}
+
+	related, err := h.service.Related(noteID, relatedResults)
+
+	if err != nil {
+		log.Printf("Failed to find related notes of %v: %v", noteID, err)
+
+		text := "Could not find related highlights"
+		if errors.Is(err, llm.ErrBudgetExceeded) {
+			text = "LLM budget reached, try again later"
+		}
+
+		_, err = cb.Answer(b, &gotgbot.AnswerCallbackQueryOpts{Text: text})
+		return err
+	}
+
+	if len(related.Linked) == 0 && len(related.Similar) == 0 {
+		_, err = cb.Answer(b, &gotgbot.AnswerCallbackQueryOpts{Text: "No related highlights found"})
+		return err
+	}
+
+	_, err = cb.Answer(b, nil)
+
+	if err != nil {
+		return fmt.Errorf("failed to answer callback query: %w", err)
+	}
+
+	text := "🔗 <b>Related highlights</b>\n" +
+		"━━━━━━━━━━━━━━\n"
+
+	position := 0
+
+	if len(related.Linked) > 0 {
+		text = text + "<b>Linked</b>\n"
+
+		for _, note := range related.Linked {
+			position++
+			text = text + formatSearchResult(position, note)
+		}
+	}
+
+	var keyboardRows [][]gotgbot.InlineKeyboardButton
+
+	if len(related.Similar) > 0 {
+		if len(related.Linked) > 0 {
+			text = text + "<b>Similar</b>\n"
+		}
+
+		for _, result := range related.Similar {
+			position++
+			text = text + formatSearchResult(position, result.Note)
+
+			keyboardRows = append(keyboardRows, []gotgbot.InlineKeyboardButton{{
+				Text:         fmt.Sprintf("👍 #%v is helpful", position),
+				CallbackData: fmt.Sprintf("link_%v_%v", noteID, result.Note.ID),
+			}})
+		}
+	}
+
+	_, err = b.SendMessage(cb.Message.GetChat().Id, text, &gotgbot.SendMessageOpts{
+		ParseMode: "HTML",
+		ReplyMarkup: gotgbot.InlineKeyboardMarkup{
+			InlineKeyboard: keyboardRows,
+		},
+	})
+
+	if err != nil {
+		return fmt.Errorf("Failed to send related notes: %w", err)
+	}
+
+	return nil
+}
+
+// LinkRelated remembers a related highlight marked as helpful
+func (h *BotHandler) LinkRelated(b *gotgbot.Bot, ctx *ext.Context) error {
+
+	if !checkUser(ctx.Update.CallbackQuery.From.Id) {
+		return nil
+	}
+
+	cb := ctx.Update.CallbackQuery
+	parts := strings.Split(cb.Data, "_")
+
+	if len(parts) != 3 {
+		_, err := cb.Answer(b, &gotgbot.AnswerCallbackQueryOpts{Text: "Got invalid response"})
+		return err
+	}
+
+	noteID, err := strconv.Atoi(parts[1])
+
+	if err != nil {
+		_, err = cb.Answer(b, &gotgbot.AnswerCallbackQueryOpts{Text: "Got invalid response"})
+		return err
+	}
+
+	relatedNoteID, err := strconv.Atoi(parts[2])
+
+	if err != nil {
+		_, err = cb.Answer(b, &gotgbot.AnswerCallbackQueryOpts{Text: "Got invalid response"})
+		return err
+	}
+
+	text := "🔗 Linked, it will show up with this highlight"
+
+	if err := h.service.LinkNotes(noteID, relatedNoteID); err != nil {
+		log.Printf("Failed to link notes: %v", err)
+		text = "Could not link the highlights"
+	}
+
+	_, err = cb.Answer(b, &gotgbot.AnswerCallbackQueryOpts{Text: text})
+
+	if err != nil {
+		return fmt.Errorf("failed to answer callback query: %w", err)
+	}
+
+	return nil
+}
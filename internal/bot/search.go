@@ -0,0 +1,287 @@
+package bot
+
+import (
+	"fmt"
+	"log"
+	"sort"
+
+	"github.com/amalrajan30/spacedgram/internal/llm"
+	"github.com/amalrajan30/spacedgram/internal/storage"
+)
+
+// Number of notes embedded per call
+const embedBatchSize = 64
+
+// EmbedPendingNotes embeds the notes that have no embedding for the current
+// model yet, and returns how many were embedded. It does nothing while
+// another call is running.
+func (s BotService) EmbedPendingNotes() (int, error) {
+	if !s.embedMux.TryLock() {
+		return 0, nil
+	}
+	defer s.embedMux.Unlock()
+
+	model, err := llm.EmbeddingModel()
+
+	if err != nil {
+		return 0, err
+	}
+
+	embedded := 0
+
+	for {
+		notes, err := s.repo.GetNotesWithoutEmbedding(model, embedBatchSize)
+
+		if err != nil {
+			return embedded, err
+		}
+
+		if len(notes) == 0 {
+			break
+		}
+
+		texts := []string{}
+		for _, note := range notes {
+			texts = append(texts, note.Content)
+		}
+
+		embeddings, err := llm.Embed(texts)
+
+		if err != nil {
+			return embedded, fmt.Errorf("embedding notes: %w", err)
+		}
+
+		for i, note := range notes {
+			if err := s.repo.SaveEmbedding(int(note.ID), model, embeddings.Vectors[i]); err != nil {
+				return embedded, err
+			}
+
+			s.index.Add(model, int(note.ID), embeddings.Vectors[i])
+		}
+
+		embedded += len(notes)
+
+		if len(notes) < embedBatchSize {
+			break
+		}
+	}
+
+	if embedded > 0 {
+		log.Printf("Embedded %v notes", embedded)
+	}
+
+	return embedded, nil
+}
+
+type SearchResult struct {
+	Note  storage.Note
+	Score float64
+}
+
+// Search returns the notes closest in meaning to query, best first
+func (s BotService) Search(query string, limit int) ([]SearchResult, error) {
+	model, err := llm.EmbeddingModel()
+
+	if err != nil {
+		return nil, err
+	}
+
+	embeddings, err := llm.Embed([]string{query})
+
+	if err != nil {
+		return nil, fmt.Errorf("embedding query: %w", err)
+	}
+
+	scores, err := s.nearest(model, embeddings.Vectors[0], 0, limit)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return s.searchResults(scores)
+}
+
+// nearest returns the similarity to vector of the limit closest notes,
+// leaving out the notes of excludeSourceID unless it is 0. pgvector is used
+// when available, the in-memory index otherwise.
+func (s BotService) nearest(model string, vector []float32, excludeSourceID int, limit int) (map[int]float64, error) {
+	scores := map[int]float64{}
+
+	if s.repo.HasPgvector() {
+		matches, err := s.repo.SearchEmbeddings(model, vector, excludeSourceID, limit)
+
+		if err != nil {
+			return nil, err
+		}
+
+		for _, match := range matches {
+			scores[match.NoteID] = match.Score
+		}
+
+		return scores, nil
+	}
+
+	err := s.index.Load(model, func() (map[int][]float32, error) {
+		stored, err := s.repo.GetEmbeddings(model)
+
+		if err != nil {
+			return nil, err
+		}
+
+		vectors := map[int][]float32{}
+		for _, embedding := range stored {
+			vectors[embedding.NoteID] = embedding.Vector
+		}
+
+		return vectors, nil
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("loading search index: %w", err)
+	}
+
+	var skip func(id int) bool
+
+	if excludeSourceID != 0 {
+		ids, err := s.repo.GetNoteIDs(excludeSourceID)
+
+		if err != nil {
+			return nil, err
+		}
+
+		excluded := map[int]bool{}
+		for _, id := range ids {
+			excluded[id] = true
+		}
+
+		skip = func(id int) bool {
+			return excluded[id]
+		}
+	}
+
+	for _, match := range s.index.Search(vector, limit, skip) {
+		scores[match.ID] = match.Score
+	}
+
+	return scores, nil
+}
+
+// searchResults loads the notes of scores, best first
+func (s BotService) searchResults(scores map[int]float64) ([]SearchResult, error) {
+	if len(scores) == 0 {
+		return nil, nil
+	}
+
+	ids := []int{}
+	for id := range scores {
+		ids = append(ids, id)
+	}
+
+	notes, err := s.repo.GetNotesByIDs(ids)
+
+	if err != nil {
+		return nil, err
+	}
+
+	results := []SearchResult{}
+
+	for _, note := range notes {
+		results = append(results, SearchResult{
+			Note:  note,
+			Score: scores[int(note.ID)],
+		})
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Score > results[j].Score
+	})
+
+	return results, nil
+}
+
+// RelatedNotes are the notes shown next to a card under review
+type RelatedNotes struct {
+	// Notes linked to the card earlier
+	Linked []storage.Note
+	// Closest notes of other sources that aren't linked yet
+	Similar []SearchResult
+}
+
+// Related returns the notes linked to a note and up to limit notes of other
+// sources closest in meaning to it. Notes without an embedding get one.
+func (s BotService) Related(noteID int, limit int) (*RelatedNotes, error) {
+	note, err := s.repo.GetNote(noteID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	linked, err := s.repo.GetLinkedNotes(noteID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	model, err := llm.EmbeddingModel()
+
+	if err != nil {
+		return nil, err
+	}
+
+	var vector []float32
+
+	embedding, err := s.repo.GetEmbedding(noteID, model)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if embedding != nil {
+		vector = embedding.Vector
+	} else {
+		embeddings, err := llm.Embed([]string{note.Content})
+
+		if err != nil {
+			return nil, fmt.Errorf("embedding note: %w", err)
+		}
+
+		vector = embeddings.Vectors[0]
+
+		if err := s.repo.SaveEmbedding(noteID, model, vector); err != nil {
+			return nil, err
+		}
+
+		s.index.Add(model, noteID, vector)
+	}
+
+	// Linked notes are shown anyway, ask for enough to fill the rest
+	scores, err := s.nearest(model, vector, note.SourceID, limit+len(linked))
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, linkedNote := range linked {
+		delete(scores, int(linkedNote.ID))
+	}
+
+	similar, err := s.searchResults(scores)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(similar) > limit {
+		similar = similar[:limit]
+	}
+
+	return &RelatedNotes{
+		Linked:  linked,
+		Similar: similar,
+	}, nil
+}
+
+// LinkNotes remembers a related note as helpful
+func (s BotService) LinkNotes(noteID int, relatedNoteID int) error {
+	return s.repo.LinkNotes(noteID, relatedNoteID)
+}
@@ -0,0 +1,128 @@
+package bot
+
+import (
+	"fmt"
+	"html"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+	"github.com/amalrajan30/spacedgram/internal/storage"
+)
+
+const (
+	searchResults = 5
+	searchSnippet = 200
+)
+
+// formatSearchResult shows a snippet of a matching note and where it's from
+func formatSearchResult(position int, note storage.Note) string {
+	return fmt.Sprintf(
+		"<b>%v.</b> <i>%s</i>\n📚 %s · %s\n\n",
+		position,
+		html.EscapeString(truncate(note.Content, searchSnippet)),
+		html.EscapeString(note.Source.Title),
+		html.EscapeString(note.Location),
+	)
+}
+
+func reviewNowRow(position int, note storage.Note) []gotgbot.InlineKeyboardButton {
+	return []gotgbot.InlineKeyboardButton{{
+		Text:         fmt.Sprintf("▶️ Review #%v", position),
+		CallbackData: fmt.Sprintf("search_review_%v", note.ID),
+	}}
+}
+
+// Search shows the highlights closest in meaning to the query, each with a
+// button to review it right away
+func (h *BotHandler) Search(b *gotgbot.Bot, ctx *ext.Context) error {
+
+	if !checkUser(ctx.Message.From.Id) {
+		return nil
+	}
+
+	query := strings.TrimSpace(strings.Join(ctx.Args()[1:], " "))
+
+	if query == "" {
+		_, err := ctx.EffectiveMessage.Reply(b, "Usage: /search <query>", nil)
+		return err
+	}
+
+	results, err := h.service.Search(query, searchResults)
+
+	if err != nil {
+		log.Printf("Failed to search notes: %v", err)
+		_, err = ctx.EffectiveMessage.Reply(b, "Search failed, try again later", nil)
+		return err
+	}
+
+	if len(results) == 0 {
+		_, err = ctx.EffectiveMessage.Reply(b, "No highlights found", nil)
+		return err
+	}
+
+	text := fmt.Sprintf(
+		"🔎 <b>Search:</b> %s\n"+
+			"━━━━━━━━━━━━━━\n",
+		html.EscapeString(query),
+	)
+
+	var keyboardRows [][]gotgbot.InlineKeyboardButton
+
+	for i, result := range results {
+		text = text + formatSearchResult(i+1, result.Note)
+		keyboardRows = append(keyboardRows, reviewNowRow(i+1, result.Note))
+	}
+
+	_, err = ctx.EffectiveMessage.Reply(b, text, &gotgbot.SendMessageOpts{
+		ParseMode: "HTML",
+		ReplyMarkup: gotgbot.InlineKeyboardMarkup{
+			InlineKeyboard: keyboardRows,
+		},
+	})
+
+	if err != nil {
+		return fmt.Errorf("Failed to send search results: %w", err)
+	}
+
+	return nil
+}
+
+// ReviewNow starts a review session of a single note
+func (h *BotHandler) ReviewNow(b *gotgbot.Bot, ctx *ext.Context) error {
+
+	if !checkUser(ctx.Update.CallbackQuery.From.Id) {
+		return nil
+	}
+
+	cb := ctx.Update.CallbackQuery
+
+	_, err := cb.Answer(b, &gotgbot.AnswerCallbackQueryOpts{
+		Text: "Starting Review....",
+	})
+
+	if err != nil {
+		return fmt.Errorf("failed to answer callback query: %w", err)
+	}
+
+	noteID, err := strconv.Atoi(cb.Data[strings.LastIndex(cb.Data, "_")+1:])
+
+	if err != nil {
+		return h.editMessage(b, cb.Message, "Got invalid response", nil)
+	}
+
+	note, err := h.service.repo.GetNote(noteID)
+
+	if err != nil {
+		log.Printf("Failed to get note to review: %v", err)
+		return h.editMessage(b, cb.Message, "Could not find the note", nil)
+	}
+
+	h.setUserData("source_id", note.SourceID)
+	h.setUserData("clozeQuestion", reviewModePlain)
+	h.startSession([]int{noteID}, 1)
+
+	return h.showReview(b, cb.From.Id, cb.Message.GetChat().Id, nil, "")
+}
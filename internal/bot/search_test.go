@@ -0,0 +1,121 @@
+package bot
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/amalrajan30/spacedgram/internal/llm"
+	"github.com/amalrajan30/spacedgram/internal/storage"
+)
+
+// testEmbedder embeds like the fake embedder under a model of its own, so
+// the embeddings of the test can be told apart
+type testEmbedder struct {
+	llm.FakeEmbedder
+	model string
+}
+
+func (e testEmbedder) Model() string {
+	return e.model
+}
+
+func TestSearch(t *testing.T) {
+	s, db := testService(t)
+	source := testSource(t, db, storage.Source{})
+	model := fmt.Sprintf("%v %v", t.Name(), time.Now().UnixNano())
+
+	llm.SetEmbedder(testEmbedder{model: model})
+	t.Cleanup(func() {
+		llm.SetEmbedder(nil)
+		db.Unscoped().Where("embed_model = ?", model).Delete(&storage.NoteEmbedding{})
+	})
+
+	for _, content := range []string{
+		"Zebras sleep standing up in the savanna",
+		"Octopuses have three hearts and blue blood",
+	} {
+		if err := db.Create(&storage.Note{Content: content, SourceID: int(source.ID)}).Error; err != nil {
+			t.Fatalf("failed to create note: %v", err)
+		}
+	}
+
+	embedded, err := s.EmbedPendingNotes()
+
+	if err != nil {
+		t.Fatalf("EmbedPendingNotes failed: %v", err)
+	}
+
+	if embedded < 2 {
+		t.Errorf("embedded %v notes, want at least the 2 of the test", embedded)
+	}
+
+	if embedded, err := s.EmbedPendingNotes(); err != nil || embedded != 0 {
+		t.Errorf("embedded %v notes again (%v), want none", embedded, err)
+	}
+
+	results, err := s.Search("how many hearts does an octopus have", 1)
+
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+
+	if len(results) != 1 || results[0].Note.Content != "Octopuses have three hearts and blue blood" {
+		t.Errorf("results = %+v, want the octopus highlight", results)
+	}
+}
+
+func TestRelated(t *testing.T) {
+	s, db := testService(t)
+	model := fmt.Sprintf("%v %v", t.Name(), time.Now().UnixNano())
+	reading := testSource(t, db, storage.Source{})
+	other := testSource(t, db, storage.Source{})
+
+	llm.SetEmbedder(testEmbedder{model: model})
+	t.Cleanup(func() {
+		llm.SetEmbedder(nil)
+		db.Unscoped().Where("embed_model = ?", model).Delete(&storage.NoteEmbedding{})
+	})
+
+	create := func(source storage.Source, content string) storage.Note {
+		note := storage.Note{Content: content, SourceID: int(source.ID)}
+
+		if err := db.Create(&note).Error; err != nil {
+			t.Fatalf("failed to create note: %v", err)
+		}
+
+		return note
+	}
+
+	note := create(reading, "Stoics accept what they cannot control")
+	create(reading, "Stoics accept fate calmly")
+	similar := create(other, "Accept what you cannot control, said the stoics")
+	linked := create(other, "Epictetus was a slave")
+
+	t.Cleanup(func() {
+		db.Unscoped().Where("note_id = ?", note.ID).Delete(&storage.NoteLink{})
+	})
+
+	if _, err := s.EmbedPendingNotes(); err != nil {
+		t.Fatalf("EmbedPendingNotes failed: %v", err)
+	}
+
+	if err := s.LinkNotes(int(note.ID), int(linked.ID)); err != nil {
+		t.Fatalf("LinkNotes failed: %v", err)
+	}
+
+	related, err := s.Related(int(note.ID), 1)
+
+	if err != nil {
+		t.Fatalf("Related failed: %v", err)
+	}
+
+	if len(related.Linked) != 1 || related.Linked[0].ID != linked.ID {
+		t.Errorf("linked notes = %+v, want the linked note", related.Linked)
+	}
+
+	// Notes of the same source and linked ones aren't suggested
+	if len(related.Similar) != 1 || related.Similar[0].Note.ID != similar.ID {
+		t.Errorf("similar notes = %+v, want the closest note of the other source", related.Similar)
+	}
+}
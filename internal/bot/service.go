@@ -9,21 +9,30 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/amalrajan30/spacedgram/internal/grading"
 	"github.com/amalrajan30/spacedgram/internal/highlights"
 	"github.com/amalrajan30/spacedgram/internal/llm"
+	"github.com/amalrajan30/spacedgram/internal/search"
 	"github.com/amalrajan30/spacedgram/internal/spaced"
 	"github.com/amalrajan30/spacedgram/internal/storage"
 )
 
 type BotService struct {
 	repo *storage.Repository
+	// Search index of the embeddings when pgvector isn't available
+	index *search.Index
+	// Held while notes are being embedded
+	embedMux *sync.Mutex
 }
 
 func NewBotService(repo *storage.Repository) *BotService {
 	return &BotService{
-		repo: repo,
+		repo:     repo,
+		index:    search.NewIndex(),
+		embedMux: &sync.Mutex{},
 	}
 }
 
@@ -123,6 +132,29 @@ func (service BotService) SyncHighlights() {
 
 	service.repo.BulkInsertHighlights(items)
 
+	queued, err := service.EnqueueUpcoming()
+
+	if err != nil {
+		log.Printf("Failed to queue cloze questions of imported notes: %v", err)
+		return
+	}
+
+	log.Printf("Queued %v cloze questions", queued)
+
+	queued, err = service.EnqueueTagSuggestions()
+
+	if err != nil {
+		log.Printf("Failed to queue tag suggestions of imported notes: %v", err)
+	} else {
+		log.Printf("Queued %v tag suggestions", queued)
+	}
+
+	go func() {
+		if _, err := service.EmbedPendingNotes(); err != nil {
+			log.Printf("Failed to embed imported notes: %v", err)
+		}
+	}()
+
 }
 
 func (s BotService) SelectSource(callbackData string) (storage.Source, error) {
@@ -146,33 +178,42 @@ func (s BotService) SelectSource(callbackData string) (storage.Source, error) {
 }
 
 type ReviewSession struct {
-	Source  storage.Source
-	Count   int
-	NoteIDs []int
+	Source   storage.Source
+	Count    int
+	NoteIDs  []int
+	HeldBack int
 }
 
-func (s BotService) StartSourceReview(sourceID int) (*ReviewSession, error) {
+func (s BotService) StartSourceReview(userID int64, sourceID int) (*ReviewSession, error) {
 	source, err := s.repo.GetSource(sourceID)
-	noteIDs := []int{}
 
 	if err != nil {
 		return nil, fmt.Errorf("getting source: %w", err)
 	}
 
-	notes, err := s.repo.GetNotes(int(source.ID))
+	settings, err := s.repo.GetUserSettings(userID)
+
+	if err != nil {
+		return nil, fmt.Errorf("getting user settings: %w", err)
+	}
+
+	notes, err := s.repo.GetNotes(int(source.ID), settings.DayEnd(time.Now()))
 
 	if err != nil {
 		return nil, fmt.Errorf("failed to retrieve notes for source ID %v", sourceID)
 	}
 
-	for _, note := range notes {
-		noteIDs = append(noteIDs, int(note.ID))
+	noteIDs, heldBack, err := s.buildQueue(userID, settings, notes)
+
+	if err != nil {
+		return nil, fmt.Errorf("building review queue: %w", err)
 	}
 
 	return &ReviewSession{
-		Source:  source,
-		Count:   len(notes),
-		NoteIDs: noteIDs,
+		Source:   source,
+		Count:    len(noteIDs),
+		NoteIDs:  noteIDs,
+		HeldBack: heldBack,
 	}, nil
 
 }
@@ -182,16 +223,51 @@ type ReviewState struct {
 	IsComplete   bool
 	CurrentCount int
 	TotalCount   int
+	// Log of the rating handled before moving on, 0 if there was none
+	ReviewLogID uint
+	// Cue shown before revealing a plain highlight
+	Prompt string
+	// Set instead of the note's questions in card sessions
+	CardToReview *storage.Card
+	// How the note is shown, plain while its question is being generated
+	Mode int
+	// Note that became a leech with the rating handled, 0 if none did
+	LeechID int
 }
 
-func (s BotService) ProcessReview(notes []int, skip int, previousResponse string, clazeQuestion bool) (*ReviewState, error) {
+// How notes are shown during a review
+const (
+	reviewModePlain = 0
+	reviewModeCloze = 1
+	reviewModeTyped = 2
+	reviewModeQuiz  = 3
+	reviewModeCards = 4
+)
+
+func (s BotService) ProcessReview(userID int64, notes []int, skip int, previousResponse string, mode int) (*ReviewState, error) {
 
 	fmt.Printf("Process review data: %v", previousResponse)
 
-	if !strings.HasPrefix(previousResponse, "cloze") && previousResponse != "start_review_schedule" {
-		if err := s.HandleReviewResponse(previousResponse); err != nil {
-			return nil, fmt.Errorf("handling review response: %w", err)
-		}
+	var reviewLog storage.ReviewLog
+	var becameLeech bool
+	var err error
+
+	switch {
+	case strings.HasPrefix(previousResponse, "review_"):
+		reviewLog, becameLeech, err = s.HandleReviewResponse(userID, previousResponse)
+	case strings.HasPrefix(previousResponse, "card_"):
+		reviewLog, becameLeech, err = s.HandleCardResponse(userID, previousResponse)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("handling review response: %w", err)
+	}
+
+	reviewLogID := reviewLog.ID
+
+	var leechID int
+	if becameLeech {
+		leechID = reviewLog.NoteID
 	}
 
 	if skip >= len(notes) {
@@ -199,6 +275,35 @@ func (s BotService) ProcessReview(notes []int, skip int, previousResponse string
 			IsComplete:   true,
 			CurrentCount: skip,
 			TotalCount:   skip,
+			ReviewLogID:  reviewLogID,
+			LeechID:      leechID,
+		}, nil
+	}
+
+	if mode == reviewModeCards {
+		card, err := s.repo.GetCard(notes[skip])
+
+		if err != nil {
+			return nil, fmt.Errorf("getting next card: %w", err)
+		}
+
+		// The note of a cloze card was edited and its question is being
+		// generated again, the highlight is shown meanwhile
+		if card.Question == "" {
+			s.enqueueGeneration(card.NoteID, storage.GenerationKindCloze)
+			card.Question = s.GetRecallPrompt(&card.Note, "")
+			card.Answer = card.Note.Content
+		}
+
+		return &ReviewState{
+			NoteToReview: &card.Note,
+			CardToReview: card,
+			Mode:         mode,
+			IsComplete:   false,
+			CurrentCount: skip,
+			TotalCount:   skip + 1,
+			ReviewLogID:  reviewLogID,
+			LeechID:      leechID,
 		}, nil
 	}
 
@@ -212,14 +317,27 @@ func (s BotService) ProcessReview(notes []int, skip int, previousResponse string
 		return nil, fmt.Errorf("getting next note: %w", err)
 	}
 
-	if clazeQuestion {
-		clazeNote, err := s.GetClozeQuestion(note)
+	prompt := ""
+
+	// Questions are generated in the background, notes without one are
+	// shown plain meanwhile
+	switch {
+	case (mode == reviewModeCloze || mode == reviewModeTyped) && note.Question == "":
+		s.enqueueGeneration(noteID, storage.GenerationKindCloze)
+		mode = reviewModePlain
+	case mode == reviewModeQuiz && (note.QuizQuestion == "" || len(quizDistractors(note)) == 0):
+		s.enqueueGeneration(noteID, storage.GenerationKindQuiz)
+		mode = reviewModePlain
+	}
+
+	if mode == reviewModePlain {
+		settings, err := s.repo.GetUserSettings(userID)
 
 		if err != nil {
-			return nil, fmt.Errorf("getting claze question: %w", err)
+			return nil, fmt.Errorf("getting user settings: %w", err)
 		}
 
-		note = clazeNote
+		prompt = s.GetRecallPrompt(note, settings.PromptStyle)
 	}
 
 	return &ReviewState{
@@ -227,15 +345,33 @@ func (s BotService) ProcessReview(notes []int, skip int, previousResponse string
 		IsComplete:   false,
 		CurrentCount: skip,
 		TotalCount:   skip + 1,
+		ReviewLogID:  reviewLogID,
+		LeechID:      leechID,
+		Prompt:       prompt,
+		Mode:         mode,
 	}, nil
 }
 
-func (service BotService) HandleReviewResponse(callbackData string) error {
-	noteId, err := strconv.Atoi(strings.Split(callbackData, "_")[1])
-	rating, err := strconv.Atoi(strings.Split(callbackData, "_")[2])
+// HandleReviewResponse applies the rating of a note and returns its review
+// log, along with whether the note just became a leech
+func (service BotService) HandleReviewResponse(userID int64, callbackData string) (storage.ReviewLog, bool, error) {
+	parts := strings.Split(callbackData, "_")
+
+	if len(parts) < 3 {
+		return storage.ReviewLog{}, false, fmt.Errorf("Failed to parse data while handling review response: %v", callbackData)
+	}
+
+	noteId, err := strconv.Atoi(parts[1])
+	rating, err := strconv.Atoi(parts[2])
 
 	if err != nil {
-		fmt.Errorf("Failed to parse data while handling review response: %w", err)
+		return storage.ReviewLog{}, false, fmt.Errorf("Failed to parse data while handling review response: %w", err)
+	}
+
+	// Cards revealed after a prompt carry the time it took to reveal them
+	var revealMs int64
+	if len(parts) > 3 {
+		revealMs, _ = strconv.ParseInt(parts[3], 10, 64)
 	}
 
 	log.Printf("Got note: %v from review response with rating: %v", noteId, rating)
@@ -243,25 +379,100 @@ func (service BotService) HandleReviewResponse(callbackData string) error {
 	note, err := service.repo.GetNote(noteId)
 
 	if err != nil {
-		return fmt.Errorf("Failed to get note: %w", err)
+		return storage.ReviewLog{}, false, fmt.Errorf("Failed to get note: %w", err)
 
 	}
 
+	settings, err := service.repo.GetUserSettings(userID)
+
+	if err != nil {
+		return storage.ReviewLog{}, false, fmt.Errorf("getting user settings: %w", err)
+	}
+
 	nextDue, interval, easiness := spaced.GetNextDueDate(*note, rating)
 
 	now := time.Now()
 
-	service.repo.UpdateNote(noteId, storage.Note{
+	update := storage.Note{
 		NextDueDate:    &nextDue,
 		Interval:       interval,
 		EasinessFactor: &easiness,
 		LastReviewed:   &now,
 		ReviewCount:    note.ReviewCount + 1,
-	})
+	}
+
+	becameLeech := applyLapse(note, rating, settings, &update)
+
+	service.repo.UpdateNote(noteId, update)
 
 	log.Println("Note updated")
 
-	return nil
+	if becameLeech {
+		service.tagLeech(noteId, settings)
+	}
+
+	reviewLog, err := service.repo.InsertReviewLog(storage.ReviewLog{
+		UserID:             userID,
+		NoteID:             noteId,
+		SourceID:           note.SourceID,
+		Rating:             rating,
+		WasNew:             note.ReviewCount == 0,
+		ReviewedAt:         now,
+		PrevEasinessFactor: note.EasinessFactor,
+		PrevNextDueDate:    note.NextDueDate,
+		PrevLastReviewed:   note.LastReviewed,
+		PrevInterval:       note.Interval,
+		PrevReviewCount:    note.ReviewCount,
+		PrevLapses:         note.Lapses,
+		PrevLeech:          note.Leech,
+		PrevSuspended:      note.Suspended,
+		RevealMs:           revealMs,
+	})
+
+	if err != nil {
+		return storage.ReviewLog{}, false, fmt.Errorf("logging review: %w", err)
+	}
+
+	return reviewLog, becameLeech, nil
+}
+
+// UndoReview reverts a rating using its review log and returns the id of
+// the note or card it belonged to
+func (service BotService) UndoReview(userID int64, reviewLogID uint) (int, error) {
+	reviewLog, err := service.repo.GetReviewLog(reviewLogID)
+
+	if err != nil {
+		return 0, err
+	}
+
+	if reviewLog.UserID != userID {
+		return 0, fmt.Errorf("review log %d belongs to another user", reviewLogID)
+	}
+
+	note, err := service.repo.GetNote(reviewLog.NoteID)
+
+	if err != nil {
+		return 0, err
+	}
+
+	if err := service.repo.UndoReview(reviewLog); err != nil {
+		return 0, err
+	}
+
+	// The rating made the note a leech, drop the tag it may have got
+	if note.Leech && !reviewLog.PrevLeech {
+		if err := service.repo.UntagNote(reviewLog.NoteID, []string{leechTag}); err != nil {
+			log.Printf("Failed to untag leech %v: %v", reviewLog.NoteID, err)
+		}
+	}
+
+	log.Printf("Undid review of note %v", reviewLog.NoteID)
+
+	if reviewLog.CardID != 0 {
+		return reviewLog.CardID, nil
+	}
+
+	return reviewLog.NoteID, nil
 }
 
 func (service BotService) HandleReset(source int) {
@@ -270,26 +481,80 @@ func (service BotService) HandleReset(source int) {
 }
 
 type ScheduledReviews struct {
-	Count   int
-	NoteIDs []int
+	Count    int
+	NoteIDs  []int
+	HeldBack int
 }
 
-func (s BotService) ScheduledReview() (*ScheduledReviews, error) {
-	notes, err := s.repo.GetPendingReviewNotes()
-	noteIDs := []int{}
+func (s BotService) ScheduledReview(userID int64) (*ScheduledReviews, error) {
+	settings, err := s.repo.GetUserSettings(userID)
+
+	if err != nil {
+		return nil, fmt.Errorf("getting user settings: %w", err)
+	}
+
+	notes, err := s.repo.GetPendingReviewNotes(settings.DayEnd(time.Now()))
 
 	if err != nil {
 		return nil, fmt.Errorf("failed to get notes: %w", err)
 
 	}
 
-	for _, note := range notes {
-		noteIDs = append(noteIDs, int(note.ID))
+	noteIDs, heldBack, err := s.buildQueue(userID, settings, notes)
+
+	if err != nil {
+		return nil, fmt.Errorf("building review queue: %w", err)
 	}
 
 	return &ScheduledReviews{
-		Count:   len(notes),
-		NoteIDs: noteIDs,
+		Count:    len(noteIDs),
+		NoteIDs:  noteIDs,
+		HeldBack: heldBack,
+	}, nil
+}
+
+// Rough time a single card takes, used to estimate the length of a session
+const estimatedSecondsPerCard = 15
+
+type ReminderSummary struct {
+	DueCount         int
+	DueBySource      []storage.SourceCount
+	NewCount         int
+	EstimatedMinutes int
+}
+
+func (s BotService) ReminderSummary(userID int64) (*ReminderSummary, error) {
+	settings, err := s.repo.GetUserSettings(userID)
+
+	if err != nil {
+		return nil, fmt.Errorf("getting user settings: %w", err)
+	}
+
+	dueBySource, err := s.repo.CountDueNotesBySource(settings.DayEnd(time.Now()))
+
+	if err != nil {
+		return nil, err
+	}
+
+	newCount, err := s.repo.CountNewNotes()
+
+	if err != nil {
+		return nil, err
+	}
+
+	dueCount := 0
+	for _, source := range dueBySource {
+		dueCount += source.Count
+	}
+
+	// Only the day's share of new notes is shown in a session
+	cards := dueCount + min(newCount, settings.NewCardsPerDay)
+
+	return &ReminderSummary{
+		DueCount:         dueCount,
+		DueBySource:      dueBySource,
+		NewCount:         newCount,
+		EstimatedMinutes: (cards*estimatedSecondsPerCard + 59) / 60,
 	}, nil
 }
 
@@ -305,13 +570,112 @@ func (s BotService) ClozeStatus(sourceID int) (bool, error) {
 
 }
 
+// Number of words of a highlight shown as its prompt
+const promptWords = 6
+
+// GetRecallPrompt returns the cue shown before revealing a note, falling back
+// to its first words while its prompt is being generated
+func (s BotService) GetRecallPrompt(note *storage.Note, style string) string {
+	words := strings.Fields(note.Content)
+	firstWords := strings.Join(words[:min(promptWords, len(words))], " ")
+
+	if len(words) > promptWords {
+		firstWords = firstWords + " …"
+	}
+
+	switch style {
+	case storage.PromptStyleLocation:
+		if note.Location != "" {
+			return fmt.Sprintf("Location %v", note.Location)
+		}
+	case storage.PromptStyleLLM:
+		if note.Prompt != "" {
+			return note.Prompt
+		}
+
+		s.enqueueGeneration(int(note.ID), storage.GenerationKindPrompt)
+	}
+
+	return firstWords
+}
+
+type AnswerGrade struct {
+	Note       *storage.Note
+	Similarity float64
+	Diff       string
+	Suggested  int
+	// Set when the LLM judged the answer
+	Judgement *llm.AnswerJudgement
+}
+
+// GradeAnswer compares a typed answer with the answer of a cloze question
+// and suggests a grade for it
+func (s BotService) GradeAnswer(userID int64, noteID int, answer string) (*AnswerGrade, error) {
+	note, err := s.repo.GetNote(noteID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	settings, err := s.repo.GetUserSettings(userID)
+
+	if err != nil {
+		return nil, fmt.Errorf("getting user settings: %w", err)
+	}
+
+	similarity := grading.Similarity(answer, note.Answer)
+
+	grade := &AnswerGrade{
+		Note:       note,
+		Similarity: similarity,
+		Diff:       grading.Diff(answer, note.Answer),
+		Suggested:  grading.SuggestGrade(similarity),
+	}
+
+	if settings.LLMJudge && similarity < 1 && strings.TrimSpace(answer) != "" {
+		judgement, err := llm.JudgeAnswer(note.Question, note.Answer, answer)
+
+		if err != nil {
+			log.Printf("Failed to judge answer, keeping fuzzy grade: %v", err)
+			return grade, nil
+		}
+
+		grade.Judgement = judgement
+
+		if judgement.Correct {
+			grade.Suggested = max(grade.Suggested, 4)
+		} else {
+			grade.Suggested = min(grade.Suggested, 2)
+		}
+	}
+
+	return grade, nil
+}
+
 func (s BotService) GetClozeQuestion(note *storage.Note) (*storage.Note, error) {
 
 	if note.Question != "" {
 		return note, nil
 	}
 
-	clazeQuestion, err := llm.GenerateClaseQuestionAnswer(note.Content)
+	rejected, err := s.repo.GetRejectedQuestions(int(note.ID))
+
+	if err != nil {
+		return nil, err
+	}
+
+	var clazeQuestion *llm.ClazeQuestion
+
+	if len(rejected) > 0 {
+		questions := []string{}
+		for _, feedback := range rejected {
+			questions = append(questions, fmt.Sprintf("%s (answer: %s)", feedback.Question, feedback.Answer))
+		}
+
+		clazeQuestion, err = llm.GenerateClozeQuestionWithFeedback(s.highlightOf(note), questions)
+	} else {
+		clazeQuestion, err = llm.GenerateClaseQuestionAnswer(s.highlightOf(note))
+	}
 
 	if err != nil {
 		return nil, err
@@ -329,3 +693,153 @@ func (s BotService) GetClozeQuestion(note *storage.Note) (*storage.Note, error)
 	return updatedNote, nil
 
 }
+
+func (s BotService) GetSettings(userID int64) (storage.UserSettings, error) {
+	return s.repo.GetUserSettings(userID)
+}
+
+func (s BotService) ListSettings() ([]storage.UserSettings, error) {
+	return s.repo.ListUserSettings()
+}
+
+func (s BotService) SetTimezone(userID int64, timezone string) (storage.UserSettings, error) {
+	settings, err := s.repo.GetUserSettings(userID)
+
+	if err != nil {
+		return storage.UserSettings{}, err
+	}
+
+	settings.Timezone = timezone
+
+	return s.repo.SaveUserSettings(settings)
+}
+
+func (s BotService) SetReminderTimes(userID int64, reminders []string) (storage.UserSettings, error) {
+	settings, err := s.repo.GetUserSettings(userID)
+
+	if err != nil {
+		return storage.UserSettings{}, err
+	}
+
+	settings.ReminderTimes = strings.Join(reminders, ",")
+
+	return s.repo.SaveUserSettings(settings)
+}
+
+func (s BotService) SetDailyLimits(userID int64, newCardsPerDay *int, maxReviewsPerDay *int) (storage.UserSettings, error) {
+	settings, err := s.repo.GetUserSettings(userID)
+
+	if err != nil {
+		return storage.UserSettings{}, err
+	}
+
+	if newCardsPerDay != nil {
+		settings.NewCardsPerDay = *newCardsPerDay
+	}
+
+	if maxReviewsPerDay != nil {
+		settings.MaxReviewsPerDay = *maxReviewsPerDay
+	}
+
+	return s.repo.SaveUserSettings(settings)
+}
+
+// SetSourceLimits overrides the daily limits of a source, nil limits fall
+// back to the user's settings
+func (s BotService) SetSourceLimits(sourceID int, newCardsPerDay *int, maxReviewsPerDay *int) (storage.Source, error) {
+	if newCardsPerDay != nil && *newCardsPerDay < 0 || maxReviewsPerDay != nil && *maxReviewsPerDay < 0 {
+		return storage.Source{}, fmt.Errorf("daily limits can't be negative")
+	}
+
+	if err := s.repo.SetSourceLimits(sourceID, newCardsPerDay, maxReviewsPerDay); err != nil {
+		return storage.Source{}, err
+	}
+
+	return s.repo.GetSource(sourceID)
+}
+
+func (s BotService) SetQueueOrder(userID int64, order string) (storage.UserSettings, error) {
+	settings, err := s.repo.GetUserSettings(userID)
+
+	if err != nil {
+		return storage.UserSettings{}, err
+	}
+
+	settings.QueueOrder = order
+
+	return s.repo.SaveUserSettings(settings)
+}
+
+func (s BotService) SetPromptStyle(userID int64, style string) (storage.UserSettings, error) {
+	settings, err := s.repo.GetUserSettings(userID)
+
+	if err != nil {
+		return storage.UserSettings{}, err
+	}
+
+	settings.PromptStyle = style
+
+	return s.repo.SaveUserSettings(settings)
+}
+
+func (s BotService) SetLLMJudge(userID int64, enabled bool) (storage.UserSettings, error) {
+	settings, err := s.repo.GetUserSettings(userID)
+
+	if err != nil {
+		return storage.UserSettings{}, err
+	}
+
+	settings.LLMJudge = enabled
+
+	return s.repo.SaveUserSettings(settings)
+}
+
+func (s BotService) SetRolloverHour(userID int64, hour int) (storage.UserSettings, error) {
+	settings, err := s.repo.GetUserSettings(userID)
+
+	if err != nil {
+		return storage.UserSettings{}, err
+	}
+
+	settings.RolloverHour = hour
+
+	return s.repo.SaveUserSettings(settings)
+}
+
+func (s BotService) GetQuizQuestion(note *storage.Note) (*storage.Note, error) {
+
+	if note.QuizQuestion != "" {
+		return note, nil
+	}
+
+	quizQuestion, err := llm.GenerateQuizQuestion(s.highlightOf(note))
+
+	if err != nil {
+		return nil, err
+	}
+
+	updatedNote, err := s.repo.UpdateNote(int(note.ID), storage.Note{
+		QuizQuestion:    quizQuestion.Question,
+		QuizAnswer:      quizQuestion.Answer,
+		QuizDistractors: quizQuestion.Distractors,
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return updatedNote, nil
+}
+
+// Grades given to quiz answers, a quiz only tells right from wrong
+const (
+	quizCorrectGrade = 4
+	quizWrongGrade   = 1
+)
+
+func quizGrade(correct bool) int {
+	if correct {
+		return quizCorrectGrade
+	}
+	return quizWrongGrade
+}
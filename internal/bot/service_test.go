@@ -0,0 +1,275 @@
+package bot
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/amalrajan30/spacedgram/internal/llm"
+	"github.com/amalrajan30/spacedgram/internal/storage"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+// testService returns a service on the database of TEST_DATABASE_URL and
+// skips the test when none is given
+func testService(t *testing.T) (*BotService, *gorm.DB) {
+	t.Helper()
+
+	dsn := os.Getenv("TEST_DATABASE_URL")
+
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+
+	db, err := gorm.Open(postgres.Open(dsn))
+
+	if err != nil {
+		t.Fatalf("failed to connect to the test database: %v", err)
+	}
+
+	return NewBotService(storage.NewRepository(db)), db
+}
+
+// testSource creates a source named after the test, removed with its notes
+// when the test ends
+func testSource(t *testing.T, db *gorm.DB, source storage.Source) storage.Source {
+	t.Helper()
+
+	source.Title = fmt.Sprintf("%v %v", t.Name(), time.Now().UnixNano())
+	source.Origin = "test"
+
+	if err := db.Create(&source).Error; err != nil {
+		t.Fatalf("failed to create source: %v", err)
+	}
+
+	t.Cleanup(func() {
+		db.Unscoped().Where("source_id = ?", source.ID).Delete(&storage.Note{})
+		db.Unscoped().Delete(&source)
+	})
+
+	return source
+}
+
+// testUserID returns a user id of no real user, so rows of the test can be
+// told apart
+func testUserID(t *testing.T, db *gorm.DB) int64 {
+	userID := -time.Now().UnixNano()
+
+	t.Cleanup(func() {
+		db.Unscoped().Where("user_id = ?", userID).Delete(&storage.ReviewLog{})
+	})
+
+	return userID
+}
+
+func TestUndoReview(t *testing.T) {
+	s, db := testService(t)
+	userID := testUserID(t, db)
+	source := testSource(t, db, storage.Source{})
+
+	note := storage.Note{Content: "Highlight", SourceID: int(source.ID)}
+
+	if err := db.Create(&note).Error; err != nil {
+		t.Fatalf("failed to create note: %v", err)
+	}
+
+	first, _, err := s.HandleReviewResponse(userID, fmt.Sprintf("review_%v_4", note.ID))
+
+	if err != nil {
+		t.Fatalf("HandleReviewResponse failed: %v", err)
+	}
+
+	reviewed, err := s.repo.GetNote(int(note.ID))
+
+	if err != nil {
+		t.Fatalf("GetNote failed: %v", err)
+	}
+
+	second, _, err := s.HandleReviewResponse(userID, fmt.Sprintf("review_%v_5", note.ID))
+
+	if err != nil {
+		t.Fatalf("HandleReviewResponse failed: %v", err)
+	}
+
+	if _, err := s.UndoReview(userID+1, second.ID); err == nil {
+		t.Error("UndoReview undid the review of another user")
+	}
+
+	if noteID, err := s.UndoReview(userID, second.ID); err != nil || noteID != int(note.ID) {
+		t.Fatalf("UndoReview = %v (%v), want note %v", noteID, err, note.ID)
+	}
+
+	undone, err := s.repo.GetNote(int(note.ID))
+
+	if err != nil {
+		t.Fatalf("GetNote failed: %v", err)
+	}
+
+	if undone.ReviewCount != 1 || undone.Interval != reviewed.Interval ||
+		!undone.NextDueDate.Equal(*reviewed.NextDueDate) || !undone.LastReviewed.Equal(*reviewed.LastReviewed) ||
+		*undone.EasinessFactor != *reviewed.EasinessFactor {
+		t.Errorf("note after undoing the second review = %+v, want it as after the first %+v", undone, reviewed)
+	}
+
+	if _, err := s.repo.GetReviewLog(second.ID); err == nil {
+		t.Error("the undone review is still logged")
+	}
+
+	if _, err := s.UndoReview(userID, first.ID); err != nil {
+		t.Fatalf("UndoReview failed: %v", err)
+	}
+
+	undone, err = s.repo.GetNote(int(note.ID))
+
+	if err != nil {
+		t.Fatalf("GetNote failed: %v", err)
+	}
+
+	if undone.ReviewCount != 0 || undone.NextDueDate != nil || undone.LastReviewed != nil || undone.EasinessFactor != nil {
+		t.Errorf("note after undoing every review = %+v, want it new", undone)
+	}
+}
+
+func TestGetRecallPrompt(t *testing.T) {
+	s := BotService{}
+
+	long := storage.Note{Content: "The obstacle in the path becomes the path", Location: "1234"}
+	short := storage.Note{Content: "Memento mori"}
+
+	tests := []struct {
+		name  string
+		note  storage.Note
+		style string
+		want  string
+	}{
+		{"first words", long, storage.PromptStyleWords, "The obstacle in the path becomes …"},
+		{"short highlight", short, storage.PromptStyleWords, "Memento mori"},
+		{"location", long, storage.PromptStyleLocation, "Location 1234"},
+		{"no location", short, storage.PromptStyleLocation, "Memento mori"},
+		{"saved prompt", storage.Note{Content: short.Content, Prompt: "Remember what?"}, storage.PromptStyleLLM, "Remember what?"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := s.GetRecallPrompt(&test.note, test.style); got != test.want {
+				t.Errorf("GetRecallPrompt = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestHandleReviewResponseInvalid(t *testing.T) {
+	if _, _, err := (BotService{}).HandleReviewResponse(1, "review_12"); err == nil {
+		t.Error("HandleReviewResponse accepted a response without a rating")
+	}
+}
+
+func TestQuizGrade(t *testing.T) {
+	if got := quizGrade(true); got < 3 {
+		t.Errorf("grade of a right answer = %v, want a passing grade", got)
+	}
+
+	if got := quizGrade(false); got >= 3 {
+		t.Errorf("grade of a wrong answer = %v, want a failing grade", got)
+	}
+}
+
+func TestGetQuizQuestionKeepsSaved(t *testing.T) {
+	note := &storage.Note{QuizQuestion: "Who wrote Meditations?", QuizAnswer: "Marcus Aurelius"}
+
+	got, err := (BotService{}).GetQuizQuestion(note)
+
+	if err != nil || got != note {
+		t.Errorf("GetQuizQuestion = %v (%v), want the saved question", got, err)
+	}
+}
+
+// useFakeProvider makes the generations of the test go to the llm fake
+// provider
+func useFakeProvider(t *testing.T) *llm.FakeProvider {
+	t.Helper()
+
+	fake := llm.NewFakeProvider()
+	llm.SetProvider(fake)
+	t.Cleanup(func() { llm.SetProvider(nil) })
+
+	return fake
+}
+
+func TestGetClozeQuestion(t *testing.T) {
+	s, db := testService(t)
+	fake := useFakeProvider(t)
+	source := testSource(t, db, storage.Source{})
+
+	note := storage.Note{Content: "Rome is the capital of Italy", SourceID: int(source.ID)}
+
+	if err := db.Create(&note).Error; err != nil {
+		t.Fatalf("failed to create note: %v", err)
+	}
+
+	fake.SetResponse("create_question", `{"question": "The capital of Italy is ____.", "answer": "Rome"}`)
+
+	generated, err := s.GetClozeQuestion(&note)
+
+	if err != nil {
+		t.Fatalf("GetClozeQuestion failed: %v", err)
+	}
+
+	if generated.Question != "The capital of Italy is ____." || generated.Answer != "Rome" {
+		t.Errorf("GetClozeQuestion = %q (%q), want the generated question", generated.Question, generated.Answer)
+	}
+
+	stored, err := s.repo.GetNote(int(note.ID))
+
+	if err != nil {
+		t.Fatalf("GetNote failed: %v", err)
+	}
+
+	if stored.Question != generated.Question || stored.Answer != generated.Answer {
+		t.Errorf("stored question = %q (%q), want %q (%q)", stored.Question, stored.Answer, generated.Question, generated.Answer)
+	}
+
+	calls := fake.Calls()
+
+	if len(calls) != 1 || calls[0].Name != "create_question" || !strings.Contains(calls[0].UserPrompt, note.Content) {
+		t.Errorf("provider calls = %+v, want one create_question with the note", calls)
+	}
+
+	// The stored question is used from then on
+	if _, err := s.GetClozeQuestion(stored); err != nil {
+		t.Fatalf("GetClozeQuestion failed: %v", err)
+	}
+
+	if calls := fake.Calls(); len(calls) != 1 {
+		t.Errorf("provider called %v times, want once", len(calls))
+	}
+}
+
+func TestGetQuizQuestion(t *testing.T) {
+	s, db := testService(t)
+	fake := useFakeProvider(t)
+	source := testSource(t, db, storage.Source{})
+
+	note := storage.Note{Content: "Marcus Aurelius wrote Meditations", SourceID: int(source.ID)}
+
+	if err := db.Create(&note).Error; err != nil {
+		t.Fatalf("failed to create note: %v", err)
+	}
+
+	quiz, err := s.GetQuizQuestion(&note)
+
+	if err != nil {
+		t.Fatalf("GetQuizQuestion failed: %v", err)
+	}
+
+	if quiz.QuizQuestion == "" || quiz.QuizAnswer == "" || len(quiz.QuizDistractors) != 3 {
+		t.Errorf("GetQuizQuestion = %+v, want the question, answer and distractors of the fake provider", quiz)
+	}
+
+	if calls := fake.Calls(); len(calls) != 1 {
+		t.Errorf("provider called %v times, want once", len(calls))
+	}
+}
@@ -0,0 +1,58 @@
+package bot
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/amalrajan30/spacedgram/internal/storage"
+)
+
+// ErrEmptyTitle is returned when renaming a source to a blank title
+var ErrEmptyTitle = errors.New("the title can't be empty")
+
+func (s BotService) GetSourceSummaries() ([]storage.Source, error) {
+	return s.repo.GetSourceSummaries()
+}
+
+func (s BotService) RenameSource(id int, title string) error {
+	title = strings.TrimSpace(title)
+
+	if title == "" {
+		return ErrEmptyTitle
+	}
+
+	return s.repo.RenameSource(id, title)
+}
+
+// MergeSources moves the notes of a source into another one and deletes it
+func (s BotService) MergeSources(fromID int, intoID int) error {
+	return s.repo.MergeSources(fromID, intoID)
+}
+
+func (s BotService) ArchiveSource(id int) error {
+	return s.repo.SetSourceArchived(id, true)
+}
+
+func (s BotService) UnarchiveSource(id int) error {
+	return s.repo.SetSourceArchived(id, false)
+}
+
+// DeleteSource soft deletes a source and its notes, which are also dropped
+// from the search index
+func (s BotService) DeleteSource(id int) error {
+	noteIDs, err := s.repo.GetNoteIDs(id)
+
+	if err != nil {
+		return err
+	}
+
+	if err := s.repo.DeleteSource(id); err != nil {
+		return err
+	}
+
+	for _, noteID := range noteIDs {
+		s.index.Remove(noteID)
+	}
+
+	return nil
+}
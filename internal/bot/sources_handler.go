@@ -0,0 +1,521 @@
+package bot
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext/handlers"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext/handlers/filters/callbackquery"
+	"github.com/amalrajan30/spacedgram/internal/storage"
+)
+
+const (
+	renameStateTitle = "rename_title"
+	// Length titles are cut to in the source list
+	sourceTitleLength = 60
+)
+
+// SourceRenameConversation asks for the new title of a source picked in
+// /sources
+func (h *BotHandler) SourceRenameConversation() handlers.Conversation {
+	return handlers.NewConversation(
+		[]ext.Handler{handlers.NewCallback(callbackquery.Prefix("src_rename_"), h.StartSourceRename)},
+		map[string][]ext.Handler{
+			renameStateTitle: {
+				handlers.NewMessage(isNoteText, h.HandleSourceRename),
+			},
+		},
+		&handlers.ConversationOpts{
+			Exits:        []ext.Handler{handlers.NewCommand("cancel", h.CancelSourceRename)},
+			AllowReEntry: true,
+			StateStorage: h.newConversationStates(),
+		},
+	)
+}
+
+func (h *BotHandler) setRenaming(chatID int64, sourceID int) {
+	h.rwMux.Lock()
+	defer h.rwMux.Unlock()
+
+	if h.renaming == nil {
+		h.renaming = map[int64]int{}
+	}
+
+	h.renaming[chatID] = sourceID
+}
+
+func (h *BotHandler) getRenaming(chatID int64) (int, bool) {
+	h.rwMux.RLock()
+	defer h.rwMux.RUnlock()
+
+	sourceID, ok := h.renaming[chatID]
+
+	return sourceID, ok
+}
+
+func (h *BotHandler) takeRenaming(chatID int64) (int, bool) {
+	h.rwMux.Lock()
+	defer h.rwMux.Unlock()
+
+	sourceID, ok := h.renaming[chatID]
+	delete(h.renaming, chatID)
+
+	return sourceID, ok
+}
+
+// sourcesMessage lists every source with its note count, with a button to
+// manage each one
+func (h *BotHandler) sourcesMessage() (string, gotgbot.InlineKeyboardMarkup, error) {
+	sources, err := h.service.GetSourceSummaries()
+
+	if err != nil {
+		return "", gotgbot.InlineKeyboardMarkup{}, err
+	}
+
+	if len(sources) == 0 {
+		return "No sources yet, /sync your highlights or /add a note", gotgbot.InlineKeyboardMarkup{}, nil
+	}
+
+	text := "📚 <b>Sources</b>\n" +
+		"━━━━━━━━━━━━━━\n"
+
+	var keyboard [][]gotgbot.InlineKeyboardButton
+	var currentRow []gotgbot.InlineKeyboardButton
+
+	for i, source := range sources {
+		archived := ""
+
+		if source.Archived {
+			archived = " · 🗄"
+		}
+
+		text = text + fmt.Sprintf(
+			"<b>%v.</b> %s · %v notes%s\n",
+			i+1,
+			html.EscapeString(truncate(source.Title, sourceTitleLength)),
+			source.TotalNotes,
+			archived,
+		)
+
+		currentRow = append(currentRow, gotgbot.InlineKeyboardButton{
+			Text:         strconv.Itoa(i + 1),
+			CallbackData: fmt.Sprintf("src_show_%v", source.ID),
+		})
+
+		if (i+1)%5 == 0 || i == len(sources)-1 {
+			keyboard = append(keyboard, currentRow)
+			currentRow = []gotgbot.InlineKeyboardButton{}
+		}
+	}
+
+	return text, gotgbot.InlineKeyboardMarkup{InlineKeyboard: keyboard}, nil
+}
+
+// Sources lists the sources to rename, merge, archive or delete them
+func (h *BotHandler) Sources(b *gotgbot.Bot, ctx *ext.Context) error {
+
+	if !checkUser(ctx.Message.From.Id) {
+		return nil
+	}
+
+	text, keyboard, err := h.sourcesMessage()
+
+	if err != nil {
+		log.Printf("Failed to get sources: %v", err)
+		_, err = ctx.EffectiveMessage.Reply(b, "Failed to get sources", nil)
+		return err
+	}
+
+	_, err = ctx.EffectiveMessage.Reply(b, text, &gotgbot.SendMessageOpts{
+		ReplyMarkup: keyboard,
+		ParseMode:   "HTML",
+	})
+
+	if err != nil {
+		return fmt.Errorf("Failed to send sources: %w", err)
+	}
+
+	return nil
+}
+
+func (h *BotHandler) refreshSources(b *gotgbot.Bot, msg gotgbot.MaybeInaccessibleMessage) error {
+	text, keyboard, err := h.sourcesMessage()
+
+	if err != nil {
+		log.Printf("Failed to get sources: %v", err)
+		return h.editMessage(b, msg, "Failed to get sources", nil)
+	}
+
+	return h.editMessage(b, msg, text, &gotgbot.EditMessageTextOpts{
+		ParseMode:   "HTML",
+		ReplyMarkup: keyboard,
+	})
+}
+
+// showSource shows a source with the actions to manage it
+func (h *BotHandler) showSource(b *gotgbot.Bot, msg gotgbot.MaybeInaccessibleMessage, id int) error {
+	source, err := h.service.repo.GetSource(id)
+
+	if err != nil {
+		log.Printf("Failed to get source %v: %v", id, err)
+		return h.editMessage(b, msg, "Could not find the source", nil)
+	}
+
+	details := fmt.Sprintf("<b>Notes:</b> %v\n", source.TotalNotes)
+
+	if source.Author != "" {
+		details = fmt.Sprintf("<b>Author:</b> %s\n", html.EscapeString(source.Author)) + details
+	}
+
+	if source.Origin != "" {
+		details = details + fmt.Sprintf("<b>Origin:</b> %s\n", html.EscapeString(source.Origin))
+	}
+
+	archive := gotgbot.InlineKeyboardButton{
+		Text:         "🗄 Archive",
+		CallbackData: fmt.Sprintf("src_archive_%v", source.ID),
+	}
+
+	if source.Archived {
+		details = details + "🗄 Archived, left out of reviews\n"
+		archive = gotgbot.InlineKeyboardButton{
+			Text:         "📤 Unarchive",
+			CallbackData: fmt.Sprintf("src_unarchive_%v", source.ID),
+		}
+	}
+
+	keyboard := gotgbot.InlineKeyboardMarkup{
+		InlineKeyboard: [][]gotgbot.InlineKeyboardButton{
+			{
+				{
+					Text:         "✏️ Rename",
+					CallbackData: fmt.Sprintf("src_rename_%v", source.ID),
+				},
+				{
+					Text:         "🔀 Merge",
+					CallbackData: fmt.Sprintf("src_merge_%v", source.ID),
+				},
+			},
+			{
+				archive,
+				{
+					Text:         "🗑 Delete",
+					CallbackData: fmt.Sprintf("src_delete_%v", source.ID),
+				},
+			},
+			{
+				{
+					Text:         "⬅️ Sources",
+					CallbackData: "src_list",
+				},
+			},
+		},
+	}
+
+	return h.editMessage(b, msg, fmt.Sprintf(
+		"📚 <b>%s</b>\n"+
+			"━━━━━━━━━━━━━━\n"+
+			"%s",
+		html.EscapeString(source.Title),
+		details,
+	), &gotgbot.EditMessageTextOpts{
+		ParseMode:   "HTML",
+		ReplyMarkup: keyboard,
+	})
+}
+
+// showMergeTargets asks which source to merge a source into
+func (h *BotHandler) showMergeTargets(b *gotgbot.Bot, msg gotgbot.MaybeInaccessibleMessage, fromID int) error {
+	sources, err := h.service.GetSourceSummaries()
+
+	if err != nil {
+		log.Printf("Failed to get sources: %v", err)
+		return h.editMessage(b, msg, "Failed to get sources", nil)
+	}
+
+	var from storage.Source
+	var keyboard [][]gotgbot.InlineKeyboardButton
+
+	for _, source := range sources {
+		if int(source.ID) == fromID {
+			from = source
+			continue
+		}
+
+		keyboard = append(keyboard, []gotgbot.InlineKeyboardButton{{
+			Text:         truncate(source.Title, sourceTitleLength),
+			CallbackData: fmt.Sprintf("src_into_%v_%v", fromID, source.ID),
+		}})
+	}
+
+	keyboard = append(keyboard, []gotgbot.InlineKeyboardButton{{
+		Text:         "✖️ Cancel",
+		CallbackData: fmt.Sprintf("src_show_%v", fromID),
+	}})
+
+	return h.editMessage(b, msg, fmt.Sprintf(
+		"🔀 Merge <b>%s</b> into:",
+		html.EscapeString(from.Title),
+	), &gotgbot.EditMessageTextOpts{
+		ParseMode:   "HTML",
+		ReplyMarkup: gotgbot.InlineKeyboardMarkup{InlineKeyboard: keyboard},
+	})
+}
+
+// confirmSourceAction asks before merging or deleting a source
+func (h *BotHandler) confirmSourceAction(b *gotgbot.Bot, msg gotgbot.MaybeInaccessibleMessage, text string, confirm gotgbot.InlineKeyboardButton, sourceID int) error {
+	return h.editMessage(b, msg, text, &gotgbot.EditMessageTextOpts{
+		ParseMode: "HTML",
+		ReplyMarkup: gotgbot.InlineKeyboardMarkup{
+			InlineKeyboard: [][]gotgbot.InlineKeyboardButton{{
+				confirm,
+				{
+					Text:         "✖️ Cancel",
+					CallbackData: fmt.Sprintf("src_show_%v", sourceID),
+				},
+			}},
+		},
+	})
+}
+
+// HandleSourceAction shows, merges, archives or deletes a source picked in
+// /sources. Merges and deletes are confirmed first.
+func (h *BotHandler) HandleSourceAction(b *gotgbot.Bot, ctx *ext.Context) error {
+
+	if !checkUser(ctx.Update.CallbackQuery.From.Id) {
+		return nil
+	}
+
+	cb := ctx.Update.CallbackQuery
+	parts := strings.Split(cb.Data, "_")
+
+	_, err := cb.Answer(b, nil)
+
+	if err != nil {
+		return fmt.Errorf("failed to answer callback query: %w", err)
+	}
+
+	if len(parts) == 2 && parts[1] == "list" {
+		return h.refreshSources(b, cb.Message)
+	}
+
+	if len(parts) < 3 {
+		return h.editMessage(b, cb.Message, "Got invalid response", nil)
+	}
+
+	ids := []int{}
+
+	for _, part := range parts[2:] {
+		id, err := strconv.Atoi(part)
+
+		if err != nil {
+			return h.editMessage(b, cb.Message, "Got invalid response", nil)
+		}
+
+		ids = append(ids, id)
+	}
+
+	id := ids[0]
+
+	switch parts[1] {
+	case "show":
+		return h.showSource(b, cb.Message, id)
+	case "merge":
+		return h.showMergeTargets(b, cb.Message, id)
+	case "into":
+		if len(ids) != 2 {
+			return h.editMessage(b, cb.Message, "Got invalid response", nil)
+		}
+
+		from, err := h.service.repo.GetSource(id)
+
+		if err != nil {
+			return h.editMessage(b, cb.Message, "Could not find the source", nil)
+		}
+
+		into, err := h.service.repo.GetSource(ids[1])
+
+		if err != nil {
+			return h.editMessage(b, cb.Message, "Could not find the source", nil)
+		}
+
+		return h.confirmSourceAction(b, cb.Message, fmt.Sprintf(
+			"Move the %v notes of <b>%s</b> into <b>%s</b> and delete it?",
+			from.TotalNotes,
+			html.EscapeString(from.Title),
+			html.EscapeString(into.Title),
+		), gotgbot.InlineKeyboardButton{
+			Text:         "🔀 Merge",
+			CallbackData: fmt.Sprintf("src_mergeok_%v_%v", id, ids[1]),
+		}, id)
+	case "mergeok":
+		if len(ids) != 2 {
+			return h.editMessage(b, cb.Message, "Got invalid response", nil)
+		}
+
+		if err := h.service.MergeSources(id, ids[1]); err != nil {
+			log.Printf("Failed to merge sources: %v", err)
+			return h.editMessage(b, cb.Message, "Failed to merge the sources", nil)
+		}
+
+		return h.showSource(b, cb.Message, ids[1])
+	case "archive":
+		if err := h.service.ArchiveSource(id); err != nil {
+			log.Printf("Failed to archive source: %v", err)
+			return h.editMessage(b, cb.Message, "Failed to archive the source", nil)
+		}
+
+		return h.showSource(b, cb.Message, id)
+	case "unarchive":
+		if err := h.service.UnarchiveSource(id); err != nil {
+			log.Printf("Failed to unarchive source: %v", err)
+			return h.editMessage(b, cb.Message, "Failed to unarchive the source", nil)
+		}
+
+		return h.showSource(b, cb.Message, id)
+	case "delete":
+		source, err := h.service.repo.GetSource(id)
+
+		if err != nil {
+			return h.editMessage(b, cb.Message, "Could not find the source", nil)
+		}
+
+		text := fmt.Sprintf(
+			"Delete <b>%s</b> and its %v notes?",
+			html.EscapeString(source.Title),
+			source.TotalNotes,
+		)
+
+		if source.Origin == "kindle" {
+			text = text + "\n\nHighlights still in your Kindle export come back on the next /sync, archive the source to keep them out of reviews instead."
+		}
+
+		return h.confirmSourceAction(b, cb.Message, text, gotgbot.InlineKeyboardButton{
+			Text:         "🗑 Delete",
+			CallbackData: fmt.Sprintf("src_deleteok_%v", id),
+		}, id)
+	case "deleteok":
+		if err := h.service.DeleteSource(id); err != nil {
+			log.Printf("Failed to delete source: %v", err)
+			return h.editMessage(b, cb.Message, "Failed to delete the source", nil)
+		}
+
+		return h.refreshSources(b, cb.Message)
+	}
+
+	return h.editMessage(b, cb.Message, "Got invalid response", nil)
+}
+
+// StartSourceRename asks for the new title of a source
+func (h *BotHandler) StartSourceRename(b *gotgbot.Bot, ctx *ext.Context) error {
+
+	if !checkUser(ctx.Update.CallbackQuery.From.Id) {
+		return nil
+	}
+
+	cb := ctx.Update.CallbackQuery
+
+	id, err := strconv.Atoi(strings.TrimPrefix(cb.Data, "src_rename_"))
+
+	if err != nil {
+		return h.editMessage(b, cb.Message, "Got invalid response", nil)
+	}
+
+	_, err = cb.Answer(b, nil)
+
+	if err != nil {
+		return fmt.Errorf("failed to answer callback query: %w", err)
+	}
+
+	source, err := h.service.repo.GetSource(id)
+
+	if err != nil {
+		return h.editMessage(b, cb.Message, "Could not find the source", nil)
+	}
+
+	h.endFlows(cb.Message.GetChat().Id)
+	h.setRenaming(cb.Message.GetChat().Id, id)
+
+	err = h.editMessage(b, cb.Message, fmt.Sprintf(
+		"✏️ Send the new title of <b>%s</b>, or /cancel",
+		html.EscapeString(source.Title),
+	), nil)
+
+	if err != nil {
+		return err
+	}
+
+	return handlers.NextConversationState(renameStateTitle)
+}
+
+// HandleSourceRename renames the source to the title sent by the user
+func (h *BotHandler) HandleSourceRename(b *gotgbot.Bot, ctx *ext.Context) error {
+
+	if !checkUser(ctx.EffectiveMessage.From.Id) {
+		return nil
+	}
+
+	chatID := ctx.EffectiveChat.Id
+
+	id, ok := h.getRenaming(chatID)
+
+	if !ok {
+		return handlers.EndConversation()
+	}
+
+	err := h.service.RenameSource(id, ctx.EffectiveMessage.Text)
+
+	if err != nil {
+		log.Printf("Failed to rename source %v: %v", id, err)
+
+		reply := "Failed to rename the source"
+
+		switch {
+		case errors.Is(err, ErrEmptyTitle):
+			reply = "The title can't be empty, send another title"
+		case errors.Is(err, storage.ErrSourceExists):
+			reply = "A source with this title already exists, merge them instead or send another title"
+		}
+
+		_, err = ctx.EffectiveMessage.Reply(b, reply, nil)
+		return err
+	}
+
+	h.takeRenaming(chatID)
+
+	text, keyboard, err := h.sourcesMessage()
+
+	if err != nil {
+		log.Printf("Failed to get sources: %v", err)
+		text = "Source renamed"
+	}
+
+	_, err = ctx.EffectiveMessage.Reply(b, text, &gotgbot.SendMessageOpts{
+		ReplyMarkup: keyboard,
+		ParseMode:   "HTML",
+	})
+
+	if err != nil {
+		return fmt.Errorf("failed to send message: %w", err)
+	}
+
+	return handlers.EndConversation()
+}
+
+func (h *BotHandler) CancelSourceRename(b *gotgbot.Bot, ctx *ext.Context) error {
+	h.takeRenaming(ctx.EffectiveChat.Id)
+
+	_, err := ctx.EffectiveMessage.Reply(b, "The source was not renamed", nil)
+
+	if err != nil {
+		return fmt.Errorf("failed to send message: %w", err)
+	}
+
+	return handlers.EndConversation()
+}
@@ -0,0 +1,58 @@
+package bot
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/amalrajan30/spacedgram/internal/storage"
+)
+
+func TestRenameSource(t *testing.T) {
+	s, db := testService(t)
+	source := testSource(t, db, storage.Source{})
+
+	t.Cleanup(func() {
+		db.Unscoped().Where("source_id = ?", source.ID).Delete(&storage.SourceAlias{})
+	})
+
+	if err := s.RenameSource(int(source.ID), " \t "); !errors.Is(err, ErrEmptyTitle) {
+		t.Errorf("renaming to a blank title = %v, want ErrEmptyTitle", err)
+	}
+
+	if err := s.RenameSource(int(source.ID), " "+source.Title+" renamed "); err != nil {
+		t.Fatalf("RenameSource failed: %v", err)
+	}
+
+	if renamed, err := s.repo.GetSource(int(source.ID)); err != nil || renamed.Title != source.Title+" renamed" {
+		t.Errorf("renamed source = %q (%v), want the trimmed title", renamed.Title, err)
+	}
+}
+
+func TestDeleteSource(t *testing.T) {
+	s, db := testService(t)
+	source := testSource(t, db, storage.Source{})
+
+	note := storage.Note{Content: "Highlight", SourceID: int(source.ID)}
+
+	if err := db.Create(&note).Error; err != nil {
+		t.Fatalf("failed to create note: %v", err)
+	}
+
+	if err := s.index.Load("model", func() (map[int][]float32, error) {
+		return map[int][]float32{int(note.ID): {1, 0}}, nil
+	}); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+
+	if err := s.DeleteSource(int(source.ID)); err != nil {
+		t.Fatalf("DeleteSource failed: %v", err)
+	}
+
+	if _, err := s.repo.GetNote(int(note.ID)); err == nil {
+		t.Error("the note of the deleted source is still there")
+	}
+
+	if matches := s.index.Search([]float32{1, 0}, 10, nil); len(matches) != 0 {
+		t.Errorf("search index = %+v, want the note of the deleted source removed", matches)
+	}
+}
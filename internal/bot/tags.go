@@ -0,0 +1,194 @@
+package bot
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/amalrajan30/spacedgram/internal/llm"
+	"github.com/amalrajan30/spacedgram/internal/storage"
+)
+
+const maxSuggestedTags = 3
+
+// normalizeTags normalizes names, dropping empty and repeated ones
+func normalizeTags(names []string) []string {
+	tags := []string{}
+	seen := map[string]bool{}
+
+	for _, name := range names {
+		tag := storage.NormalizeTag(name)
+
+		if tag == "" || seen[tag] {
+			continue
+		}
+
+		seen[tag] = true
+		tags = append(tags, tag)
+	}
+
+	return tags
+}
+
+func (s BotService) TagNote(noteID int, names []string) ([]string, error) {
+	tags := normalizeTags(names)
+
+	if len(tags) == 0 {
+		return nil, fmt.Errorf("no valid tags given")
+	}
+
+	if err := s.repo.TagNote(noteID, tags); err != nil {
+		return nil, err
+	}
+
+	return s.repo.GetNoteTags(noteID)
+}
+
+func (s BotService) UntagNote(noteID int, names []string) ([]string, error) {
+	if err := s.repo.UntagNote(noteID, normalizeTags(names)); err != nil {
+		return nil, err
+	}
+
+	return s.repo.GetNoteTags(noteID)
+}
+
+func (s BotService) TagSource(sourceID int, names []string) (storage.Source, []string, error) {
+	tags := normalizeTags(names)
+
+	if len(tags) == 0 {
+		return storage.Source{}, nil, fmt.Errorf("no valid tags given")
+	}
+
+	source, err := s.repo.GetSource(sourceID)
+
+	if err != nil {
+		return storage.Source{}, nil, err
+	}
+
+	if err := s.repo.TagSource(sourceID, tags); err != nil {
+		return storage.Source{}, nil, err
+	}
+
+	current, err := s.repo.GetSourceTags(sourceID)
+
+	return source, current, err
+}
+
+func (s BotService) UntagSource(sourceID int, names []string) (storage.Source, []string, error) {
+	source, err := s.repo.GetSource(sourceID)
+
+	if err != nil {
+		return storage.Source{}, nil, err
+	}
+
+	if err := s.repo.UntagSource(sourceID, normalizeTags(names)); err != nil {
+		return storage.Source{}, nil, err
+	}
+
+	current, err := s.repo.GetSourceTags(sourceID)
+
+	return source, current, err
+}
+
+// Notes imported within this window get tags suggested, older ones are left
+// to be tagged by hand rather than sending the whole library to the LLM
+const tagSuggestionWindow = 7 * 24 * time.Hour
+
+// EnqueueTagSuggestions queues tag suggestions for the recently imported
+// notes that never had any
+func (s BotService) EnqueueTagSuggestions() (int, error) {
+	notes, err := s.repo.GetNotesWithoutTagJob(time.Now().Add(-tagSuggestionWindow))
+
+	if err != nil {
+		return 0, err
+	}
+
+	jobs := []storage.GenerationJob{}
+
+	for _, note := range notes {
+		jobs = append(jobs, storage.GenerationJob{
+			NoteID: int(note.ID),
+			Kind:   storage.GenerationKindTags,
+		})
+	}
+
+	return s.repo.EnqueueGenerationJobs(jobs)
+}
+
+// suggestTags tags a note with the tags suggested by the LLM, unless it was
+// tagged in the meantime
+func (s BotService) suggestTags(note *storage.Note) error {
+	current, err := s.repo.GetNoteTags(int(note.ID))
+
+	if err != nil {
+		return err
+	}
+
+	if len(current) > 0 {
+		return nil
+	}
+
+	counts, err := s.repo.GetTagCounts()
+
+	if err != nil {
+		return err
+	}
+
+	highlight := s.highlightOf(note)
+
+	for _, count := range counts {
+		highlight.Tags = append(highlight.Tags, count.Name)
+	}
+
+	suggestions, err := llm.SuggestTags(highlight)
+
+	if err != nil {
+		return err
+	}
+
+	tags := normalizeTags(suggestions.Tags)
+
+	if len(tags) > maxSuggestedTags {
+		tags = tags[:maxSuggestedTags]
+	}
+
+	if len(tags) == 0 {
+		return nil
+	}
+
+	log.Printf("Tagging note %v with %v", note.ID, tags)
+
+	return s.repo.TagNote(int(note.ID), tags)
+}
+
+// TagReview builds a review session from the due and new notes carrying a
+// tag, across sources
+func (s BotService) TagReview(userID int64, tag string) (*ScheduledReviews, error) {
+	settings, err := s.repo.GetUserSettings(userID)
+
+	if err != nil {
+		return nil, fmt.Errorf("getting user settings: %w", err)
+	}
+
+	notes, err := s.repo.GetTaggedNotes(storage.NormalizeTag(tag), settings.DayEnd(time.Now()))
+
+	if err != nil {
+		return nil, err
+	}
+
+	noteIDs, heldBack, err := s.buildQueue(userID, settings, notes)
+
+	if err != nil {
+		return nil, fmt.Errorf("building review queue: %w", err)
+	}
+
+	return &ScheduledReviews{
+		Count:    len(noteIDs),
+		NoteIDs:  noteIDs,
+		HeldBack: heldBack,
+	}, nil
+}
+
+func (s BotService) GetTagCounts() ([]storage.TagCount, error) {
+	return s.repo.GetTagCounts()
+}
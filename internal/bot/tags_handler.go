@@ -0,0 +1,210 @@
+package bot
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+	"github.com/amalrajan30/spacedgram/internal/storage"
+	"gorm.io/gorm"
+)
+
+const tagUsage = "Usage:\n" +
+	"/%[1]v <tags...> - %[1]v the current review card\n" +
+	"/%[1]v source:<id> <tags...> - %[1]v every note of a source"
+
+func formatTags(tags []string) string {
+	if len(tags) == 0 {
+		return "none"
+	}
+
+	return html.EscapeString(strings.Join(tags, ", "))
+}
+
+// formatTagCounts lists the tags in use, for the usage message of /tag
+func (h *BotHandler) formatTagCounts() string {
+	counts, err := h.service.GetTagCounts()
+
+	if err != nil {
+		log.Printf("Failed to count tags: %v", err)
+		return ""
+	}
+
+	if len(counts) == 0 {
+		return ""
+	}
+
+	text := "\n\n🏷 <b>Tags</b>\n"
+
+	for _, count := range counts {
+		text = text + fmt.Sprintf("%s (%v)\n", html.EscapeString(count.Name), count.Count)
+	}
+
+	return text
+}
+
+// Tag adds tags to the current review card or to a source
+func (h *BotHandler) Tag(b *gotgbot.Bot, ctx *ext.Context) error {
+	return h.changeTags(b, ctx, "tag")
+}
+
+// Untag removes tags from the current review card or from a source
+func (h *BotHandler) Untag(b *gotgbot.Bot, ctx *ext.Context) error {
+	return h.changeTags(b, ctx, "untag")
+}
+
+func (h *BotHandler) changeTags(b *gotgbot.Bot, ctx *ext.Context, command string) error {
+
+	if !checkUser(ctx.Message.From.Id) {
+		return nil
+	}
+
+	args := ctx.Args()[1:]
+
+	if len(args) == 0 || (len(args) == 1 && strings.HasPrefix(args[0], "source:")) {
+		_, err := ctx.EffectiveMessage.Reply(b, html.EscapeString(fmt.Sprintf(tagUsage, command))+h.formatTagCounts(), &gotgbot.SendMessageOpts{
+			ParseMode: "HTML",
+		})
+		return err
+	}
+
+	var text string
+
+	if strings.HasPrefix(args[0], "source:") {
+		sourceID, err := strconv.Atoi(strings.TrimPrefix(args[0], "source:"))
+
+		if err != nil {
+			_, err = ctx.EffectiveMessage.Reply(b, fmt.Sprintf("Invalid source %q", args[0]), nil)
+			return err
+		}
+
+		tagSource := h.service.TagSource
+		if command == "untag" {
+			tagSource = h.service.UntagSource
+		}
+
+		source, tags, err := tagSource(sourceID, args[1:])
+
+		if err != nil {
+			log.Printf("Failed to %v source %v: %v", command, sourceID, err)
+
+			text = "Failed to update the tags of the source"
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				text = "Could not find the specified book"
+			}
+
+			_, err = ctx.EffectiveMessage.Reply(b, text, nil)
+			return err
+		}
+
+		text = fmt.Sprintf(
+			"🏷 <b>Tags of %s</b>\n"+
+				"━━━━━━━━━━━━━━\n"+
+				"%s",
+			html.EscapeString(source.Title),
+			formatTags(tags),
+		)
+	} else {
+		noteID, ok := h.getUserData("current_note")
+
+		if !ok {
+			_, err := ctx.EffectiveMessage.Reply(b, "No card under review, use source:<id> to tag a source", nil)
+			return err
+		}
+
+		tagNote := h.service.TagNote
+		if command == "untag" {
+			tagNote = h.service.UntagNote
+		}
+
+		tags, err := tagNote(noteID, args)
+
+		if err != nil {
+			log.Printf("Failed to %v note %v: %v", command, noteID, err)
+			_, err = ctx.EffectiveMessage.Reply(b, "Failed to update the tags of the card", nil)
+			return err
+		}
+
+		text = fmt.Sprintf(
+			"🏷 <b>Tags of the card</b>\n"+
+				"━━━━━━━━━━━━━━\n"+
+				"%s",
+			formatTags(tags),
+		)
+	}
+
+	_, err := ctx.EffectiveMessage.Reply(b, text, &gotgbot.SendMessageOpts{
+		ParseMode: "HTML",
+	})
+
+	if err != nil {
+		return fmt.Errorf("Failed to send tags: %w", err)
+	}
+
+	return nil
+}
+
+// Review starts a review session of the notes carrying a tag, across
+// sources, e.g. /review tag:stoicism
+func (h *BotHandler) Review(b *gotgbot.Bot, ctx *ext.Context) error {
+
+	if !checkUser(ctx.Message.From.Id) {
+		return nil
+	}
+
+	args := ctx.Args()[1:]
+
+	if len(args) != 1 || !strings.HasPrefix(args[0], "tag:") || strings.TrimPrefix(args[0], "tag:") == "" {
+		_, err := ctx.EffectiveMessage.Reply(b, html.EscapeString("Usage: /review tag:<name>")+h.formatTagCounts(), &gotgbot.SendMessageOpts{
+			ParseMode: "HTML",
+		})
+		return err
+	}
+
+	tag := storage.NormalizeTag(strings.TrimPrefix(args[0], "tag:"))
+
+	session, err := h.service.TagReview(ctx.EffectiveUser.Id, tag)
+
+	if err != nil {
+		log.Printf("Failed to start review of tag %v: %v", tag, err)
+		_, err = ctx.EffectiveMessage.Reply(b, "Failed to start review", nil)
+		return err
+	}
+
+	if session.Count == 0 {
+		_, err = ctx.EffectiveMessage.Reply(b, fmt.Sprintf(
+			"No notes tagged %s left to review today%s",
+			html.EscapeString(tag),
+			formatHeldBack(session.HeldBack),
+		), &gotgbot.SendMessageOpts{
+			ParseMode: "HTML",
+		})
+		return err
+	}
+
+	_, err = ctx.EffectiveMessage.Reply(b, fmt.Sprintf(
+		"🏷 <b>Starting Review</b>\n"+
+			"━━━━━━━━━━━━━━\n"+
+			"<b>Tag:</b> %s\n"+
+			"<b>Today:</b> %v%s",
+		html.EscapeString(tag),
+		session.Count,
+		formatHeldBack(session.HeldBack),
+	), &gotgbot.SendMessageOpts{
+		ParseMode: "HTML",
+	})
+
+	if err != nil {
+		return fmt.Errorf("Failed to send review start: %w", err)
+	}
+
+	h.setUserData("clozeQuestion", reviewModePlain)
+	h.startSession(session.NoteIDs, session.Count)
+
+	return h.showReview(b, ctx.EffectiveUser.Id, ctx.EffectiveChat.Id, nil, "")
+}
@@ -0,0 +1,156 @@
+package bot
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/amalrajan30/spacedgram/internal/storage"
+	"gorm.io/gorm"
+)
+
+func TestNormalizeTags(t *testing.T) {
+	got := normalizeTags([]string{"#Focus", "", "focus", "Deep Work", "#"})
+
+	if want := []string{"focus", "deep-work"}; !slices.Equal(got, want) {
+		t.Errorf("normalizeTags = %v, want %v", got, want)
+	}
+}
+
+// testTags returns tag names of the test, removed with their links when the
+// test ends
+func testTags(t *testing.T, db *gorm.DB, names ...string) []string {
+	suffix := time.Now().UnixNano()
+	tags := []string{}
+
+	for _, name := range names {
+		tags = append(tags, fmt.Sprintf("%v-%v", name, suffix))
+	}
+
+	t.Cleanup(func() {
+		var stored []storage.Tag
+		db.Where("name IN ?", tags).Find(&stored)
+
+		for _, tag := range stored {
+			db.Exec("DELETE FROM note_tags WHERE tag_id = ?", tag.ID)
+			db.Exec("DELETE FROM source_tags WHERE tag_id = ?", tag.ID)
+			db.Unscoped().Delete(&tag)
+		}
+	})
+
+	return tags
+}
+
+func TestTagNote(t *testing.T) {
+	s, db := testService(t)
+	source := testSource(t, db, storage.Source{})
+	tags := testTags(t, db, "stoicism", "ethics")
+
+	note := storage.Note{Content: "Highlight", SourceID: int(source.ID)}
+
+	if err := db.Create(&note).Error; err != nil {
+		t.Fatalf("failed to create note: %v", err)
+	}
+
+	if _, err := s.TagNote(int(note.ID), []string{"#", " "}); err == nil {
+		t.Error("TagNote accepted no valid tag")
+	}
+
+	current, err := s.TagNote(int(note.ID), []string{"#" + strings.ToUpper(tags[0]), tags[1]})
+
+	if err != nil || !slices.Equal(current, []string{tags[1], tags[0]}) {
+		t.Errorf("TagNote = %v, %v, want %v", current, err, []string{tags[1], tags[0]})
+	}
+
+	if current, err := s.UntagNote(int(note.ID), []string{tags[1]}); err != nil || !slices.Equal(current, tags[:1]) {
+		t.Errorf("UntagNote = %v, %v, want %v", current, err, tags[:1])
+	}
+
+	tagged, current, err := s.TagSource(int(source.ID), tags[1:])
+
+	if err != nil || tagged.ID != source.ID || !slices.Equal(current, tags[1:]) {
+		t.Errorf("TagSource = source %v with %v, %v, want %v", tagged.ID, current, err, tags[1:])
+	}
+
+	if _, current, err := s.UntagSource(int(source.ID), tags[1:]); err != nil || len(current) != 0 {
+		t.Errorf("UntagSource = %v, %v, want no tags", current, err)
+	}
+}
+
+func TestSuggestTags(t *testing.T) {
+	s, db := testService(t)
+	fake := useFakeProvider(t)
+	source := testSource(t, db, storage.Source{})
+	tags := testTags(t, db, "memory", "learning", "sleep", "habits")
+
+	fake.SetResponse("suggest_tags", fmt.Sprintf(`{"tags": ["#%v", %q, %q, %q, %q]}`,
+		strings.ToUpper(tags[0]), tags[0], tags[1], tags[2], tags[3]))
+
+	note := storage.Note{Content: "Sleep consolidates memories", SourceID: int(source.ID)}
+
+	if err := db.Create(&note).Error; err != nil {
+		t.Fatalf("failed to create note: %v", err)
+	}
+
+	if err := s.RunGenerationJob(storage.GenerationJob{NoteID: int(note.ID), Kind: storage.GenerationKindTags}); err != nil {
+		t.Fatalf("RunGenerationJob failed: %v", err)
+	}
+
+	// At most three distinct tags are kept
+	if current, err := s.repo.GetNoteTags(int(note.ID)); err != nil || !slices.Equal(current, []string{tags[1], tags[0], tags[2]}) {
+		t.Errorf("suggested tags = %v (%v), want %v", current, err, []string{tags[1], tags[0], tags[2]})
+	}
+
+	calls := len(fake.Calls())
+
+	// Notes tagged in the meantime are left alone
+	if err := s.RunGenerationJob(storage.GenerationJob{NoteID: int(note.ID), Kind: storage.GenerationKindTags}); err != nil {
+		t.Fatalf("RunGenerationJob failed: %v", err)
+	}
+
+	if len(fake.Calls()) != calls {
+		t.Error("tags were suggested for a tagged note")
+	}
+}
+
+func TestTagReview(t *testing.T) {
+	s, db := testService(t)
+	userID := testUserID(t, db)
+	tags := testTags(t, db, "rome")
+	tagged := testSource(t, db, storage.Source{})
+	other := testSource(t, db, storage.Source{})
+
+	past := time.Now().AddDate(0, 0, -1)
+
+	notes := []storage.Note{
+		{Content: "Due through its source", SourceID: int(tagged.ID), NextDueDate: &past},
+		{Content: "New and tagged", SourceID: int(other.ID)},
+		{Content: "Not tagged", SourceID: int(other.ID), NextDueDate: &past},
+	}
+
+	for i := range notes {
+		if err := db.Create(&notes[i]).Error; err != nil {
+			t.Fatalf("failed to create note: %v", err)
+		}
+	}
+
+	if _, _, err := s.TagSource(int(tagged.ID), tags); err != nil {
+		t.Fatalf("TagSource failed: %v", err)
+	}
+
+	if _, err := s.TagNote(int(notes[1].ID), tags); err != nil {
+		t.Fatalf("TagNote failed: %v", err)
+	}
+
+	reviews, err := s.TagReview(userID, "#"+tags[0])
+
+	if err != nil {
+		t.Fatalf("TagReview failed: %v", err)
+	}
+
+	if want := []int{int(notes[0].ID), int(notes[1].ID)}; !slices.Equal(reviews.NoteIDs, want) || reviews.Count != 2 {
+		t.Errorf("tag review = %v, want %v", reviews.NoteIDs, want)
+	}
+}
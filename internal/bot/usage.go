@@ -0,0 +1,146 @@
+package bot
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/amalrajan30/spacedgram/internal/llm"
+	"github.com/amalrajan30/spacedgram/internal/storage"
+)
+
+// usageTracker records the LLM calls of the bot's user and stops them once
+// one of the user's budgets is spent
+type usageTracker struct {
+	repo   *storage.Repository
+	userID int64
+}
+
+// NewUsageTracker accounts every LLM call to userID, as notes aren't owned by
+// a user and questions are shared
+func NewUsageTracker(repo *storage.Repository, userID int64) llm.UsageTracker {
+	return usageTracker{
+		repo:   repo,
+		userID: userID,
+	}
+}
+
+func monthStart(settings storage.UserSettings, now time.Time) time.Time {
+	local := now.In(settings.Location())
+	return time.Date(local.Year(), local.Month(), 1, 0, 0, 0, 0, local.Location())
+}
+
+func (t usageTracker) Allow() error {
+	settings, err := t.repo.GetUserSettings(t.userID)
+
+	if err != nil {
+		// Don't block generation on a settings lookup
+		log.Printf("Failed to get settings to check llm budget: %v", err)
+		return nil
+	}
+
+	now := time.Now()
+
+	budgets := []struct {
+		name   string
+		budget float64
+		since  time.Time
+	}{
+		{"daily", settings.DailyBudget, settings.DayStart(now)},
+		{"monthly", settings.MonthlyBudget, monthStart(settings, now)},
+	}
+
+	for _, budget := range budgets {
+		if budget.budget <= 0 {
+			continue
+		}
+
+		spend, err := t.repo.GetLLMSpend(t.userID, budget.since)
+
+		if err != nil {
+			log.Printf("Failed to get llm spend: %v", err)
+			return nil
+		}
+
+		if spend >= budget.budget {
+			return fmt.Errorf("%w: spent $%.2f of the %v budget of $%.2f", llm.ErrBudgetExceeded, spend, budget.name, budget.budget)
+		}
+	}
+
+	return nil
+}
+
+func (t usageTracker) Record(call llm.Call) {
+	err := t.repo.InsertLLMCall(storage.LLMCall{
+		UserID:       t.userID,
+		Provider:     call.Provider,
+		LLMModel:     call.Model,
+		Name:         call.Name,
+		InputTokens:  call.InputTokens,
+		OutputTokens: call.OutputTokens,
+		LatencyMs:    call.Latency.Milliseconds(),
+		CostUSD:      call.CostUSD,
+		Error:        call.Error,
+	})
+
+	if err != nil {
+		log.Printf("Failed to record llm call: %v", err)
+	}
+}
+
+type UsageReport struct {
+	Today         []storage.LLMUsage
+	Month         []storage.LLMUsage
+	DailyBudget   float64
+	MonthlyBudget float64
+}
+
+func (s BotService) GetUsage(userID int64) (*UsageReport, error) {
+	settings, err := s.repo.GetUserSettings(userID)
+
+	if err != nil {
+		return nil, fmt.Errorf("getting user settings: %w", err)
+	}
+
+	now := time.Now()
+
+	today, err := s.repo.GetLLMUsage(userID, settings.DayStart(now))
+
+	if err != nil {
+		return nil, err
+	}
+
+	month, err := s.repo.GetLLMUsage(userID, monthStart(settings, now))
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &UsageReport{
+		Today:         today,
+		Month:         month,
+		DailyBudget:   settings.DailyBudget,
+		MonthlyBudget: settings.MonthlyBudget,
+	}, nil
+}
+
+// SetBudget sets the daily or monthly LLM budget of a user in USD, 0 removes
+// the cap
+func (s BotService) SetBudget(userID int64, period string, budget float64) (storage.UserSettings, error) {
+	settings, err := s.repo.GetUserSettings(userID)
+
+	if err != nil {
+		return storage.UserSettings{}, err
+	}
+
+	switch period {
+	case "daily":
+		settings.DailyBudget = budget
+	case "monthly":
+		settings.MonthlyBudget = budget
+	default:
+		return storage.UserSettings{}, fmt.Errorf("unknown budget %q, expected daily or monthly", period)
+	}
+
+	return s.repo.SaveUserSettings(settings)
+}
@@ -0,0 +1,83 @@
+package bot
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+	"github.com/amalrajan30/spacedgram/internal/storage"
+)
+
+func formatUsagePeriod(name string, usage []storage.LLMUsage, budget float64) string {
+	total := storage.LLMUsage{}
+	lines := ""
+
+	for _, model := range usage {
+		total.Calls += model.Calls
+		total.Failed += model.Failed
+		total.InputTokens += model.InputTokens
+		total.OutputTokens += model.OutputTokens
+		total.CostUSD += model.CostUSD
+
+		lines = lines + fmt.Sprintf(
+			"• %v: %v calls, $%.4f, ~%.1fs\n",
+			model.Model,
+			model.Calls,
+			model.CostUSD,
+			model.AvgLatencyMs/1000,
+		)
+	}
+
+	text := fmt.Sprintf(
+		"<b>%s:</b> $%.4f",
+		name,
+		total.CostUSD,
+	)
+
+	if budget > 0 {
+		text = text + fmt.Sprintf(" of $%.2f", budget)
+	}
+
+	text = text + fmt.Sprintf(
+		"\n%v calls (%v failed), %v in / %v out tokens\n%s",
+		total.Calls,
+		total.Failed,
+		total.InputTokens,
+		total.OutputTokens,
+		lines,
+	)
+
+	return text
+}
+
+// Usage shows the LLM spend of the day and month against the budgets
+func (h *BotHandler) Usage(b *gotgbot.Bot, ctx *ext.Context) error {
+
+	if !checkUser(ctx.Message.From.Id) {
+		return nil
+	}
+
+	report, err := h.service.GetUsage(ctx.Message.From.Id)
+
+	if err != nil {
+		log.Printf("Failed to get llm usage: %v", err)
+		_, err = ctx.EffectiveMessage.Reply(b, "Failed to get usage", nil)
+		return err
+	}
+
+	_, err = ctx.EffectiveMessage.Reply(b,
+		"💸 <b>LLM usage</b>\n"+
+			"━━━━━━━━━━━━━━\n"+
+			formatUsagePeriod("Today", report.Today, report.DailyBudget)+"\n"+
+			formatUsagePeriod("This month", report.Month, report.MonthlyBudget),
+		&gotgbot.SendMessageOpts{
+			ParseMode: "HTML",
+		})
+
+	if err != nil {
+		return fmt.Errorf("Failed to send usage message: %w", err)
+	}
+
+	return nil
+}
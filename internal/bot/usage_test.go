@@ -0,0 +1,86 @@
+package bot
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/amalrajan30/spacedgram/internal/llm"
+	"github.com/amalrajan30/spacedgram/internal/storage"
+)
+
+func TestMonthStart(t *testing.T) {
+	settings := storage.UserSettings{Timezone: "Asia/Kolkata"}
+	now := time.Date(2024, 3, 31, 20, 0, 0, 0, time.UTC)
+
+	// Already the 1st of April in India
+	if got, want := monthStart(settings, now), time.Date(2024, 4, 1, 0, 0, 0, 0, settings.Location()); !got.Equal(want) {
+		t.Errorf("monthStart = %v, want %v", got, want)
+	}
+}
+
+func TestUsageTracker(t *testing.T) {
+	s, db := testService(t)
+	userID := testUserID(t, db)
+
+	t.Cleanup(func() {
+		db.Unscoped().Where("user_id = ?", userID).Delete(&storage.LLMCall{})
+		db.Unscoped().Where("user_id = ?", userID).Delete(&storage.UserSettings{})
+	})
+
+	tracker := NewUsageTracker(s.repo, userID)
+
+	if err := tracker.Allow(); err != nil {
+		t.Fatalf("Allow without a budget = %v", err)
+	}
+
+	for _, call := range []llm.Call{
+		{Provider: llm.ProviderOpenAI, Model: "gpt-4o-mini", Name: "create_question", InputTokens: 1000, OutputTokens: 200, Latency: time.Second, CostUSD: 0.30},
+		{Provider: llm.ProviderOpenAI, Model: "gpt-4o-mini", Name: "create_quiz", InputTokens: 500, Latency: 3 * time.Second, CostUSD: 0.20, Error: "timeout"},
+		{Provider: llm.ProviderLocal, Model: "llama3.1", Name: "create_question", InputTokens: 800, OutputTokens: 100},
+	} {
+		tracker.Record(call)
+	}
+
+	report, err := s.GetUsage(userID)
+
+	if err != nil {
+		t.Fatalf("GetUsage failed: %v", err)
+	}
+
+	if len(report.Today) != 2 || len(report.Month) != 2 {
+		t.Fatalf("usage = %+v, want the calls of both models today and this month", report)
+	}
+
+	// The most expensive model comes first
+	if usage := report.Today[0]; usage.Model != "gpt-4o-mini" || usage.Calls != 2 || usage.Failed != 1 ||
+		usage.InputTokens != 1500 || usage.OutputTokens != 200 || usage.CostUSD != 0.5 || usage.AvgLatencyMs != 2000 {
+		t.Errorf("usage of gpt-4o-mini = %+v", usage)
+	}
+
+	if _, err := s.SetBudget(userID, "weekly", 1); err == nil {
+		t.Error("SetBudget accepted a weekly budget")
+	}
+
+	if _, err := s.SetBudget(userID, "daily", -1); err == nil {
+		t.Error("SetBudget accepted a negative budget")
+	}
+
+	settings, err := s.SetBudget(userID, "monthly", 1)
+
+	if err != nil || settings.MonthlyBudget != 1 {
+		t.Fatalf("SetBudget = %+v, %v, want a monthly budget of $1", settings, err)
+	}
+
+	if err := tracker.Allow(); err != nil {
+		t.Errorf("Allow under the budget = %v", err)
+	}
+
+	if _, err := s.SetBudget(userID, "daily", 0.5); err != nil {
+		t.Fatalf("SetBudget failed: %v", err)
+	}
+
+	if err := tracker.Allow(); !errors.Is(err, llm.ErrBudgetExceeded) {
+		t.Errorf("Allow with the daily budget spent = %v, want ErrBudgetExceeded", err)
+	}
+}
@@ -0,0 +1,181 @@
+package generation
+
+import (
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/amalrajan30/spacedgram/internal/bot"
+	"github.com/amalrajan30/spacedgram/internal/llm"
+	"github.com/amalrajan30/spacedgram/internal/storage"
+)
+
+const (
+	pollInterval    = 5 * time.Second
+	enqueueInterval = 30 * time.Minute
+	maxAttempts     = 5
+	baseBackoff     = 30 * time.Second
+	maxBackoff      = time.Hour
+	budgetRetry     = time.Hour
+)
+
+// Pool generates the questions of queued generation jobs in the background,
+// running at most workers jobs at a time
+type Pool struct {
+	service *bot.BotService
+	repo    *storage.Repository
+	workers int
+
+	slots chan struct{}
+	stop  chan struct{}
+	wg    sync.WaitGroup
+}
+
+func NewPool(service *bot.BotService, repo *storage.Repository, workers int) *Pool {
+	if workers < 1 {
+		workers = 1
+	}
+
+	return &Pool{
+		service: service,
+		repo:    repo,
+		workers: workers,
+		slots:   make(chan struct{}, workers),
+		stop:    make(chan struct{}),
+	}
+}
+
+// Start requeues the jobs interrupted by the last shutdown and starts
+// polling for jobs. Questions of upcoming notes are queued periodically,
+// along with the embeddings of notes missing one.
+func (p *Pool) Start() {
+	requeued, err := p.repo.RequeueRunningGenerationJobs()
+
+	if err != nil {
+		log.Printf("failed to requeue interrupted generation jobs: %v", err)
+	} else if requeued > 0 {
+		log.Printf("Requeued %v interrupted generation jobs", requeued)
+	}
+
+	p.wg.Add(1)
+	go p.run()
+
+	log.Printf("Started generation pool with %v workers", p.workers)
+}
+
+// Stop waits for the running jobs to finish
+func (p *Pool) Stop() {
+	close(p.stop)
+	p.wg.Wait()
+}
+
+func (p *Pool) run() {
+	defer p.wg.Done()
+
+	poll := time.NewTicker(pollInterval)
+	defer poll.Stop()
+
+	enqueue := time.NewTicker(enqueueInterval)
+	defer enqueue.Stop()
+
+	p.enqueueUpcoming()
+
+	for {
+		select {
+		case <-p.stop:
+			return
+		case <-enqueue.C:
+			p.enqueueUpcoming()
+		case <-poll.C:
+			p.dispatch()
+		}
+	}
+}
+
+func (p *Pool) enqueueUpcoming() {
+	queued, err := p.service.EnqueueUpcoming()
+
+	if err != nil {
+		log.Printf("failed to queue upcoming questions: %v", err)
+	} else if queued > 0 {
+		log.Printf("Queued %v upcoming questions", queued)
+	}
+
+	// Catch up on notes whose embedding failed at import
+	if _, err := p.service.EmbedPendingNotes(); err != nil {
+		log.Printf("failed to embed pending notes: %v", err)
+	}
+}
+
+// dispatch claims as many jobs as there are free workers and runs them
+func (p *Pool) dispatch() {
+	free := p.workers - len(p.slots)
+
+	if free == 0 {
+		return
+	}
+
+	jobs, err := p.repo.ClaimGenerationJobs(free)
+
+	if err != nil {
+		log.Printf("failed to claim generation jobs: %v", err)
+		return
+	}
+
+	for _, job := range jobs {
+		p.slots <- struct{}{}
+		p.wg.Add(1)
+
+		go func(job storage.GenerationJob) {
+			defer func() {
+				<-p.slots
+				p.wg.Done()
+			}()
+
+			p.runJob(job)
+		}(job)
+	}
+}
+
+func (p *Pool) runJob(job storage.GenerationJob) {
+	err := p.service.RunGenerationJob(job)
+
+	if err == nil {
+		if err := p.repo.CompleteGenerationJob(job.ID); err != nil {
+			log.Printf("failed to complete generation job %v: %v", job.ID, err)
+		}
+		return
+	}
+
+	var retryAt *time.Time
+
+	switch {
+	case errors.Is(err, llm.ErrBudgetExceeded):
+		// Wait for the budget to reset without using up attempts
+		if err := p.repo.PostponeGenerationJob(job.ID, time.Now().Add(budgetRetry)); err != nil {
+			log.Printf("failed to postpone generation job: %v", err)
+		}
+		return
+	case job.Attempts < maxAttempts:
+		next := time.Now().Add(backoff(job.Attempts))
+		retryAt = &next
+	}
+
+	log.Printf("Generation of %v for note %v failed (attempt %v/%v): %v", job.Kind, job.NoteID, job.Attempts, maxAttempts, err)
+
+	if err := p.repo.FailGenerationJob(job.ID, err, retryAt); err != nil {
+		log.Printf("failed to record generation failure: %v", err)
+	}
+}
+
+// backoff doubles the wait after each failed attempt, up to maxBackoff
+func backoff(attempts int) time.Duration {
+	wait := baseBackoff
+
+	for i := 1; i < attempts && wait < maxBackoff; i++ {
+		wait *= 2
+	}
+
+	return min(wait, maxBackoff)
+}
@@ -0,0 +1,144 @@
+package grading
+
+import (
+	"html"
+	"strings"
+	"unicode"
+)
+
+var articles = map[string]bool{
+	"a":   true,
+	"an":  true,
+	"the": true,
+}
+
+// Normalize lowercases an answer, strips punctuation and articles and
+// collapses whitespace, so that "The Roman Empire." matches "roman empire"
+func Normalize(answer string) string {
+	return strings.Join(normalizedWords(answer), " ")
+}
+
+func normalizeWord(word string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsPunct(r) || unicode.IsSymbol(r) {
+			return -1
+		}
+		return unicode.ToLower(r)
+	}, word)
+}
+
+func normalizedWords(answer string) []string {
+	words := []string{}
+
+	for _, word := range strings.Fields(answer) {
+		word = normalizeWord(word)
+		if word == "" || articles[word] {
+			continue
+		}
+		words = append(words, word)
+	}
+
+	return words
+}
+
+func levenshtein(a []rune, b []rune) int {
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+
+	for j := range previous {
+		previous[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+
+		previous, current = current, previous
+	}
+
+	return previous[len(b)]
+}
+
+// Similarity compares two answers after normalization, from 0 for nothing
+// in common to 1 for a match. An empty answer matches nothing.
+func Similarity(answer string, expected string) float64 {
+	a := []rune(Normalize(answer))
+	b := []rune(Normalize(expected))
+
+	if len(a) == 0 {
+		return 0
+	}
+
+	longest := max(len(a), len(b))
+
+	return 1 - float64(levenshtein(a, b))/float64(longest)
+}
+
+// SuggestGrade maps the similarity of an answer to one of the review scores
+func SuggestGrade(similarity float64) int {
+	switch {
+	case similarity >= 1:
+		return 5
+	case similarity >= 0.9:
+		return 4
+	case similarity >= 0.75:
+		return 3
+	case similarity >= 0.5:
+		return 2
+	case similarity >= 0.25:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// Diff renders the answer word by word against the expected one as Telegram
+// HTML. Extra words are struck through and missing ones underlined.
+func Diff(answer string, expected string) string {
+	given := strings.Fields(answer)
+	wanted := strings.Fields(expected)
+
+	// Longest common subsequence of the normalized words
+	lcs := make([][]int, len(given)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(wanted)+1)
+	}
+
+	for i := len(given) - 1; i >= 0; i-- {
+		for j := len(wanted) - 1; j >= 0; j-- {
+			if normalizeWord(given[i]) == normalizeWord(wanted[j]) {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	parts := []string{}
+	i, j := 0, 0
+
+	for i < len(given) || j < len(wanted) {
+		switch {
+		case i < len(given) && j < len(wanted) && normalizeWord(given[i]) == normalizeWord(wanted[j]):
+			parts = append(parts, html.EscapeString(given[i]))
+			i++
+			j++
+		case j < len(wanted) && (i == len(given) || lcs[i][j+1] >= lcs[i+1][j]):
+			parts = append(parts, "<u>"+html.EscapeString(wanted[j])+"</u>")
+			j++
+		default:
+			parts = append(parts, "<s>"+html.EscapeString(given[i])+"</s>")
+			i++
+		}
+	}
+
+	return strings.Join(parts, " ")
+}
@@ -0,0 +1,113 @@
+package grading
+
+import "testing"
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		answer string
+		want   string
+	}{
+		{"The Roman Empire.", "roman empire"},
+		{"  an   Apple, a day ", "apple day"},
+		{"Rock'n'roll!", "rocknroll"},
+		{"", ""},
+		{"the", ""},
+	}
+
+	for _, test := range tests {
+		if got := Normalize(test.answer); got != test.want {
+			t.Errorf("Normalize(%q) = %q, want %q", test.answer, got, test.want)
+		}
+	}
+}
+
+func TestLevenshtein(t *testing.T) {
+	tests := []struct {
+		a    string
+		b    string
+		want int
+	}{
+		{"", "", 0},
+		{"abc", "", 3},
+		{"", "abc", 3},
+		{"kitten", "sitting", 3},
+		{"flaw", "lawn", 2},
+		{"same", "same", 0},
+		{"café", "cafe", 1},
+	}
+
+	for _, test := range tests {
+		if got := levenshtein([]rune(test.a), []rune(test.b)); got != test.want {
+			t.Errorf("levenshtein(%q, %q) = %v, want %v", test.a, test.b, got, test.want)
+		}
+	}
+}
+
+func TestSimilarity(t *testing.T) {
+	tests := []struct {
+		name     string
+		answer   string
+		expected string
+		want     float64
+	}{
+		{"exact", "roman empire", "roman empire", 1},
+		{"normalized", "The Roman Empire.", "roman empire", 1},
+		{"one typo", "roman empira", "roman empire", 1 - 1.0/12},
+		{"nothing in common", "abc", "xyz", 0},
+		{"empty answer", "", "roman empire", 0},
+		{"empty answer and expected", "", "", 0},
+		{"only articles", "the", "the", 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := Similarity(test.answer, test.expected); got != test.want {
+				t.Errorf("Similarity(%q, %q) = %v, want %v", test.answer, test.expected, got, test.want)
+			}
+		})
+	}
+}
+
+func TestSuggestGrade(t *testing.T) {
+	tests := []struct {
+		similarity float64
+		want       int
+	}{
+		{1, 5},
+		{0.95, 4},
+		{0.8, 3},
+		{0.5, 2},
+		{0.3, 1},
+		{0, 0},
+	}
+
+	for _, test := range tests {
+		if got := SuggestGrade(test.similarity); got != test.want {
+			t.Errorf("SuggestGrade(%v) = %v, want %v", test.similarity, got, test.want)
+		}
+	}
+}
+
+func TestDiff(t *testing.T) {
+	tests := []struct {
+		name     string
+		answer   string
+		expected string
+		want     string
+	}{
+		{"match", "The Roman empire", "the roman Empire.", "The Roman empire"},
+		{"missing word", "roman empire", "western roman empire", "<u>western</u> roman empire"},
+		{"extra word", "the holy roman empire", "the roman empire", "the <s>holy</s> roman empire"},
+		{"replaced word", "eastern empire", "western empire", "<u>western</u> <s>eastern</s> empire"},
+		{"empty answer", "", "roman empire", "<u>roman</u> <u>empire</u>"},
+		{"escaped", "<b>", "a & b", "<u>a</u> <u>&amp;</u> &lt;b&gt;"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := Diff(test.answer, test.expected); got != test.want {
+				t.Errorf("Diff(%q, %q) = %q, want %q", test.answer, test.expected, got, test.want)
+			}
+		})
+	}
+}
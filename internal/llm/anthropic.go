@@ -0,0 +1,177 @@
+package llm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+)
+
+const (
+	defaultAnthropicModel = "claude-3-5-haiku-latest"
+	defaultAnthropicURL   = "https://api.anthropic.com/v1/messages"
+	anthropicVersion      = "2023-06-01"
+	anthropicMaxTokens    = 1024
+)
+
+// anthropicProvider uses the messages API, forcing a tool call whose input
+// schema is the requested one to get structured responses
+type anthropicProvider struct {
+	client      *http.Client
+	url         string
+	apiKey      string
+	model       string
+	temperature *float64
+}
+
+func newAnthropicProvider(config Config) (*anthropicProvider, error) {
+	apiKey := config.APIKey
+	if apiKey == "" {
+		apiKey = os.Getenv("ANTHROPIC_API_KEY")
+	}
+
+	if apiKey == "" {
+		return nil, fmt.Errorf("anthropic provider needs LLM_API_KEY or ANTHROPIC_API_KEY")
+	}
+
+	url := config.BaseURL
+	if url == "" {
+		url = defaultAnthropicURL
+	}
+
+	model := config.Model
+	if model == "" {
+		model = defaultAnthropicModel
+	}
+
+	return &anthropicProvider{
+		client:      &http.Client{},
+		url:         url,
+		apiKey:      apiKey,
+		model:       model,
+		temperature: config.Temperature,
+	}, nil
+}
+
+type anthropicTool struct {
+	Name        string      `json:"name"`
+	Description string      `json:"description"`
+	InputSchema interface{} `json:"input_schema"`
+}
+
+type anthropicMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type anthropicRequest struct {
+	Model       string             `json:"model"`
+	MaxTokens   int                `json:"max_tokens"`
+	System      string             `json:"system"`
+	Messages    []anthropicMessage `json:"messages"`
+	Tools       []anthropicTool    `json:"tools"`
+	ToolChoice  map[string]string  `json:"tool_choice"`
+	Temperature *float64           `json:"temperature,omitempty"`
+}
+
+type anthropicResponse struct {
+	Model string `json:"model"`
+	Usage struct {
+		InputTokens  int `json:"input_tokens"`
+		OutputTokens int `json:"output_tokens"`
+	} `json:"usage"`
+	Content []struct {
+		Type  string          `json:"type"`
+		Name  string          `json:"name"`
+		Input json.RawMessage `json:"input"`
+	} `json:"content"`
+	Error *struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+func (p *anthropicProvider) Name() string {
+	return ProviderAnthropic
+}
+
+func (p *anthropicProvider) Generate(ctx context.Context, request Request) (Response, error) {
+	body, err := json.Marshal(anthropicRequest{
+		Model:     p.model,
+		MaxTokens: anthropicMaxTokens,
+		System:    request.SystemPrompt,
+		Messages: []anthropicMessage{{
+			Role:    "user",
+			Content: request.UserPrompt,
+		}},
+		Tools: []anthropicTool{{
+			Name:        request.Name,
+			Description: request.Description,
+			InputSchema: request.Schema,
+		}},
+		ToolChoice: map[string]string{
+			"type": "tool",
+			"name": request.Name,
+		},
+		Temperature: p.temperature,
+	})
+
+	if err != nil {
+		return Response{Model: p.model}, fmt.Errorf("encoding anthropic request: %w", err)
+	}
+
+	httpRequest, err := http.NewRequestWithContext(ctx, http.MethodPost, p.url, bytes.NewReader(body))
+
+	if err != nil {
+		return Response{Model: p.model}, err
+	}
+
+	httpRequest.Header.Set("content-type", "application/json")
+	httpRequest.Header.Set("x-api-key", p.apiKey)
+	httpRequest.Header.Set("anthropic-version", anthropicVersion)
+
+	httpResponse, err := p.client.Do(httpRequest)
+
+	if err != nil {
+		return Response{Model: p.model}, fmt.Errorf("calling anthropic: %w", err)
+	}
+
+	defer httpResponse.Body.Close()
+
+	responseBody, err := io.ReadAll(httpResponse.Body)
+
+	if err != nil {
+		return Response{Model: p.model}, fmt.Errorf("reading anthropic response: %w", err)
+	}
+
+	var response anthropicResponse
+	if err := json.Unmarshal(responseBody, &response); err != nil {
+		return Response{Model: p.model}, fmt.Errorf("decoding anthropic response: %w", err)
+	}
+
+	if response.Error != nil {
+		return Response{Model: p.model}, fmt.Errorf("anthropic %v: %v", response.Error.Type, response.Error.Message)
+	}
+
+	if httpResponse.StatusCode != http.StatusOK {
+		return Response{Model: p.model}, fmt.Errorf("anthropic returned %v", httpResponse.Status)
+	}
+
+	result := Response{
+		Model:        response.Model,
+		InputTokens:  response.Usage.InputTokens,
+		OutputTokens: response.Usage.OutputTokens,
+	}
+
+	for _, content := range response.Content {
+		if content.Type == "tool_use" && content.Name == request.Name {
+			result.Content = string(content.Input)
+			return result, nil
+		}
+	}
+
+	return result, fmt.Errorf("anthropic response has no %v tool call", request.Name)
+}
@@ -0,0 +1,80 @@
+package llm
+
+import (
+	"log"
+)
+
+type OpenQuestion struct {
+	Question string `json:"question" jsonschema_description:"Open ended question testing the main idea of the notes"`
+	Answer   string `json:"answer" jsonschema_description:"Short model answer of the question"`
+}
+
+type TrueFalseQuestion struct {
+	Statement   string `json:"statement" jsonschema_description:"Statement about the notes that is either true or subtly false"`
+	IsTrue      bool   `json:"is_true" jsonschema_description:"Whether the statement is true according to the notes"`
+	Explanation string `json:"explanation" jsonschema_description:"One sentence explaining why the statement is true or false"`
+}
+
+type ExplainPrompt struct {
+	Prompt    string `json:"prompt" jsonschema_description:"Request to explain the idea of the notes in your own words, without quoting them"`
+	KeyPoints string `json:"key_points" jsonschema_description:"Key points a good explanation should cover"`
+}
+
+type ReverseCard struct {
+	Concept string `json:"concept" jsonschema_description:"Name or short description of the concept the notes are about, without quoting them"`
+}
+
+var (
+	OpenQuestionResponseSchema      = GenerateSchema[OpenQuestion]()
+	TrueFalseQuestionResponseSchema = GenerateSchema[TrueFalseQuestion]()
+	ExplainPromptResponseSchema     = GenerateSchema[ExplainPrompt]()
+	ReverseCardResponseSchema       = GenerateSchema[ReverseCard]()
+)
+
+func GenerateOpenQuestion(highlight Highlight) (*OpenQuestion, error) {
+	log.Println("Generating open question")
+
+	return generateFromHighlight[OpenQuestion](
+		"create_open_question",
+		"Generate an open ended question and its answer from a piece of information",
+		OpenQuestionResponseSchema,
+		TemplateOpen,
+		highlight,
+	)
+}
+
+func GenerateTrueFalseQuestion(highlight Highlight) (*TrueFalseQuestion, error) {
+	log.Println("Generating true/false question")
+
+	return generateFromHighlight[TrueFalseQuestion](
+		"create_true_false",
+		"Generate a true or false statement from a piece of information",
+		TrueFalseQuestionResponseSchema,
+		TemplateTrueFalse,
+		highlight,
+	)
+}
+
+func GenerateExplainPrompt(highlight Highlight) (*ExplainPrompt, error) {
+	log.Println("Generating explain prompt")
+
+	return generateFromHighlight[ExplainPrompt](
+		"create_explain_prompt",
+		"Generate a request to explain a piece of information in your own words",
+		ExplainPromptResponseSchema,
+		TemplateExplain,
+		highlight,
+	)
+}
+
+func GenerateReverseCard(highlight Highlight) (*ReverseCard, error) {
+	log.Println("Generating reverse card")
+
+	return generateFromHighlight[ReverseCard](
+		"create_reverse_card",
+		"Name the concept a piece of information is about, so that it can be recalled from the concept",
+		ReverseCardResponseSchema,
+		TemplateReverse,
+		highlight,
+	)
+}
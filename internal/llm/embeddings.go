@@ -0,0 +1,277 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"math"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/openai/openai-go"
+	"github.com/openai/openai-go/option"
+)
+
+const (
+	defaultOpenAIEmbeddingModel = openai.EmbeddingModelTextEmbedding3Small
+	defaultLocalEmbeddingModel  = "nomic-embed-text"
+	// Dimensions of the fake embeddings
+	fakeEmbeddingSize = 256
+)
+
+// Embeddings are the vectors of a batch of texts, in the order of the texts
+type Embeddings struct {
+	Vectors     [][]float32
+	Model       string
+	InputTokens int
+}
+
+// Embedder turns texts into vectors for semantic search
+type Embedder interface {
+	Embed(ctx context.Context, texts []string) (Embeddings, error)
+	Name() string
+	// Model the vectors come from, vectors of different models can't be
+	// compared
+	Model() string
+}
+
+// NewEmbedder creates the embedder selected by LLM_EMBEDDING_PROVIDER and
+// LLM_EMBEDDING_MODEL. It defaults to the provider of the config, or OpenAI
+// for providers without embeddings.
+func NewEmbedder(config Config) (Embedder, error) {
+	provider := os.Getenv("LLM_EMBEDDING_PROVIDER")
+
+	if provider == "" {
+		provider = config.Provider
+	}
+
+	// The endpoint and key of the config belong to another provider
+	if provider != config.Provider {
+		config.BaseURL = ""
+		config.APIKey = ""
+	}
+
+	config.Model = os.Getenv("LLM_EMBEDDING_MODEL")
+
+	switch provider {
+	case ProviderOpenAI, ProviderAnthropic:
+		if config.Model == "" {
+			config.Model = defaultOpenAIEmbeddingModel
+		}
+		if provider == ProviderAnthropic {
+			config.BaseURL = ""
+			config.APIKey = ""
+		}
+		return &openAIEmbedder{
+			name:   ProviderOpenAI,
+			client: newOpenAIProvider(config).client,
+			model:  config.Model,
+		}, nil
+	case ProviderLocal:
+		if config.Model == "" {
+			config.Model = defaultLocalEmbeddingModel
+		}
+		return &openAIEmbedder{
+			name:   ProviderLocal,
+			client: newLocalProvider(config).client,
+			model:  config.Model,
+		}, nil
+	case ProviderFake:
+		return FakeEmbedder{}, nil
+	default:
+		return nil, fmt.Errorf("unknown embedding provider %q", provider)
+	}
+}
+
+type openAIEmbedder struct {
+	name   string
+	client *openai.Client
+	model  string
+}
+
+func (e *openAIEmbedder) Name() string {
+	return e.name
+}
+
+func (e *openAIEmbedder) Model() string {
+	return e.model
+}
+
+func (e *openAIEmbedder) Embed(ctx context.Context, texts []string) (Embeddings, error) {
+	response, err := e.client.Embeddings.New(ctx, openai.EmbeddingNewParams{
+		Input: openai.F[openai.EmbeddingNewParamsInputUnion](openai.EmbeddingNewParamsInputArrayOfStrings(texts)),
+		Model: openai.F(e.model),
+	}, option.WithMaxRetries(2))
+
+	if err != nil {
+		return Embeddings{Model: e.model}, err
+	}
+
+	embeddings := Embeddings{
+		Vectors:     make([][]float32, len(texts)),
+		Model:       e.model,
+		InputTokens: int(response.Usage.PromptTokens),
+	}
+
+	for _, data := range response.Data {
+		if int(data.Index) >= len(texts) {
+			return embeddings, fmt.Errorf("embedding index %d out of range", data.Index)
+		}
+
+		vector := make([]float32, len(data.Embedding))
+		for i, value := range data.Embedding {
+			vector[i] = float32(value)
+		}
+
+		embeddings.Vectors[data.Index] = vector
+	}
+
+	for i, vector := range embeddings.Vectors {
+		if vector == nil {
+			return embeddings, fmt.Errorf("missing embedding for text %d", i)
+		}
+	}
+
+	return embeddings, nil
+}
+
+// FakeEmbedder hashes the words of a text into a normalised bag of words, so
+// texts sharing words end up close without any network access
+type FakeEmbedder struct{}
+
+func (FakeEmbedder) Name() string {
+	return ProviderFake
+}
+
+func (FakeEmbedder) Model() string {
+	return ProviderFake
+}
+
+func (FakeEmbedder) Embed(ctx context.Context, texts []string) (Embeddings, error) {
+	embeddings := Embeddings{Model: ProviderFake}
+
+	for _, text := range texts {
+		vector := make([]float32, fakeEmbeddingSize)
+
+		for _, word := range strings.Fields(strings.ToLower(text)) {
+			hash := fnv.New32a()
+			hash.Write([]byte(strings.Trim(word, ".,;:!?\"'()")))
+			vector[hash.Sum32()%fakeEmbeddingSize]++
+		}
+
+		var norm float64
+		for _, value := range vector {
+			norm += float64(value * value)
+		}
+
+		if norm > 0 {
+			for i := range vector {
+				vector[i] = float32(float64(vector[i]) / math.Sqrt(norm))
+			}
+		}
+
+		embeddings.Vectors = append(embeddings.Vectors, vector)
+	}
+
+	return embeddings, nil
+}
+
+var embedder Embedder
+
+// currentEmbedder returns the configured embedder, configuring it from the
+// environment on first use
+func currentEmbedder() (Embedder, time.Duration, error) {
+	mux.RLock()
+	e, t := embedder, timeout
+	mux.RUnlock()
+
+	if e != nil {
+		return e, t, nil
+	}
+
+	config, err := ConfigFromEnv()
+
+	if err != nil {
+		return nil, 0, err
+	}
+
+	e, err = NewEmbedder(config)
+
+	if err != nil {
+		return nil, 0, err
+	}
+
+	SetEmbedder(e)
+
+	return e, t, nil
+}
+
+func SetEmbedder(e Embedder) {
+	mux.Lock()
+	defer mux.Unlock()
+
+	embedder = e
+}
+
+// EmbeddingModel returns the model of the configured embedder
+func EmbeddingModel() (string, error) {
+	e, _, err := currentEmbedder()
+
+	if err != nil {
+		return "", err
+	}
+
+	return e.Model(), nil
+}
+
+// Embed returns the vectors of texts, recording the call like the other
+// generations
+func Embed(texts []string) (*Embeddings, error) {
+	e, timeout, err := currentEmbedder()
+
+	if err != nil {
+		return nil, err
+	}
+
+	usage := currentTracker()
+
+	if usage != nil {
+		if err := usage.Allow(); err != nil {
+			log.Printf("Skipping embeddings: %v", err)
+			return nil, err
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	start := time.Now()
+
+	embeddings, err := e.Embed(ctx, texts)
+
+	if usage != nil {
+		call := Call{
+			Provider:    e.Name(),
+			Model:       embeddings.Model,
+			Name:        "embed",
+			InputTokens: embeddings.InputTokens,
+			Latency:     time.Since(start),
+			CostUSD:     Cost(embeddings.Model, embeddings.InputTokens, 0),
+		}
+
+		if err != nil {
+			call.Error = err.Error()
+		}
+
+		usage.Record(call)
+	}
+
+	if err != nil {
+		log.Printf("failed to embed %v texts: %v", len(texts), err)
+		return nil, err
+	}
+
+	return &embeddings, nil
+}
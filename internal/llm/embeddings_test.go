@@ -0,0 +1,128 @@
+package llm
+
+import (
+	"context"
+	"testing"
+)
+
+func similarity(a []float32, b []float32) float64 {
+	var sum float64
+
+	for i := range a {
+		sum += float64(a[i]) * float64(b[i])
+	}
+
+	return sum
+}
+
+func TestFakeEmbedder(t *testing.T) {
+	embeddings, err := FakeEmbedder{}.Embed(context.Background(), []string{
+		"The Roman Empire was vast.",
+		"the roman empire",
+		"Photosynthesis feeds plants",
+		"",
+	})
+
+	if err != nil {
+		t.Fatalf("Embed failed: %v", err)
+	}
+
+	if len(embeddings.Vectors) != 4 || len(embeddings.Vectors[0]) != fakeEmbeddingSize {
+		t.Fatalf("embedded %v vectors, want 4 of %v dimensions", len(embeddings.Vectors), fakeEmbeddingSize)
+	}
+
+	vectors := embeddings.Vectors
+
+	if norm := similarity(vectors[0], vectors[0]); norm < 0.999 || norm > 1.001 {
+		t.Errorf("squared norm = %v, want a normalised vector", norm)
+	}
+
+	if similarity(vectors[0], vectors[1]) <= similarity(vectors[0], vectors[2]) {
+		t.Error("texts sharing words aren't closer than unrelated ones")
+	}
+
+	if similarity(vectors[3], vectors[3]) != 0 {
+		t.Error("an empty text has a non zero vector")
+	}
+}
+
+func TestNewEmbedder(t *testing.T) {
+	t.Setenv("LLM_EMBEDDING_PROVIDER", "")
+	t.Setenv("LLM_EMBEDDING_MODEL", "")
+
+	tests := []struct {
+		config Config
+		name   string
+		model  string
+	}{
+		{Config{Provider: ProviderOpenAI, APIKey: "key"}, ProviderOpenAI, defaultOpenAIEmbeddingModel},
+		// Anthropic has no embeddings
+		{Config{Provider: ProviderAnthropic, APIKey: "key"}, ProviderOpenAI, defaultOpenAIEmbeddingModel},
+		{Config{Provider: ProviderLocal}, ProviderLocal, defaultLocalEmbeddingModel},
+		{Config{Provider: ProviderFake}, ProviderFake, ProviderFake},
+	}
+
+	for _, test := range tests {
+		e, err := NewEmbedder(test.config)
+
+		if err != nil {
+			t.Fatalf("NewEmbedder(%v) failed: %v", test.config.Provider, err)
+		}
+
+		if e.Name() != test.name || e.Model() != test.model {
+			t.Errorf("embedder of %v = %v with %v, want %v with %v", test.config.Provider, e.Name(), e.Model(), test.name, test.model)
+		}
+	}
+
+	t.Setenv("LLM_EMBEDDING_PROVIDER", ProviderLocal)
+	t.Setenv("LLM_EMBEDDING_MODEL", "mxbai-embed-large")
+
+	e, err := NewEmbedder(Config{Provider: ProviderFake})
+
+	if err != nil {
+		t.Fatalf("NewEmbedder failed: %v", err)
+	}
+
+	if e.Name() != ProviderLocal || e.Model() != "mxbai-embed-large" {
+		t.Errorf("embedder = %v with %v, want the local one with the configured model", e.Name(), e.Model())
+	}
+
+	t.Setenv("LLM_EMBEDDING_PROVIDER", "word2vec")
+
+	if _, err := NewEmbedder(Config{Provider: ProviderFake}); err == nil {
+		t.Error("NewEmbedder accepted an unknown provider")
+	}
+}
+
+func TestEmbed(t *testing.T) {
+	usage := &fakeTracker{budget: 1}
+
+	SetEmbedder(FakeEmbedder{})
+	SetUsageTracker(usage)
+	t.Cleanup(func() {
+		SetEmbedder(nil)
+		SetUsageTracker(nil)
+	})
+
+	if model, err := EmbeddingModel(); err != nil || model != ProviderFake {
+		t.Errorf("EmbeddingModel = %v, %v, want the fake model", model, err)
+	}
+
+	embeddings, err := Embed([]string{"one", "two"})
+
+	if err != nil {
+		t.Fatalf("Embed failed: %v", err)
+	}
+
+	if len(embeddings.Vectors) != 2 {
+		t.Errorf("embedded %v vectors, want 2", len(embeddings.Vectors))
+	}
+
+	if len(usage.calls) != 1 || usage.calls[0].Name != "embed" || usage.calls[0].Provider != ProviderFake {
+		t.Errorf("recorded calls = %+v, want the embedding call", usage.calls)
+	}
+
+	if _, err := Embed([]string{"three"}); err == nil {
+		t.Error("Embed succeeded over the budget")
+	}
+}
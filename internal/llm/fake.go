@@ -0,0 +1,119 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// FakeProvider answers without any network access. Responses set for a
+// request name are returned as is, otherwise a response is derived from the
+// schema and the user prompt, so the same request always gets the same
+// response.
+type FakeProvider struct {
+	mux       sync.Mutex
+	responses map[string]string
+	calls     []Request
+}
+
+func NewFakeProvider() *FakeProvider {
+	return &FakeProvider{
+		responses: map[string]string{},
+	}
+}
+
+// SetResponse makes requests named name return response
+func (p *FakeProvider) SetResponse(name string, response string) {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+
+	p.responses[name] = response
+}
+
+// Calls returns the requests received so far
+func (p *FakeProvider) Calls() []Request {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+
+	return append([]Request{}, p.calls...)
+}
+
+func (p *FakeProvider) Name() string {
+	return ProviderFake
+}
+
+func (p *FakeProvider) Generate(ctx context.Context, request Request) (Response, error) {
+	p.mux.Lock()
+	p.calls = append(p.calls, request)
+	response, ok := p.responses[request.Name]
+	p.mux.Unlock()
+
+	if ok {
+		return Response{Content: response, Model: ProviderFake}, nil
+	}
+
+	encoded, err := json.Marshal(request.Schema)
+
+	if err != nil {
+		return Response{}, fmt.Errorf("encoding schema: %w", err)
+	}
+
+	var schema fakeSchema
+	if err := json.Unmarshal(encoded, &schema); err != nil {
+		return Response{}, fmt.Errorf("decoding schema: %w", err)
+	}
+
+	value := schema.value("", request.UserPrompt)
+
+	result, err := json.Marshal(value)
+
+	if err != nil {
+		return Response{}, err
+	}
+
+	return Response{Content: string(result), Model: ProviderFake}, nil
+}
+
+// fakeSchema is the part of a JSON schema the fake provider understands
+type fakeSchema struct {
+	Type       string                `json:"type"`
+	Properties map[string]fakeSchema `json:"properties"`
+	Items      *fakeSchema           `json:"items"`
+}
+
+func (s fakeSchema) value(name string, prompt string) interface{} {
+	switch s.Type {
+	case "object":
+		object := map[string]interface{}{}
+		for property, schema := range s.Properties {
+			object[property] = schema.value(property, prompt)
+		}
+		return object
+	case "array":
+		items := []interface{}{}
+		if s.Items != nil {
+			for i := 1; i <= 3; i++ {
+				items = append(items, s.Items.value(fmt.Sprintf("%v %v", name, i), prompt))
+			}
+		}
+		return items
+	case "boolean":
+		return true
+	case "integer", "number":
+		return 0
+	default:
+		return fmt.Sprintf("%v: %v", name, firstWords(prompt, 8))
+	}
+}
+
+func firstWords(text string, count int) string {
+	words := strings.Fields(text)
+
+	if len(words) > count {
+		words = words[:count]
+	}
+
+	return strings.Join(words, " ")
+}
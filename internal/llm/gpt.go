@@ -1,12 +1,10 @@
 package llm
 
 import (
-	"context"
-	"encoding/json"
+	"fmt"
 	"log"
 
 	"github.com/invopop/jsonschema"
-	"github.com/openai/openai-go"
 )
 
 type ClazeQuestion struct {
@@ -29,45 +27,108 @@ func GenerateSchema[T any]() interface{} {
 // Generate the JSON schema at initialization time
 var ClazeQuestionResponseSchema = GenerateSchema[ClazeQuestion]()
 
-func GenerateClaseQuestionAnswer(question string) (*ClazeQuestion, error) {
-	log.Println("Generating claze question using gpt")
-	client := openai.NewClient()
-	ctx := context.Background()
+func GenerateClaseQuestionAnswer(highlight Highlight) (*ClazeQuestion, error) {
+	log.Println("Generating claze question")
 
-	schemaParam := openai.ResponseFormatJSONSchemaJSONSchemaParam{
-		Name:        openai.F("create_question"),
-		Description: openai.F("Generate claze type question and answer from a piece of information"),
-		Schema:      openai.F(ClazeQuestionResponseSchema),
-		Strict:      openai.Bool(true),
-	}
+	return generateFromHighlight[ClazeQuestion](
+		"create_question",
+		"Generate claze type question and answer from a piece of information",
+		ClazeQuestionResponseSchema,
+		TemplateCloze,
+		highlight,
+	)
+}
 
-	// Query the Chat Completions API
-	chat, err := client.Chat.Completions.New(ctx, openai.ChatCompletionNewParams{
-		Messages: openai.F([]openai.ChatCompletionMessageParamUnion{
-			openai.SystemMessage("You are a specialized educational assistant designed to create fill-in-the-blank questions from provided text content."),
-			openai.UserMessage(question),
-		}),
-		ResponseFormat: openai.F[openai.ChatCompletionNewParamsResponseFormatUnion](
-			openai.ResponseFormatJSONSchemaParam{
-				Type:       openai.F(openai.ResponseFormatJSONSchemaTypeJSONSchema),
-				JSONSchema: openai.F(schemaParam),
-			},
-		),
-		// Only certain models can perform structured outputs
-		Model: openai.F(openai.ChatModelGPT4oMini2024_07_18),
-	})
+// GenerateClozeQuestionWithFeedback asks for a new cloze question, avoiding
+// the ones the learner rejected
+func GenerateClozeQuestionWithFeedback(highlight Highlight, rejected []string) (*ClazeQuestion, error) {
+	log.Println("Regenerating claze question with feedback")
+
+	systemPrompt, userPrompt, err := prompts(TemplateCloze, highlight)
 
 	if err != nil {
-		log.Printf("failed to generate claze question: %v", err)
 		return nil, err
 	}
 
-	clazeQuestionAnswer := ClazeQuestion{}
-	err = json.Unmarshal([]byte(chat.Choices[0].Message.Content), &clazeQuestionAnswer)
+	userPrompt = userPrompt + "\n\nThe learner rejected these questions as unclear, trivial or wrong. Write a different and better one:"
+	for _, question := range rejected {
+		userPrompt = userPrompt + "\n- " + question
+	}
+
+	return generateStructured[ClazeQuestion](
+		"create_question",
+		"Generate claze type question and answer from a piece of information",
+		ClazeQuestionResponseSchema,
+		systemPrompt,
+		userPrompt,
+	)
+}
+
+type RecallPrompt struct {
+	Prompt string `json:"prompt" jsonschema_description:"Short cue that helps recall the highlight without giving it away"`
+}
+
+var RecallPromptResponseSchema = GenerateSchema[RecallPrompt]()
+
+func GenerateRecallPrompt(highlight Highlight) (*RecallPrompt, error) {
+	log.Println("Generating recall prompt")
+
+	return generateFromHighlight[RecallPrompt](
+		"create_recall_prompt",
+		"Generate a short cue to recall a highlight before it is shown",
+		RecallPromptResponseSchema,
+		TemplateRecall,
+		highlight,
+	)
+}
+
+type AnswerJudgement struct {
+	Correct     bool   `json:"correct" jsonschema_description:"Whether the given answer means the same as the expected answer"`
+	Explanation string `json:"explanation" jsonschema_description:"One sentence explaining the judgement"`
+}
+
+var AnswerJudgementResponseSchema = GenerateSchema[AnswerJudgement]()
+
+func JudgeAnswer(question string, expected string, answer string) (*AnswerJudgement, error) {
+	log.Println("Judging answer")
+
+	return generateStructured[AnswerJudgement](
+		"judge_answer",
+		"Judge whether an answer to a fill in the blank question is semantically equivalent to the expected one",
+		AnswerJudgementResponseSchema,
+		"You are a specialized educational assistant grading answers to fill-in-the-blank questions. Accept synonyms, paraphrases and minor spelling mistakes, reject answers with a different meaning.",
+		fmt.Sprintf("Question: %s\nExpected answer: %s\nGiven answer: %s", question, expected, answer),
+	)
+}
+
+type QuizQuestion struct {
+	Question    string   `json:"question" jsonschema_description:"Multiple choice question about the notes"`
+	Answer      string   `json:"answer" jsonschema_description:"Correct answer of the question, at most 100 characters"`
+	Distractors []string `json:"distractors" jsonschema_description:"Exactly three plausible but wrong answers, at most 100 characters each"`
+}
+
+var QuizQuestionResponseSchema = GenerateSchema[QuizQuestion]()
+
+func GenerateQuizQuestion(highlight Highlight) (*QuizQuestion, error) {
+	log.Println("Generating quiz question")
+
+	quizQuestion, err := generateFromHighlight[QuizQuestion](
+		"create_quiz",
+		"Generate a multiple choice question with one correct answer and three distractors from a piece of information",
+		QuizQuestionResponseSchema,
+		TemplateQuiz,
+		highlight,
+	)
+
 	if err != nil {
-		log.Printf("failed to parse llm response %v", err)
 		return nil, err
 	}
 
-	return &clazeQuestionAnswer, nil
+	if len(quizQuestion.Distractors) < 3 {
+		return nil, fmt.Errorf("expected 3 distractors, got %d", len(quizQuestion.Distractors))
+	}
+
+	quizQuestion.Distractors = quizQuestion.Distractors[:3]
+
+	return quizQuestion, nil
 }
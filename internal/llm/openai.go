@@ -0,0 +1,125 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/openai/openai-go"
+	"github.com/openai/openai-go/option"
+)
+
+const (
+	defaultOpenAIModel = openai.ChatModelGPT4oMini2024_07_18
+	defaultLocalModel  = "llama3.1"
+	defaultLocalURL    = "http://localhost:11434/v1/"
+)
+
+// openAIProvider uses the chat completions API with structured outputs. It
+// also serves OpenAI compatible endpoints such as Ollama or llama.cpp.
+type openAIProvider struct {
+	name        string
+	client      *openai.Client
+	model       string
+	temperature *float64
+}
+
+func newOpenAIProvider(config Config) *openAIProvider {
+	opts := []option.RequestOption{}
+
+	if config.APIKey != "" {
+		opts = append(opts, option.WithAPIKey(config.APIKey))
+	}
+
+	if config.BaseURL != "" {
+		opts = append(opts, option.WithBaseURL(config.BaseURL))
+	}
+
+	model := config.Model
+	if model == "" {
+		model = defaultOpenAIModel
+	}
+
+	return &openAIProvider{
+		name:        ProviderOpenAI,
+		client:      openai.NewClient(opts...),
+		model:       model,
+		temperature: config.Temperature,
+	}
+}
+
+func newLocalProvider(config Config) *openAIProvider {
+	baseURL := config.BaseURL
+	if baseURL == "" {
+		baseURL = defaultLocalURL
+	}
+
+	// Local servers ignore the key, but the client requires one
+	apiKey := config.APIKey
+	if apiKey == "" {
+		apiKey = "local"
+	}
+
+	model := config.Model
+	if model == "" {
+		model = defaultLocalModel
+	}
+
+	return &openAIProvider{
+		name:        ProviderLocal,
+		client:      openai.NewClient(option.WithBaseURL(baseURL), option.WithAPIKey(apiKey)),
+		model:       model,
+		temperature: config.Temperature,
+	}
+}
+
+func (p *openAIProvider) Name() string {
+	return p.name
+}
+
+func (p *openAIProvider) Generate(ctx context.Context, request Request) (Response, error) {
+	schemaParam := openai.ResponseFormatJSONSchemaJSONSchemaParam{
+		Name:        openai.F(request.Name),
+		Description: openai.F(request.Description),
+		Schema:      openai.F(request.Schema),
+		Strict:      openai.Bool(true),
+	}
+
+	params := openai.ChatCompletionNewParams{
+		Messages: openai.F([]openai.ChatCompletionMessageParamUnion{
+			openai.SystemMessage(request.SystemPrompt),
+			openai.UserMessage(request.UserPrompt),
+		}),
+		ResponseFormat: openai.F[openai.ChatCompletionNewParamsResponseFormatUnion](
+			openai.ResponseFormatJSONSchemaParam{
+				Type:       openai.F(openai.ResponseFormatJSONSchemaTypeJSONSchema),
+				JSONSchema: openai.F(schemaParam),
+			},
+		),
+		// Only certain models can perform structured outputs
+		Model: openai.F(p.model),
+	}
+
+	if p.temperature != nil {
+		params.Temperature = openai.F(*p.temperature)
+	}
+
+	chat, err := p.client.Chat.Completions.New(ctx, params)
+
+	if err != nil {
+		return Response{Model: p.model}, err
+	}
+
+	response := Response{
+		Model:        chat.Model,
+		InputTokens:  int(chat.Usage.PromptTokens),
+		OutputTokens: int(chat.Usage.CompletionTokens),
+	}
+
+	if len(chat.Choices) == 0 {
+		return response, fmt.Errorf("empty response from %v", p.name)
+	}
+
+	response.Content = chat.Choices[0].Message.Content
+
+	return response, nil
+}
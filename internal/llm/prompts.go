@@ -0,0 +1,185 @@
+package llm
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+// Highlight is the piece of information a question is generated from, along
+// with what is known about where it comes from
+type Highlight struct {
+	Content  string
+	Title    string
+	Author   string
+	Location string
+	// Neighbouring highlights of the same source, in reading order
+	Before []string
+	After  []string
+	// Extra instructions of the source, added to the system prompt
+	SystemPrompt string
+	// Tags already in use, offered when suggesting tags
+	Tags []string
+}
+
+// Names of the prompt templates. The highlight template renders the user
+// message, the other ones the system prompt of each kind of question.
+const (
+	TemplateHighlight = "highlight"
+	TemplateCloze     = "cloze"
+	TemplateRecall    = "recall"
+	TemplateQuiz      = "quiz"
+	TemplateOpen      = "open"
+	TemplateTrueFalse = "truefalse"
+	TemplateExplain   = "explain"
+	TemplateReverse   = "reverse"
+	TemplateTags      = "tags"
+)
+
+var defaultTemplates = map[string]string{
+	TemplateHighlight: `{{if .Title}}Book: {{.Title}}{{if .Author}} by {{.Author}}{{end}}
+{{end}}{{if .Location}}Location: {{.Location}}
+{{end}}{{if .Before}}
+Preceding highlights, for context only:
+{{range .Before}}- {{.}}
+{{end}}{{end}}
+Highlight:
+{{.Content}}
+{{if .After}}
+Following highlights, for context only:
+{{range .After}}- {{.}}
+{{end}}{{end}}`,
+	TemplateCloze:     "You are a specialized educational assistant designed to create fill-in-the-blank questions from provided text content. Blank out a meaningful term that tests understanding, and make sure the answer fills the blank exactly. Only ask about the highlight, the book and the surrounding highlights are context.",
+	TemplateRecall:    "You are a specialized educational assistant. Given a highlight from a book, write a one sentence cue or question that prompts the reader to recall the highlight, without quoting it.",
+	TemplateQuiz:      "You are a specialized educational assistant designed to create multiple choice questions from provided text content. Distractors must be plausible, of similar length to the answer and clearly wrong to someone who remembers the text.",
+	TemplateOpen:      "You are a specialized educational assistant designed to create open ended questions that test understanding of provided text content.",
+	TemplateTrueFalse: "You are a specialized educational assistant designed to create true or false statements from provided text content. False statements must change a single meaningful detail.",
+	TemplateExplain:   "You are a specialized educational assistant designed to ask learners to explain ideas from provided text content in their own words.",
+	TemplateReverse:   "You are a specialized educational assistant. Name the concept of the provided text content so a learner can recall the text from it.",
+	TemplateTags:      "You are a specialized assistant organizing highlights from many books by topic. Suggest one to three short, lowercase topic tags that would group the highlight with related highlights from other books. Don't name the book or its author.{{if .Tags}} Reuse these existing tags when they fit: {{range $i, $tag := .Tags}}{{if $i}}, {{end}}{{$tag}}{{end}}.{{end}}",
+}
+
+var templates = mustParseTemplates(defaultTemplates)
+
+func mustParseTemplates(sources map[string]string) map[string]*template.Template {
+	parsed, err := parseTemplates(sources)
+
+	if err != nil {
+		panic(err)
+	}
+
+	return parsed
+}
+
+func parseTemplates(sources map[string]string) (map[string]*template.Template, error) {
+	parsed := map[string]*template.Template{}
+
+	for name, source := range sources {
+		tmpl, err := template.New(name).Parse(source)
+
+		if err != nil {
+			return nil, fmt.Errorf("parsing %v prompt template: %w", name, err)
+		}
+
+		parsed[name] = tmpl
+	}
+
+	return parsed, nil
+}
+
+// LoadTemplates replaces the default prompt templates with the ones found in
+// dir, named after the template with a .tmpl extension, e.g. cloze.tmpl
+func LoadTemplates(dir string) error {
+	sources := map[string]string{}
+
+	for name, source := range defaultTemplates {
+		sources[name] = source
+	}
+
+	for name := range defaultTemplates {
+		content, err := os.ReadFile(filepath.Join(dir, name+".tmpl"))
+
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+
+		if err != nil {
+			return fmt.Errorf("reading %v prompt template: %w", name, err)
+		}
+
+		log.Printf("Using %v prompt template from %v", name, dir)
+
+		sources[name] = string(content)
+	}
+
+	parsed, err := parseTemplates(sources)
+
+	if err != nil {
+		return err
+	}
+
+	mux.Lock()
+	defer mux.Unlock()
+
+	templates = parsed
+
+	return nil
+}
+
+func render(name string, data interface{}) (string, error) {
+	mux.RLock()
+	tmpl, ok := templates[name]
+	mux.RUnlock()
+
+	if !ok {
+		return "", fmt.Errorf("unknown prompt template %q", name)
+	}
+
+	var out bytes.Buffer
+
+	if err := tmpl.Execute(&out, data); err != nil {
+		return "", fmt.Errorf("rendering %v prompt template: %w", name, err)
+	}
+
+	return strings.TrimSpace(out.String()), nil
+}
+
+// prompts renders the system prompt of a kind of question, with the
+// source's instructions, and the user message of a highlight
+func prompts(kind string, highlight Highlight) (string, string, error) {
+	systemPrompt, err := render(kind, highlight)
+
+	if err != nil {
+		return "", "", err
+	}
+
+	if highlight.SystemPrompt != "" {
+		systemPrompt = systemPrompt + "\n\n" + highlight.SystemPrompt
+	}
+
+	userPrompt, err := render(TemplateHighlight, highlight)
+
+	if err != nil {
+		return "", "", err
+	}
+
+	return systemPrompt, userPrompt, nil
+}
+
+// generateFromHighlight asks for a response following the schema of T to
+// the prompts of kind
+func generateFromHighlight[T any](name string, description string, schema interface{}, kind string, highlight Highlight) (*T, error) {
+	systemPrompt, userPrompt, err := prompts(kind, highlight)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return generateStructured[T](name, description, schema, systemPrompt, userPrompt)
+}
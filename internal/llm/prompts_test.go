@@ -0,0 +1,104 @@
+package llm
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPrompts(t *testing.T) {
+	highlight := Highlight{
+		Content:      "Habits are the compound interest of self-improvement",
+		Title:        "Atomic Habits",
+		Author:       "James Clear",
+		Location:     "Location 120",
+		Before:       []string{"Small changes add up"},
+		After:        []string{"Systems beat goals"},
+		SystemPrompt: "Ask about the author's examples",
+	}
+
+	systemPrompt, userPrompt, err := prompts(TemplateCloze, highlight)
+
+	if err != nil {
+		t.Fatalf("prompts failed: %v", err)
+	}
+
+	if !strings.HasPrefix(systemPrompt, defaultTemplates[TemplateCloze]) || !strings.HasSuffix(systemPrompt, "\n\nAsk about the author's examples") {
+		t.Errorf("system prompt = %q, want the cloze prompt followed by the source's", systemPrompt)
+	}
+
+	for _, want := range []string{
+		"Book: Atomic Habits by James Clear",
+		"Location: Location 120",
+		"Preceding highlights, for context only:\n- Small changes add up",
+		"Highlight:\nHabits are the compound interest of self-improvement",
+		"Following highlights, for context only:\n- Systems beat goals",
+	} {
+		if !strings.Contains(userPrompt, want) {
+			t.Errorf("user prompt = %q, want it to contain %q", userPrompt, want)
+		}
+	}
+
+	_, userPrompt, err = prompts(TemplateRecall, Highlight{Content: "Only the highlight"})
+
+	if err != nil {
+		t.Fatalf("prompts failed: %v", err)
+	}
+
+	if userPrompt != "Highlight:\nOnly the highlight" {
+		t.Errorf("user prompt without metadata = %q", userPrompt)
+	}
+
+	if _, _, err := prompts("unknown", highlight); err == nil {
+		t.Error("prompts of an unknown kind succeeded")
+	}
+}
+
+func TestLoadTemplates(t *testing.T) {
+	t.Cleanup(func() {
+		if err := LoadTemplates(t.TempDir()); err != nil {
+			t.Errorf("restoring the default templates failed: %v", err)
+		}
+	})
+
+	dir := t.TempDir()
+
+	if err := os.WriteFile(filepath.Join(dir, "cloze.tmpl"), []byte("Quiz me on {{.Title}}"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := LoadTemplates(dir); err != nil {
+		t.Fatalf("LoadTemplates failed: %v", err)
+	}
+
+	systemPrompt, _, err := prompts(TemplateCloze, Highlight{Content: "highlight", Title: "Dune"})
+
+	if err != nil {
+		t.Fatalf("prompts failed: %v", err)
+	}
+
+	if systemPrompt != "Quiz me on Dune" {
+		t.Errorf("system prompt = %q, want the loaded template", systemPrompt)
+	}
+
+	// Templates missing from the directory keep their default
+	systemPrompt, _, err = prompts(TemplateQuiz, Highlight{Content: "highlight"})
+
+	if err != nil || systemPrompt != defaultTemplates[TemplateQuiz] {
+		t.Errorf("quiz system prompt = %q, %v, want the default", systemPrompt, err)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "quiz.tmpl"), []byte("{{.Title"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := LoadTemplates(dir); err == nil {
+		t.Error("LoadTemplates of an invalid template succeeded")
+	}
+
+	// A failed load keeps the previous templates
+	if systemPrompt, _, _ := prompts(TemplateCloze, Highlight{Title: "Dune"}); systemPrompt != "Quiz me on Dune" {
+		t.Errorf("system prompt after a failed load = %q", systemPrompt)
+	}
+}
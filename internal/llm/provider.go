@@ -0,0 +1,256 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	ProviderOpenAI    = "openai"
+	ProviderAnthropic = "anthropic"
+	ProviderLocal     = "local"
+	ProviderFake      = "fake"
+)
+
+const defaultTimeout = 60 * time.Second
+
+// Request asks a provider for a JSON response following Schema
+type Request struct {
+	// Name and Description of the structured output, used by the providers
+	// as the name of the schema or tool
+	Name         string
+	Description  string
+	Schema       interface{}
+	SystemPrompt string
+	UserPrompt   string
+}
+
+// Response is the raw JSON content returned by a provider with its usage
+type Response struct {
+	Content      string
+	Model        string
+	InputTokens  int
+	OutputTokens int
+}
+
+// Provider generates structured responses from a language model
+type Provider interface {
+	Generate(ctx context.Context, request Request) (Response, error)
+	Name() string
+}
+
+// Config selects the provider and how it is called. A nil Temperature
+// keeps the provider's default.
+type Config struct {
+	Provider    string
+	Model       string
+	Temperature *float64
+	Timeout     time.Duration
+	// Endpoint of the local provider, e.g. http://localhost:11434/v1/
+	BaseURL string
+	APIKey  string
+	// Directory of prompt templates overriding the default ones
+	PromptDir string
+}
+
+// ConfigFromEnv reads the config from LLM_PROVIDER, LLM_MODEL,
+// LLM_TEMPERATURE, LLM_TIMEOUT, LLM_BASE_URL, LLM_API_KEY and
+// LLM_PROMPT_DIR
+func ConfigFromEnv() (Config, error) {
+	config := Config{
+		Provider: os.Getenv("LLM_PROVIDER"),
+		Model:    os.Getenv("LLM_MODEL"),
+		Timeout:  defaultTimeout,
+		BaseURL:  os.Getenv("LLM_BASE_URL"),
+		APIKey:   os.Getenv("LLM_API_KEY"),
+
+		PromptDir: os.Getenv("LLM_PROMPT_DIR"),
+	}
+
+	if config.Provider == "" {
+		config.Provider = ProviderOpenAI
+	}
+
+	if value := os.Getenv("LLM_TEMPERATURE"); value != "" {
+		temperature, err := strconv.ParseFloat(value, 64)
+
+		if err != nil {
+			return Config{}, fmt.Errorf("invalid LLM_TEMPERATURE: %w", err)
+		}
+
+		config.Temperature = &temperature
+	}
+
+	if value := os.Getenv("LLM_TIMEOUT"); value != "" {
+		timeout, err := time.ParseDuration(value)
+
+		if err != nil {
+			return Config{}, fmt.Errorf("invalid LLM_TIMEOUT: %w", err)
+		}
+
+		config.Timeout = timeout
+	}
+
+	return config, nil
+}
+
+// NewProvider creates the provider selected by the config
+func NewProvider(config Config) (Provider, error) {
+	switch config.Provider {
+	case ProviderOpenAI:
+		return newOpenAIProvider(config), nil
+	case ProviderAnthropic:
+		return newAnthropicProvider(config)
+	case ProviderLocal:
+		return newLocalProvider(config), nil
+	case ProviderFake:
+		return NewFakeProvider(), nil
+	default:
+		return nil, fmt.Errorf("unknown llm provider %q", config.Provider)
+	}
+}
+
+var (
+	mux      sync.RWMutex
+	provider Provider
+	timeout  = defaultTimeout
+)
+
+// Configure sets the provider used for every generation
+func Configure(config Config) error {
+	p, err := NewProvider(config)
+
+	if err != nil {
+		return err
+	}
+
+	if config.PromptDir != "" {
+		if err := LoadTemplates(config.PromptDir); err != nil {
+			return err
+		}
+	}
+
+	e, err := NewEmbedder(config)
+
+	if err != nil {
+		return err
+	}
+
+	mux.Lock()
+	defer mux.Unlock()
+
+	provider = p
+	embedder = e
+	if config.Timeout > 0 {
+		timeout = config.Timeout
+	}
+
+	log.Printf("Using %v llm provider", p.Name())
+
+	return nil
+}
+
+// SetProvider replaces the provider, e.g. with a fake one in tests
+func SetProvider(p Provider) {
+	mux.Lock()
+	defer mux.Unlock()
+
+	provider = p
+}
+
+// currentProvider returns the configured provider, configuring it from the
+// environment on first use
+func currentProvider() (Provider, time.Duration, error) {
+	mux.RLock()
+	p, t := provider, timeout
+	mux.RUnlock()
+
+	if p != nil {
+		return p, t, nil
+	}
+
+	config, err := ConfigFromEnv()
+
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if err := Configure(config); err != nil {
+		return nil, 0, err
+	}
+
+	mux.RLock()
+	defer mux.RUnlock()
+
+	return provider, timeout, nil
+}
+
+// generateStructured asks the provider for a response following the schema
+// of T
+func generateStructured[T any](name string, description string, schema interface{}, systemPrompt string, userPrompt string) (*T, error) {
+	p, timeout, err := currentProvider()
+
+	if err != nil {
+		return nil, err
+	}
+
+	usage := currentTracker()
+
+	if usage != nil {
+		if err := usage.Allow(); err != nil {
+			log.Printf("Skipping %v: %v", name, err)
+			return nil, err
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	start := time.Now()
+
+	result, err := p.Generate(ctx, Request{
+		Name:         name,
+		Description:  description,
+		Schema:       schema,
+		SystemPrompt: systemPrompt,
+		UserPrompt:   userPrompt,
+	})
+
+	if usage != nil {
+		call := Call{
+			Provider:     p.Name(),
+			Model:        result.Model,
+			Name:         name,
+			InputTokens:  result.InputTokens,
+			OutputTokens: result.OutputTokens,
+			Latency:      time.Since(start),
+			CostUSD:      Cost(result.Model, result.InputTokens, result.OutputTokens),
+		}
+
+		if err != nil {
+			call.Error = err.Error()
+		}
+
+		usage.Record(call)
+	}
+
+	if err != nil {
+		log.Printf("failed to generate %v: %v", name, err)
+		return nil, err
+	}
+
+	var response T
+	err = json.Unmarshal([]byte(result.Content), &response)
+	if err != nil {
+		log.Printf("failed to parse llm response %v", err)
+		return nil, err
+	}
+
+	return &response, nil
+}
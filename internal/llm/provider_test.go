@@ -0,0 +1,267 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// useFakeProvider makes the generations of the test go to a fake provider
+func useFakeProvider(t *testing.T) *FakeProvider {
+	t.Helper()
+
+	fake := NewFakeProvider()
+	SetProvider(fake)
+	t.Cleanup(func() { SetProvider(nil) })
+
+	return fake
+}
+
+func TestConfigFromEnv(t *testing.T) {
+	t.Setenv("LLM_PROVIDER", "")
+	t.Setenv("LLM_MODEL", "")
+	t.Setenv("LLM_TEMPERATURE", "")
+	t.Setenv("LLM_TIMEOUT", "")
+
+	config, err := ConfigFromEnv()
+
+	if err != nil {
+		t.Fatalf("ConfigFromEnv failed: %v", err)
+	}
+
+	if config.Provider != ProviderOpenAI || config.Temperature != nil || config.Timeout != defaultTimeout {
+		t.Errorf("default config = %+v, want openai with the default timeout and temperature", config)
+	}
+
+	t.Setenv("LLM_PROVIDER", ProviderLocal)
+	t.Setenv("LLM_MODEL", "mistral")
+	t.Setenv("LLM_TEMPERATURE", "0.2")
+	t.Setenv("LLM_TIMEOUT", "90s")
+	t.Setenv("LLM_PROMPT_DIR", "/etc/prompts")
+
+	config, err = ConfigFromEnv()
+
+	if err != nil {
+		t.Fatalf("ConfigFromEnv failed: %v", err)
+	}
+
+	if config.Provider != ProviderLocal || config.Model != "mistral" || config.Timeout != 90*time.Second || config.PromptDir != "/etc/prompts" {
+		t.Errorf("config = %+v, want the local provider with mistral, a 90s timeout and the prompt dir", config)
+	}
+
+	if config.Temperature == nil || *config.Temperature != 0.2 {
+		t.Errorf("temperature = %v, want 0.2", config.Temperature)
+	}
+
+	for name, value := range map[string]string{"LLM_TEMPERATURE": "warm", "LLM_TIMEOUT": "soon"} {
+		t.Run(name, func(t *testing.T) {
+			t.Setenv(name, value)
+
+			if _, err := ConfigFromEnv(); err == nil {
+				t.Errorf("ConfigFromEnv accepted %v=%v", name, value)
+			}
+		})
+	}
+}
+
+func TestNewProvider(t *testing.T) {
+	t.Setenv("ANTHROPIC_API_KEY", "")
+
+	if _, err := NewProvider(Config{Provider: "parrot"}); err == nil {
+		t.Error("NewProvider accepted an unknown provider")
+	}
+
+	if _, err := NewProvider(Config{Provider: ProviderAnthropic}); err == nil {
+		t.Error("NewProvider created an anthropic provider without a key")
+	}
+
+	p, err := NewProvider(Config{Provider: ProviderLocal})
+
+	if err != nil {
+		t.Fatalf("NewProvider failed: %v", err)
+	}
+
+	if got, want := p.Name(), ProviderLocal; got != want {
+		t.Errorf("local provider name = %q, want %q", got, want)
+	}
+}
+
+func TestFakeProvider(t *testing.T) {
+	fake := useFakeProvider(t)
+
+	question, err := GenerateClaseQuestionAnswer(Highlight{Content: "The Roman Empire was founded in 27 BC by Augustus"})
+
+	if err != nil {
+		t.Fatalf("GenerateClaseQuestionAnswer failed: %v", err)
+	}
+
+	// Derived responses fill every field of the schema from the prompt
+	if !strings.HasPrefix(question.Question, "question: ") || !strings.HasPrefix(question.Answer, "answer: ") {
+		t.Errorf("derived question = %+v, want the fields named after the schema", question)
+	}
+
+	fake.SetResponse("create_question", `{"question": "The Roman Empire was founded by ____.", "answer": "Augustus"}`)
+
+	question, err = GenerateClaseQuestionAnswer(Highlight{Content: "The Roman Empire was founded in 27 BC by Augustus"})
+
+	if err != nil {
+		t.Fatalf("GenerateClaseQuestionAnswer failed: %v", err)
+	}
+
+	if question.Answer != "Augustus" {
+		t.Errorf("answer = %q, want the set response", question.Answer)
+	}
+
+	calls := fake.Calls()
+
+	if len(calls) != 2 || calls[1].Name != "create_question" || !strings.Contains(calls[1].UserPrompt, "Augustus") {
+		t.Errorf("calls = %+v, want two create_question requests with the highlight", calls)
+	}
+}
+
+func TestFakeProviderInvalidResponse(t *testing.T) {
+	fake := useFakeProvider(t)
+	fake.SetResponse("create_question", "not json")
+
+	if _, err := GenerateClaseQuestionAnswer(Highlight{Content: "highlight"}); err == nil {
+		t.Error("GenerateClaseQuestionAnswer accepted an invalid response")
+	}
+}
+
+func TestAnthropicProvider(t *testing.T) {
+	var request anthropicRequest
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("x-api-key") != "key" || r.Header.Get("anthropic-version") != anthropicVersion {
+			t.Errorf("headers = %v, want the api key and version", r.Header)
+		}
+
+		body, _ := io.ReadAll(r.Body)
+		if err := json.Unmarshal(body, &request); err != nil {
+			t.Errorf("invalid request body: %v", err)
+		}
+
+		io.WriteString(w, `{"model": "claude-3-5-haiku-20241022", "usage": {"input_tokens": 120, "output_tokens": 30}, "content": [
+			{"type": "text", "text": "Sure"},
+			{"type": "tool_use", "name": "create_question", "input": {"question": "q", "answer": "a"}}
+		]}`)
+	}))
+	defer server.Close()
+
+	p, err := NewProvider(Config{Provider: ProviderAnthropic, APIKey: "key", BaseURL: server.URL})
+
+	if err != nil {
+		t.Fatalf("NewProvider failed: %v", err)
+	}
+
+	response, err := p.Generate(context.Background(), Request{
+		Name:         "create_question",
+		Schema:       ClazeQuestionResponseSchema,
+		SystemPrompt: "system",
+		UserPrompt:   "user",
+	})
+
+	if err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+
+	if response.Content != `{"question": "q", "answer": "a"}` {
+		t.Errorf("content = %s, want the input of the tool call", response.Content)
+	}
+
+	if response.Model != "claude-3-5-haiku-20241022" || response.InputTokens != 120 || response.OutputTokens != 30 {
+		t.Errorf("response = %+v, want the model and usage of the response", response)
+	}
+
+	if request.Model != defaultAnthropicModel || request.System != "system" || request.ToolChoice["name"] != "create_question" {
+		t.Errorf("request = %+v, want the default model forced to call create_question", request)
+	}
+}
+
+func TestAnthropicProviderError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTooManyRequests)
+		io.WriteString(w, `{"error": {"type": "rate_limit_error", "message": "slow down"}}`)
+	}))
+	defer server.Close()
+
+	p, err := NewProvider(Config{Provider: ProviderAnthropic, APIKey: "key", BaseURL: server.URL})
+
+	if err != nil {
+		t.Fatalf("NewProvider failed: %v", err)
+	}
+
+	_, err = p.Generate(context.Background(), Request{Name: "create_question"})
+
+	if err == nil || !strings.Contains(err.Error(), "slow down") {
+		t.Errorf("Generate error = %v, want the error of the response", err)
+	}
+}
+
+func TestLocalProvider(t *testing.T) {
+	var request map[string]interface{}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasSuffix(r.URL.Path, "/chat/completions") {
+			t.Errorf("request to %v, want the chat completions endpoint", r.URL.Path)
+		}
+
+		body, _ := io.ReadAll(r.Body)
+		if err := json.Unmarshal(body, &request); err != nil {
+			t.Errorf("invalid request body: %v", err)
+		}
+
+		w.Header().Set("content-type", "application/json")
+		io.WriteString(w, `{"id": "1", "object": "chat.completion", "created": 0, "model": "mistral", "choices": [
+			{"index": 0, "finish_reason": "stop", "message": {"role": "assistant", "content": "{\"answer\": \"a\"}"}}
+		], "usage": {"prompt_tokens": 80, "completion_tokens": 12, "total_tokens": 92}}`)
+	}))
+	defer server.Close()
+
+	temperature := 0.2
+	p, err := NewProvider(Config{Provider: ProviderLocal, Model: "mistral", BaseURL: server.URL + "/v1/", Temperature: &temperature})
+
+	if err != nil {
+		t.Fatalf("NewProvider failed: %v", err)
+	}
+
+	response, err := p.Generate(context.Background(), Request{Name: "create_question", Schema: ClazeQuestionResponseSchema})
+
+	if err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+
+	if response.Content != `{"answer": "a"}` {
+		t.Errorf("content = %s, want the message of the first choice", response.Content)
+	}
+
+	if response.Model != "mistral" || response.InputTokens != 80 || response.OutputTokens != 12 {
+		t.Errorf("response = %+v, want the model and usage of the response", response)
+	}
+
+	if request["model"] != "mistral" || request["temperature"] != 0.2 {
+		t.Errorf("request = %v, want the configured model and temperature", request)
+	}
+}
+
+func TestGenerateClozeQuestionWithFeedback(t *testing.T) {
+	fake := useFakeProvider(t)
+
+	_, err := GenerateClozeQuestionWithFeedback(Highlight{Content: "Rome is the capital of Italy"}, []string{"____ is a city. (answer: Rome)"})
+
+	if err != nil {
+		t.Fatalf("GenerateClozeQuestionWithFeedback failed: %v", err)
+	}
+
+	calls := fake.Calls()
+
+	if len(calls) != 1 || !strings.Contains(calls[0].UserPrompt, "Rome is the capital of Italy") ||
+		!strings.Contains(calls[0].UserPrompt, "- ____ is a city. (answer: Rome)") {
+		t.Errorf("calls = %+v, want the highlight and the rejected question in the prompt", calls)
+	}
+}
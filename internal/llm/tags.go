@@ -0,0 +1,25 @@
+package llm
+
+import (
+	"log"
+)
+
+type TagSuggestions struct {
+	Tags []string `json:"tags" jsonschema_description:"One to three short lowercase topic tags of the highlight"`
+}
+
+var TagSuggestionsResponseSchema = GenerateSchema[TagSuggestions]()
+
+// SuggestTags returns topic tags for a highlight, preferring the tags in
+// highlight.Tags
+func SuggestTags(highlight Highlight) (*TagSuggestions, error) {
+	log.Println("Suggesting tags")
+
+	return generateFromHighlight[TagSuggestions](
+		"suggest_tags",
+		"Suggest topic tags grouping a piece of information with related ones",
+		TagSuggestionsResponseSchema,
+		TemplateTags,
+		highlight,
+	)
+}
@@ -0,0 +1,84 @@
+package llm
+
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+var ErrBudgetExceeded = errors.New("llm budget exceeded")
+
+// Call is a finished LLM call, as recorded for usage accounting
+type Call struct {
+	Provider     string
+	Model        string
+	Name         string
+	InputTokens  int
+	OutputTokens int
+	Latency      time.Duration
+	CostUSD      float64
+	// Set when the call failed
+	Error string
+}
+
+// UsageTracker records LLM calls and enforces budgets. Allow is checked
+// before every call, and should wrap ErrBudgetExceeded when the budget is
+// spent.
+type UsageTracker interface {
+	Allow() error
+	Record(call Call)
+}
+
+var tracker UsageTracker
+
+func SetUsageTracker(t UsageTracker) {
+	mux.Lock()
+	defer mux.Unlock()
+
+	tracker = t
+}
+
+func currentTracker() UsageTracker {
+	mux.RLock()
+	defer mux.RUnlock()
+
+	return tracker
+}
+
+// Price of a model in USD per million tokens
+type price struct {
+	input  float64
+	output float64
+}
+
+// Prices of known models, matched by prefix so dated versions share the
+// price of their family. Longer prefixes come first.
+var prices = []struct {
+	prefix string
+	price  price
+}{
+	{"gpt-4o-mini", price{0.15, 0.60}},
+	{"gpt-4o", price{2.50, 10.00}},
+	{"gpt-4.1-nano", price{0.10, 0.40}},
+	{"gpt-4.1-mini", price{0.40, 1.60}},
+	{"gpt-4.1", price{2.00, 8.00}},
+	{"claude-3-5-haiku", price{0.80, 4.00}},
+	{"claude-3-haiku", price{0.25, 1.25}},
+	{"claude-3-5-sonnet", price{3.00, 15.00}},
+	{"claude-3-7-sonnet", price{3.00, 15.00}},
+	{"claude-sonnet-4", price{3.00, 15.00}},
+	{"text-embedding-3-small", price{0.02, 0}},
+	{"text-embedding-3-large", price{0.13, 0}},
+}
+
+// Cost returns the cost in USD of a call to model. Unknown models, such as
+// local ones, are free.
+func Cost(model string, inputTokens int, outputTokens int) float64 {
+	for _, known := range prices {
+		if strings.HasPrefix(model, known.prefix) {
+			return (float64(inputTokens)*known.price.input + float64(outputTokens)*known.price.output) / 1_000_000
+		}
+	}
+
+	return 0
+}
@@ -0,0 +1,78 @@
+package llm
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"testing"
+)
+
+// fakeTracker records calls and allows them until budget calls were made
+type fakeTracker struct {
+	budget int
+	calls  []Call
+}
+
+func (t *fakeTracker) Allow() error {
+	if len(t.calls) >= t.budget {
+		return fmt.Errorf("%w: %v calls made", ErrBudgetExceeded, len(t.calls))
+	}
+
+	return nil
+}
+
+func (t *fakeTracker) Record(call Call) {
+	t.calls = append(t.calls, call)
+}
+
+func TestCost(t *testing.T) {
+	tests := []struct {
+		model  string
+		input  int
+		output int
+		want   float64
+	}{
+		{"gpt-4o-mini", 1_000_000, 1_000_000, 0.75},
+		{"gpt-4o-2024-08-06", 1_000_000, 0, 2.50},
+		{"gpt-4.1-mini-2025-04-14", 500_000, 250_000, 0.60},
+		{"claude-3-5-haiku-20241022", 1000, 500, 0.0028},
+		{"llama3.1", 1_000_000, 1_000_000, 0},
+		{ProviderFake, 10, 10, 0},
+	}
+
+	for _, test := range tests {
+		if got := Cost(test.model, test.input, test.output); math.Abs(got-test.want) > 1e-9 {
+			t.Errorf("Cost(%v, %v, %v) = %v, want %v", test.model, test.input, test.output, got, test.want)
+		}
+	}
+}
+
+func TestUsageTracker(t *testing.T) {
+	fake := useFakeProvider(t)
+	usage := &fakeTracker{budget: 1}
+
+	SetUsageTracker(usage)
+	t.Cleanup(func() { SetUsageTracker(nil) })
+
+	if _, err := GenerateClaseQuestionAnswer(Highlight{Content: "Rome is the capital of Italy"}); err != nil {
+		t.Fatalf("GenerateClaseQuestionAnswer failed: %v", err)
+	}
+
+	if len(usage.calls) != 1 {
+		t.Fatalf("recorded %v calls, want 1", len(usage.calls))
+	}
+
+	if call := usage.calls[0]; call.Provider != ProviderFake || call.Model != ProviderFake || call.Name != "create_question" || call.Error != "" {
+		t.Errorf("call = %+v, want a successful call to the fake provider", call)
+	}
+
+	_, err := GenerateClaseQuestionAnswer(Highlight{Content: "Rome is the capital of Italy"})
+
+	if !errors.Is(err, ErrBudgetExceeded) {
+		t.Errorf("generating over the budget = %v, want ErrBudgetExceeded", err)
+	}
+
+	if len(fake.Calls()) != 1 || len(usage.calls) != 1 {
+		t.Errorf("%v calls reached the provider and %v were recorded over the budget, want 1", len(fake.Calls()), len(usage.calls))
+	}
+}
@@ -0,0 +1,440 @@
+// Package query parses the filter expressions of saved decks, e.g.
+//
+//	source:"Sapiens" AND tag:history AND (ease<2.0 OR lapses>2)
+//
+// Terms are joined with AND, OR and NOT, grouped with parentheses. Terms
+// next to each other without an operator are joined with AND.
+package query
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Fields a term can filter on
+const (
+	FieldSource   = "source"
+	FieldTag      = "tag"
+	FieldIs       = "is"
+	FieldEase     = "ease"
+	FieldLapses   = "lapses"
+	FieldInterval = "interval"
+	FieldReviews  = "reviews"
+)
+
+// Comparison operators of a term. ":" is the same as "=".
+const (
+	OpEq    = "="
+	OpNotEq = "!="
+	OpLt    = "<"
+	OpLte   = "<="
+	OpGt    = ">"
+	OpGte   = ">="
+)
+
+// Values of the is field
+const (
+	IsDue       = "due"
+	IsNew       = "new"
+	IsScheduled = "scheduled"
+	IsLeech     = "leech"
+)
+
+var numericFields = map[string]bool{
+	FieldEase:     true,
+	FieldLapses:   true,
+	FieldInterval: true,
+	FieldReviews:  true,
+}
+
+var textFields = map[string]bool{
+	FieldSource: true,
+	FieldTag:    true,
+	FieldIs:     true,
+}
+
+// Node is a parsed expression: And, Or, Not or Term
+type Node interface {
+	String() string
+}
+
+type And struct {
+	Left  Node
+	Right Node
+}
+
+type Or struct {
+	Left  Node
+	Right Node
+}
+
+type Not struct {
+	Node Node
+}
+
+// Term compares a field to a value. Number is set for numeric fields.
+type Term struct {
+	Field  string
+	Op     string
+	Value  string
+	Number float64
+}
+
+func (n And) String() string {
+	return fmt.Sprintf("(%v AND %v)", n.Left, n.Right)
+}
+
+func (n Or) String() string {
+	return fmt.Sprintf("(%v OR %v)", n.Left, n.Right)
+}
+
+func (n Not) String() string {
+	return fmt.Sprintf("NOT %v", n.Node)
+}
+
+func (t Term) String() string {
+	return fmt.Sprintf("%v%v%q", t.Field, t.Op, t.Value)
+}
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenLParen
+	tokenRParen
+	tokenAnd
+	tokenOr
+	tokenNot
+	tokenTerm
+)
+
+type token struct {
+	kind tokenKind
+	pos  int
+	term Term
+}
+
+type lexer struct {
+	input []rune
+	pos   int
+}
+
+func (l *lexer) skipSpaces() {
+	for l.pos < len(l.input) && unicode.IsSpace(l.input[l.pos]) {
+		l.pos++
+	}
+}
+
+func (l *lexer) peek() rune {
+	if l.pos >= len(l.input) {
+		return 0
+	}
+
+	return l.input[l.pos]
+}
+
+func isWordRune(r rune) bool {
+	return r != 0 && !unicode.IsSpace(r) && r != '(' && r != ')' && r != '"'
+}
+
+func isFieldRune(r rune) bool {
+	return unicode.IsLetter(r) || r == '_'
+}
+
+func (l *lexer) next() (token, error) {
+	l.skipSpaces()
+
+	start := l.pos
+
+	switch r := l.peek(); {
+	case r == 0:
+		return token{kind: tokenEOF, pos: start}, nil
+	case r == '(':
+		l.pos++
+		return token{kind: tokenLParen, pos: start}, nil
+	case r == ')':
+		l.pos++
+		return token{kind: tokenRParen, pos: start}, nil
+	case !isFieldRune(r):
+		return token{}, fmt.Errorf("unexpected %q at %d", r, start)
+	}
+
+	for isFieldRune(l.peek()) {
+		l.pos++
+	}
+
+	word := string(l.input[start:l.pos])
+
+	op := l.operator()
+
+	if op == "" {
+		switch strings.ToUpper(word) {
+		case "AND":
+			return token{kind: tokenAnd, pos: start}, nil
+		case "OR":
+			return token{kind: tokenOr, pos: start}, nil
+		case "NOT":
+			return token{kind: tokenNot, pos: start}, nil
+		}
+
+		return token{}, fmt.Errorf("expected an operator after %q at %d, e.g. %v:value", word, start, word)
+	}
+
+	value, err := l.value()
+
+	if err != nil {
+		return token{}, err
+	}
+
+	term, err := newTerm(strings.ToLower(word), op, value)
+
+	if err != nil {
+		return token{}, fmt.Errorf("%w at %d", err, start)
+	}
+
+	return token{kind: tokenTerm, pos: start, term: term}, nil
+}
+
+// operator reads the comparison operator of a term, if any
+func (l *lexer) operator() string {
+	for _, op := range []string{OpNotEq, OpLte, OpGte, ":", OpEq, OpLt, OpGt} {
+		end := l.pos + len(op)
+
+		if end <= len(l.input) && string(l.input[l.pos:end]) == op {
+			l.pos = end
+
+			if op == ":" {
+				return OpEq
+			}
+
+			return op
+		}
+	}
+
+	return ""
+}
+
+// value reads a bare word or a quoted string, where \" is a quote
+func (l *lexer) value() (string, error) {
+	if l.peek() != '"' {
+		start := l.pos
+
+		for isWordRune(l.peek()) {
+			l.pos++
+		}
+
+		if l.pos == start {
+			return "", fmt.Errorf("missing value at %d", start)
+		}
+
+		return string(l.input[start:l.pos]), nil
+	}
+
+	start := l.pos
+	l.pos++
+
+	var value strings.Builder
+
+	for {
+		switch r := l.peek(); r {
+		case 0:
+			return "", fmt.Errorf("unterminated quote at %d", start)
+		case '"':
+			l.pos++
+			return value.String(), nil
+		case '\\':
+			l.pos++
+
+			if l.peek() == 0 {
+				return "", fmt.Errorf("unterminated quote at %d", start)
+			}
+
+			value.WriteRune(l.peek())
+			l.pos++
+		default:
+			value.WriteRune(r)
+			l.pos++
+		}
+	}
+}
+
+func newTerm(field string, op string, value string) (Term, error) {
+	term := Term{Field: field, Op: op, Value: value}
+
+	switch {
+	case numericFields[field]:
+		number, err := strconv.ParseFloat(value, 64)
+
+		if err != nil {
+			return term, fmt.Errorf("%v needs a number, got %q", field, value)
+		}
+
+		term.Number = number
+	case textFields[field]:
+		if op != OpEq && op != OpNotEq {
+			return term, fmt.Errorf("%v can only be compared with : or !=", field)
+		}
+
+		if field == FieldIs && value != IsDue && value != IsNew && value != IsScheduled && value != IsLeech {
+			return term, fmt.Errorf("is must be one of %v, %v, %v or %v", IsDue, IsNew, IsScheduled, IsLeech)
+		}
+	default:
+		return term, fmt.Errorf("unknown field %q", field)
+	}
+
+	return term, nil
+}
+
+type parser struct {
+	lexer   *lexer
+	current token
+}
+
+func (p *parser) advance() error {
+	next, err := p.lexer.next()
+
+	if err != nil {
+		return err
+	}
+
+	p.current = next
+
+	return nil
+}
+
+// Parse parses a filter expression
+func Parse(input string) (Node, error) {
+	p := &parser{lexer: &lexer{input: []rune(input)}}
+
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+
+	if p.current.kind == tokenEOF {
+		return nil, fmt.Errorf("empty query")
+	}
+
+	node, err := p.parseOr()
+
+	if err != nil {
+		return nil, err
+	}
+
+	if p.current.kind != tokenEOF {
+		return nil, fmt.Errorf("unexpected input at %d", p.current.pos)
+	}
+
+	return node, nil
+}
+
+func (p *parser) parseOr() (Node, error) {
+	left, err := p.parseAnd()
+
+	if err != nil {
+		return nil, err
+	}
+
+	for p.current.kind == tokenOr {
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+
+		right, err := p.parseAnd()
+
+		if err != nil {
+			return nil, err
+		}
+
+		left = Or{Left: left, Right: right}
+	}
+
+	return left, nil
+}
+
+func (p *parser) parseAnd() (Node, error) {
+	left, err := p.parseNot()
+
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		switch p.current.kind {
+		case tokenAnd:
+			if err := p.advance(); err != nil {
+				return nil, err
+			}
+		case tokenNot, tokenLParen, tokenTerm:
+			// Implicit AND
+		default:
+			return left, nil
+		}
+
+		right, err := p.parseNot()
+
+		if err != nil {
+			return nil, err
+		}
+
+		left = And{Left: left, Right: right}
+	}
+}
+
+func (p *parser) parseNot() (Node, error) {
+	if p.current.kind != tokenNot {
+		return p.parsePrimary()
+	}
+
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+
+	node, err := p.parseNot()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return Not{Node: node}, nil
+}
+
+func (p *parser) parsePrimary() (Node, error) {
+	switch p.current.kind {
+	case tokenTerm:
+		term := p.current.term
+
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+
+		return term, nil
+	case tokenLParen:
+		start := p.current.pos
+
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+
+		node, err := p.parseOr()
+
+		if err != nil {
+			return nil, err
+		}
+
+		if p.current.kind != tokenRParen {
+			return nil, fmt.Errorf("missing ) for ( at %d", start)
+		}
+
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+
+		return node, nil
+	case tokenEOF:
+		return nil, fmt.Errorf("unexpected end of query")
+	default:
+		return nil, fmt.Errorf("expected a term at %d", p.current.pos)
+	}
+}
@@ -0,0 +1,95 @@
+package query
+
+import "testing"
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{"term", "tag:history", `tag="history"`},
+		{"implicit and", "tag:a tag:b", `(tag="a" AND tag="b")`},
+		{"and binds tighter than or", "tag:a OR tag:b AND tag:c", `(tag="a" OR (tag="b" AND tag="c"))`},
+		{"or is left associative", "tag:a OR tag:b OR tag:c", `((tag="a" OR tag="b") OR tag="c")`},
+		{"parentheses", "(tag:a OR tag:b) AND NOT is:new", `((tag="a" OR tag="b") AND NOT is="new")`},
+		{"not binds tighter than and", "NOT tag:a tag:b", `(NOT tag="a" AND tag="b")`},
+		{"double negation", "NOT NOT tag:a", `NOT NOT tag="a"`},
+		{"case insensitive keywords and fields", "Tag:a and tag:b or TAG:c", `((tag="a" AND tag="b") OR tag="c")`},
+		{"quoted value", `source:"Sapiens: A Brief History" ease<2.0`, `(source="Sapiens: A Brief History" AND ease<"2.0")`},
+		{"escaped quote", `source:"say \"hi\""`, `source="say \"hi\""`},
+		{"not equal", "tag!=history", `tag!="history"`},
+		{"numeric operators", "lapses>=3 reviews<=10 interval>7", `((lapses>="3" AND reviews<="10") AND interval>"7")`},
+		{"equals sign", "ease=2.5", `ease="2.5"`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			node, err := Parse(test.input)
+
+			if err != nil {
+				t.Fatalf("Parse(%q) failed: %v", test.input, err)
+			}
+
+			if got := node.String(); got != test.want {
+				t.Errorf("Parse(%q) = %v, want %v", test.input, got, test.want)
+			}
+		})
+	}
+}
+
+func TestParseNumber(t *testing.T) {
+	node, err := Parse("ease<2.1")
+
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	term, ok := node.(Term)
+
+	if !ok {
+		t.Fatalf("Parse returned %T, want Term", node)
+	}
+
+	if term.Number != 2.1 {
+		t.Errorf("Number = %v, want 2.1", term.Number)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{"empty", "  ", "empty query"},
+		{"unknown field", "foo:bar", `unknown field "foo" at 0`},
+		{"unknown field position", "tag:a foo:bar", `unknown field "foo" at 6`},
+		{"number expected", "ease:high", `ease needs a number, got "high" at 0`},
+		{"text field comparison", "tag<a", "tag can only be compared with : or != at 0"},
+		{"unknown is value", "is:soon", "is must be one of due, new, scheduled or leech at 0"},
+		{"missing operator", "tag", `expected an operator after "tag" at 0, e.g. tag:value`},
+		{"missing value", "tag:", "missing value at 4"},
+		{"unterminated quote", `tag:"abc`, "unterminated quote at 4"},
+		{"unterminated escape", `tag:"abc\`, "unterminated quote at 4"},
+		{"unexpected rune", "tag:a OR 5", "unexpected '5' at 9"},
+		{"dangling and", "tag:a AND", "unexpected end of query"},
+		{"operator without term", "tag:a AND OR tag:b", "expected a term at 10"},
+		{"missing closing parenthesis", "(tag:a", "missing ) for ( at 0"},
+		{"extra closing parenthesis", "tag:a )", "unexpected input at 6"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := Parse(test.input)
+
+			if err == nil {
+				t.Fatalf("Parse(%q) succeeded, want error %q", test.input, test.want)
+			}
+
+			if err.Error() != test.want {
+				t.Errorf("Parse(%q) error = %q, want %q", test.input, err, test.want)
+			}
+		})
+	}
+}
@@ -1,44 +1,386 @@
 package scheduler
 
 import (
+	"fmt"
 	"log"
 	"os"
 	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/amalrajan30/spacedgram/internal/bot"
+	"github.com/amalrajan30/spacedgram/internal/storage"
+	"github.com/robfig/cron/v3"
 )
 
+const reminderJobPrefix = "reminder_"
+
 type Scheduler struct {
-	// service     *bot.BotService
+	service     *bot.BotService
+	repo        *storage.Repository
 	botInstance gotgbot.Bot
+	cron        *cron.Cron
+	gracePeriod time.Duration
+
+	mux     sync.Mutex
+	entries map[int64][]cron.EntryID
+	snoozes map[int64]*time.Timer
 }
 
-func NewScheduler(bot gotgbot.Bot) *Scheduler {
+// NewScheduler creates a scheduler whose jobs are persisted through repo.
+// Reminders missed by less than gracePeriod are sent on Start.
+func NewScheduler(bot gotgbot.Bot, service *bot.BotService, repo *storage.Repository, gracePeriod time.Duration) *Scheduler {
 	return &Scheduler{
+		service:     service,
+		repo:        repo,
 		botInstance: bot,
+		cron:        cron.New(),
+		gracePeriod: gracePeriod,
+		entries:     map[int64][]cron.EntryID{},
+		snoozes:     map[int64]*time.Timer{},
+	}
+}
+
+// Start schedules the reminders of every user with saved settings, falling
+// back to the default reminder for the configured USER_ID, and catches up
+// on the reminders and snoozes missed while the bot was down
+func (s *Scheduler) Start() error {
+	settings, err := s.service.ListSettings()
+
+	if err != nil {
+		return fmt.Errorf("loading user settings: %w", err)
+	}
+
+	if userID, err := strconv.Atoi(os.Getenv("USER_ID")); err == nil {
+		found := false
+		for _, userSettings := range settings {
+			if userSettings.UserID == int64(userID) {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			settings = append(settings, storage.DefaultUserSettings(int64(userID)))
+		}
+	}
+
+	now := time.Now()
+
+	for _, userSettings := range settings {
+		jobs, err := s.scheduleUser(userSettings)
+
+		if err != nil {
+			log.Printf("failed to schedule reminders for user %v: %v", userSettings.UserID, err)
+			continue
+		}
+
+		s.catchUpReminders(userSettings, jobs, now)
+	}
+
+	if err := s.restoreSnoozes(now); err != nil {
+		log.Printf("failed to restore snoozed reminders: %v", err)
+	}
+
+	s.cron.Start()
+
+	return nil
+}
+
+func (s *Scheduler) Stop() {
+	s.cron.Stop()
+}
+
+// previousRun returns the last time a reminder set for reminder (HH:MM)
+// should have fired before now
+func previousRun(reminder string, loc *time.Location, now time.Time) (time.Time, error) {
+	hour, minute, err := storage.ParseReminderTime(reminder)
+
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	local := now.In(loc)
+	prev := time.Date(local.Year(), local.Month(), local.Day(), hour, minute, 0, 0, loc)
+
+	if prev.After(now) {
+		prev = prev.AddDate(0, 0, -1)
+	}
+
+	return prev, nil
+}
+
+// catchUpReminders sends a single reminder if any of the user's reminders
+// were missed within the grace period
+func (s *Scheduler) catchUpReminders(settings storage.UserSettings, jobs []storage.ScheduledJob, now time.Time) {
+	for _, job := range jobs {
+		prev, err := previousRun(strings.TrimPrefix(job.Name, reminderJobPrefix), settings.Location(), now)
+
+		if err != nil {
+			log.Printf("failed to get previous run of job %v: %v", job.Name, err)
+			continue
+		}
+
+		if !job.CreatedAt.Before(prev) || now.Sub(prev) > s.gracePeriod {
+			continue
+		}
+
+		if job.LastRunAt != nil && !job.LastRunAt.Before(prev) {
+			continue
+		}
+
+		log.Printf("Reminder %v for user %v was missed at %v, catching up", job.Name, job.UserID, prev)
+
+		if s.runJob(job, prev) {
+			return
+		}
 	}
 }
 
-func (s Scheduler) RunScheduled() {
+func (s *Scheduler) restoreSnoozes(now time.Time) error {
+	jobs, err := s.repo.GetJobs(storage.JobKindSnooze)
 
-	log.Println("Running scheduled")
-	userID, userIDErr := strconv.Atoi(os.Getenv("USER_ID"))
+	if err != nil {
+		return err
+	}
+
+	for _, job := range jobs {
+		switch {
+		case job.RunAt == nil || now.Sub(*job.RunAt) > s.gracePeriod:
+			if err := s.repo.DeleteJob(job.ID); err != nil {
+				log.Printf("failed to delete expired snooze: %v", err)
+			}
+		case job.RunAt.After(now):
+			s.startSnoozeTimer(job)
+		default:
+			log.Printf("Snoozed reminder for user %v was missed at %v, catching up", job.UserID, job.RunAt)
+			s.runSnooze(job)
+		}
+	}
+
+	return nil
+}
+
+// runJob sends the reminder of a job for the occurrence at scheduledFor,
+// unless it already ran. It returns whether the reminder went out.
+func (s *Scheduler) runJob(job storage.ScheduledJob, scheduledFor time.Time) bool {
+	claimed, err := s.repo.ClaimJobRun(job.ID, scheduledFor)
+
+	if err != nil {
+		log.Printf("failed to claim job %v: %v", job.Name, err)
+		return false
+	}
+
+	if !claimed {
+		log.Printf("Job %v for %v already ran, skipping", job.Name, scheduledFor)
+		return false
+	}
 
-	if userIDErr != nil {
-		log.Printf("failed to load user id: %v", userIDErr)
+	s.RunScheduled(job.UserID, scheduledFor)
+
+	return true
+}
+
+// ScheduleUser replaces the reminder jobs of a user with the ones from the
+// given settings, firing in the user's timezone
+func (s *Scheduler) ScheduleUser(settings storage.UserSettings) error {
+	_, err := s.scheduleUser(settings)
+
+	return err
+}
+
+func (s *Scheduler) scheduleUser(settings storage.UserSettings) ([]storage.ScheduledJob, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	for _, entryID := range s.entries[settings.UserID] {
+		s.cron.Remove(entryID)
+	}
+	delete(s.entries, settings.UserID)
+
+	specs := map[string]string{}
+
+	for _, reminder := range settings.Reminders() {
+		hour, minute, err := storage.ParseReminderTime(reminder)
+
+		if err != nil {
+			return nil, err
+		}
+
+		specs[reminderJobPrefix+reminder] = fmt.Sprintf("CRON_TZ=%s %d %d * * *", settings.Location().String(), minute, hour)
+	}
+
+	jobs, err := s.repo.SyncReminderJobs(settings.UserID, settings.Location().String(), specs)
+
+	if err != nil {
+		return nil, err
+	}
+
+	entryIDs := []cron.EntryID{}
+
+	for _, job := range jobs {
+		job := job
+
+		entryID, err := s.cron.AddFunc(job.Spec, func() {
+			s.runJob(job, time.Now().Truncate(time.Minute))
+		})
+
+		if err != nil {
+			// Leave no reminder of a half scheduled user behind
+			for _, added := range entryIDs {
+				s.cron.Remove(added)
+			}
+
+			return nil, fmt.Errorf("adding reminder %v: %w", job.Name, err)
+		}
+
+		entryIDs = append(entryIDs, entryID)
+	}
+
+	s.entries[settings.UserID] = entryIDs
+
+	log.Printf("Scheduled %v reminders for user %v in %v", len(entryIDs), settings.UserID, settings.Location())
+
+	return jobs, nil
+}
+
+// Snooze sends the reminder again at the given time. Regular reminders falling
+// at or before it are skipped.
+func (s *Scheduler) Snooze(userID int64, until time.Time) {
+	job, err := s.repo.SaveSnoozeJob(userID, until)
+
+	if err != nil {
+		log.Printf("failed to snooze reminder for user %v: %v", userID, err)
+		return
+	}
+
+	s.startSnoozeTimer(job)
+
+	log.Printf("Snoozed reminder for user %v until %v", userID, until)
+}
+
+func (s *Scheduler) startSnoozeTimer(job storage.ScheduledJob) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	if timer, ok := s.snoozes[job.UserID]; ok {
+		timer.Stop()
+	}
+
+	s.snoozes[job.UserID] = time.AfterFunc(time.Until(*job.RunAt), func() {
+		s.mux.Lock()
+		delete(s.snoozes, job.UserID)
+		s.mux.Unlock()
+
+		s.runSnooze(job)
+	})
+}
+
+func (s *Scheduler) runSnooze(job storage.ScheduledJob) {
+	claimed, err := s.repo.ClaimJobRun(job.ID, *job.RunAt)
+
+	if err != nil {
+		log.Printf("failed to claim snooze of user %v: %v", job.UserID, err)
+		return
+	}
+
+	if !claimed {
+		return
+	}
+
+	// The job is kept, so that a regular reminder due at the same time sees it
+	// and stays quiet. It is replaced by the next snooze, or dropped once it
+	// expires on restart.
+	s.SendReminder(job.UserID)
+}
+
+// isSnoozed returns whether the regular reminder scheduled for scheduledFor
+// falls before or at the time of the user's snooze, which sends it instead
+func (s *Scheduler) isSnoozed(userID int64, scheduledFor time.Time) bool {
+	job, err := s.repo.GetSnoozeJob(userID)
+
+	if err != nil {
+		log.Printf("failed to check snooze of user %v: %v", userID, err)
+		return false
+	}
+
+	return job != nil && job.RunAt != nil && !job.RunAt.Before(scheduledFor)
+}
+
+func (s *Scheduler) RunScheduled(userID int64, scheduledFor time.Time) {
+
+	log.Printf("Running scheduled for user %v", userID)
+
+	if s.isSnoozed(userID, scheduledFor) {
+		log.Printf("Reminder for user %v is snoozed, skipping", userID)
+		return
+	}
+
+	s.SendReminder(userID)
+}
+
+func formatReminder(summary *bot.ReminderSummary) string {
+	msg := fmt.Sprintf(
+		"📅 <b>Today's Review</b>\n"+
+			"━━━━━━━━━━━━━━\n"+
+			"<b>Due:</b> %v notes (~%v min)\n",
+		summary.DueCount,
+		summary.EstimatedMinutes,
+	)
+
+	for _, source := range summary.DueBySource {
+		msg = msg + fmt.Sprintf("• %v: %v\n", source.Title, source.Count)
+	}
+
+	if summary.NewCount > 0 {
+		msg = msg + fmt.Sprintf("\n<b>New:</b> %v notes not reviewed yet", summary.NewCount)
+	}
+
+	return msg
+}
+
+// SendReminder sends the review reminder, unless nothing is due
+func (s *Scheduler) SendReminder(userID int64) {
+	summary, err := s.service.ReminderSummary(userID)
+
+	if err != nil {
+		log.Printf("failed to build reminder for user %v: %v", userID, err)
+		return
+	}
+
+	if summary.DueCount == 0 && summary.NewCount == 0 {
+		log.Printf("Nothing due for user %v, skipping reminder", userID)
 		return
 	}
 
 	keyboard := gotgbot.InlineKeyboardMarkup{
-		InlineKeyboard: [][]gotgbot.InlineKeyboardButton{{
+		InlineKeyboard: [][]gotgbot.InlineKeyboardButton{
+			{
+				{
+					Text:         "Start Review",
+					CallbackData: "start_review_schedule",
+				},
+			},
 			{
-				Text:         "Start Review",
-				CallbackData: "start_review_schedule",
+				{
+					Text:         "⏰ 30 min",
+					CallbackData: "snooze_30m",
+				},
+				{
+					Text:         "⏰ 2 h",
+					CallbackData: "snooze_2h",
+				},
+				{
+					Text:         "⏰ Tomorrow",
+					CallbackData: "snooze_tomorrow",
+				},
 			},
-		}},
+		},
 	}
 
-	_, err := s.botInstance.SendMessage(int64(userID), "Ready to start todays review?", &gotgbot.SendMessageOpts{
+	_, err = s.botInstance.SendMessage(userID, formatReminder(summary), &gotgbot.SendMessageOpts{
 		ParseMode:   "HTML",
 		ReplyMarkup: keyboard,
 	})
@@ -0,0 +1,167 @@
+package scheduler
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/amalrajan30/spacedgram/internal/bot"
+	"github.com/amalrajan30/spacedgram/internal/storage"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+// testScheduler returns a scheduler keeping its jobs in the database of
+// TEST_DATABASE_URL, and skips the test when none is given
+func testScheduler(t *testing.T, userID int64) *Scheduler {
+	t.Helper()
+
+	dsn := os.Getenv("TEST_DATABASE_URL")
+
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+
+	db, err := gorm.Open(postgres.Open(dsn))
+
+	if err != nil {
+		t.Fatalf("failed to connect to the test database: %v", err)
+	}
+
+	repo := storage.NewRepository(db)
+	s := NewScheduler(gotgbot.Bot{}, bot.NewBotService(repo), repo, time.Hour)
+
+	t.Cleanup(func() {
+		for _, timer := range s.snoozes {
+			timer.Stop()
+		}
+		db.Unscoped().Where("user_id = ?", userID).Delete(&storage.ScheduledJob{})
+	})
+
+	return s
+}
+
+func TestPreviousRun(t *testing.T) {
+	kolkata, err := time.LoadLocation("Asia/Kolkata")
+
+	if err != nil {
+		t.Skipf("no time zone data: %v", err)
+	}
+
+	// 09:30 in Kolkata
+	now := time.Date(2024, 3, 10, 4, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		reminder string
+		want     time.Time
+	}{
+		{"08:30", time.Date(2024, 3, 10, 8, 30, 0, 0, kolkata)},
+		{"09:30", time.Date(2024, 3, 10, 9, 30, 0, 0, kolkata)},
+		{"20:00", time.Date(2024, 3, 9, 20, 0, 0, 0, kolkata)},
+	}
+
+	for _, test := range tests {
+		got, err := previousRun(test.reminder, kolkata, now)
+
+		if err != nil {
+			t.Fatalf("previousRun(%q) failed: %v", test.reminder, err)
+		}
+
+		if !got.Equal(test.want) {
+			t.Errorf("previousRun(%q) = %v, want %v", test.reminder, got, test.want)
+		}
+	}
+
+	if _, err := previousRun("25:00", kolkata, now); err == nil {
+		t.Error("previousRun accepted an invalid reminder time")
+	}
+}
+
+func TestScheduleUser(t *testing.T) {
+	kolkata, err := time.LoadLocation("Asia/Kolkata")
+
+	if err != nil {
+		t.Skipf("no time zone data: %v", err)
+	}
+
+	userID := -time.Now().UnixNano()
+	s := testScheduler(t, userID)
+
+	settings := storage.UserSettings{UserID: userID, Timezone: "Asia/Kolkata", ReminderTimes: "08:30"}
+
+	if err := s.ScheduleUser(settings); err != nil {
+		t.Fatalf("ScheduleUser failed: %v", err)
+	}
+
+	if got := len(s.entries[userID]); got != 1 {
+		t.Fatalf("scheduled %v reminders, want 1", got)
+	}
+
+	now := time.Date(2024, 3, 10, 4, 0, 0, 0, time.UTC)
+	next := s.cron.Entry(s.entries[userID][0]).Schedule.Next(now)
+
+	// 04:00 UTC is 09:30 in Kolkata, past the morning reminder
+	if want := time.Date(2024, 3, 11, 8, 30, 0, 0, kolkata); !next.Equal(want) {
+		t.Errorf("next reminder = %v, want %v", next, want)
+	}
+
+	// Rescheduling replaces the previous reminders
+	settings.ReminderTimes = "07:00,21:00"
+
+	if err := s.ScheduleUser(settings); err != nil {
+		t.Fatalf("ScheduleUser failed: %v", err)
+	}
+
+	if got := len(s.cron.Entries()); got != 2 {
+		t.Errorf("%v reminders after rescheduling, want 2", got)
+	}
+}
+
+func TestSnooze(t *testing.T) {
+	userID := -time.Now().UnixNano()
+	s := testScheduler(t, userID)
+
+	until := time.Now().Add(time.Hour).Truncate(time.Second)
+	s.Snooze(userID, until)
+
+	// The snooze replaces regular reminders up to and at its time
+	if !s.isSnoozed(userID, until.Add(-time.Minute)) || !s.isSnoozed(userID, until) {
+		t.Error("the user isn't snoozed")
+	}
+
+	if s.isSnoozed(userID, until.Add(time.Minute)) {
+		t.Error("a reminder after the snooze is skipped")
+	}
+
+	if s.isSnoozed(userID+1, until) {
+		t.Error("another user is snoozed")
+	}
+}
+
+func TestFormatReminder(t *testing.T) {
+	summary := &bot.ReminderSummary{
+		DueCount: 3,
+		DueBySource: []storage.SourceCount{
+			{Title: "Meditations", Count: 2},
+			{Title: "Walden", Count: 1},
+		},
+		NewCount:         4,
+		EstimatedMinutes: 1,
+	}
+
+	msg := formatReminder(summary)
+
+	for _, want := range []string{"<b>Due:</b> 3 notes (~1 min)", "• Meditations: 2", "• Walden: 1", "<b>New:</b> 4 notes"} {
+		if !strings.Contains(msg, want) {
+			t.Errorf("reminder %q doesn't contain %q", msg, want)
+		}
+	}
+
+	summary.NewCount = 0
+
+	if msg := formatReminder(summary); strings.Contains(msg, "New:") {
+		t.Errorf("reminder %q mentions new notes when there are none", msg)
+	}
+}
@@ -0,0 +1,132 @@
+package search
+
+import (
+	"math"
+	"sort"
+	"sync"
+)
+
+// Index is an in-memory vector index searched by brute force, used when
+// pgvector isn't available. It is good enough for a personal library of a
+// few thousand highlights.
+type Index struct {
+	mux     sync.RWMutex
+	model   string
+	vectors map[int][]float32
+	loaded  bool
+}
+
+type Match struct {
+	ID    int
+	Score float64
+}
+
+func NewIndex() *Index {
+	return &Index{
+		vectors: map[int][]float32{},
+	}
+}
+
+// Load fills the index with the vectors of model returned by load, unless it
+// was already loaded for that model
+func (index *Index) Load(model string, load func() (map[int][]float32, error)) error {
+	index.mux.Lock()
+	defer index.mux.Unlock()
+
+	if index.loaded && index.model == model {
+		return nil
+	}
+
+	vectors, err := load()
+
+	if err != nil {
+		return err
+	}
+
+	for id, vector := range vectors {
+		vectors[id] = normalize(vector)
+	}
+
+	index.model = model
+	index.vectors = vectors
+	index.loaded = true
+
+	return nil
+}
+
+// Add sets the vector of id, if the index holds vectors of model
+func (index *Index) Add(model string, id int, vector []float32) {
+	index.mux.Lock()
+	defer index.mux.Unlock()
+
+	if !index.loaded || index.model != model {
+		return
+	}
+
+	index.vectors[id] = normalize(vector)
+}
+
+func (index *Index) Remove(id int) {
+	index.mux.Lock()
+	defer index.mux.Unlock()
+
+	delete(index.vectors, id)
+}
+
+// Search returns the limit vectors most similar to query by cosine
+// similarity, best first. Ids for which skip returns true are left out, skip
+// may be nil.
+func (index *Index) Search(query []float32, limit int, skip func(id int) bool) []Match {
+	index.mux.RLock()
+	defer index.mux.RUnlock()
+
+	query = normalize(query)
+	matches := []Match{}
+
+	for id, vector := range index.vectors {
+		if len(vector) != len(query) || (skip != nil && skip(id)) {
+			continue
+		}
+
+		matches = append(matches, Match{
+			ID:    id,
+			Score: dot(query, vector),
+		})
+	}
+
+	sort.Slice(matches, func(i, j int) bool {
+		return matches[i].Score > matches[j].Score
+	})
+
+	if len(matches) > limit {
+		matches = matches[:limit]
+	}
+
+	return matches
+}
+
+func dot(a []float32, b []float32) float64 {
+	var sum float64
+
+	for i := range a {
+		sum += float64(a[i]) * float64(b[i])
+	}
+
+	return sum
+}
+
+func normalize(vector []float32) []float32 {
+	norm := math.Sqrt(dot(vector, vector))
+
+	if norm == 0 {
+		return vector
+	}
+
+	normalized := make([]float32, len(vector))
+
+	for i, value := range vector {
+		normalized[i] = float32(float64(value) / norm)
+	}
+
+	return normalized
+}
@@ -0,0 +1,131 @@
+package search
+
+import (
+	"math"
+	"slices"
+	"testing"
+)
+
+func loadedIndex(t *testing.T, model string, vectors map[int][]float32) *Index {
+	t.Helper()
+
+	index := NewIndex()
+
+	err := index.Load(model, func() (map[int][]float32, error) {
+		return vectors, nil
+	})
+
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+
+	return index
+}
+
+func matchIDs(matches []Match) []int {
+	ids := []int{}
+
+	for _, match := range matches {
+		ids = append(ids, match.ID)
+	}
+
+	return ids
+}
+
+func TestSearchOrdersByCosineSimilarity(t *testing.T) {
+	index := loadedIndex(t, "model", map[int][]float32{
+		1: {1, 0},
+		2: {10, 10},
+		3: {0, 3},
+		4: {-1, 0},
+	})
+
+	matches := index.Search([]float32{2, 0}, 10, nil)
+
+	if got, want := matchIDs(matches), []int{1, 2, 3, 4}; !slices.Equal(got, want) {
+		t.Fatalf("Search = %v, want %v", got, want)
+	}
+
+	if math.Abs(matches[0].Score-1) > 1e-6 {
+		t.Errorf("score of an identical direction = %v, want 1", matches[0].Score)
+	}
+
+	if math.Abs(matches[1].Score-math.Sqrt2/2) > 1e-6 {
+		t.Errorf("score at 45 degrees = %v, want %v", matches[1].Score, math.Sqrt2/2)
+	}
+}
+
+func TestSearchLimitAndSkip(t *testing.T) {
+	index := loadedIndex(t, "model", map[int][]float32{
+		1: {1, 0},
+		2: {1, 1},
+		3: {0, 1},
+	})
+
+	matches := index.Search([]float32{1, 0}, 1, func(id int) bool {
+		return id == 1
+	})
+
+	if got, want := matchIDs(matches), []int{2}; !slices.Equal(got, want) {
+		t.Errorf("Search = %v, want %v", got, want)
+	}
+}
+
+func TestSearchSkipsOtherDimensions(t *testing.T) {
+	index := loadedIndex(t, "model", map[int][]float32{
+		1: {1, 0},
+		2: {1, 0, 0},
+	})
+
+	if got, want := matchIDs(index.Search([]float32{1, 0}, 10, nil)), []int{1}; !slices.Equal(got, want) {
+		t.Errorf("Search = %v, want %v", got, want)
+	}
+}
+
+func TestAddAndRemove(t *testing.T) {
+	index := loadedIndex(t, "model", map[int][]float32{
+		1: {1, 0},
+	})
+
+	index.Add("model", 2, []float32{0, 1})
+	index.Add("other", 3, []float32{0, 1})
+
+	if got, want := matchIDs(index.Search([]float32{0, 1}, 10, nil)), []int{2, 1}; !slices.Equal(got, want) {
+		t.Errorf("Search after Add = %v, want %v", got, want)
+	}
+
+	index.Remove(2)
+
+	if got, want := matchIDs(index.Search([]float32{0, 1}, 10, nil)), []int{1}; !slices.Equal(got, want) {
+		t.Errorf("Search after Remove = %v, want %v", got, want)
+	}
+}
+
+func TestAddBeforeLoad(t *testing.T) {
+	index := NewIndex()
+	index.Add("model", 1, []float32{1, 0})
+
+	if matches := index.Search([]float32{1, 0}, 10, nil); len(matches) != 0 {
+		t.Errorf("Search = %v, want no matches before Load", matchIDs(matches))
+	}
+}
+
+func TestLoadOncePerModel(t *testing.T) {
+	index := NewIndex()
+	loads := 0
+
+	load := func() (map[int][]float32, error) {
+		loads++
+		return map[int][]float32{1: {1, 0}}, nil
+	}
+
+	for _, model := range []string{"a", "a", "b"} {
+		if err := index.Load(model, load); err != nil {
+			t.Fatalf("Load(%q) failed: %v", model, err)
+		}
+	}
+
+	if loads != 2 {
+		t.Errorf("loaded %v times, want 2", loads)
+	}
+}
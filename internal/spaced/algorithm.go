@@ -1,6 +1,7 @@
 package spaced
 
 import (
+	"math"
 	"math/rand"
 	"time"
 
@@ -62,3 +63,15 @@ func GetNextDueDate(note storage.Note, reviewQuality int) (nextDate time.Time, i
 	return nextDueDate, interval, easinessFactor
 
 }
+
+// Retrievability estimates the probability of recalling a note now, assuming
+// the scheduled interval targets 90% recall and memory decays exponentially
+func Retrievability(note storage.Note, now time.Time) float64 {
+	if note.LastReviewed == nil || note.Interval <= 0 {
+		return 0
+	}
+
+	elapsedDays := now.Sub(*note.LastReviewed).Hours() / 24
+
+	return math.Exp(math.Log(0.9) * elapsedDays / float64(note.Interval))
+}
@@ -0,0 +1,37 @@
+package spaced
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/amalrajan30/spacedgram/internal/storage"
+)
+
+func TestRetrievability(t *testing.T) {
+	now := time.Date(2024, 3, 10, 12, 0, 0, 0, time.UTC)
+	daysAgo := func(days int) *time.Time {
+		at := now.AddDate(0, 0, -days)
+		return &at
+	}
+
+	tests := []struct {
+		name string
+		note storage.Note
+		want float64
+	}{
+		{"never reviewed", storage.Note{}, 0},
+		{"reviewed just now", storage.Note{LastReviewed: &now, Interval: 4}, 1},
+		{"due today", storage.Note{LastReviewed: daysAgo(4), Interval: 4}, 0.9},
+		{"one interval overdue", storage.Note{LastReviewed: daysAgo(8), Interval: 4}, 0.81},
+		{"no interval", storage.Note{LastReviewed: daysAgo(1)}, 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := Retrievability(test.note, now); math.Abs(got-test.want) > 1e-9 {
+				t.Errorf("Retrievability = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,125 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm/clause"
+)
+
+// SaveCard creates the card of a note, replacing the question of an
+// existing card of the same type
+func (repo Repository) SaveCard(card Card) (Card, error) {
+	result := repo.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "note_id"}, {Name: "type"}},
+		DoUpdates: clause.AssignmentColumns([]string{"question", "answer", "updated_at", "deleted_at"}),
+	}).Create(&card)
+
+	if result.Error != nil {
+		return Card{}, fmt.Errorf("failed to save %v card of note %d: %w", card.Type, card.NoteID, result.Error)
+	}
+
+	return card, nil
+}
+
+// GetCard returns a card with its note. Cloze cards get the question and
+// answer of the note.
+func (repo Repository) GetCard(id int) (*Card, error) {
+	var card Card
+
+	result := repo.db.Limit(1).
+		Preload("Note.Source").
+		Where("id = ?", id).
+		Find(&card)
+
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to get card: %w", result.Error)
+	}
+
+	if result.RowsAffected == 0 {
+		return nil, fmt.Errorf("card with id %d not found", id)
+	}
+
+	if card.Type == CardTypeCloze {
+		card.Question = card.Note.Question
+		card.Answer = card.Note.Answer
+	}
+
+	return &card, nil
+}
+
+// GetCardTypes returns the types of the cards already generated for a note
+func (repo Repository) GetCardTypes(noteID int) ([]string, error) {
+	var types []string
+
+	result := repo.db.Model(&Card{}).Where("note_id = ?", noteID).Pluck("type", &types)
+
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to get card types of note %d: %w", noteID, result.Error)
+	}
+
+	return types, nil
+}
+
+// GetDueCards returns the cards of a source due before dueBefore, along with
+// the ones that were never reviewed
+func (repo Repository) GetDueCards(sourceID int, dueBefore time.Time) ([]Card, error) {
+	var cards []Card
+
+	result := repo.db.
+		Joins("JOIN notes ON cards.note_id = notes.id AND notes.deleted_at IS NULL").
+		Where("notes.source_id = ? AND (cards.next_due_date < ? OR cards.next_due_date IS NULL)", sourceID, dueBefore).
+		Scopes(reviewable).
+		Preload("Note").
+		Find(&cards)
+
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to get cards for source %d: %w", sourceID, result.Error)
+	}
+
+	return cards, nil
+}
+
+func (repo Repository) UpdateCardSchedule(id int, update Card) error {
+	result := repo.db.Model(&Card{}).Where("id = ?", id).Updates(update)
+
+	if result.Error != nil {
+		return fmt.Errorf("failed to update card: %w", result.Error)
+	}
+
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("card with id %d not found", id)
+	}
+
+	return nil
+}
+
+// GetSourceNotes returns the reviewable notes of a source, due or not
+func (repo Repository) GetSourceNotes(sourceID int) ([]Note, error) {
+	var notes []Note
+
+	result := repo.db.Where("source_id = ?", sourceID).Scopes(reviewable).Order("id ASC").Find(&notes)
+
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to get notes for source %d: %w", sourceID, result.Error)
+	}
+
+	return notes, nil
+}
+
+func (repo Repository) SetSourceCardTypes(id int, types []string) error {
+	encoded, err := json.Marshal(types)
+
+	if err != nil {
+		return fmt.Errorf("failed to encode card types: %w", err)
+	}
+
+	result := repo.db.Model(&Source{}).Where("id = ?", id).Update("card_types", string(encoded))
+
+	if result.Error != nil {
+		return fmt.Errorf("failed to update card types: %w", result.Error)
+	}
+
+	return nil
+}
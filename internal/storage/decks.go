@@ -0,0 +1,198 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/amalrajan30/spacedgram/internal/query"
+	"gorm.io/gorm"
+)
+
+// Columns compared by the numeric fields of a query
+var queryColumns = map[string]string{
+	query.FieldEase:     "COALESCE(notes.easiness_factor, 2.5)",
+	query.FieldLapses:   "notes.lapses",
+	query.FieldInterval: "notes.interval",
+	query.FieldReviews:  "notes.review_count",
+}
+
+// compileQuery turns a parsed query into a condition on notes joined with
+// their sources
+func compileQuery(node query.Node, now time.Time) (string, []interface{}, error) {
+	switch n := node.(type) {
+	case query.And:
+		return compileBinary("AND", n.Left, n.Right, now)
+	case query.Or:
+		return compileBinary("OR", n.Left, n.Right, now)
+	case query.Not:
+		condition, args, err := compileQuery(n.Node, now)
+
+		if err != nil {
+			return "", nil, err
+		}
+
+		return "NOT (" + condition + ")", args, nil
+	case query.Term:
+		return compileTerm(n, now)
+	default:
+		return "", nil, fmt.Errorf("unknown query node %T", node)
+	}
+}
+
+func compileBinary(operator string, left query.Node, right query.Node, now time.Time) (string, []interface{}, error) {
+	leftCondition, leftArgs, err := compileQuery(left, now)
+
+	if err != nil {
+		return "", nil, err
+	}
+
+	rightCondition, rightArgs, err := compileQuery(right, now)
+
+	if err != nil {
+		return "", nil, err
+	}
+
+	return fmt.Sprintf("(%v %v %v)", leftCondition, operator, rightCondition), append(leftArgs, rightArgs...), nil
+}
+
+// sourceTitle matches the notes of the sources whose current or former title
+// is like a pattern. It takes the pattern twice.
+const sourceTitle = "(sources.title ILIKE ? OR sources.id IN (SELECT source_id FROM source_aliases WHERE title ILIKE ? AND deleted_at IS NULL))"
+
+func compileTerm(term query.Term, now time.Time) (string, []interface{}, error) {
+	var condition string
+	var args []interface{}
+
+	switch term.Field {
+	case query.FieldSource:
+		// Kindle titles carry a subtitle and the author, match any part of
+		// the title or of a former one
+		pattern := "%" + escapeLike(term.Value) + "%"
+		condition = sourceTitle
+		args = []interface{}{pattern, pattern}
+	case query.FieldTag:
+		tag := NormalizeTag(term.Value)
+		condition = taggedNotes
+		args = []interface{}{tag, tag}
+	case query.FieldIs:
+		switch term.Value {
+		case query.IsDue:
+			condition = "notes.next_due_date < ?"
+			args = []interface{}{now}
+		case query.IsNew:
+			condition = "notes.next_due_date IS NULL"
+		case query.IsScheduled:
+			condition = "notes.next_due_date >= ?"
+			args = []interface{}{now}
+		case query.IsLeech:
+			condition = "notes.leech"
+		default:
+			return "", nil, fmt.Errorf("unknown value %q of is", term.Value)
+		}
+	default:
+		column, ok := queryColumns[term.Field]
+
+		if !ok {
+			return "", nil, fmt.Errorf("unknown field %q", term.Field)
+		}
+
+		return fmt.Sprintf("%v %v ?", column, term.Op), []interface{}{term.Number}, nil
+	}
+
+	if term.Op == query.OpNotEq {
+		condition = "NOT (" + condition + ")"
+	}
+
+	return condition, args, nil
+}
+
+func escapeLike(value string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(value)
+}
+
+// GetQueryNotes returns the notes matching a parsed deck query, due or not.
+// Suspended and buried notes are left out.
+func (repo Repository) GetQueryNotes(expr query.Node) ([]Note, error) {
+	condition, args, err := compileQuery(expr, time.Now())
+
+	if err != nil {
+		return nil, err
+	}
+
+	var notes []Note
+
+	result := repo.db.
+		Joins("JOIN sources ON notes.source_id = sources.id AND sources.deleted_at IS NULL").
+		Where(condition, args...).
+		Scopes(reviewable).
+		Find(&notes)
+
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to get notes of query: %w", result.Error)
+	}
+
+	return notes, nil
+}
+
+// SaveDeck creates a deck, or replaces the query of the user's deck of the
+// same name
+func (repo Repository) SaveDeck(userID int64, name string, deckQuery string) (Deck, error) {
+	var deck Deck
+
+	result := repo.db.
+		Where(Deck{UserID: userID, Name: name}).
+		Assign(Deck{Query: deckQuery}).
+		FirstOrCreate(&deck)
+
+	if result.Error != nil {
+		return Deck{}, fmt.Errorf("failed to save deck %q: %w", name, result.Error)
+	}
+
+	return deck, nil
+}
+
+func (repo Repository) GetDecks(userID int64) ([]Deck, error) {
+	var decks []Deck
+
+	result := repo.db.Where("user_id = ?", userID).Order("name").Find(&decks)
+
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to get decks: %w", result.Error)
+	}
+
+	return decks, nil
+}
+
+func (repo Repository) GetDeck(userID int64, id int) (Deck, error) {
+	var deck Deck
+
+	result := repo.db.Where("user_id = ? AND id = ?", userID, id).First(&deck)
+
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return Deck{}, result.Error
+		}
+		return Deck{}, fmt.Errorf("failed to get deck: %w", result.Error)
+	}
+
+	return deck, nil
+}
+
+// DeleteDeck deletes the user's deck of that name, returning
+// gorm.ErrRecordNotFound when there is none
+func (repo Repository) DeleteDeck(userID int64, name string) error {
+	// Deleted for good so the name can be used again
+	result := repo.db.Unscoped().Where("user_id = ? AND name = ?", userID, name).Delete(&Deck{})
+
+	if result.Error != nil {
+		return fmt.Errorf("failed to delete deck %q: %w", name, result.Error)
+	}
+
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,112 @@
+package storage
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/amalrajan30/spacedgram/internal/query"
+	"gorm.io/gorm"
+)
+
+func TestCompileQuery(t *testing.T) {
+	now := time.Date(2024, 3, 10, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		query     string
+		condition string
+		args      []interface{}
+	}{
+		{"source:stoic", sourceTitle, []interface{}{"%stoic%", "%stoic%"}},
+		{"source!=100%_off", "NOT (" + sourceTitle + ")", []interface{}{`%100\%\_off%`, `%100\%\_off%`}},
+		{"tag:#Stoicism", taggedNotes, []interface{}{"stoicism", "stoicism"}},
+		{"tag:history is:due", "(" + taggedNotes + " AND notes.next_due_date < ?)", []interface{}{"history", "history", now}},
+		{"NOT is:new OR lapses>=3", "(NOT (notes.next_due_date IS NULL) OR notes.lapses >= ?)", []interface{}{3.0}},
+		{"is:leech", "notes.leech", nil},
+		{"is!=scheduled", "NOT (notes.next_due_date >= ?)", []interface{}{now}},
+		{
+			"ease<2.1 (interval>30 OR reviews!=0)",
+			"(COALESCE(notes.easiness_factor, 2.5) < ? AND (notes.interval > ? OR notes.review_count != ?))",
+			[]interface{}{2.1, 30.0, 0.0},
+		},
+	}
+
+	for _, test := range tests {
+		node, err := query.Parse(test.query)
+
+		if err != nil {
+			t.Fatalf("Parse(%q) failed: %v", test.query, err)
+		}
+
+		condition, args, err := compileQuery(node, now)
+
+		if err != nil {
+			t.Errorf("compileQuery(%q) failed: %v", test.query, err)
+			continue
+		}
+
+		if condition != test.condition {
+			t.Errorf("compileQuery(%q) = %q, want %q", test.query, condition, test.condition)
+		}
+
+		if !reflect.DeepEqual(args, test.args) {
+			t.Errorf("compileQuery(%q) args = %#v, want %#v", test.query, args, test.args)
+		}
+	}
+
+	if _, _, err := compileQuery(query.Term{Field: "title", Op: query.OpEq, Value: "x"}, now); err == nil {
+		t.Error("compileQuery accepted an unknown field")
+	}
+}
+
+func TestDecks(t *testing.T) {
+	repo, db := testRepository(t)
+	userID := testUserID()
+
+	t.Cleanup(func() {
+		db.Unscoped().Where("user_id = ?", userID).Delete(&Deck{})
+	})
+
+	if _, err := repo.SaveDeck(userID, "stoics", "tag:stoicism"); err != nil {
+		t.Fatalf("SaveDeck failed: %v", err)
+	}
+
+	// Saving under the same name replaces the query
+	saved, err := repo.SaveDeck(userID, "stoics", "tag:stoicism is:due")
+
+	if err != nil {
+		t.Fatalf("SaveDeck failed: %v", err)
+	}
+
+	if _, err := repo.SaveDeck(userID, "hard", "lapses>=3"); err != nil {
+		t.Fatalf("SaveDeck failed: %v", err)
+	}
+
+	decks, err := repo.GetDecks(userID)
+
+	if err != nil || len(decks) != 2 || decks[0].Name != "hard" || decks[1].Query != "tag:stoicism is:due" {
+		t.Errorf("decks = %+v (%v), want hard and the updated stoics", decks, err)
+	}
+
+	if deck, err := repo.GetDeck(userID, int(saved.ID)); err != nil || deck.Name != "stoics" {
+		t.Errorf("GetDeck = %+v, %v, want the stoics deck", deck, err)
+	}
+
+	if _, err := repo.GetDeck(userID+1, int(saved.ID)); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("GetDeck of another user = %v, want ErrRecordNotFound", err)
+	}
+
+	if err := repo.DeleteDeck(userID, "stoics"); err != nil {
+		t.Fatalf("DeleteDeck failed: %v", err)
+	}
+
+	if err := repo.DeleteDeck(userID, "stoics"); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("deleting a deleted deck = %v, want ErrRecordNotFound", err)
+	}
+
+	// The name can be used again
+	if _, err := repo.SaveDeck(userID, "stoics", "tag:stoicism"); err != nil {
+		t.Errorf("saving a deck under a deleted name failed: %v", err)
+	}
+}
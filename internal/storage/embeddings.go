@@ -0,0 +1,175 @@
+package storage
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// setupPgvector enables the pgvector extension and adds the vector column to
+// the embeddings, returning false when the extension isn't available
+func setupPgvector(db *gorm.DB) bool {
+	if err := db.Exec("CREATE EXTENSION IF NOT EXISTS vector").Error; err != nil {
+		log.Printf("pgvector is not available, using the in-memory search index: %v", err)
+		return false
+	}
+
+	if err := db.Exec("ALTER TABLE note_embeddings ADD COLUMN IF NOT EXISTS embedding vector").Error; err != nil {
+		log.Printf("failed to add the embedding column, using the in-memory search index: %v", err)
+		return false
+	}
+
+	return true
+}
+
+// HasPgvector returns whether SearchEmbeddings can be used
+func (repo Repository) HasPgvector() bool {
+	return repo.pgvector
+}
+
+// vectorLiteral formats a vector the way pgvector parses it, e.g. [1,2,3]
+func vectorLiteral(vector []float32) string {
+	values := make([]string, len(vector))
+
+	for i, value := range vector {
+		values[i] = strconv.FormatFloat(float64(value), 'f', -1, 32)
+	}
+
+	return "[" + strings.Join(values, ",") + "]"
+}
+
+func (repo Repository) SaveEmbedding(noteID int, model string, vector []float32) error {
+	embedding := NoteEmbedding{
+		NoteID:     noteID,
+		EmbedModel: model,
+		Dimensions: len(vector),
+		Vector:     vector,
+	}
+
+	err := repo.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "note_id"}},
+			DoUpdates: clause.AssignmentColumns([]string{"embed_model", "dimensions", "vector", "updated_at", "deleted_at"}),
+		}).Create(&embedding)
+
+		if result.Error != nil || !repo.pgvector {
+			return result.Error
+		}
+
+		return tx.Exec("UPDATE note_embeddings SET embedding = ?::vector WHERE note_id = ?", vectorLiteral(vector), noteID).Error
+	})
+
+	if err != nil {
+		return fmt.Errorf("failed to save embedding of note %d: %w", noteID, err)
+	}
+
+	return nil
+}
+
+// GetEmbedding returns the embedding of a note made with model, or nil when
+// it wasn't embedded yet
+func (repo Repository) GetEmbedding(noteID int, model string) (*NoteEmbedding, error) {
+	var embedding NoteEmbedding
+
+	result := repo.db.Where("note_id = ? AND embed_model = ?", noteID, model).Limit(1).Find(&embedding)
+
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to get embedding of note %d: %w", noteID, result.Error)
+	}
+
+	if result.RowsAffected == 0 {
+		return nil, nil
+	}
+
+	return &embedding, nil
+}
+
+// DeleteEmbedding drops the embedding of a note whose content changed, so
+// that it gets embedded again
+func (repo Repository) DeleteEmbedding(noteID int) error {
+	if err := repo.db.Where("note_id = ?", noteID).Delete(&NoteEmbedding{}).Error; err != nil {
+		return fmt.Errorf("failed to delete embedding of note %d: %w", noteID, err)
+	}
+
+	return nil
+}
+
+// GetEmbeddings returns every embedding made with model
+func (repo Repository) GetEmbeddings(model string) ([]NoteEmbedding, error) {
+	var embeddings []NoteEmbedding
+
+	result := repo.db.Where("embed_model = ?", model).Find(&embeddings)
+
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to get embeddings: %w", result.Error)
+	}
+
+	return embeddings, nil
+}
+
+// GetNotesWithoutEmbedding returns up to limit notes not embedded with model
+// yet
+func (repo Repository) GetNotesWithoutEmbedding(model string, limit int) ([]Note, error) {
+	var notes []Note
+
+	result := repo.db.
+		Where("NOT EXISTS (SELECT 1 FROM note_embeddings WHERE note_embeddings.note_id = notes.id AND note_embeddings.embed_model = ? AND note_embeddings.deleted_at IS NULL)", model).
+		Order("id").
+		Limit(limit).
+		Find(&notes)
+
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to get notes without embedding: %w", result.Error)
+	}
+
+	return notes, nil
+}
+
+type EmbeddingMatch struct {
+	NoteID int
+	// Cosine similarity to the query
+	Score float64
+}
+
+// SearchEmbeddings returns the limit notes closest to vector with pgvector,
+// leaving out the notes of excludeSourceID unless it is 0
+func (repo Repository) SearchEmbeddings(model string, vector []float32, excludeSourceID int, limit int) ([]EmbeddingMatch, error) {
+	if !repo.pgvector {
+		return nil, fmt.Errorf("pgvector is not available")
+	}
+
+	var matches []EmbeddingMatch
+
+	result := repo.db.Raw(
+		"SELECT note_embeddings.note_id, 1 - (embedding <=> ?::vector) AS score "+
+			"FROM note_embeddings JOIN notes ON notes.id = note_embeddings.note_id "+
+			"WHERE note_embeddings.embed_model = ? AND note_embeddings.dimensions = ? "+
+			"AND note_embeddings.deleted_at IS NULL AND notes.deleted_at IS NULL "+
+			"AND notes.source_id <> ? "+
+			"ORDER BY embedding <=> ?::vector LIMIT ?",
+		vectorLiteral(vector), model, len(vector), excludeSourceID, vectorLiteral(vector), limit,
+	).Scan(&matches)
+
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to search embeddings: %w", result.Error)
+	}
+
+	return matches, nil
+}
+
+// GetNotesByIDs returns the notes with their source, in no particular order
+func (repo Repository) GetNotesByIDs(ids []int) ([]Note, error) {
+	var notes []Note
+
+	result := repo.db.Preload("Source").Where("id IN ?", ids).Find(&notes)
+
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to get notes: %w", result.Error)
+	}
+
+	return notes, nil
+}
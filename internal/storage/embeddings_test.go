@@ -0,0 +1,98 @@
+package storage
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+)
+
+func TestVectorLiteral(t *testing.T) {
+	if got, want := vectorLiteral([]float32{1, -0.5, 0.125}), "[1,-0.5,0.125]"; got != want {
+		t.Errorf("vectorLiteral = %v, want %v", got, want)
+	}
+
+	if got, want := vectorLiteral(nil), "[]"; got != want {
+		t.Errorf("vectorLiteral of no vector = %v, want %v", got, want)
+	}
+}
+
+func TestEmbeddings(t *testing.T) {
+	repo, db := testRepository(t)
+	model := fmt.Sprintf("test-%v", testUserID())
+
+	note := Note{Content: "Embedded highlight", SourceID: int(testUserID() % 1000000000)}
+
+	if err := db.Create(&note).Error; err != nil {
+		t.Fatalf("failed to create note: %v", err)
+	}
+
+	t.Cleanup(func() {
+		db.Unscoped().Where("note_id = ?", note.ID).Delete(&NoteEmbedding{})
+		db.Unscoped().Delete(&note)
+	})
+
+	pending := func() bool {
+		notes, err := repo.GetNotesWithoutEmbedding(model, 100000)
+
+		if err != nil {
+			t.Fatalf("GetNotesWithoutEmbedding failed: %v", err)
+		}
+
+		return slices.ContainsFunc(notes, func(n Note) bool { return n.ID == note.ID })
+	}
+
+	if !pending() {
+		t.Fatal("a new note isn't waiting for its embedding")
+	}
+
+	for _, vector := range [][]float32{{1, 0}, {0.6, 0.8}} {
+		if err := repo.SaveEmbedding(int(note.ID), model, vector); err != nil {
+			t.Fatalf("SaveEmbedding failed: %v", err)
+		}
+	}
+
+	if pending() {
+		t.Error("an embedded note is still waiting for its embedding")
+	}
+
+	embeddings, err := repo.GetEmbeddings(model)
+
+	if err != nil {
+		t.Fatalf("GetEmbeddings failed: %v", err)
+	}
+
+	// Saving again replaces the vector
+	if len(embeddings) != 1 || !slices.Equal(embeddings[0].Vector, []float32{0.6, 0.8}) || embeddings[0].Dimensions != 2 {
+		t.Errorf("embeddings = %+v, want the last vector of the note", embeddings)
+	}
+
+	embedding, err := repo.GetEmbedding(int(note.ID), model)
+
+	if err != nil || embedding == nil || !slices.Equal(embedding.Vector, []float32{0.6, 0.8}) {
+		t.Errorf("GetEmbedding = %+v, %v, want the vector of the note", embedding, err)
+	}
+
+	if embedding, err := repo.GetEmbedding(int(note.ID), model+" other"); err != nil || embedding != nil {
+		t.Errorf("GetEmbedding of another model = %+v, %v, want none", embedding, err)
+	}
+
+	if !repo.HasPgvector() {
+		return
+	}
+
+	matches, err := repo.SearchEmbeddings(model, []float32{0.6, 0.8}, 0, 5)
+
+	if err != nil {
+		t.Fatalf("SearchEmbeddings failed: %v", err)
+	}
+
+	if len(matches) != 1 || matches[0].NoteID != int(note.ID) || matches[0].Score < 0.999 {
+		t.Errorf("matches = %+v, want the note with a score of 1", matches)
+	}
+
+	matches, err = repo.SearchEmbeddings(model, []float32{0.6, 0.8}, note.SourceID, 5)
+
+	if err != nil || len(matches) != 0 {
+		t.Errorf("matches outside the note's source = %+v, %v, want none", matches, err)
+	}
+}
@@ -0,0 +1,47 @@
+package storage
+
+import (
+	"fmt"
+)
+
+func (repo Repository) InsertQuestionFeedback(feedback QuestionFeedback) error {
+	result := repo.db.Create(&feedback)
+
+	if result.Error != nil {
+		return fmt.Errorf("failed to log question feedback: %w", result.Error)
+	}
+
+	return nil
+}
+
+// GetRejectedQuestions returns the questions of a note the user rejected or
+// asked to regenerate, oldest first
+func (repo Repository) GetRejectedQuestions(noteID int) ([]QuestionFeedback, error) {
+	var feedback []QuestionFeedback
+
+	result := repo.db.
+		Where("note_id = ? AND action IN ?", noteID, []string{QuestionFeedbackRejected, QuestionFeedbackRegenerated}).
+		Order("created_at").
+		Find(&feedback)
+
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to get rejected questions of note %d: %w", noteID, result.Error)
+	}
+
+	return feedback, nil
+}
+
+// SetClozeQuestion replaces the cloze question of a note, clearing it when
+// both are empty
+func (repo Repository) SetClozeQuestion(noteID int, question string, answer string) (*Note, error) {
+	result := repo.db.Model(&Note{}).Where("id = ?", noteID).Updates(map[string]interface{}{
+		"question": question,
+		"answer":   answer,
+	})
+
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to update question of note %d: %w", noteID, result.Error)
+	}
+
+	return repo.GetNote(noteID)
+}
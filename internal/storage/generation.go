@@ -0,0 +1,253 @@
+package storage
+
+import (
+	"fmt"
+	"slices"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// failedJobCooldown is how long a failed job is left alone before enqueuing
+// it again starts it over, so a note the LLM keeps failing on isn't retried
+// every time the upcoming notes are enqueued
+const failedJobCooldown = 24 * time.Hour
+
+// EnqueueGenerationJobs adds pending jobs for the given notes. Jobs already
+// pending or running are left alone, done ones start over, as callers only
+// enqueue questions that are missing. Failed ones start over once they have
+// cooled down.
+func (repo Repository) EnqueueGenerationJobs(jobs []GenerationJob) (int, error) {
+	return repo.enqueueGenerationJobs(jobs, time.Now().Add(-failedJobCooldown))
+}
+
+// RetryGenerationJobs is EnqueueGenerationJobs for questions the user asked
+// for, failed jobs start over right away
+func (repo Repository) RetryGenerationJobs(jobs []GenerationJob) (int, error) {
+	return repo.enqueueGenerationJobs(jobs, time.Now())
+}
+
+// enqueueGenerationJobs restarts the failed jobs last updated before
+// failedBefore
+func (repo Repository) enqueueGenerationJobs(jobs []GenerationJob, failedBefore time.Time) (int, error) {
+	if len(jobs) == 0 {
+		return 0, nil
+	}
+
+	now := time.Now()
+
+	for i := range jobs {
+		jobs[i].Status = GenerationStatusPending
+		jobs[i].Attempts = 0
+		jobs[i].NextAttemptAt = now
+	}
+
+	result := repo.db.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "note_id"}, {Name: "kind"}, {Name: "card_type"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"status":          GenerationStatusPending,
+			"attempts":        0,
+			"last_error":      "",
+			"next_attempt_at": now,
+			"updated_at":      now,
+		}),
+		Where: clause.Where{Exprs: []clause.Expression{clause.Expr{
+			SQL:  "generation_jobs.status = ? OR (generation_jobs.status = ? AND generation_jobs.updated_at < ?)",
+			Vars: []interface{}{GenerationStatusDone, GenerationStatusFailed, failedBefore},
+		}}},
+	}).Create(&jobs)
+
+	if result.Error != nil {
+		return 0, fmt.Errorf("failed to enqueue generation jobs: %w", result.Error)
+	}
+
+	return int(result.RowsAffected), nil
+}
+
+// ClaimGenerationJobs marks up to limit pending jobs whose next attempt is
+// due as running and returns them. Jobs locked by another claim are skipped.
+func (repo Repository) ClaimGenerationJobs(limit int) ([]GenerationJob, error) {
+	var jobs []GenerationJob
+
+	err := repo.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("status = ? AND next_attempt_at <= ?", GenerationStatusPending, time.Now()).
+			Order("next_attempt_at").
+			Limit(limit).
+			Find(&jobs)
+
+		if result.Error != nil {
+			return result.Error
+		}
+
+		if len(jobs) == 0 {
+			return nil
+		}
+
+		ids := []uint{}
+		for i := range jobs {
+			ids = append(ids, jobs[i].ID)
+			jobs[i].Status = GenerationStatusRunning
+			jobs[i].Attempts++
+		}
+
+		return tx.Model(&GenerationJob{}).
+			Where("id IN ?", ids).
+			Updates(map[string]interface{}{
+				"status":   GenerationStatusRunning,
+				"attempts": gorm.Expr("attempts + 1"),
+			}).Error
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim generation jobs: %w", err)
+	}
+
+	return jobs, nil
+}
+
+func (repo Repository) CompleteGenerationJob(id uint) error {
+	result := repo.db.Model(&GenerationJob{}).
+		Where("id = ?", id).
+		Updates(map[string]interface{}{
+			"status":     GenerationStatusDone,
+			"last_error": "",
+		})
+
+	if result.Error != nil {
+		return fmt.Errorf("failed to complete generation job %d: %w", id, result.Error)
+	}
+
+	return nil
+}
+
+// FailGenerationJob records the error of an attempt. The job is retried at
+// retryAt, or marked as failed for good when retryAt is nil.
+func (repo Repository) FailGenerationJob(id uint, jobErr error, retryAt *time.Time) error {
+	updates := map[string]interface{}{
+		"status":     GenerationStatusFailed,
+		"last_error": jobErr.Error(),
+	}
+
+	if retryAt != nil {
+		updates["status"] = GenerationStatusPending
+		updates["next_attempt_at"] = *retryAt
+	}
+
+	result := repo.db.Model(&GenerationJob{}).Where("id = ?", id).Updates(updates)
+
+	if result.Error != nil {
+		return fmt.Errorf("failed to update generation job %d: %w", id, result.Error)
+	}
+
+	return nil
+}
+
+// PostponeGenerationJob puts a job back in the queue until the given time,
+// without counting the attempt
+func (repo Repository) PostponeGenerationJob(id uint, until time.Time) error {
+	result := repo.db.Model(&GenerationJob{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"status":          GenerationStatusPending,
+		"attempts":        gorm.Expr("GREATEST(attempts - 1, 0)"),
+		"next_attempt_at": until,
+	})
+
+	if result.Error != nil {
+		return fmt.Errorf("failed to postpone generation job %d: %w", id, result.Error)
+	}
+
+	return nil
+}
+
+// RequeueRunningGenerationJobs puts back the jobs left running when the bot
+// stopped
+func (repo Repository) RequeueRunningGenerationJobs() (int, error) {
+	result := repo.db.Model(&GenerationJob{}).
+		Where("status = ?", GenerationStatusRunning).
+		Update("status", GenerationStatusPending)
+
+	if result.Error != nil {
+		return 0, fmt.Errorf("failed to requeue generation jobs: %w", result.Error)
+	}
+
+	return int(result.RowsAffected), nil
+}
+
+// locationKey is the first number of a highlight location, which orders the
+// highlights within a source
+const locationKey = "COALESCE(substring(notes.location from '[0-9]+')::bigint, 0)"
+
+// GetNeighbourNotes returns up to limit notes of the same source on each
+// side of a note, ordered by location
+func (repo Repository) GetNeighbourNotes(note Note, limit int) ([]Note, []Note, error) {
+	var before, after []Note
+
+	position := "(" + locationKey + ", notes.id) %s (COALESCE(substring(?::text from '[0-9]+')::bigint, 0), ?)"
+
+	result := repo.db.
+		Where("notes.source_id = ?", note.SourceID).
+		Where(fmt.Sprintf(position, "<"), note.Location, note.ID).
+		Order(locationKey + " DESC, notes.id DESC").
+		Limit(limit).
+		Find(&before)
+
+	if result.Error != nil {
+		return nil, nil, fmt.Errorf("failed to get highlights before note %d: %w", note.ID, result.Error)
+	}
+
+	result = repo.db.
+		Where("notes.source_id = ?", note.SourceID).
+		Where(fmt.Sprintf(position, ">"), note.Location, note.ID).
+		Order(locationKey + ", notes.id").
+		Limit(limit).
+		Find(&after)
+
+	if result.Error != nil {
+		return nil, nil, fmt.Errorf("failed to get highlights after note %d: %w", note.ID, result.Error)
+	}
+
+	slices.Reverse(before)
+
+	return before, after, nil
+}
+
+// GetNotesMissingCloze returns the reviewable notes of sources with cloze
+// questions enabled that have no question yet and are due before dueBefore
+// or new
+func (repo Repository) GetNotesMissingCloze(dueBefore time.Time) ([]Note, error) {
+	var notes []Note
+
+	result := repo.db.
+		Joins("JOIN sources ON notes.source_id = sources.id").
+		Where("sources.cloze_question AND COALESCE(notes.question, '') = ''").
+		Where("next_due_date < ? OR next_due_date IS NULL", dueBefore).
+		Scopes(reviewable).
+		Find(&notes)
+
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to get notes missing cloze questions: %w", result.Error)
+	}
+
+	return notes, nil
+}
+
+func (repo Repository) SetSourceCloze(id int, enabled bool) error {
+	result := repo.db.Model(&Source{}).Where("id = ?", id).Update("cloze_question", enabled)
+
+	if result.Error != nil {
+		return fmt.Errorf("failed to update cloze questions of source %d: %w", id, result.Error)
+	}
+
+	return nil
+}
+
+func (repo Repository) SetSourceSystemPrompt(id int, prompt string) error {
+	result := repo.db.Model(&Source{}).Where("id = ?", id).Update("system_prompt", prompt)
+
+	if result.Error != nil {
+		return fmt.Errorf("failed to update system prompt of source %d: %w", id, result.Error)
+	}
+
+	return nil
+}
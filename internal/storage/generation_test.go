@@ -0,0 +1,191 @@
+package storage
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// claimJob claims the due jobs and returns the one of the note, if claimed
+func claimJob(t *testing.T, repo *Repository, noteID int) *GenerationJob {
+	t.Helper()
+
+	jobs, err := repo.ClaimGenerationJobs(1000)
+
+	if err != nil {
+		t.Fatalf("ClaimGenerationJobs failed: %v", err)
+	}
+
+	for _, job := range jobs {
+		if job.NoteID == noteID {
+			return &job
+		}
+	}
+
+	return nil
+}
+
+func TestGenerationJobs(t *testing.T) {
+	repo, db := testRepository(t)
+	noteID := int(testUserID() % 1000000000)
+
+	t.Cleanup(func() {
+		db.Unscoped().Where("note_id = ?", noteID).Delete(&GenerationJob{})
+	})
+
+	enqueue := func() int {
+		queued, err := repo.EnqueueGenerationJobs([]GenerationJob{{NoteID: noteID, Kind: GenerationKindCloze}})
+
+		if err != nil {
+			t.Fatalf("EnqueueGenerationJobs failed: %v", err)
+		}
+
+		return queued
+	}
+
+	if queued := enqueue(); queued != 1 {
+		t.Fatalf("queued %v jobs, want 1", queued)
+	}
+
+	// A pending job isn't queued twice
+	if queued := enqueue(); queued != 0 {
+		t.Errorf("queued %v jobs again while pending, want 0", queued)
+	}
+
+	job := claimJob(t, repo, noteID)
+
+	if job == nil || job.Status != GenerationStatusRunning || job.Attempts != 1 {
+		t.Fatalf("claimed job = %+v, want it running on its first attempt", job)
+	}
+
+	if claimJob(t, repo, noteID) != nil {
+		t.Error("a running job was claimed again")
+	}
+
+	retryAt := time.Now().Add(time.Hour)
+
+	if err := repo.FailGenerationJob(job.ID, errors.New("timeout"), &retryAt); err != nil {
+		t.Fatalf("FailGenerationJob failed: %v", err)
+	}
+
+	if claimJob(t, repo, noteID) != nil {
+		t.Error("a job was claimed before its retry")
+	}
+
+	if err := repo.FailGenerationJob(job.ID, errors.New("timeout"), nil); err != nil {
+		t.Fatalf("FailGenerationJob failed: %v", err)
+	}
+
+	var failed GenerationJob
+	if err := db.First(&failed, job.ID).Error; err != nil {
+		t.Fatalf("failed to get job: %v", err)
+	}
+
+	if failed.Status != GenerationStatusFailed || failed.LastError != "timeout" {
+		t.Errorf("job = %v (%q), want it failed with the error", failed.Status, failed.LastError)
+	}
+
+	// Failed jobs cool down before they are queued again
+	if queued := enqueue(); queued != 0 {
+		t.Errorf("queued %v jobs right after a failure, want 0", queued)
+	}
+
+	db.Model(&GenerationJob{}).Where("id = ?", job.ID).UpdateColumn("updated_at", time.Now().Add(-failedJobCooldown-time.Minute))
+
+	if queued := enqueue(); queued != 1 {
+		t.Errorf("queued %v jobs after the cooldown, want 1", queued)
+	}
+
+	job = claimJob(t, repo, noteID)
+
+	if job == nil || job.Attempts != 1 {
+		t.Fatalf("claimed job = %+v, want it on its first attempt again", job)
+	}
+
+	if err := repo.FailGenerationJob(job.ID, errors.New("timeout"), nil); err != nil {
+		t.Fatalf("FailGenerationJob failed: %v", err)
+	}
+
+	// Questions the user asks for don't wait for the cooldown
+	queued, err := repo.RetryGenerationJobs([]GenerationJob{{NoteID: noteID, Kind: GenerationKindCloze}})
+
+	if err != nil || queued != 1 {
+		t.Errorf("RetryGenerationJobs queued %v jobs (%v), want 1", queued, err)
+	}
+
+	job = claimJob(t, repo, noteID)
+
+	if job == nil {
+		t.Fatal("the retried job wasn't claimed")
+	}
+
+	if err := repo.CompleteGenerationJob(job.ID); err != nil {
+		t.Fatalf("CompleteGenerationJob failed: %v", err)
+	}
+
+	if claimJob(t, repo, noteID) != nil {
+		t.Error("a done job was claimed")
+	}
+}
+
+func TestPostponeGenerationJob(t *testing.T) {
+	repo, db := testRepository(t)
+	noteID := int(testUserID() % 1000000000)
+
+	t.Cleanup(func() {
+		db.Unscoped().Where("note_id = ?", noteID).Delete(&GenerationJob{})
+	})
+
+	if _, err := repo.EnqueueGenerationJobs([]GenerationJob{{NoteID: noteID, Kind: GenerationKindPrompt}}); err != nil {
+		t.Fatalf("EnqueueGenerationJobs failed: %v", err)
+	}
+
+	job := claimJob(t, repo, noteID)
+
+	if job == nil {
+		t.Fatal("the job wasn't claimed")
+	}
+
+	if err := repo.PostponeGenerationJob(job.ID, time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("PostponeGenerationJob failed: %v", err)
+	}
+
+	if claimJob(t, repo, noteID) != nil {
+		t.Error("a postponed job was claimed before its time")
+	}
+
+	var postponed GenerationJob
+	if err := db.First(&postponed, job.ID).Error; err != nil {
+		t.Fatalf("failed to get job: %v", err)
+	}
+
+	// The attempt isn't counted
+	if postponed.Status != GenerationStatusPending || postponed.Attempts != 0 {
+		t.Errorf("job = %v after %v attempts, want it pending without attempts", postponed.Status, postponed.Attempts)
+	}
+}
+
+func TestRequeueRunningGenerationJobs(t *testing.T) {
+	repo, db := testRepository(t)
+	noteID := int(testUserID() % 1000000000)
+
+	t.Cleanup(func() {
+		db.Unscoped().Where("note_id = ?", noteID).Delete(&GenerationJob{})
+	})
+
+	if _, err := repo.EnqueueGenerationJobs([]GenerationJob{{NoteID: noteID, Kind: GenerationKindQuiz}}); err != nil {
+		t.Fatalf("EnqueueGenerationJobs failed: %v", err)
+	}
+
+	if claimJob(t, repo, noteID) == nil {
+		t.Fatal("the job wasn't claimed")
+	}
+
+	if _, err := repo.RequeueRunningGenerationJobs(); err != nil {
+		t.Fatalf("RequeueRunningGenerationJobs failed: %v", err)
+	}
+
+	if claimJob(t, repo, noteID) == nil {
+		t.Error("the interrupted job wasn't requeued")
+	}
+}
@@ -0,0 +1,160 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Namespace for the advisory locks taken on scheduled jobs, so they don't
+// collide with other users of pg_advisory_lock on the same database
+const jobLockNamespace = 7001
+
+// SyncReminderJobs makes the user's reminder jobs match the given cron specs,
+// keyed by name. Existing jobs keep their last run timestamp.
+func (repo Repository) SyncReminderJobs(userID int64, timezone string, specs map[string]string) ([]ScheduledJob, error) {
+	names := []string{}
+
+	for name, spec := range specs {
+		names = append(names, name)
+
+		job := ScheduledJob{
+			UserID:   userID,
+			Name:     name,
+			Kind:     JobKindReminder,
+			Spec:     spec,
+			Timezone: timezone,
+		}
+
+		result := repo.db.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "user_id"}, {Name: "name"}},
+			DoUpdates: clause.AssignmentColumns([]string{"spec", "timezone", "updated_at", "deleted_at"}),
+		}).Create(&job)
+
+		if result.Error != nil {
+			return nil, fmt.Errorf("failed to save reminder job %v: %w", name, result.Error)
+		}
+	}
+
+	stale := repo.db.Unscoped().Where("user_id = ? AND kind = ?", userID, JobKindReminder)
+	if len(names) > 0 {
+		stale = stale.Where("name NOT IN ?", names)
+	}
+
+	if err := stale.Delete(&ScheduledJob{}).Error; err != nil {
+		return nil, fmt.Errorf("failed to remove stale reminder jobs: %w", err)
+	}
+
+	var jobs []ScheduledJob
+
+	result := repo.db.Where("user_id = ? AND kind = ?", userID, JobKindReminder).Find(&jobs)
+
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to get reminder jobs: %w", result.Error)
+	}
+
+	return jobs, nil
+}
+
+func (repo Repository) GetJobs(kind string) ([]ScheduledJob, error) {
+	var jobs []ScheduledJob
+
+	result := repo.db.Where("kind = ?", kind).Order("id ASC").Find(&jobs)
+
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to get %v jobs: %w", kind, result.Error)
+	}
+
+	return jobs, nil
+}
+
+// SaveSnoozeJob replaces the pending snooze of a user
+func (repo Repository) SaveSnoozeJob(userID int64, runAt time.Time) (ScheduledJob, error) {
+	job := ScheduledJob{
+		UserID: userID,
+		Name:   JobKindSnooze,
+		Kind:   JobKindSnooze,
+		RunAt:  &runAt,
+	}
+
+	result := repo.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}, {Name: "name"}},
+		DoUpdates: clause.AssignmentColumns([]string{"run_at", "updated_at", "deleted_at"}),
+	}).Create(&job)
+
+	if result.Error != nil {
+		return ScheduledJob{}, fmt.Errorf("failed to save snooze job: %w", result.Error)
+	}
+
+	if err := repo.db.Where("user_id = ? AND name = ?", userID, JobKindSnooze).First(&job).Error; err != nil {
+		return ScheduledJob{}, fmt.Errorf("failed to get snooze job: %w", err)
+	}
+
+	return job, nil
+}
+
+// GetSnoozeJob returns the pending snooze of a user, or nil if there is none
+func (repo Repository) GetSnoozeJob(userID int64) (*ScheduledJob, error) {
+	var job ScheduledJob
+
+	result := repo.db.Where("user_id = ? AND kind = ?", userID, JobKindSnooze).First(&job)
+
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get snooze job: %w", result.Error)
+	}
+
+	return &job, nil
+}
+
+func (repo Repository) DeleteJob(id uint) error {
+	if err := repo.db.Unscoped().Delete(&ScheduledJob{}, id).Error; err != nil {
+		return fmt.Errorf("failed to delete job %d: %w", id, err)
+	}
+
+	return nil
+}
+
+// ClaimJobRun marks the occurrence of a job scheduled for scheduledFor as run.
+// It returns false if the occurrence was already claimed, by this process or
+// by another replica holding the job's advisory lock.
+func (repo Repository) ClaimJobRun(id uint, scheduledFor time.Time) (bool, error) {
+	claimed := false
+
+	err := repo.db.Transaction(func(tx *gorm.DB) error {
+		var locked bool
+
+		if err := tx.Raw("SELECT pg_try_advisory_xact_lock(?, ?)", jobLockNamespace, int32(id)).Scan(&locked).Error; err != nil {
+			return fmt.Errorf("failed to lock job %d: %w", id, err)
+		}
+
+		if !locked {
+			return nil
+		}
+
+		var job ScheduledJob
+
+		if err := tx.First(&job, id).Error; err != nil {
+			return fmt.Errorf("failed to get job %d: %w", id, err)
+		}
+
+		if job.LastRunAt != nil && !job.LastRunAt.Before(scheduledFor) {
+			return nil
+		}
+
+		if err := tx.Model(&job).Update("last_run_at", time.Now()).Error; err != nil {
+			return fmt.Errorf("failed to update job %d: %w", id, err)
+		}
+
+		claimed = true
+
+		return nil
+	})
+
+	return claimed, err
+}
@@ -0,0 +1,139 @@
+package storage
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSyncReminderJobs(t *testing.T) {
+	repo, db := testRepository(t)
+	userID := testUserID()
+
+	t.Cleanup(func() {
+		db.Unscoped().Where("user_id = ?", userID).Delete(&ScheduledJob{})
+	})
+
+	jobs, err := repo.SyncReminderJobs(userID, "UTC", map[string]string{
+		"reminder_08:00": "CRON_TZ=UTC 0 8 * * *",
+		"reminder_20:00": "CRON_TZ=UTC 0 20 * * *",
+	})
+
+	if err != nil {
+		t.Fatalf("SyncReminderJobs failed: %v", err)
+	}
+
+	if len(jobs) != 2 {
+		t.Fatalf("SyncReminderJobs returned %v jobs, want 2", len(jobs))
+	}
+
+	var kept ScheduledJob
+	for _, job := range jobs {
+		if job.Name == "reminder_20:00" {
+			kept = job
+		}
+	}
+
+	if _, err := repo.ClaimJobRun(kept.ID, time.Now()); err != nil {
+		t.Fatalf("ClaimJobRun failed: %v", err)
+	}
+
+	jobs, err = repo.SyncReminderJobs(userID, "Asia/Kolkata", map[string]string{
+		"reminder_20:00": "CRON_TZ=Asia/Kolkata 0 20 * * *",
+	})
+
+	if err != nil {
+		t.Fatalf("SyncReminderJobs failed: %v", err)
+	}
+
+	if len(jobs) != 1 || jobs[0].Name != "reminder_20:00" {
+		t.Fatalf("SyncReminderJobs = %v, want only reminder_20:00", jobs)
+	}
+
+	if jobs[0].ID != kept.ID || jobs[0].LastRunAt == nil {
+		t.Errorf("the 20:00 reminder was recreated, want it kept with its last run")
+	}
+
+	if jobs[0].Timezone != "Asia/Kolkata" || jobs[0].Spec != "CRON_TZ=Asia/Kolkata 0 20 * * *" {
+		t.Errorf("reminder = %v in %v, want the new spec and time zone", jobs[0].Spec, jobs[0].Timezone)
+	}
+}
+
+func TestClaimJobRun(t *testing.T) {
+	repo, db := testRepository(t)
+	userID := testUserID()
+
+	t.Cleanup(func() {
+		db.Unscoped().Where("user_id = ?", userID).Delete(&ScheduledJob{})
+	})
+
+	jobs, err := repo.SyncReminderJobs(userID, "UTC", map[string]string{
+		"reminder_08:00": "CRON_TZ=UTC 0 8 * * *",
+	})
+
+	if err != nil {
+		t.Fatalf("SyncReminderJobs failed: %v", err)
+	}
+
+	scheduledFor := time.Now().Truncate(time.Minute)
+
+	for i, want := range []bool{true, false} {
+		claimed, err := repo.ClaimJobRun(jobs[0].ID, scheduledFor)
+
+		if err != nil {
+			t.Fatalf("ClaimJobRun failed: %v", err)
+		}
+
+		if claimed != want {
+			t.Errorf("claim %v = %v, want %v", i+1, claimed, want)
+		}
+	}
+
+	// The next occurrence can be claimed again
+	if claimed, err := repo.ClaimJobRun(jobs[0].ID, scheduledFor.Add(24*time.Hour)); err != nil || !claimed {
+		t.Errorf("claim of the next occurrence = %v (%v), want true", claimed, err)
+	}
+}
+
+func TestSnoozeJob(t *testing.T) {
+	repo, db := testRepository(t)
+	userID := testUserID()
+
+	t.Cleanup(func() {
+		db.Unscoped().Where("user_id = ?", userID).Delete(&ScheduledJob{})
+	})
+
+	if job, err := repo.GetSnoozeJob(userID); err != nil || job != nil {
+		t.Fatalf("GetSnoozeJob = %v (%v), want none", job, err)
+	}
+
+	first := time.Now().Add(time.Hour).Truncate(time.Second)
+	second := first.Add(time.Hour)
+
+	if _, err := repo.SaveSnoozeJob(userID, first); err != nil {
+		t.Fatalf("SaveSnoozeJob failed: %v", err)
+	}
+
+	saved, err := repo.SaveSnoozeJob(userID, second)
+
+	if err != nil {
+		t.Fatalf("SaveSnoozeJob failed: %v", err)
+	}
+
+	job, err := repo.GetSnoozeJob(userID)
+
+	if err != nil || job == nil {
+		t.Fatalf("GetSnoozeJob = %v (%v), want the snooze", job, err)
+	}
+
+	if job.ID != saved.ID || !job.RunAt.Equal(second) {
+		t.Errorf("snooze runs at %v, want it replaced by %v", job.RunAt, second)
+	}
+
+	if err := repo.DeleteJob(job.ID); err != nil {
+		t.Fatalf("DeleteJob failed: %v", err)
+	}
+
+	if job, err := repo.GetSnoozeJob(userID); err != nil || job != nil {
+		t.Errorf("GetSnoozeJob after DeleteJob = %v (%v), want none", job, err)
+	}
+}
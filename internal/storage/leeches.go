@@ -0,0 +1,77 @@
+package storage
+
+import (
+	"fmt"
+)
+
+// GetLeeches returns the leeches with their source, most lapsed first
+func (repo Repository) GetLeeches() ([]Note, error) {
+	var notes []Note
+
+	result := repo.db.Preload("Source").Where("leech").Order("lapses DESC, id").Find(&notes)
+
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to get leeches: %w", result.Error)
+	}
+
+	return notes, nil
+}
+
+// ReleaseLeech clears the leech flag and the lapses of a note and brings it
+// back to reviews, keeping its schedule
+func (repo Repository) ReleaseLeech(noteID int) error {
+	result := repo.db.Model(&Note{}).Where("id = ?", noteID).Updates(map[string]interface{}{
+		"lapses":    0,
+		"leech":     false,
+		"suspended": false,
+	})
+
+	if result.Error != nil {
+		return fmt.Errorf("failed to release leech %d: %w", noteID, result.Error)
+	}
+
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("note with id %d not found", noteID)
+	}
+
+	return nil
+}
+
+// ResetNote makes a note new again, clearing its lapses and leech flag
+func (repo Repository) ResetNote(noteID int) error {
+	result := repo.db.Model(&Note{}).Where("id = ?", noteID).Updates(map[string]interface{}{
+		"next_due_date":   nil,
+		"last_reviewed":   nil,
+		"interval":        0,
+		"easiness_factor": nil,
+		"review_count":    0,
+		"lapses":          0,
+		"leech":           false,
+		"suspended":       false,
+	})
+
+	if result.Error != nil {
+		return fmt.Errorf("failed to reset note %d: %w", noteID, result.Error)
+	}
+
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("note with id %d not found", noteID)
+	}
+
+	return nil
+}
+
+// DeleteNote soft deletes a note
+func (repo Repository) DeleteNote(noteID int) error {
+	result := repo.db.Delete(&Note{}, noteID)
+
+	if result.Error != nil {
+		return fmt.Errorf("failed to delete note %d: %w", noteID, result.Error)
+	}
+
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("note with id %d not found", noteID)
+	}
+
+	return nil
+}
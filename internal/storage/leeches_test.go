@@ -0,0 +1,91 @@
+package storage
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestLeeches(t *testing.T) {
+	repo, db := testRepository(t)
+
+	due := time.Now().AddDate(0, 0, 2)
+	easiness := 1.3
+
+	notes := []Note{
+		{Content: "Leech", Lapses: 8, Leech: true, Suspended: true, NextDueDate: &due, EasinessFactor: &easiness, ReviewCount: 12, Interval: 2},
+		{Content: "Worse leech", Lapses: 11, Leech: true, Suspended: true, NextDueDate: &due, ReviewCount: 15},
+		{Content: "Not a leech", Lapses: 1},
+	}
+
+	for i := range notes {
+		if err := db.Create(&notes[i]).Error; err != nil {
+			t.Fatalf("failed to create note: %v", err)
+		}
+	}
+
+	t.Cleanup(func() {
+		for _, note := range notes {
+			db.Unscoped().Delete(&note)
+		}
+	})
+
+	leeches, err := repo.GetLeeches()
+
+	if err != nil {
+		t.Fatalf("GetLeeches failed: %v", err)
+	}
+
+	ids := []uint{}
+	for _, leech := range leeches {
+		if leech.ID == notes[0].ID || leech.ID == notes[1].ID || leech.ID == notes[2].ID {
+			ids = append(ids, leech.ID)
+		}
+	}
+
+	// The most lapsed come first
+	if want := []uint{notes[1].ID, notes[0].ID}; !slices.Equal(ids, want) {
+		t.Errorf("leeches = %v, want %v", ids, want)
+	}
+
+	if err := repo.ReleaseLeech(int(notes[0].ID)); err != nil {
+		t.Fatalf("ReleaseLeech failed: %v", err)
+	}
+
+	released, err := repo.GetNote(int(notes[0].ID))
+
+	if err != nil {
+		t.Fatalf("GetNote failed: %v", err)
+	}
+
+	// The schedule is kept
+	if released.Leech || released.Suspended || released.Lapses != 0 || released.ReviewCount != 12 || released.NextDueDate == nil {
+		t.Errorf("released leech = %+v, want it back in reviews on its schedule", released)
+	}
+
+	if err := repo.ResetNote(int(notes[1].ID)); err != nil {
+		t.Fatalf("ResetNote failed: %v", err)
+	}
+
+	reset, err := repo.GetNote(int(notes[1].ID))
+
+	if err != nil {
+		t.Fatalf("GetNote failed: %v", err)
+	}
+
+	if reset.Leech || reset.Suspended || reset.Lapses != 0 || reset.ReviewCount != 0 || reset.NextDueDate != nil {
+		t.Errorf("reset leech = %+v, want a new note", reset)
+	}
+
+	if err := repo.DeleteNote(int(notes[2].ID)); err != nil {
+		t.Fatalf("DeleteNote failed: %v", err)
+	}
+
+	if err := repo.DeleteNote(int(notes[2].ID)); err == nil {
+		t.Error("deleting a deleted note succeeded")
+	}
+
+	if err := repo.ReleaseLeech(int(notes[2].ID)); err == nil {
+		t.Error("releasing a deleted note succeeded")
+	}
+}
@@ -0,0 +1,48 @@
+package storage
+
+import (
+	"fmt"
+
+	"gorm.io/gorm/clause"
+)
+
+// LinkNotes remembers two notes as related. Linking them again does nothing.
+func (repo Repository) LinkNotes(noteID int, linkedNoteID int) error {
+	if noteID == linkedNoteID {
+		return fmt.Errorf("cannot link note %d to itself", noteID)
+	}
+
+	link := NoteLink{
+		NoteID:       min(noteID, linkedNoteID),
+		LinkedNoteID: max(noteID, linkedNoteID),
+	}
+
+	result := repo.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&link)
+
+	if result.Error != nil {
+		return fmt.Errorf("failed to link notes %d and %d: %w", noteID, linkedNoteID, result.Error)
+	}
+
+	return nil
+}
+
+// GetLinkedNotes returns the notes linked to a note, with their source
+func (repo Repository) GetLinkedNotes(noteID int) ([]Note, error) {
+	var notes []Note
+
+	result := repo.db.
+		Preload("Source").
+		Where(
+			"id IN (SELECT linked_note_id FROM note_links WHERE note_id = ? AND deleted_at IS NULL) "+
+				"OR id IN (SELECT note_id FROM note_links WHERE linked_note_id = ? AND deleted_at IS NULL)",
+			noteID, noteID,
+		).
+		Order("id").
+		Find(&notes)
+
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to get notes linked to %d: %w", noteID, result.Error)
+	}
+
+	return notes, nil
+}
@@ -0,0 +1,71 @@
+package storage
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestLinkNotes(t *testing.T) {
+	repo, db := testRepository(t)
+
+	notes := make([]Note, 3)
+
+	for i := range notes {
+		notes[i] = Note{Content: "Linked highlight"}
+
+		if err := db.Create(&notes[i]).Error; err != nil {
+			t.Fatalf("failed to create note: %v", err)
+		}
+	}
+
+	t.Cleanup(func() {
+		for _, note := range notes {
+			db.Unscoped().Where("note_id = ? OR linked_note_id = ?", note.ID, note.ID).Delete(&NoteLink{})
+			db.Unscoped().Delete(&note)
+		}
+	})
+
+	first, second, third := int(notes[0].ID), int(notes[1].ID), int(notes[2].ID)
+
+	if err := repo.LinkNotes(first, first); err == nil {
+		t.Error("LinkNotes linked a note to itself")
+	}
+
+	// Linking the other way round, or again, does nothing
+	for _, pair := range [][2]int{{third, first}, {first, third}, {first, second}, {first, second}} {
+		if err := repo.LinkNotes(pair[0], pair[1]); err != nil {
+			t.Fatalf("LinkNotes(%v, %v) failed: %v", pair[0], pair[1], err)
+		}
+	}
+
+	var links int64
+	db.Model(&NoteLink{}).Where("note_id = ?", first).Count(&links)
+
+	if links != 2 {
+		t.Errorf("%v links stored, want 2", links)
+	}
+
+	linkedIDs := func(noteID int) []uint {
+		linked, err := repo.GetLinkedNotes(noteID)
+
+		if err != nil {
+			t.Fatalf("GetLinkedNotes failed: %v", err)
+		}
+
+		ids := []uint{}
+		for _, note := range linked {
+			ids = append(ids, note.ID)
+		}
+
+		return ids
+	}
+
+	if got, want := linkedIDs(first), []uint{notes[1].ID, notes[2].ID}; !slices.Equal(got, want) {
+		t.Errorf("notes linked to the first = %v, want %v", got, want)
+	}
+
+	// Links go both ways
+	if got, want := linkedIDs(third), []uint{notes[0].ID}; !slices.Equal(got, want) {
+		t.Errorf("notes linked to the third = %v, want %v", got, want)
+	}
+}
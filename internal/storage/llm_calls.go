@@ -0,0 +1,67 @@
+package storage
+
+import (
+	"fmt"
+	"time"
+)
+
+func (repo Repository) InsertLLMCall(call LLMCall) error {
+	result := repo.db.Create(&call)
+
+	if result.Error != nil {
+		return fmt.Errorf("failed to record llm call: %w", result.Error)
+	}
+
+	return nil
+}
+
+type LLMUsage struct {
+	Model        string
+	Calls        int
+	Failed       int
+	InputTokens  int
+	OutputTokens int
+	CostUSD      float64
+	AvgLatencyMs float64
+}
+
+// GetLLMUsage sums the LLM calls of a user made since the given time, per
+// model
+func (repo Repository) GetLLMUsage(userID int64, since time.Time) ([]LLMUsage, error) {
+	var usage []LLMUsage
+
+	result := repo.db.Model(&LLMCall{}).
+		Select("model, COUNT(*) AS calls, "+
+			"COUNT(*) FILTER (WHERE error <> '') AS failed, "+
+			"COALESCE(SUM(input_tokens), 0) AS input_tokens, "+
+			"COALESCE(SUM(output_tokens), 0) AS output_tokens, "+
+			"COALESCE(SUM(cost_usd), 0) AS cost_usd, "+
+			"COALESCE(AVG(latency_ms), 0) AS avg_latency_ms").
+		Where("user_id = ? AND created_at >= ?", userID, since).
+		Group("model").
+		Order("cost_usd DESC").
+		Scan(&usage)
+
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to get llm usage: %w", result.Error)
+	}
+
+	return usage, nil
+}
+
+// GetLLMSpend returns the cost in USD of the LLM calls of a user since the
+// given time
+func (repo Repository) GetLLMSpend(userID int64, since time.Time) (float64, error) {
+	var spend float64
+
+	result := repo.db.Model(&LLMCall{}).
+		Select("COALESCE(SUM(cost_usd), 0)").
+		Where("user_id = ? AND created_at >= ?", userID, since).
+		Scan(&spend)
+
+	if result.Error != nil {
+		return 0, fmt.Errorf("failed to get llm spend: %w", result.Error)
+	}
+
+	return spend, nil
+}
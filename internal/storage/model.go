@@ -1,7 +1,6 @@
 package storage
 
 import (
-	"log"
 	"time"
 
 	"gorm.io/gorm"
@@ -18,23 +17,257 @@ type Note struct {
 	Location       string `gorm:"index"`
 	Question       string
 	Answer         string
-	SourceID       int
-	Source         Source
+	Prompt         string
+	// Multiple choice question, delivered as a quiz poll
+	QuizQuestion    string
+	QuizAnswer      string
+	QuizDistractors []string `gorm:"serializer:json"`
+	SourceID        int
+	Source          Source
+	Tags            []Tag `gorm:"many2many:note_tags"`
+	// Times the note was forgotten after being learnt
+	Lapses int
+	// Set once Lapses reaches the user's leech threshold
+	Leech bool `gorm:"index"`
+	// Suspended notes are left out of reviews
+	Suspended bool `gorm:"index"`
+	// Buried notes are left out of reviews until then
+	BuriedUntil *time.Time `gorm:"index"`
+	// Where a note forwarded from another Telegram chat came from
+	Forward *ForwardOrigin `gorm:"serializer:json"`
+}
+
+// ForwardOrigin is the sender of a message forwarded or quoted from another
+// Telegram chat
+type ForwardOrigin struct {
+	// user, hidden_user, chat or channel
+	Type string
+	Name string
+	// Link to the original message, for public chats
+	Link string
+	Date time.Time
 }
 
 type Source struct {
 	gorm.Model
-	Title         string `gorm:"index"`
-	Origin        string
-	TotalNotes    int
+	Title  string `gorm:"index"`
+	Author string
+	Origin string
+	// Count of the source's notes, filled by the queries selecting it
+	TotalNotes    int `gorm:"->;-:migration"`
 	ClozeQuestion bool
+	// Extra instructions given to the LLM when generating questions
+	SystemPrompt string
+	// Per-source daily limits, falling back to the user's when nil
+	NewCardsPerDay   *int
+	MaxReviewsPerDay *int
+	// Card types generated for the notes of the source
+	CardTypes []string `gorm:"serializer:json"`
+	// Tags shared by every note of the source
+	Tags []Tag `gorm:"many2many:source_tags"`
+	// Archived sources are left out of reviews
+	Archived bool `gorm:"index"`
+}
+
+// SourceAlias is a former title of a renamed or merged source, so that
+// highlights imported under it keep going to the source
+type SourceAlias struct {
+	gorm.Model
+	Title    string `gorm:"uniqueIndex"`
+	SourceID int    `gorm:"index"`
+}
+
+// Tag groups notes across sources, either directly or through their source
+type Tag struct {
+	gorm.Model
+	Name string `gorm:"uniqueIndex"`
+}
+
+// Deck is a saved filter over the notes of every source, reviewed like a
+// source
+type Deck struct {
+	gorm.Model
+	UserID int64  `gorm:"uniqueIndex:idx_deck_user_name"`
+	Name   string `gorm:"uniqueIndex:idx_deck_user_name"`
+	Query  string
+}
+
+const (
+	CardTypeCloze     = "cloze"
+	CardTypeOpen      = "open"
+	CardTypeTrueFalse = "truefalse"
+	CardTypeExplain   = "explain"
+	CardTypeReverse   = "reverse"
+)
+
+var CardTypes = []string{
+	CardTypeCloze,
+	CardTypeOpen,
+	CardTypeTrueFalse,
+	CardTypeExplain,
+	CardTypeReverse,
 }
 
-func (n *Note) AfterCreate(tx *gorm.DB) (err error) {
+// Card is a question generated from a note, scheduled independently from
+// the note and its other cards. Cloze cards leave Question and Answer empty
+// and use the ones of the note.
+type Card struct {
+	gorm.Model
+	NoteID         int    `gorm:"uniqueIndex:idx_card_note_type"`
+	Type           string `gorm:"uniqueIndex:idx_card_note_type"`
+	Question       string
+	Answer         string
+	EasinessFactor *float64
+	NextDueDate    *time.Time `gorm:"index"`
+	LastReviewed   *time.Time
+	Interval       int
+	ReviewCount    int
+	Note           Note
+}
 
-	log.Printf("Updating total notes of source %v", n.SourceID)
+type UserSettings struct {
+	gorm.Model
+	UserID           int64 `gorm:"uniqueIndex"`
+	Timezone         string
+	ReminderTimes    string
+	RolloverHour     int
+	NewCardsPerDay   int    `gorm:"default:20"`
+	MaxReviewsPerDay int    `gorm:"default:200"`
+	QueueOrder       string `gorm:"default:overdue"`
+	PromptStyle      string `gorm:"default:words"`
+	// Let the LLM judge typed answers that don't match the expected one
+	LLMJudge bool
+	// LLM spend caps in USD, 0 means no cap
+	DailyBudget   float64
+	MonthlyBudget float64
+	// Lapses after which a note becomes a leech, and what happens to it
+	LeechThreshold int    `gorm:"default:8"`
+	LeechAction    string `gorm:"default:suspend"`
+}
 
-	tx.Exec("UPDATE sources SET total_notes = total_notes + 1 WHERE id = ?", n.SourceID)
+type ReviewLog struct {
+	gorm.Model
+	UserID     int64 `gorm:"index"`
+	NoteID     int   `gorm:"index"`
+	CardID     int   `gorm:"index"`
+	SourceID   int   `gorm:"index"`
+	Rating     int
+	WasNew     bool
+	ReviewedAt time.Time `gorm:"index"`
+	// Scheduling fields of the note, or of the card if CardID is set, before
+	// the review, used to undo it. Lapses are always the note's.
+	PrevEasinessFactor *float64
+	PrevNextDueDate    *time.Time
+	PrevLastReviewed   *time.Time
+	PrevInterval       int
+	PrevReviewCount    int
+	PrevLapses         int
+	PrevLeech          bool
+	PrevSuspended      bool
+	// Time between showing the prompt and revealing the note
+	RevealMs int64
+}
 
-	return
+const (
+	JobKindReminder = "reminder"
+	JobKindSnooze   = "snooze"
+)
+
+type ScheduledJob struct {
+	gorm.Model
+	UserID    int64  `gorm:"uniqueIndex:idx_scheduled_job_user_name"`
+	Name      string `gorm:"uniqueIndex:idx_scheduled_job_user_name"`
+	Kind      string `gorm:"index"`
+	Spec      string
+	Timezone  string
+	RunAt     *time.Time
+	LastRunAt *time.Time
+}
+
+const (
+	GenerationKindCloze  = "cloze"
+	GenerationKindQuiz   = "quiz"
+	GenerationKindPrompt = "prompt"
+	GenerationKindCard   = "card"
+	GenerationKindTags   = "tags"
+)
+
+const (
+	GenerationStatusPending = "pending"
+	GenerationStatusRunning = "running"
+	GenerationStatusDone    = "done"
+	GenerationStatusFailed  = "failed"
+)
+
+// GenerationJob is a question to generate in the background for a note.
+// CardType is only set for card jobs.
+type GenerationJob struct {
+	gorm.Model
+	NoteID        int    `gorm:"uniqueIndex:idx_generation_job_note_kind"`
+	Kind          string `gorm:"uniqueIndex:idx_generation_job_note_kind"`
+	CardType      string `gorm:"uniqueIndex:idx_generation_job_note_kind"`
+	Status        string `gorm:"index"`
+	Attempts      int
+	LastError     string
+	NextAttemptAt time.Time
+}
+
+const (
+	QuestionFeedbackRegenerated = "regenerated"
+	QuestionFeedbackEdited      = "edited"
+	QuestionFeedbackRejected    = "rejected"
+)
+
+// QuestionFeedback records what the user did with a generated cloze
+// question. Replacement is only set for edits.
+type QuestionFeedback struct {
+	gorm.Model
+	UserID      int64 `gorm:"index"`
+	NoteID      int   `gorm:"index"`
+	Question    string
+	Answer      string
+	Action      string `gorm:"index"`
+	Replacement string
+}
+
+// LLMCall is a call made to the LLM provider, for usage accounting
+type LLMCall struct {
+	gorm.Model
+	UserID   int64 `gorm:"index"`
+	Provider string
+	// Named after the column, as Model is taken by gorm.Model
+	LLMModel     string `gorm:"column:model"`
+	Name         string
+	InputTokens  int
+	OutputTokens int
+	LatencyMs    int64
+	CostUSD      float64
+	Error        string
+}
+
+// NoteEmbedding is the vector of a note's content. Vectors are kept as JSON
+// for the in-memory index, and in the embedding column when pgvector is
+// available.
+type NoteEmbedding struct {
+	gorm.Model
+	NoteID     int    `gorm:"uniqueIndex"`
+	EmbedModel string `gorm:"index"`
+	Dimensions int
+	Vector     []float32 `gorm:"serializer:json"`
+}
+
+// NoteLink is a pair of related notes marked as helpful during a review.
+// Links go both ways and are stored with the lower note id first.
+type NoteLink struct {
+	gorm.Model
+	NoteID       int `gorm:"uniqueIndex:idx_note_link"`
+	LinkedNoteID int `gorm:"uniqueIndex:idx_note_link;index"`
+}
+
+// NoteRevision is the content of a note before it was edited. The oldest
+// revision of a note holds the original highlight.
+type NoteRevision struct {
+	gorm.Model
+	NoteID  int `gorm:"index"`
+	Content string
 }
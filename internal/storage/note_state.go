@@ -0,0 +1,48 @@
+package storage
+
+import (
+	"fmt"
+	"time"
+)
+
+func (repo Repository) SetNoteSuspended(noteID int, suspended bool) error {
+	result := repo.db.Model(&Note{}).Where("id = ?", noteID).Update("suspended", suspended)
+
+	if result.Error != nil {
+		return fmt.Errorf("failed to update note %d: %w", noteID, result.Error)
+	}
+
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("note with id %d not found", noteID)
+	}
+
+	return nil
+}
+
+// BuryNote leaves a note out of reviews until the given time
+func (repo Repository) BuryNote(noteID int, until time.Time) error {
+	result := repo.db.Model(&Note{}).Where("id = ?", noteID).Update("buried_until", until)
+
+	if result.Error != nil {
+		return fmt.Errorf("failed to bury note %d: %w", noteID, result.Error)
+	}
+
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("note with id %d not found", noteID)
+	}
+
+	return nil
+}
+
+// GetSuspendedNotes returns the suspended notes with their source
+func (repo Repository) GetSuspendedNotes() ([]Note, error) {
+	var notes []Note
+
+	result := repo.db.Preload("Source").Where("suspended").Order("updated_at DESC").Find(&notes)
+
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to get suspended notes: %w", result.Error)
+	}
+
+	return notes, nil
+}
@@ -0,0 +1,91 @@
+package storage
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestNoteState(t *testing.T) {
+	repo, db := testRepository(t)
+
+	source := Source{Title: fmt.Sprintf("%v %v", t.Name(), time.Now().UnixNano()), Origin: "test"}
+
+	if err := db.Create(&source).Error; err != nil {
+		t.Fatalf("failed to create source: %v", err)
+	}
+
+	t.Cleanup(func() {
+		db.Unscoped().Where("source_id = ?", source.ID).Delete(&Note{})
+		db.Unscoped().Delete(&source)
+	})
+
+	notes := make([]Note, 3)
+
+	for i := range notes {
+		notes[i] = Note{Content: fmt.Sprintf("Highlight %v", i), SourceID: int(source.ID)}
+
+		if err := db.Create(&notes[i]).Error; err != nil {
+			t.Fatalf("failed to create note: %v", err)
+		}
+	}
+
+	reviewableIDs := func() []uint {
+		t.Helper()
+
+		found, err := repo.GetNotes(int(source.ID), time.Now())
+
+		if err != nil {
+			t.Fatalf("GetNotes failed: %v", err)
+		}
+
+		ids := []uint{}
+		for _, note := range found {
+			ids = append(ids, note.ID)
+		}
+		slices.Sort(ids)
+
+		return ids
+	}
+
+	if err := repo.SetNoteSuspended(int(notes[0].ID), true); err != nil {
+		t.Fatalf("SetNoteSuspended failed: %v", err)
+	}
+
+	if err := repo.BuryNote(int(notes[1].ID), time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("BuryNote failed: %v", err)
+	}
+
+	if got, want := reviewableIDs(), []uint{notes[2].ID}; !slices.Equal(got, want) {
+		t.Errorf("reviewable notes = %v, want %v", got, want)
+	}
+
+	suspended, err := repo.GetSuspendedNotes()
+
+	if err != nil || !slices.ContainsFunc(suspended, func(n Note) bool { return n.ID == notes[0].ID && n.Source.ID == source.ID }) {
+		t.Errorf("suspended notes = %v (%v), want the suspended note with its source", len(suspended), err)
+	}
+
+	// Buried notes come back once the time has passed
+	if err := repo.SetNoteSuspended(int(notes[0].ID), false); err != nil {
+		t.Fatalf("SetNoteSuspended failed: %v", err)
+	}
+
+	if err := repo.BuryNote(int(notes[1].ID), time.Now().Add(-time.Minute)); err != nil {
+		t.Fatalf("BuryNote failed: %v", err)
+	}
+
+	if got, want := reviewableIDs(), []uint{notes[0].ID, notes[1].ID, notes[2].ID}; !slices.Equal(got, want) {
+		t.Errorf("reviewable notes = %v, want %v", got, want)
+	}
+
+	for _, err := range []error{
+		repo.SetNoteSuspended(0, true),
+		repo.BuryNote(0, time.Now()),
+	} {
+		if err == nil {
+			t.Error("changing a missing note succeeded")
+		}
+	}
+}
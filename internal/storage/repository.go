@@ -12,16 +12,36 @@ import (
 
 type Repository struct {
 	db *gorm.DB
+	// Whether embeddings are also stored as pgvector vectors
+	pgvector bool
 }
 
 func NewRepository(db *gorm.DB) *Repository {
-	db.AutoMigrate(&Note{}, &Source{})
+	db.AutoMigrate(&Note{}, &Source{}, &UserSettings{}, &ScheduledJob{}, &ReviewLog{}, &Card{}, &GenerationJob{}, &QuestionFeedback{}, &LLMCall{}, &NoteEmbedding{}, &NoteLink{}, &Tag{}, &Deck{}, &NoteRevision{}, &SourceAlias{})
+	setupFullText(db)
+
+	// Note counts are derived from the notes since they stopped being kept
+	// up to date on insert
+	if db.Migrator().HasColumn(&Source{}, "total_notes") {
+		if err := db.Migrator().DropColumn(&Source{}, "total_notes"); err != nil {
+			log.Printf("Failed to drop total_notes of sources: %v", err)
+		}
+	}
 
 	return &Repository{
-		db: db,
+		db:       db,
+		pgvector: setupPgvector(db),
 	}
 }
 
+// reviewable leaves out the suspended notes, the ones buried for now and
+// the notes of archived sources. Every query building a review queue goes
+// through it.
+func reviewable(db *gorm.DB) *gorm.DB {
+	return db.Where("NOT notes.suspended AND (notes.buried_until IS NULL OR notes.buried_until <= ?)", time.Now()).
+		Where("notes.source_id NOT IN (SELECT id FROM sources WHERE archived)")
+}
+
 func insertToSource(db *gorm.DB, data *Source) (sourceId int, err error) {
 	result := db.Create(data)
 
@@ -33,18 +53,50 @@ func insertToSource(db *gorm.DB, data *Source) (sourceId int, err error) {
 	return 0, result.Error
 }
 
+// FindOrCreateSource returns the source with the given title, creating it
+// with the given origin when there is none
+func (repo Repository) FindOrCreateSource(title string, origin string) (Source, error) {
+	var source Source
+
+	result := repo.db.Where(Source{Title: title}).Attrs(Source{Origin: origin}).FirstOrCreate(&source)
+
+	if result.Error != nil {
+		return Source{}, fmt.Errorf("failed to get source %v: %w", title, result.Error)
+	}
+
+	return source, nil
+}
+
+// InsertNote adds a note written by the user rather than imported
+func (repo Repository) InsertNote(note *Note) error {
+	if err := repo.db.Create(note).Error; err != nil {
+		return fmt.Errorf("failed to insert note: %w", err)
+	}
+
+	return nil
+}
+
 func (repo Repository) ensureSourceExists(itm highlights.Highlight) (id int, err error) {
 	var source Source
 
 	result := repo.db.Where("title = ?", itm.Title).First(&source)
 
+	if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		// The source may have been renamed or merged into another one
+		var alias SourceAlias
+
+		if err := repo.db.Where("title = ?", itm.Title).First(&alias).Error; err == nil {
+			return alias.SourceID, nil
+		}
+	}
+
 	if result.Error != nil {
 		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
 			log.Printf("No record for %v found, inserting.. \n", itm.Title)
 			newSource, err := insertToSource(repo.db, &Source{
-				Title:      itm.Title,
-				Origin:     "kindle",
-				TotalNotes: 0,
+				Title:  itm.Title,
+				Author: itm.Author,
+				Origin: "kindle",
 			})
 
 			return newSource, err
@@ -54,6 +106,13 @@ func (repo Repository) ensureSourceExists(itm highlights.Highlight) (id int, err
 		}
 	}
 
+	// Sources imported before authors were stored get theirs on the next sync
+	if source.Author == "" && itm.Author != "" {
+		if err := repo.db.Model(&source).Update("author", itm.Author).Error; err != nil {
+			log.Printf("Failed to update author of %v: %v", itm.Title, err)
+		}
+	}
+
 	return int(source.ID), nil
 
 }
@@ -91,7 +150,7 @@ func (repo Repository) BulkInsertHighlights(toInsert []highlights.Highlight) {
 		var notes Note
 		location := highlight.Location
 		title := highlight.Title
-		result := repo.db.Joins("JOIN sources ON notes.source_id = sources.id").Where("notes.location = ? AND sources.title = ?", location, title).First(&notes)
+		result := repo.db.Joins("JOIN sources ON notes.source_id = sources.id").Where("notes.location = ? AND (sources.title = ? OR sources.id IN (SELECT source_id FROM source_aliases WHERE title = ?))", location, title, title).First(&notes)
 
 		if result.Error != nil {
 			if errors.Is(result.Error, gorm.ErrRecordNotFound) {
@@ -121,7 +180,7 @@ func (repo Repository) GetSources() []title {
 
 	var sources []Source
 
-	repo.db.Find(&sources)
+	repo.db.Where("NOT archived").Find(&sources)
 
 	for _, source := range sources {
 		titles = append(titles, title{
@@ -136,7 +195,7 @@ func (repo Repository) GetSources() []title {
 func (repo Repository) GetSource(id int) (Source, error) {
 	var source Source
 
-	result := repo.db.Where("id = ?", id).First(&source)
+	result := repo.db.Scopes(withTotalNotes).Where("sources.id = ?", id).First(&source)
 	if result.Error != nil {
 		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
 			return Source{}, result.Error
@@ -147,11 +206,30 @@ func (repo Repository) GetSource(id int) (Source, error) {
 	return source, nil
 }
 
-func (repo Repository) GetNotes(sourceID int) ([]Note, error) {
+// GetSourcesByID returns the sources of the given ids, keyed by id
+func (repo Repository) GetSourcesByID(ids []int) (map[int]Source, error) {
+	var sources []Source
+
+	if err := repo.db.Where("id IN ?", ids).Find(&sources).Error; err != nil {
+		return nil, fmt.Errorf("failed to get sources: %w", err)
+	}
+
+	byID := make(map[int]Source, len(sources))
+	for _, source := range sources {
+		byID[int(source.ID)] = source
+	}
+
+	return byID, nil
+}
+
+// GetNotes returns the notes of a source that are due before dueBefore,
+// along with the ones that were never reviewed
+func (repo Repository) GetNotes(sourceID int, dueBefore time.Time) ([]Note, error) {
 	var notes []Note
 
 	result := repo.db.Joins("JOIN sources ON notes.source_id = sources.id").
-		Where("(source_id = ?) AND (DATE(next_due_date) <= DATE(?) OR next_due_date IS NULL)", sourceID, time.Now()).
+		Where("(source_id = ?) AND (next_due_date < ? OR next_due_date IS NULL)", sourceID, dueBefore).
+		Scopes(reviewable).
 		Find(&notes)
 
 	if result.Error != nil {
@@ -163,6 +241,19 @@ func (repo Repository) GetNotes(sourceID int) ([]Note, error) {
 	return notes, nil
 }
 
+// GetNoteIDs returns the ids of every note of a source
+func (repo Repository) GetNoteIDs(sourceID int) ([]int, error) {
+	var ids []int
+
+	result := repo.db.Model(&Note{}).Where("source_id = ?", sourceID).Pluck("id", &ids)
+
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to get notes of source %d: %w", sourceID, result.Error)
+	}
+
+	return ids, nil
+}
+
 var ErrNoNextNote = errors.New("No more notes to skip")
 
 func (repo Repository) GetNextNote(source_id int) (Note, error) {
@@ -217,7 +308,7 @@ func (repo Repository) UpdateNote(id int, update Note) (*Note, error) {
 	}
 
 	// Fetch the updated record to return
-	if err := repo.db.First(&note, id).Error; err != nil {
+	if err := repo.db.Preload("Source").First(&note, id).Error; err != nil {
 		return nil, fmt.Errorf("failed to fetch updated note: %w", err)
 	}
 
@@ -229,6 +320,25 @@ func (repo Repository) UpdateNote(id int, update Note) (*Note, error) {
 	return &note, nil
 }
 
+// SetSourceLimits overrides the user's daily limits for a source. A nil
+// limit falls back to the user's setting.
+func (repo Repository) SetSourceLimits(id int, newCardsPerDay *int, maxReviewsPerDay *int) error {
+	result := repo.db.Model(&Source{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"new_cards_per_day":   newCardsPerDay,
+		"max_reviews_per_day": maxReviewsPerDay,
+	})
+
+	if result.Error != nil {
+		return fmt.Errorf("failed to update source limits: %w", result.Error)
+	}
+
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("source with id %d not found", id)
+	}
+
+	return nil
+}
+
 func (repo Repository) ResetSource(id int) {
 
 	repo.db.Model(&Note{}).Where("source_id = ?", id).Updates(map[string]interface{}{
@@ -240,12 +350,13 @@ func (repo Repository) ResetSource(id int) {
 	})
 }
 
-func (repo Repository) GetPendingReviewNotes() ([]Note, error) {
+func (repo Repository) GetPendingReviewNotes(dueBefore time.Time) ([]Note, error) {
 	var notes []Note
 
 	result := repo.db.
 		Joins("JOIN sources ON notes.source_id = sources.id").
-		Where("DATE(next_due_date) <= DATE(?)", time.Now()).
+		Where("next_due_date < ?", dueBefore).
+		Scopes(reviewable).
 		Find(&notes)
 
 	if result.Error != nil {
@@ -254,3 +365,41 @@ func (repo Repository) GetPendingReviewNotes() ([]Note, error) {
 
 	return notes, nil
 }
+
+type SourceCount struct {
+	SourceID int
+	Title    string
+	Count    int
+}
+
+// CountDueNotesBySource groups the notes due before dueBefore by their source
+func (repo Repository) CountDueNotesBySource(dueBefore time.Time) ([]SourceCount, error) {
+	var counts []SourceCount
+
+	result := repo.db.Model(&Note{}).
+		Select("notes.source_id AS source_id, sources.title AS title, COUNT(notes.id) AS count").
+		Joins("JOIN sources ON notes.source_id = sources.id").
+		Where("next_due_date < ?", dueBefore).
+		Scopes(reviewable).
+		Group("notes.source_id, sources.title").
+		Order("count DESC").
+		Scan(&counts)
+
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to count due notes: %w", result.Error)
+	}
+
+	return counts, nil
+}
+
+func (repo Repository) CountNewNotes() (int, error) {
+	var count int64
+
+	result := repo.db.Model(&Note{}).Where("next_due_date IS NULL").Scopes(reviewable).Count(&count)
+
+	if result.Error != nil {
+		return 0, fmt.Errorf("failed to count new notes: %w", result.Error)
+	}
+
+	return int(count), nil
+}
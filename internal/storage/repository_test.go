@@ -0,0 +1,61 @@
+package storage
+
+import (
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+// testRepository returns a repository on the database of TEST_DATABASE_URL
+// and skips the test when none is given
+func testRepository(t *testing.T) (*Repository, *gorm.DB) {
+	t.Helper()
+
+	dsn := os.Getenv("TEST_DATABASE_URL")
+
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+
+	db, err := gorm.Open(postgres.Open(dsn))
+
+	if err != nil {
+		t.Fatalf("failed to connect to the test database: %v", err)
+	}
+
+	return NewRepository(db), db
+}
+
+// testUserID returns a user id of no real user, so rows of the test can be
+// told apart
+func testUserID() int64 {
+	return -time.Now().UnixNano()
+}
+
+func TestGetSourcesByID(t *testing.T) {
+	repo, db := testRepository(t)
+
+	source := Source{Title: fmt.Sprintf("%v %v", t.Name(), time.Now().UnixNano()), Origin: "test"}
+
+	if err := db.Create(&source).Error; err != nil {
+		t.Fatalf("failed to create source: %v", err)
+	}
+
+	t.Cleanup(func() {
+		db.Unscoped().Delete(&source)
+	})
+
+	sources, err := repo.GetSourcesByID([]int{int(source.ID), 0})
+
+	if err != nil {
+		t.Fatalf("GetSourcesByID failed: %v", err)
+	}
+
+	if len(sources) != 1 || sources[int(source.ID)].Title != source.Title {
+		t.Errorf("sources = %+v, want only %q", sources, source.Title)
+	}
+}
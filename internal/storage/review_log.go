@@ -0,0 +1,96 @@
+package storage
+
+import (
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+func (repo Repository) InsertReviewLog(log ReviewLog) (ReviewLog, error) {
+	if err := repo.db.Create(&log).Error; err != nil {
+		return ReviewLog{}, fmt.Errorf("failed to insert review log: %w", err)
+	}
+
+	return log, nil
+}
+
+func (repo Repository) GetReviewLog(id uint) (ReviewLog, error) {
+	var log ReviewLog
+
+	if err := repo.db.First(&log, id).Error; err != nil {
+		return ReviewLog{}, fmt.Errorf("failed to get review log %d: %w", id, err)
+	}
+
+	return log, nil
+}
+
+// UndoReview puts back the scheduling fields the note or card had before the
+// review and removes the review from the log
+func (repo Repository) UndoReview(log ReviewLog) error {
+	return repo.db.Transaction(func(tx *gorm.DB) error {
+		updates := map[string]interface{}{
+			"next_due_date":   log.PrevNextDueDate,
+			"last_reviewed":   log.PrevLastReviewed,
+			"interval":        log.PrevInterval,
+			"easiness_factor": log.PrevEasinessFactor,
+			"review_count":    log.PrevReviewCount,
+		}
+
+		reviewed := tx.Model(&Card{}).Where("id = ?", log.CardID)
+
+		if log.CardID == 0 {
+			reviewed = tx.Model(&Note{}).Where("id = ?", log.NoteID)
+		}
+
+		result := reviewed.Updates(updates)
+
+		if result.Error != nil {
+			return fmt.Errorf("failed to restore review %d: %w", log.ID, result.Error)
+		}
+
+		// Lapses are counted on the note, for cards too
+		result = tx.Model(&Note{}).Where("id = ?", log.NoteID).Updates(map[string]interface{}{
+			"lapses":    log.PrevLapses,
+			"leech":     log.PrevLeech,
+			"suspended": log.PrevSuspended,
+		})
+
+		if result.Error != nil {
+			return fmt.Errorf("failed to restore lapses of review %d: %w", log.ID, result.Error)
+		}
+
+		if err := tx.Delete(&log).Error; err != nil {
+			return fmt.Errorf("failed to delete review log %d: %w", log.ID, err)
+		}
+
+		return nil
+	})
+}
+
+type ReviewCount struct {
+	SourceID int
+	New      int
+	Reviews  int
+}
+
+// CountReviewsSince counts the new cards and reviews a user went through
+// since the given time, grouped by source. Every rating counts, including
+// the ones of several cards of the same note.
+func (repo Repository) CountReviewsSince(userID int64, since time.Time) ([]ReviewCount, error) {
+	var counts []ReviewCount
+
+	result := repo.db.Model(&ReviewLog{}).
+		Select("source_id, "+
+			"COUNT(*) FILTER (WHERE was_new) AS new, "+
+			"COUNT(*) FILTER (WHERE NOT was_new) AS reviews").
+		Where("user_id = ? AND reviewed_at >= ?", userID, since).
+		Group("source_id").
+		Scan(&counts)
+
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to count reviews: %w", result.Error)
+	}
+
+	return counts, nil
+}
@@ -0,0 +1,46 @@
+package storage
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCountReviewsSince(t *testing.T) {
+	repo, db := testRepository(t)
+	userID := testUserID()
+
+	t.Cleanup(func() {
+		db.Unscoped().Where("user_id = ?", userID).Delete(&ReviewLog{})
+	})
+
+	now := time.Now()
+	logs := []ReviewLog{
+		// Two cards of the same note
+		{NoteID: 1, CardID: 1, SourceID: 1, WasNew: true, ReviewedAt: now},
+		{NoteID: 1, CardID: 2, SourceID: 1, WasNew: true, ReviewedAt: now},
+		// The same card rated twice
+		{NoteID: 2, SourceID: 1, ReviewedAt: now},
+		{NoteID: 2, SourceID: 1, ReviewedAt: now},
+		{NoteID: 3, SourceID: 1, ReviewedAt: now.AddDate(0, 0, -1)},
+	}
+
+	for _, log := range logs {
+		log.UserID = userID
+
+		if _, err := repo.InsertReviewLog(log); err != nil {
+			t.Fatalf("InsertReviewLog failed: %v", err)
+		}
+	}
+
+	counts, err := repo.CountReviewsSince(userID, now.Add(-time.Hour))
+
+	if err != nil {
+		t.Fatalf("CountReviewsSince failed: %v", err)
+	}
+
+	want := ReviewCount{SourceID: 1, New: 2, Reviews: 2}
+
+	if len(counts) != 1 || counts[0] != want {
+		t.Errorf("counts = %+v, want %+v", counts, want)
+	}
+}
@@ -0,0 +1,71 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+// ErrContentUnchanged is returned when an edit leaves a note as it was
+var ErrContentUnchanged = errors.New("content is unchanged")
+
+// EditNoteContent replaces the content of a note, keeping the previous one
+// as a revision. The questions generated from the previous content are
+// cleared.
+func (repo Repository) EditNoteContent(noteID int, content string) error {
+	err := repo.db.Transaction(func(tx *gorm.DB) error {
+		var note Note
+
+		if err := tx.Select("id", "content").First(&note, noteID).Error; err != nil {
+			return err
+		}
+
+		if note.Content == content {
+			return ErrContentUnchanged
+		}
+
+		if err := tx.Create(&NoteRevision{NoteID: noteID, Content: note.Content}).Error; err != nil {
+			return err
+		}
+
+		return tx.Model(&note).Updates(map[string]interface{}{
+			"content":          content,
+			"question":         "",
+			"answer":           "",
+			"prompt":           "",
+			"quiz_question":    "",
+			"quiz_answer":      "",
+			"quiz_distractors": gorm.Expr("NULL"),
+		}).Error
+	})
+
+	if err != nil {
+		return fmt.Errorf("failed to edit note %d: %w", noteID, err)
+	}
+
+	return nil
+}
+
+// GetNoteRevisions returns the previous contents of a note, oldest first
+func (repo Repository) GetNoteRevisions(noteID int) ([]NoteRevision, error) {
+	var revisions []NoteRevision
+
+	result := repo.db.Where("note_id = ?", noteID).Order("id ASC").Find(&revisions)
+
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to get revisions of note %d: %w", noteID, result.Error)
+	}
+
+	return revisions, nil
+}
+
+func (repo Repository) GetNoteRevision(id int) (NoteRevision, error) {
+	var revision NoteRevision
+
+	if err := repo.db.First(&revision, id).Error; err != nil {
+		return NoteRevision{}, fmt.Errorf("failed to get revision %d: %w", id, err)
+	}
+
+	return revision, nil
+}
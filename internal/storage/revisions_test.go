@@ -0,0 +1,77 @@
+package storage
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestEditNoteContent(t *testing.T) {
+	repo, db := testRepository(t)
+
+	note := Note{Content: "Original", Question: "The ___", Answer: "Original", QuizQuestion: "Which?"}
+
+	if err := repo.InsertNote(&note); err != nil {
+		t.Fatalf("InsertNote failed: %v", err)
+	}
+
+	t.Cleanup(func() {
+		db.Unscoped().Where("note_id = ?", note.ID).Delete(&NoteRevision{})
+		db.Unscoped().Delete(&note)
+	})
+
+	for _, content := range []string{"First edit", "Second edit"} {
+		if err := repo.EditNoteContent(int(note.ID), content); err != nil {
+			t.Fatalf("EditNoteContent(%q) failed: %v", content, err)
+		}
+	}
+
+	if err := repo.EditNoteContent(int(note.ID), "Second edit"); !errors.Is(err, ErrContentUnchanged) {
+		t.Errorf("editing without a change = %v, want ErrContentUnchanged", err)
+	}
+
+	if err := repo.EditNoteContent(0, "Edit"); err == nil {
+		t.Error("editing a missing note succeeded")
+	}
+
+	if edited, err := repo.GetNote(int(note.ID)); err != nil || edited.Content != "Second edit" {
+		t.Errorf("note = %q (%v), want the last edit", edited.Content, err)
+	} else if edited.Question != "" || edited.Answer != "" || edited.QuizQuestion != "" {
+		t.Errorf("questions of the edited note = %q, %q, %q, want them cleared", edited.Question, edited.Answer, edited.QuizQuestion)
+	}
+
+	revisions, err := repo.GetNoteRevisions(int(note.ID))
+
+	if err != nil {
+		t.Fatalf("GetNoteRevisions failed: %v", err)
+	}
+
+	// The oldest revision holds the original
+	if len(revisions) != 2 || revisions[0].Content != "Original" || revisions[1].Content != "First edit" {
+		t.Fatalf("revisions = %+v, want the original and the first edit", revisions)
+	}
+
+	if revision, err := repo.GetNoteRevision(int(revisions[1].ID)); err != nil || revision.Content != "First edit" || revision.NoteID != int(note.ID) {
+		t.Errorf("GetNoteRevision = %+v, %v, want the first edit", revision, err)
+	}
+}
+
+func TestFindOrCreateSource(t *testing.T) {
+	repo, db := testRepository(t)
+	title := t.Name()
+
+	t.Cleanup(func() {
+		db.Unscoped().Where("title = ?", title).Delete(&Source{})
+	})
+
+	created, err := repo.FindOrCreateSource(title, "telegram")
+
+	if err != nil || created.ID == 0 || created.Origin != "telegram" {
+		t.Fatalf("FindOrCreateSource = %+v, %v, want a new telegram source", created, err)
+	}
+
+	found, err := repo.FindOrCreateSource(title, "kindle")
+
+	if err != nil || found.ID != created.ID || found.Origin != "telegram" {
+		t.Errorf("FindOrCreateSource = %+v, %v, want the existing source", found, err)
+	}
+}
@@ -0,0 +1,112 @@
+package storage
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// setupFullText adds the generated tsvector column of the notes and its
+// GIN index, used by SearchNotes
+func setupFullText(db *gorm.DB) {
+	statements := []string{
+		"ALTER TABLE notes ADD COLUMN IF NOT EXISTS search_vector tsvector " +
+			"GENERATED ALWAYS AS (to_tsvector('english', COALESCE(content, ''))) STORED",
+		"CREATE INDEX IF NOT EXISTS idx_notes_search_vector ON notes USING GIN (search_vector)",
+	}
+
+	for _, statement := range statements {
+		if err := db.Exec(statement).Error; err != nil {
+			log.Printf("failed to set up full-text search: %v", err)
+			return
+		}
+	}
+}
+
+// Due states a search can be restricted to
+const (
+	DueStateAny       = ""
+	DueStateDue       = "due"
+	DueStateNew       = "new"
+	DueStateScheduled = "scheduled"
+)
+
+// NoteFilters narrows down the notes returned by SearchNotes. Zero values
+// don't filter. Notes count as due before DueBefore, the end of the user's
+// day, or before now when it is zero.
+type NoteFilters struct {
+	SourceID  int
+	Tag       string
+	DueState  string
+	DueBefore time.Time
+	Limit     int
+	Offset    int
+}
+
+// SearchNotes returns the reviewable notes matching a keyword query, best
+// match first, along with the total number of matches. Quoted phrases match
+// exactly, "or" and a leading "-" work as in web searches.
+func (repo Repository) SearchNotes(query string, filters NoteFilters) ([]Note, int, error) {
+	tsQuery := gorm.Expr("websearch_to_tsquery('english', ?)", query)
+
+	db := repo.db.Model(&Note{}).
+		Joins("JOIN sources ON notes.source_id = sources.id AND sources.deleted_at IS NULL").
+		Where("notes.search_vector @@ ?", tsQuery).
+		Scopes(reviewable)
+
+	if filters.SourceID != 0 {
+		db = db.Where("notes.source_id = ?", filters.SourceID)
+	}
+
+	if filters.Tag != "" {
+		db = db.Where(taggedNotes, filters.Tag, filters.Tag)
+	}
+
+	dueBefore := filters.DueBefore
+
+	if dueBefore.IsZero() {
+		dueBefore = time.Now()
+	}
+
+	switch filters.DueState {
+	case DueStateAny:
+	case DueStateDue:
+		db = db.Where("notes.next_due_date < ?", dueBefore)
+	case DueStateNew:
+		db = db.Where("notes.next_due_date IS NULL")
+	case DueStateScheduled:
+		db = db.Where("notes.next_due_date >= ?", dueBefore)
+	default:
+		return nil, 0, fmt.Errorf("unknown due state %q", filters.DueState)
+	}
+
+	var total int64
+
+	if err := db.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count matching notes: %w", err)
+	}
+
+	if filters.Limit > 0 {
+		db = db.Limit(filters.Limit)
+	}
+
+	var notes []Note
+
+	result := db.
+		Preload("Source").
+		Clauses(clause.OrderBy{Expression: clause.Expr{
+			SQL:  "ts_rank(notes.search_vector, ?) DESC, notes.id",
+			Vars: []interface{}{tsQuery},
+		}}).
+		Offset(filters.Offset).
+		Find(&notes)
+
+	if result.Error != nil {
+		return nil, 0, fmt.Errorf("failed to search notes: %w", result.Error)
+	}
+
+	return notes, int(total), nil
+}
@@ -0,0 +1,108 @@
+package storage
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestSearchNotes(t *testing.T) {
+	repo, db := testRepository(t)
+
+	source := Source{Title: fmt.Sprintf("%v %v", t.Name(), time.Now().UnixNano()), Origin: "test"}
+
+	if err := db.Create(&source).Error; err != nil {
+		t.Fatalf("failed to create source: %v", err)
+	}
+
+	t.Cleanup(func() {
+		db.Unscoped().Where("source_id = ?", source.ID).Delete(&Note{})
+		db.Unscoped().Delete(&source)
+	})
+
+	past := time.Now().AddDate(0, 0, -1)
+	future := time.Now().AddDate(0, 0, 1)
+
+	notes := []Note{
+		{Content: "Rome was not built in a day", NextDueDate: &past},
+		{Content: "All roads lead to Rome", NextDueDate: &future},
+		{Content: "The Roman roads were built to last, roads everywhere"},
+		{Content: "Athens had a democracy"},
+		// Suspended notes are never found
+		{Content: "Rome burned while Nero played", Suspended: true},
+	}
+
+	for i := range notes {
+		notes[i].SourceID = int(source.ID)
+
+		if err := db.Create(&notes[i]).Error; err != nil {
+			t.Fatalf("failed to create note: %v", err)
+		}
+	}
+
+	search := func(query string, filters NoteFilters) ([]uint, int) {
+		t.Helper()
+
+		filters.SourceID = int(source.ID)
+		found, total, err := repo.SearchNotes(query, filters)
+
+		if err != nil {
+			t.Fatalf("SearchNotes(%q) failed: %v", query, err)
+		}
+
+		ids := []uint{}
+		for _, note := range found {
+			if note.Source.ID != source.ID {
+				t.Errorf("note %v came without its source", note.ID)
+			}
+
+			ids = append(ids, note.ID)
+		}
+
+		return ids, total
+	}
+
+	tests := []struct {
+		query    string
+		dueState string
+		want     []uint
+	}{
+		// Words are stemmed and the best match comes first
+		{"road", DueStateAny, []uint{notes[2].ID, notes[1].ID}},
+		{"rome", DueStateAny, []uint{notes[0].ID, notes[1].ID}},
+		{`"lead to rome"`, DueStateAny, []uint{notes[1].ID}},
+		{"rome -built", DueStateAny, []uint{notes[1].ID}},
+		{"athens or day", DueStateAny, []uint{notes[0].ID, notes[3].ID}},
+		{"rome", DueStateDue, []uint{notes[0].ID}},
+		{"rome", DueStateScheduled, []uint{notes[1].ID}},
+		{"built", DueStateNew, []uint{notes[2].ID}},
+		{"carthage", DueStateAny, []uint{}},
+	}
+
+	for _, test := range tests {
+		got, total := search(test.query, NoteFilters{DueState: test.dueState})
+
+		if !slices.Equal(got, test.want) || total != len(test.want) {
+			t.Errorf("SearchNotes(%q, %q) = %v of %v, want %v", test.query, test.dueState, got, total, test.want)
+		}
+	}
+
+	// Notes due by the end of the user's day count as due
+	got, _ := search("rome", NoteFilters{DueState: DueStateDue, DueBefore: future.Add(time.Hour)})
+
+	if !slices.Equal(got, []uint{notes[0].ID, notes[1].ID}) {
+		t.Errorf("due by %v = %v, want both notes about Rome", future.Add(time.Hour), got)
+	}
+
+	// Pages count every match
+	got, total := search("rome", NoteFilters{Limit: 1, Offset: 1})
+
+	if !slices.Equal(got, []uint{notes[1].ID}) || total != 2 {
+		t.Errorf("second page = %v of %v, want the second match of 2", got, total)
+	}
+
+	if _, _, err := repo.SearchNotes("rome", NoteFilters{DueState: "overdue"}); err == nil {
+		t.Error("SearchNotes accepted an unknown due state")
+	}
+}
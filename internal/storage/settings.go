@@ -0,0 +1,279 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	DefaultTimezone         = "Asia/Kolkata"
+	DefaultReminderTimes    = "20:00"
+	DefaultRolloverHour     = 0
+	DefaultNewCardsPerDay   = 20
+	DefaultMaxReviewsPerDay = 200
+	DefaultQueueOrder       = QueueOrderOverdue
+	DefaultPromptStyle      = PromptStyleWords
+	DefaultLeechThreshold   = 8
+	DefaultLeechAction      = LeechActionSuspend
+)
+
+// What happens to a note when it becomes a leech
+const (
+	LeechActionSuspend = "suspend"
+	LeechActionTag     = "tag"
+)
+
+var LeechActions = []string{
+	LeechActionSuspend,
+	LeechActionTag,
+}
+
+// Orderings a review session can be built in
+const (
+	QueueOrderOverdue        = "overdue"
+	QueueOrderRetrievability = "retrievability"
+	QueueOrderLocation       = "location"
+	QueueOrderRandom         = "random"
+	QueueOrderRoundRobin     = "roundrobin"
+)
+
+// Cues shown before revealing a plain highlight
+const (
+	PromptStyleLocation = "location"
+	PromptStyleWords    = "words"
+	PromptStyleLLM      = "llm"
+)
+
+var PromptStyles = []string{
+	PromptStyleLocation,
+	PromptStyleWords,
+	PromptStyleLLM,
+}
+
+var QueueOrders = []string{
+	QueueOrderOverdue,
+	QueueOrderRetrievability,
+	QueueOrderLocation,
+	QueueOrderRandom,
+	QueueOrderRoundRobin,
+}
+
+func DefaultUserSettings(userID int64) UserSettings {
+	return UserSettings{
+		UserID:           userID,
+		Timezone:         DefaultTimezone,
+		ReminderTimes:    DefaultReminderTimes,
+		RolloverHour:     DefaultRolloverHour,
+		NewCardsPerDay:   DefaultNewCardsPerDay,
+		MaxReviewsPerDay: DefaultMaxReviewsPerDay,
+		QueueOrder:       DefaultQueueOrder,
+		PromptStyle:      DefaultPromptStyle,
+		LeechThreshold:   DefaultLeechThreshold,
+		LeechAction:      DefaultLeechAction,
+	}
+}
+
+// ParseReminderTime validates a HH:MM reminder time and returns its hour and minute
+func ParseReminderTime(value string) (hour int, minute int, err error) {
+	parsed, err := time.Parse("15:04", strings.TrimSpace(value))
+
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid reminder time %q, expected HH:MM", value)
+	}
+
+	return parsed.Hour(), parsed.Minute(), nil
+}
+
+func (s UserSettings) Location() *time.Location {
+	loc, err := time.LoadLocation(s.Timezone)
+
+	if err != nil {
+		loc, _ = time.LoadLocation(DefaultTimezone)
+	}
+
+	return loc
+}
+
+func (s UserSettings) Reminders() []string {
+	reminders := []string{}
+
+	for _, reminder := range strings.Split(s.ReminderTimes, ",") {
+		reminder = strings.TrimSpace(reminder)
+		if reminder != "" {
+			reminders = append(reminders, reminder)
+		}
+	}
+
+	return reminders
+}
+
+// DayStart returns the moment the user's current review day began, taking
+// the rollover hour into account. With a rollover of 4, 02:00 still belongs
+// to the previous day.
+func (s UserSettings) DayStart(now time.Time) time.Time {
+	local := now.In(s.Location())
+
+	start := time.Date(local.Year(), local.Month(), local.Day(), s.RolloverHour, 0, 0, 0, local.Location())
+
+	if local.Before(start) {
+		start = start.AddDate(0, 0, -1)
+	}
+
+	return start
+}
+
+// DayEnd returns the moment the user's current review day ends. Notes due
+// before this are due "today".
+func (s UserSettings) DayEnd(now time.Time) time.Time {
+	return s.DayStart(now).AddDate(0, 0, 1)
+}
+
+// FirstReminderTomorrow returns the first reminder of the user's next review
+// day, or the same time tomorrow if no reminders are set
+func (s UserSettings) FirstReminderTomorrow(now time.Time) time.Time {
+	dayStart := s.DayEnd(now)
+	dayEnd := dayStart.AddDate(0, 0, 1)
+
+	var first time.Time
+
+	for _, reminder := range s.Reminders() {
+		hour, minute, err := ParseReminderTime(reminder)
+		if err != nil {
+			continue
+		}
+
+		at := time.Date(dayStart.Year(), dayStart.Month(), dayStart.Day(), hour, minute, 0, 0, dayStart.Location())
+		if at.Before(dayStart) {
+			at = at.AddDate(0, 0, 1)
+		}
+
+		if at.Before(dayEnd) && (first.IsZero() || at.Before(first)) {
+			first = at
+		}
+	}
+
+	if first.IsZero() {
+		return now.AddDate(0, 0, 1)
+	}
+
+	return first
+}
+
+func (repo Repository) GetUserSettings(userID int64) (UserSettings, error) {
+	var settings UserSettings
+
+	result := repo.db.Where("user_id = ?", userID).First(&settings)
+
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return DefaultUserSettings(userID), nil
+		}
+		return UserSettings{}, fmt.Errorf("failed to get settings for user %d: %w", userID, result.Error)
+	}
+
+	return settings, nil
+}
+
+func (repo Repository) ListUserSettings() ([]UserSettings, error) {
+	var settings []UserSettings
+
+	result := repo.db.Order("user_id ASC").Find(&settings)
+
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to list user settings: %w", result.Error)
+	}
+
+	return settings, nil
+}
+
+func (repo Repository) SaveUserSettings(settings UserSettings) (UserSettings, error) {
+	if _, err := time.LoadLocation(settings.Timezone); err != nil {
+		return UserSettings{}, fmt.Errorf("invalid timezone %q: %w", settings.Timezone, err)
+	}
+
+	if settings.RolloverHour < 0 || settings.RolloverHour > 23 {
+		return UserSettings{}, fmt.Errorf("rollover hour must be between 0 and 23, got %d", settings.RolloverHour)
+	}
+
+	if settings.NewCardsPerDay < 0 || settings.MaxReviewsPerDay < 0 {
+		return UserSettings{}, fmt.Errorf("daily limits can't be negative")
+	}
+
+	if settings.DailyBudget < 0 || settings.MonthlyBudget < 0 {
+		return UserSettings{}, fmt.Errorf("budgets can't be negative")
+	}
+
+	if settings.QueueOrder == "" {
+		settings.QueueOrder = DefaultQueueOrder
+	}
+
+	if !slices.Contains(QueueOrders, settings.QueueOrder) {
+		return UserSettings{}, fmt.Errorf("unknown queue order %q, expected one of %v", settings.QueueOrder, strings.Join(QueueOrders, ", "))
+	}
+
+	if settings.PromptStyle == "" {
+		settings.PromptStyle = DefaultPromptStyle
+	}
+
+	if !slices.Contains(PromptStyles, settings.PromptStyle) {
+		return UserSettings{}, fmt.Errorf("unknown prompt style %q, expected one of %v", settings.PromptStyle, strings.Join(PromptStyles, ", "))
+	}
+
+	if settings.LeechThreshold < 1 {
+		return UserSettings{}, fmt.Errorf("leech threshold must be at least 1, got %d", settings.LeechThreshold)
+	}
+
+	if settings.LeechAction == "" {
+		settings.LeechAction = DefaultLeechAction
+	}
+
+	if !slices.Contains(LeechActions, settings.LeechAction) {
+		return UserSettings{}, fmt.Errorf("unknown leech action %q, expected one of %v", settings.LeechAction, strings.Join(LeechActions, ", "))
+	}
+
+	reminders := settings.Reminders()
+	minutes := map[string]int{}
+	for _, reminder := range reminders {
+		hour, minute, err := ParseReminderTime(reminder)
+		if err != nil {
+			return UserSettings{}, err
+		}
+		minutes[reminder] = hour*60 + minute
+	}
+	// Sorted by time of day, as "8:00" sorts after "20:00" as a string
+	sort.SliceStable(reminders, func(i, j int) bool {
+		return minutes[reminders[i]] < minutes[reminders[j]]
+	})
+	settings.ReminderTimes = strings.Join(reminders, ",")
+
+	var existing UserSettings
+
+	result := repo.db.Where("user_id = ?", settings.UserID).First(&existing)
+
+	if result.Error != nil && !errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		return UserSettings{}, fmt.Errorf("failed to get settings for user %d: %w", settings.UserID, result.Error)
+	}
+
+	settings.ID = existing.ID
+	settings.CreatedAt = existing.CreatedAt
+
+	if err := repo.db.Save(&settings).Error; err != nil {
+		return UserSettings{}, fmt.Errorf("failed to save settings for user %d: %w", settings.UserID, err)
+	}
+
+	// Create skips zero values of columns with a default, so a limit of 0
+	// has to be written explicitly
+	if existing.ID == 0 {
+		if err := repo.db.Model(&settings).Select("new_cards_per_day", "max_reviews_per_day").Updates(&settings).Error; err != nil {
+			return UserSettings{}, fmt.Errorf("failed to save limits for user %d: %w", settings.UserID, err)
+		}
+	}
+
+	return settings, nil
+}
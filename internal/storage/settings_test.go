@@ -0,0 +1,183 @@
+package storage
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestDayStartAndEnd(t *testing.T) {
+	kolkata, err := time.LoadLocation("Asia/Kolkata")
+
+	if err != nil {
+		t.Skipf("no time zone data: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		timezone string
+		rollover int
+		now      time.Time
+		start    time.Time
+	}{
+		{
+			name:     "midnight rollover",
+			timezone: "UTC",
+			now:      time.Date(2024, 3, 10, 15, 30, 0, 0, time.UTC),
+			start:    time.Date(2024, 3, 10, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "after the rollover hour",
+			timezone: "UTC",
+			rollover: 4,
+			now:      time.Date(2024, 3, 10, 5, 0, 0, 0, time.UTC),
+			start:    time.Date(2024, 3, 10, 4, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "before the rollover hour",
+			timezone: "UTC",
+			rollover: 4,
+			now:      time.Date(2024, 3, 10, 2, 0, 0, 0, time.UTC),
+			start:    time.Date(2024, 3, 9, 4, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "at the rollover hour",
+			timezone: "UTC",
+			rollover: 4,
+			now:      time.Date(2024, 3, 10, 4, 0, 0, 0, time.UTC),
+			start:    time.Date(2024, 3, 10, 4, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "user's time zone",
+			timezone: "Asia/Kolkata",
+			// 20:00 UTC is already 01:30 on the next day in Kolkata
+			now:   time.Date(2024, 3, 10, 20, 0, 0, 0, time.UTC),
+			start: time.Date(2024, 3, 11, 0, 0, 0, 0, kolkata),
+		},
+		{
+			name:     "unknown time zone",
+			timezone: "Nowhere/Unknown",
+			now:      time.Date(2024, 3, 10, 20, 0, 0, 0, time.UTC),
+			start:    time.Date(2024, 3, 11, 0, 0, 0, 0, kolkata),
+		},
+		{
+			name:     "end of month",
+			timezone: "UTC",
+			rollover: 4,
+			now:      time.Date(2024, 3, 1, 1, 0, 0, 0, time.UTC),
+			start:    time.Date(2024, 2, 29, 4, 0, 0, 0, time.UTC),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			settings := UserSettings{Timezone: test.timezone, RolloverHour: test.rollover}
+
+			if got := settings.DayStart(test.now); !got.Equal(test.start) {
+				t.Errorf("DayStart(%v) = %v, want %v", test.now, got, test.start)
+			}
+
+			end := test.start.AddDate(0, 0, 1)
+
+			if got := settings.DayEnd(test.now); !got.Equal(end) {
+				t.Errorf("DayEnd(%v) = %v, want %v", test.now, got, end)
+			}
+		})
+	}
+}
+
+func TestParseReminderTime(t *testing.T) {
+	tests := []struct {
+		value  string
+		hour   int
+		minute int
+		valid  bool
+	}{
+		{"20:00", 20, 0, true},
+		{" 07:45 ", 7, 45, true},
+		{"00:00", 0, 0, true},
+		{"24:00", 0, 0, false},
+		{"7pm", 0, 0, false},
+		{"", 0, 0, false},
+	}
+
+	for _, test := range tests {
+		hour, minute, err := ParseReminderTime(test.value)
+
+		if (err == nil) != test.valid {
+			t.Errorf("ParseReminderTime(%q) error = %v, want valid %v", test.value, err, test.valid)
+			continue
+		}
+
+		if hour != test.hour || minute != test.minute {
+			t.Errorf("ParseReminderTime(%q) = %v:%v, want %v:%v", test.value, hour, minute, test.hour, test.minute)
+		}
+	}
+}
+
+func TestReminders(t *testing.T) {
+	tests := []struct {
+		times string
+		want  []string
+	}{
+		{"20:00", []string{"20:00"}},
+		{"08:00, 20:00", []string{"08:00", "20:00"}},
+		{" ,08:00,, ", []string{"08:00"}},
+		{"", []string{}},
+	}
+
+	for _, test := range tests {
+		got := UserSettings{ReminderTimes: test.times}.Reminders()
+
+		if !slices.Equal(got, test.want) {
+			t.Errorf("Reminders of %q = %v, want %v", test.times, got, test.want)
+		}
+	}
+}
+
+func TestFirstReminderTomorrow(t *testing.T) {
+	now := time.Date(2024, 3, 10, 21, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		times    string
+		rollover int
+		want     time.Time
+	}{
+		{"earliest reminder", "20:00,08:30", 0, time.Date(2024, 3, 11, 8, 30, 0, 0, time.UTC)},
+		{"before the rollover", "02:00,20:00", 4, time.Date(2024, 3, 11, 20, 0, 0, 0, time.UTC)},
+		{"after midnight of the next day", "02:00", 4, time.Date(2024, 3, 12, 2, 0, 0, 0, time.UTC)},
+		{"no reminders", "", 0, now.AddDate(0, 0, 1)},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			settings := UserSettings{Timezone: "UTC", ReminderTimes: test.times, RolloverHour: test.rollover}
+
+			if got := settings.FirstReminderTomorrow(now); !got.Equal(test.want) {
+				t.Errorf("FirstReminderTomorrow(%v) = %v, want %v", now, got, test.want)
+			}
+		})
+	}
+}
+
+func TestSaveUserSettingsSortsReminders(t *testing.T) {
+	repo, db := testRepository(t)
+	settings := DefaultUserSettings(testUserID())
+
+	t.Cleanup(func() {
+		db.Unscoped().Where("user_id = ?", settings.UserID).Delete(&UserSettings{})
+	})
+
+	settings.ReminderTimes = "20:00,8:00,13:30"
+
+	saved, err := repo.SaveUserSettings(settings)
+
+	if err != nil {
+		t.Fatalf("SaveUserSettings failed: %v", err)
+	}
+
+	if want := "8:00,13:30,20:00"; saved.ReminderTimes != want {
+		t.Errorf("saved reminders = %q, want %q", saved.ReminderTimes, want)
+	}
+}
@@ -0,0 +1,198 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrSourceExists is returned when renaming a source to the current or former
+// title of another
+var ErrSourceExists = errors.New("a source with this title already exists")
+
+// withTotalNotes fills TotalNotes with the count of the source's notes
+func withTotalNotes(db *gorm.DB) *gorm.DB {
+	return db.Select("sources.*, (SELECT COUNT(*) FROM notes WHERE notes.source_id = sources.id AND notes.deleted_at IS NULL) AS total_notes")
+}
+
+// GetSourceSummaries returns every source with its note count, archived
+// ones included
+func (repo Repository) GetSourceSummaries() ([]Source, error) {
+	var sources []Source
+
+	result := repo.db.Scopes(withTotalNotes).Order("sources.archived, sources.title").Find(&sources)
+
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to get sources: %w", result.Error)
+	}
+
+	return sources, nil
+}
+
+// addAlias keeps a former title of a source, pointing it at sourceID
+func addAlias(tx *gorm.DB, title string, sourceID int) error {
+	return tx.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "title"}},
+		DoUpdates: clause.AssignmentColumns([]string{"source_id", "updated_at"}),
+	}).Create(&SourceAlias{Title: title, SourceID: sourceID}).Error
+}
+
+// RenameSource changes the title of a source. The former title is kept as an
+// alias so the next sync doesn't import its highlights again.
+func (repo Repository) RenameSource(id int, title string) error {
+	err := repo.db.Transaction(func(tx *gorm.DB) error {
+		var source Source
+
+		if err := tx.First(&source, id).Error; err != nil {
+			return err
+		}
+
+		if source.Title == title {
+			return nil
+		}
+
+		var taken int64
+
+		if err := tx.Model(&Source{}).Where("title = ? AND id <> ?", title, id).Count(&taken).Error; err != nil {
+			return err
+		}
+
+		if taken > 0 {
+			return ErrSourceExists
+		}
+
+		// A former title of another source would send its highlights here
+		err := tx.Model(&SourceAlias{}).Where("title = ? AND source_id <> ?", title, id).Count(&taken).Error
+
+		if err != nil {
+			return err
+		}
+
+		if taken > 0 {
+			return ErrSourceExists
+		}
+
+		if err := addAlias(tx, source.Title, id); err != nil {
+			return err
+		}
+
+		// The new title is the source's own again if it was a former one
+		if err := tx.Unscoped().Where("title = ? AND source_id = ?", title, id).Delete(&SourceAlias{}).Error; err != nil {
+			return err
+		}
+
+		return tx.Model(&source).Update("title", title).Error
+	})
+
+	if err != nil {
+		return fmt.Errorf("failed to rename source %d: %w", id, err)
+	}
+
+	return nil
+}
+
+// MergeSources moves the notes, review history, tags and aliases of a source
+// into another one, then deletes it
+func (repo Repository) MergeSources(fromID int, intoID int) error {
+	if fromID == intoID {
+		return fmt.Errorf("can't merge a source into itself")
+	}
+
+	err := repo.db.Transaction(func(tx *gorm.DB) error {
+		var from, into Source
+
+		if err := tx.First(&from, fromID).Error; err != nil {
+			return err
+		}
+
+		if err := tx.First(&into, intoID).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Model(&Note{}).Where("source_id = ?", fromID).Update("source_id", intoID).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Model(&ReviewLog{}).Where("source_id = ?", fromID).Update("source_id", intoID).Error; err != nil {
+			return err
+		}
+
+		err := tx.Exec(
+			"INSERT INTO source_tags (source_id, tag_id) SELECT ?, tag_id FROM source_tags WHERE source_id = ? ON CONFLICT DO NOTHING",
+			intoID, fromID,
+		).Error
+
+		if err != nil {
+			return err
+		}
+
+		if err := tx.Exec("DELETE FROM source_tags WHERE source_id = ?", fromID).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Model(&SourceAlias{}).Where("source_id = ?", fromID).Update("source_id", intoID).Error; err != nil {
+			return err
+		}
+
+		if err := addAlias(tx, from.Title, intoID); err != nil {
+			return err
+		}
+
+		return tx.Delete(&from).Error
+	})
+
+	if err != nil {
+		return fmt.Errorf("failed to merge source %d into %d: %w", fromID, intoID, err)
+	}
+
+	return nil
+}
+
+func (repo Repository) SetSourceArchived(id int, archived bool) error {
+	result := repo.db.Model(&Source{}).Where("id = ?", id).Update("archived", archived)
+
+	if result.Error != nil {
+		return fmt.Errorf("failed to update source %d: %w", id, result.Error)
+	}
+
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("source with id %d not found", id)
+	}
+
+	return nil
+}
+
+// DeleteSource soft deletes a source along with its notes. Its aliases are
+// dropped, so highlights still in the Kindle export come back on the next
+// sync.
+func (repo Repository) DeleteSource(id int) error {
+	err := repo.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("source_id = ?", id).Delete(&Note{}).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Unscoped().Where("source_id = ?", id).Delete(&SourceAlias{}).Error; err != nil {
+			return err
+		}
+
+		result := tx.Delete(&Source{}, id)
+
+		if result.Error != nil {
+			return result.Error
+		}
+
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return fmt.Errorf("failed to delete source %d: %w", id, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,185 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/amalrajan30/spacedgram/internal/highlights"
+)
+
+func TestRenameAndMergeSources(t *testing.T) {
+	repo, db := testRepository(t)
+	prefix := fmt.Sprintf("%v %v", t.Name(), time.Now().UnixNano())
+
+	sources := make([]Source, 2)
+
+	for i := range sources {
+		sources[i] = Source{Title: fmt.Sprintf("%v %v", prefix, i), Origin: "kindle"}
+
+		if err := db.Create(&sources[i]).Error; err != nil {
+			t.Fatalf("failed to create source: %v", err)
+		}
+	}
+
+	t.Cleanup(func() {
+		for _, source := range sources {
+			db.Unscoped().Where("source_id = ?", source.ID).Delete(&Note{})
+			db.Unscoped().Where("source_id = ?", source.ID).Delete(&SourceAlias{})
+			db.Unscoped().Delete(&source)
+		}
+	})
+
+	from, into := sources[0], sources[1]
+	original := from.Title
+	renamed := prefix + " renamed"
+
+	if err := db.Create(&Note{Content: "Highlight", Location: "120", SourceID: int(from.ID)}).Error; err != nil {
+		t.Fatalf("failed to create note: %v", err)
+	}
+
+	if err := repo.RenameSource(int(from.ID), into.Title); !errors.Is(err, ErrSourceExists) {
+		t.Errorf("renaming to the title of another source = %v, want ErrSourceExists", err)
+	}
+
+	if err := repo.RenameSource(int(from.ID), renamed); err != nil {
+		t.Fatalf("RenameSource failed: %v", err)
+	}
+
+	// Highlights exported under the former title keep going to the source
+	if id, err := repo.ensureSourceExists(highlights.Highlight{Title: original}); err != nil || id != int(from.ID) {
+		t.Errorf("source of the former title = %v (%v), want %v", id, err, from.ID)
+	}
+
+	repo.BulkInsertHighlights([]highlights.Highlight{{Title: original, Location: "120", Content: "Highlight"}})
+
+	var notes int64
+	db.Model(&Note{}).Where("source_id = ?", from.ID).Count(&notes)
+
+	if notes != 1 {
+		t.Errorf("source has %v notes after syncing its former title, want 1", notes)
+	}
+
+	// The former title still belongs to the source
+	if err := repo.RenameSource(int(into.ID), original); !errors.Is(err, ErrSourceExists) {
+		t.Errorf("renaming to the former title of another source = %v, want ErrSourceExists", err)
+	}
+
+	// Renaming back drops the alias of the title taken again
+	if err := repo.RenameSource(int(from.ID), original); err != nil {
+		t.Fatalf("RenameSource failed: %v", err)
+	}
+
+	var aliases []SourceAlias
+	db.Where("source_id = ?", from.ID).Find(&aliases)
+
+	if len(aliases) != 1 || aliases[0].Title != renamed {
+		t.Errorf("aliases = %+v, want only %q", aliases, renamed)
+	}
+
+	if err := repo.MergeSources(int(into.ID), int(into.ID)); err == nil {
+		t.Error("MergeSources merged a source into itself")
+	}
+
+	if err := repo.MergeSources(int(from.ID), int(into.ID)); err != nil {
+		t.Fatalf("MergeSources failed: %v", err)
+	}
+
+	merged, err := repo.GetSource(int(into.ID))
+
+	if err != nil || merged.TotalNotes != 1 {
+		t.Errorf("merged source = %+v (%v), want the note moved into it", merged, err)
+	}
+
+	if _, err := repo.GetSource(int(from.ID)); err == nil {
+		t.Error("the merged source is still there")
+	}
+
+	// Both the former titles and the aliases of the merged source follow it
+	for _, title := range []string{original, renamed} {
+		if id, err := repo.ensureSourceExists(highlights.Highlight{Title: title}); err != nil || id != int(into.ID) {
+			t.Errorf("source of %q = %v (%v), want %v", title, id, err, into.ID)
+		}
+	}
+
+	if err := repo.DeleteSource(int(into.ID)); err != nil {
+		t.Fatalf("DeleteSource failed: %v", err)
+	}
+
+	db.Model(&SourceAlias{}).Where("source_id = ?", into.ID).Count(&notes)
+
+	if notes != 0 {
+		t.Errorf("%v aliases left after deleting the source, want 0", notes)
+	}
+
+	if err := repo.DeleteSource(int(into.ID)); err == nil {
+		t.Error("deleting a deleted source succeeded")
+	}
+}
+
+func TestArchiveSource(t *testing.T) {
+	repo, db := testRepository(t)
+
+	source := Source{Title: fmt.Sprintf("%v %v", t.Name(), time.Now().UnixNano()), Origin: "test"}
+
+	if err := db.Create(&source).Error; err != nil {
+		t.Fatalf("failed to create source: %v", err)
+	}
+
+	t.Cleanup(func() {
+		db.Unscoped().Where("source_id = ?", source.ID).Delete(&Note{})
+		db.Unscoped().Delete(&source)
+	})
+
+	if err := db.Create(&Note{Content: "Highlight", SourceID: int(source.ID)}).Error; err != nil {
+		t.Fatalf("failed to create note: %v", err)
+	}
+
+	due := func() int {
+		notes, err := repo.GetNotes(int(source.ID), time.Now())
+
+		if err != nil {
+			t.Fatalf("GetNotes failed: %v", err)
+		}
+
+		return len(notes)
+	}
+
+	if err := repo.SetSourceArchived(int(source.ID), true); err != nil {
+		t.Fatalf("SetSourceArchived failed: %v", err)
+	}
+
+	if got := due(); got != 0 {
+		t.Errorf("%v notes of an archived source to review, want 0", got)
+	}
+
+	summaries, err := repo.GetSourceSummaries()
+
+	if err != nil {
+		t.Fatalf("GetSourceSummaries failed: %v", err)
+	}
+
+	found := false
+	for _, summary := range summaries {
+		if summary.ID == source.ID {
+			found = summary.Archived && summary.TotalNotes == 1
+		}
+	}
+
+	if !found {
+		t.Error("the archived source isn't summarized with its note")
+	}
+
+	if err := repo.SetSourceArchived(int(source.ID), false); err != nil {
+		t.Fatalf("SetSourceArchived failed: %v", err)
+	}
+
+	if got := due(); got != 1 {
+		t.Errorf("%v notes of an unarchived source to review, want 1", got)
+	}
+
+	if err := repo.SetSourceArchived(0, true); err == nil {
+		t.Error("archiving a missing source succeeded")
+	}
+}
@@ -0,0 +1,221 @@
+package storage
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const maxTagLength = 32
+
+// NormalizeTag turns a tag as typed or suggested into its stored form, e.g.
+// "#Decision Making" into "decision-making"
+func NormalizeTag(name string) string {
+	name = strings.ToLower(strings.TrimSpace(name))
+	name = strings.TrimLeft(name, "#")
+	name = strings.Join(strings.Fields(name), "-")
+
+	if runes := []rune(name); len(runes) > maxTagLength {
+		name = string(runes[:maxTagLength])
+	}
+
+	return name
+}
+
+// taggedNotes matches the notes carrying a tag, directly or through their
+// source. It takes the tag name twice.
+const taggedNotes = "(notes.id IN (SELECT note_tags.note_id FROM note_tags JOIN tags ON tags.id = note_tags.tag_id WHERE tags.name = ?) " +
+	"OR notes.source_id IN (SELECT source_tags.source_id FROM source_tags JOIN tags ON tags.id = source_tags.tag_id WHERE tags.name = ?))"
+
+// ensureTags returns the tags with the given names, creating the missing ones
+func ensureTags(db *gorm.DB, names []string) ([]Tag, error) {
+	tags := []Tag{}
+
+	for _, name := range names {
+		var tag Tag
+
+		if err := db.Where(Tag{Name: name}).FirstOrCreate(&tag).Error; err != nil {
+			return nil, fmt.Errorf("failed to create tag %q: %w", name, err)
+		}
+
+		tags = append(tags, tag)
+	}
+
+	return tags, nil
+}
+
+// findTags returns the existing tags among names
+func findTags(db *gorm.DB, names []string) ([]Tag, error) {
+	var tags []Tag
+
+	if err := db.Where("name IN ?", names).Find(&tags).Error; err != nil {
+		return nil, fmt.Errorf("failed to get tags: %w", err)
+	}
+
+	return tags, nil
+}
+
+func (repo Repository) TagNote(noteID int, names []string) error {
+	return repo.db.Transaction(func(tx *gorm.DB) error {
+		tags, err := ensureTags(tx, names)
+
+		if err != nil {
+			return err
+		}
+
+		note := Note{Model: gorm.Model{ID: uint(noteID)}}
+
+		if err := tx.Model(&note).Association("Tags").Append(&tags); err != nil {
+			return fmt.Errorf("failed to tag note %d: %w", noteID, err)
+		}
+
+		return nil
+	})
+}
+
+func (repo Repository) UntagNote(noteID int, names []string) error {
+	tags, err := findTags(repo.db, names)
+
+	if err != nil || len(tags) == 0 {
+		return err
+	}
+
+	note := Note{Model: gorm.Model{ID: uint(noteID)}}
+
+	if err := repo.db.Model(&note).Association("Tags").Delete(&tags); err != nil {
+		return fmt.Errorf("failed to untag note %d: %w", noteID, err)
+	}
+
+	return nil
+}
+
+func (repo Repository) TagSource(sourceID int, names []string) error {
+	return repo.db.Transaction(func(tx *gorm.DB) error {
+		tags, err := ensureTags(tx, names)
+
+		if err != nil {
+			return err
+		}
+
+		source := Source{Model: gorm.Model{ID: uint(sourceID)}}
+
+		if err := tx.Model(&source).Association("Tags").Append(&tags); err != nil {
+			return fmt.Errorf("failed to tag source %d: %w", sourceID, err)
+		}
+
+		return nil
+	})
+}
+
+func (repo Repository) UntagSource(sourceID int, names []string) error {
+	tags, err := findTags(repo.db, names)
+
+	if err != nil || len(tags) == 0 {
+		return err
+	}
+
+	source := Source{Model: gorm.Model{ID: uint(sourceID)}}
+
+	if err := repo.db.Model(&source).Association("Tags").Delete(&tags); err != nil {
+		return fmt.Errorf("failed to untag source %d: %w", sourceID, err)
+	}
+
+	return nil
+}
+
+// GetNoteTags returns the names of the tags of a note, including the ones of
+// its source
+func (repo Repository) GetNoteTags(noteID int) ([]string, error) {
+	var names []string
+
+	result := repo.db.Model(&Tag{}).
+		Where("id IN (SELECT tag_id FROM note_tags WHERE note_id = ?) "+
+			"OR id IN (SELECT tag_id FROM source_tags JOIN notes ON notes.source_id = source_tags.source_id WHERE notes.id = ?)",
+			noteID, noteID).
+		Order("name").
+		Pluck("name", &names)
+
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to get tags of note %d: %w", noteID, result.Error)
+	}
+
+	return names, nil
+}
+
+func (repo Repository) GetSourceTags(sourceID int) ([]string, error) {
+	var names []string
+
+	result := repo.db.Model(&Tag{}).
+		Where("id IN (SELECT tag_id FROM source_tags WHERE source_id = ?)", sourceID).
+		Order("name").
+		Pluck("name", &names)
+
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to get tags of source %d: %w", sourceID, result.Error)
+	}
+
+	return names, nil
+}
+
+type TagCount struct {
+	Name  string
+	Count int
+}
+
+// GetTagCounts returns every tag in use with the number of notes carrying
+// it, most used first
+func (repo Repository) GetTagCounts() ([]TagCount, error) {
+	var counts []TagCount
+
+	result := repo.db.Raw(
+		"SELECT tags.name AS name, COUNT(DISTINCT notes.id) AS count FROM tags " +
+			"JOIN notes ON notes.deleted_at IS NULL AND (" +
+			"notes.id IN (SELECT note_id FROM note_tags WHERE tag_id = tags.id) " +
+			"OR notes.source_id IN (SELECT source_id FROM source_tags WHERE tag_id = tags.id)) " +
+			"WHERE tags.deleted_at IS NULL " +
+			"GROUP BY tags.name ORDER BY count DESC, tags.name",
+	).Scan(&counts)
+
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to count tags: %w", result.Error)
+	}
+
+	return counts, nil
+}
+
+// GetTaggedNotes returns the notes carrying a tag, across sources, that are
+// due before dueBefore or were never reviewed
+func (repo Repository) GetTaggedNotes(tag string, dueBefore time.Time) ([]Note, error) {
+	var notes []Note
+
+	result := repo.db.Joins("JOIN sources ON notes.source_id = sources.id AND sources.deleted_at IS NULL").
+		Where(taggedNotes, tag, tag).
+		Where("next_due_date < ? OR next_due_date IS NULL", dueBefore).
+		Scopes(reviewable).
+		Find(&notes)
+
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to get notes tagged %q: %w", tag, result.Error)
+	}
+
+	return notes, nil
+}
+
+// GetNotesWithoutTagJob returns the notes created since the given time that
+// never had their tags suggested
+func (repo Repository) GetNotesWithoutTagJob(since time.Time) ([]Note, error) {
+	var notes []Note
+
+	result := repo.db.
+		Where("notes.created_at >= ?", since).
+		Where("NOT EXISTS (SELECT 1 FROM generation_jobs WHERE generation_jobs.note_id = notes.id AND generation_jobs.kind = ?)", GenerationKindTags).
+		Find(&notes)
+
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to get notes without tag suggestions: %w", result.Error)
+	}
+
+	return notes, nil
+}
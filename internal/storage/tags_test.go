@@ -0,0 +1,211 @@
+package storage
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNormalizeTag(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"history", "history"},
+		{"#Decision Making", "decision-making"},
+		{"  ##Stoicism  ", "stoicism"},
+		{"machine \t learning", "machine-learning"},
+		{"Ünïcode", "ünïcode"},
+		{"#", ""},
+		{"", ""},
+		{strings.Repeat("a", 40), strings.Repeat("a", maxTagLength)},
+		{strings.Repeat("é", 40), strings.Repeat("é", maxTagLength)},
+	}
+
+	for _, test := range tests {
+		if got := NormalizeTag(test.name); got != test.want {
+			t.Errorf("NormalizeTag(%q) = %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestTags(t *testing.T) {
+	repo, db := testRepository(t)
+
+	source := Source{Title: fmt.Sprintf("%v %v", t.Name(), time.Now().UnixNano()), Origin: "test"}
+
+	if err := db.Create(&source).Error; err != nil {
+		t.Fatalf("failed to create source: %v", err)
+	}
+
+	other := Source{Title: source.Title + " other", Origin: "test"}
+
+	if err := db.Create(&other).Error; err != nil {
+		t.Fatalf("failed to create source: %v", err)
+	}
+
+	past := time.Now().AddDate(0, 0, -1)
+	future := time.Now().AddDate(0, 0, 3)
+
+	notes := []Note{
+		{Content: "Due", SourceID: int(source.ID), NextDueDate: &past},
+		{Content: "Scheduled", SourceID: int(source.ID), NextDueDate: &future},
+		{Content: "New", SourceID: int(other.ID)},
+	}
+
+	for i := range notes {
+		if err := db.Create(&notes[i]).Error; err != nil {
+			t.Fatalf("failed to create note: %v", err)
+		}
+	}
+
+	suffix := time.Now().UnixNano()
+	habits, focus := fmt.Sprintf("habits-%v", suffix), fmt.Sprintf("focus-%v", suffix)
+
+	t.Cleanup(func() {
+		var tags []Tag
+		db.Where("name IN ?", []string{habits, focus}).Find(&tags)
+
+		for _, tag := range tags {
+			db.Exec("DELETE FROM note_tags WHERE tag_id = ?", tag.ID)
+			db.Exec("DELETE FROM source_tags WHERE tag_id = ?", tag.ID)
+			db.Unscoped().Delete(&tag)
+		}
+
+		for _, s := range []Source{source, other} {
+			db.Unscoped().Where("source_id = ?", s.ID).Delete(&Note{})
+			db.Unscoped().Delete(&s)
+		}
+	})
+
+	// Tagging twice keeps a single tag
+	for i := 0; i < 2; i++ {
+		if err := repo.TagNote(int(notes[2].ID), []string{habits, focus}); err != nil {
+			t.Fatalf("TagNote failed: %v", err)
+		}
+	}
+
+	if err := repo.TagSource(int(source.ID), []string{habits}); err != nil {
+		t.Fatalf("TagSource failed: %v", err)
+	}
+
+	if tags, err := repo.GetNoteTags(int(notes[2].ID)); err != nil || !slices.Equal(tags, []string{focus, habits}) {
+		t.Errorf("note tags = %v (%v), want %v", tags, err, []string{focus, habits})
+	}
+
+	if tags, err := repo.GetSourceTags(int(source.ID)); err != nil || !slices.Equal(tags, []string{habits}) {
+		t.Errorf("source tags = %v (%v), want %v", tags, err, []string{habits})
+	}
+
+	counts, err := repo.GetTagCounts()
+
+	if err != nil {
+		t.Fatalf("GetTagCounts failed: %v", err)
+	}
+
+	got := map[string]int{}
+	for _, count := range counts {
+		got[count.Name] = count.Count
+	}
+
+	// Notes count through their source too
+	if got[habits] != 3 || got[focus] != 1 {
+		t.Errorf("tag counts = %v of %v and %v of %v, want 3 and 1", got[habits], habits, got[focus], focus)
+	}
+
+	tagged, err := repo.GetTaggedNotes(habits, time.Now())
+
+	if err != nil {
+		t.Fatalf("GetTaggedNotes failed: %v", err)
+	}
+
+	ids := []uint{}
+	for _, note := range tagged {
+		ids = append(ids, note.ID)
+	}
+	slices.Sort(ids)
+
+	if want := []uint{notes[0].ID, notes[2].ID}; !slices.Equal(ids, want) {
+		t.Errorf("due notes tagged %v = %v, want %v", habits, ids, want)
+	}
+
+	// Notes of deleted sources are left out
+	if err := db.Delete(&other).Error; err != nil {
+		t.Fatalf("failed to delete source: %v", err)
+	}
+
+	if tagged, _ := repo.GetTaggedNotes(habits, time.Now()); len(tagged) != 1 || tagged[0].ID != notes[0].ID {
+		t.Errorf("due notes tagged %v after deleting a source = %+v, want only %v", habits, tagged, notes[0].ID)
+	}
+
+	if err := repo.UntagNote(int(notes[2].ID), []string{focus}); err != nil {
+		t.Fatalf("UntagNote failed: %v", err)
+	}
+
+	if err := repo.UntagSource(int(source.ID), []string{habits}); err != nil {
+		t.Fatalf("UntagSource failed: %v", err)
+	}
+
+	if tags, _ := repo.GetNoteTags(int(notes[2].ID)); !slices.Equal(tags, []string{habits}) {
+		t.Errorf("note tags after untagging = %v, want %v", tags, []string{habits})
+	}
+
+	if tags, _ := repo.GetSourceTags(int(source.ID)); len(tags) != 0 {
+		t.Errorf("source tags after untagging = %v, want none", tags)
+	}
+}
+
+func TestGetNotesWithoutTagJob(t *testing.T) {
+	repo, db := testRepository(t)
+
+	source := Source{Title: fmt.Sprintf("%v %v", t.Name(), time.Now().UnixNano()), Origin: "test"}
+
+	if err := db.Create(&source).Error; err != nil {
+		t.Fatalf("failed to create source: %v", err)
+	}
+
+	notes := []Note{
+		{Content: "Imported long ago", SourceID: int(source.ID)},
+		{Content: "Just imported", SourceID: int(source.ID)},
+		{Content: "Already suggested", SourceID: int(source.ID)},
+	}
+	notes[0].CreatedAt = time.Now().AddDate(0, -1, 0)
+
+	for i := range notes {
+		if err := db.Create(&notes[i]).Error; err != nil {
+			t.Fatalf("failed to create note: %v", err)
+		}
+	}
+
+	t.Cleanup(func() {
+		for _, note := range notes {
+			db.Unscoped().Where("note_id = ?", note.ID).Delete(&GenerationJob{})
+		}
+
+		db.Unscoped().Where("source_id = ?", source.ID).Delete(&Note{})
+		db.Unscoped().Delete(&source)
+	})
+
+	if _, err := repo.EnqueueGenerationJobs([]GenerationJob{{NoteID: int(notes[2].ID), Kind: GenerationKindTags}}); err != nil {
+		t.Fatalf("EnqueueGenerationJobs failed: %v", err)
+	}
+
+	found, err := repo.GetNotesWithoutTagJob(time.Now().AddDate(0, 0, -1))
+
+	if err != nil {
+		t.Fatalf("GetNotesWithoutTagJob failed: %v", err)
+	}
+
+	ids := []uint{}
+	for _, note := range found {
+		if note.SourceID == int(source.ID) {
+			ids = append(ids, note.ID)
+		}
+	}
+
+	if want := []uint{notes[1].ID}; !slices.Equal(ids, want) {
+		t.Errorf("notes without tag job = %v, want %v", ids, want)
+	}
+}